@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -14,6 +15,9 @@ import (
 	"binrc.com/roma/core/constants"
 	"binrc.com/roma/core/global"
 	"binrc.com/roma/core/initialize"
+	"binrc.com/roma/core/jitaccess"
+	"binrc.com/roma/core/ldapauth"
+	"binrc.com/roma/core/mcpserver"
 	"binrc.com/roma/core/middleware"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/pkg/i18n"
@@ -66,6 +70,45 @@ var (
 			return nil
 		},
 	}
+
+	mcpToken string
+	mcpCmd   = &cobra.Command{
+		Use:   "mcp",
+		Short: "以 stdio 方式运行 MCP 服务",
+		Long:  "以 stdio 方式运行 MCP 服务，由 AI 工具按需启动；令牌通过 POST /api/v1/users/me/mcp-tokens 申请",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			initConfig()
+			bindFlags(rootCmd)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// 标准输出只用于 MCP 协议数据，其他输出全部转到标准错误
+			stdout := os.Stdout
+			os.Stdout = os.Stderr
+			color.Output = os.Stderr
+			logger.UseStderr()
+
+			cfg := &configs.Config{}
+			if err := viper.Unmarshal(cfg); err != nil {
+				return fmt.Errorf("failed to unmarshal config: %w", err)
+			}
+			global.CONFIG = cfg
+
+			if mcpToken == "" {
+				mcpToken = os.Getenv("ROMA_MCP_TOKEN")
+			}
+			if mcpToken == "" {
+				return fmt.Errorf("missing mcp token, use --token or ROMA_MCP_TOKEN")
+			}
+
+			LoadDatabase()
+			LoadI18n()
+
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			return mcpserver.ServeStdio(ctx, mcpToken, os.Stdin, stdout, os.Stderr)
+		},
+	}
 )
 
 func init() {
@@ -83,6 +126,7 @@ func init() {
 	rootCmd.PersistentFlags().String("common-history-tmp-dir", "", "历史文件存储目录")
 	rootCmd.PersistentFlags().Int("common-history-tmp-max-line", 0, "最大历史记录行数")
 	rootCmd.PersistentFlags().Int("common-history-tmp-max-size", 0, "最大历史文件大小（字节）")
+	rootCmd.PersistentFlags().String("common-recording-dir", "", "会话录像存储目录")
 
 	// Database 配置
 	rootCmd.PersistentFlags().String("database-cdb-url", "", "数据库 CDB URL")
@@ -91,6 +135,10 @@ func init() {
 
 	// Log 配置
 	rootCmd.PersistentFlags().String("log-level", "", "日志级别 (debug, info, warn, error)")
+
+	// MCP stdio 子命令
+	mcpCmd.Flags().StringVar(&mcpToken, "token", "", "MCP 令牌（也可通过 ROMA_MCP_TOKEN 设置）")
+	rootCmd.AddCommand(mcpCmd)
 }
 
 func main() {
@@ -130,6 +178,7 @@ func bindFlags(cmd *cobra.Command) {
 	viper.BindPFlag("common.history_tmp_dir", cmd.PersistentFlags().Lookup("common-history-tmp-dir"))
 	viper.BindPFlag("common.history_tmp_max_line", cmd.PersistentFlags().Lookup("common-history-tmp-max-line"))
 	viper.BindPFlag("common.history_tmp_max_size", cmd.PersistentFlags().Lookup("common-history-tmp-max-size"))
+	viper.BindPFlag("common.recording_dir", cmd.PersistentFlags().Lookup("common-recording-dir"))
 
 	// Database 配置
 	viper.BindPFlag("database.cdb_url", cmd.PersistentFlags().Lookup("database-cdb-url"))
@@ -154,6 +203,9 @@ func bindEnvVars() {
 	viper.BindEnv("common.language", "ROMA_COMMON_LANGUAGE")
 	viper.BindEnv("common.port", "ROMA_COMMON_PORT")
 	viper.BindEnv("common.prompt", "ROMA_COMMON_PROMPT")
+	viper.BindEnv("common.recording_dir", "ROMA_COMMON_RECORDING_DIR")
+	viper.BindEnv("common.recording_disabled", "ROMA_COMMON_RECORDING_DISABLED")
+	viper.BindEnv("common.scp_max_size", "ROMA_COMMON_SCP_MAX_SIZE")
 
 	// Database 配置
 	viper.BindEnv("database.cdb_url", "ROMA_DATABASE_CDB_URL")
@@ -167,6 +219,37 @@ func bindEnvVars() {
 	viper.BindEnv("apikey.prefix", "ROMA_APIKEY_PREFIX")
 	viper.BindEnv("apikey.key", "ROMA_APIKEY_KEY")
 
+	// Security 配置
+	viper.BindEnv("security.host_key_strict", "ROMA_SECURITY_HOST_KEY_STRICT")
+	viper.BindEnv("security.ssh_ca.enabled", "ROMA_SECURITY_SSH_CA_ENABLED")
+	viper.BindEnv("security.ssh_ca.validity_minutes", "ROMA_SECURITY_SSH_CA_VALIDITY_MINUTES")
+
+	// LDAP 配置
+	viper.BindEnv("ldap.enabled", "ROMA_LDAP_ENABLED")
+	viper.BindEnv("ldap.url", "ROMA_LDAP_URL")
+	viper.BindEnv("ldap.bind_dn", "ROMA_LDAP_BIND_DN")
+	viper.BindEnv("ldap.bind_password", "ROMA_LDAP_BIND_PASSWORD")
+	viper.BindEnv("ldap.base_dn", "ROMA_LDAP_BASE_DN")
+
+	// OIDC 配置
+	viper.BindEnv("oidc.enabled", "ROMA_OIDC_ENABLED")
+	viper.BindEnv("oidc.issuer", "ROMA_OIDC_ISSUER")
+	viper.BindEnv("oidc.client_id", "ROMA_OIDC_CLIENT_ID")
+	viper.BindEnv("oidc.client_secret", "ROMA_OIDC_CLIENT_SECRET")
+	viper.BindEnv("oidc.redirect_url", "ROMA_OIDC_REDIRECT_URL")
+	viper.BindEnv("oidc.frontend_url", "ROMA_OIDC_FRONTEND_URL")
+
+	// MCP 配置
+	viper.BindEnv("mcp.enabled", "ROMA_MCP_ENABLED")
+	viper.BindEnv("mcp.path", "ROMA_MCP_PATH")
+	viper.BindEnv("mcp.token_expire_days", "ROMA_MCP_TOKEN_EXPIRE_DAYS")
+
+	// 临时访问申请配置
+	viper.BindEnv("access_request.max_duration_hours", "ROMA_ACCESS_REQUEST_MAX_DURATION_HOURS")
+
+	// 命令审批配置
+	viper.BindEnv("command_approval.timeout_seconds", "ROMA_COMMAND_APPROVAL_TIMEOUT_SECONDS")
+
 	// User1st 配置
 	viper.BindEnv("user_1st.email", "ROMA_USER_1ST_EMAIL")
 	viper.BindEnv("user_1st.name", "ROMA_USER_1ST_NAME")
@@ -230,9 +313,10 @@ func startServices() {
 	go func() {
 		go StartApiService()
 		go StartSshdService()
-		// MCP 服务器应该独立运行，由 AI 工具按需启动
-		// 不需要嵌入到 roma 主程序中
-		// go StartMCPService()
+		// LDAP 用户定期同步
+		ldapauth.StartSync()
+		// 到期的临时访问授权自动收回
+		jitaccess.StartExpiry()
 	}()
 
 	c := make(chan os.Signal, 1)
@@ -288,6 +372,16 @@ func StartSshdService() {
 	})
 	ssh.Handle(secureHandler)
 
+	// SFTP 子系统：与普通会话使用同样的安全包装器
+	secureSftpHandler := sshd.SecureConnectionHandler(func(sess ssh.Session) {
+		defer func() {
+			if e, ok := recover().(error); ok {
+				logger.Logger.Panic(e)
+			}
+		}()
+		sshd.SftpHandler(sess)
+	})
+
 	log.Printf("starting ssh server on port %s...\n", global.CONFIG.Common.Port)
 	hostKey, err := op.GetLatestHostKey()
 	if err != nil {
@@ -303,8 +397,20 @@ func StartSshdService() {
 		fmt.Sprintf(":%s", global.CONFIG.Common.Port),
 		nil,
 		// ssh.PasswordAuth(services.PasswordAuth),
-		ssh.PublicKeyAuth(sshd.SecurePublicKeyAuth), // 使用安全的公钥认证包装器
+		// ssh.PublicKeyAuth(sshd.SecurePublicKeyAuth),
 		ssh.HostKeyPEM(privateKeyBytes),
+		func(srv *ssh.Server) error {
+			// 公钥认证（SecurePublicKeyAuth 的逻辑）+ 已绑定用户的 TOTP 二次验证
+			srv.ServerConfigCallback = sshd.SecureServerConfig
+			srv.SubsystemHandlers = map[string]ssh.SubsystemHandler{"sftp": secureSftpHandler}
+			// 本地端口转发（ssh -L）和 ProxyJump（ssh -J），只允许转发到有 use 权限的资源
+			// 公钥认证时推迟的操作（更新公钥使用时间、同步 LDAP 用户）在第一个通道打开前执行
+			srv.ChannelHandlers = map[string]ssh.ChannelHandler{
+				"session":      sshd.AuthenticatedChannel(ssh.DefaultSessionHandler),
+				"direct-tcpip": sshd.AuthenticatedChannel(sshd.DirectTCPIPHandler),
+			}
+			return nil
+		},
 	),
 	)
 }
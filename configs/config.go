@@ -14,6 +14,12 @@ type Config struct {
 	PermissionPolicy    *PermissionPolicyConfig `mapstructure:"permission_policy"`
 	ControlPassport     *ControlPassportConfig  `mapstructure:"control_passport"`
 	Banner              *BannerConfig           `mapstructure:"banner"`
+	LDAP                *LDAPConfig             `mapstructure:"ldap"`
+	OIDC                *OIDCConfig             `mapstructure:"oidc"`
+	MCP                 *MCPConfig              `mapstructure:"mcp"`
+	AccessRequest       *AccessRequestConfig    `mapstructure:"access_request"`
+	CommandPolicies     []*CommandPolicyConfig  `mapstructure:"command_policies"`
+	CommandApproval     *CommandApprovalConfig  `mapstructure:"command_approval"`
 	PermissionBlueprint []*PermissionTarget     `mapstructure:"permissions"`
 }
 
@@ -26,6 +32,8 @@ type ApiConfig struct {
 	Host             string `mapstructure:"host"`
 	Port             string `mapstructure:"port"`
 	CorsAllowOrigins string `mapstructure:"cors_allow_origins"` // CORS 允许的域名列表，多个用逗号分隔
+	// 可信反向代理的 IP 或 CIDR，多个用逗号分隔；只有来自这些地址的请求才采用 X-Forwarded-For/X-Real-IP，留空则只使用连接地址
+	TrustedProxies string `mapstructure:"trusted_proxies"`
 }
 
 type CommonConfig struct {
@@ -35,6 +43,11 @@ type CommonConfig struct {
 	Language          string `mapstructure:"language"`
 	Port              string `mapstructure:"port"`
 	Prompt            string `mapstructure:"prompt"`
+	RecordingDir      string `mapstructure:"recording_dir"`      // 会话录像存储目录
+	RecordingDisabled bool   `mapstructure:"recording_disabled"` // 关闭会话录像（默认开启）
+	RecordingRequired bool   `mapstructure:"recording_required"` // 需要录像但无法开始录像时拒绝会话，同时记录键盘输入
+	RecordingInput    bool   `mapstructure:"recording_input"`    // 录像中记录键盘输入（"i" 事件），包括无回显输入的密码
+	ScpMaxSize        int64  `mapstructure:"scp_max_size"`       // 单次 SCP 传输允许的最大字节数，0 表示不限制
 }
 
 type DatabaseConfig struct {
@@ -63,23 +76,44 @@ type UserFirstConfig struct {
 }
 
 type RoleConfig struct {
-	Name            string                  `mapstructure:"name"`
-	Desc            string                  `mapstructure:"desc"` // legacy textual format
-	Description     string                  `mapstructure:"description"`
-	IsDefaultSuper  bool                    `mapstructure:"is_default_super"`
-	Permissions     []*RolePermissionConfig `mapstructure:"permissions"`
-	PermissionScope []*RoleScopeConfig      `mapstructure:"scopes"` // optional legacy support
+	Name                 string                  `mapstructure:"name"`
+	Desc                 string                  `mapstructure:"desc"` // legacy textual format
+	Description          string                  `mapstructure:"description"`
+	IsDefaultSuper       bool                    `mapstructure:"is_default_super"`
+	DisableRecording     bool                    `mapstructure:"disable_recording"`      // 该角色的终端会话不录像
+	AllowAgentForwarding bool                    `mapstructure:"allow_agent_forwarding"` // 允许该角色把客户端的 ssh-agent 转发到上游
+	AllowPortForwarding  bool                    `mapstructure:"allow_port_forwarding"`  // 允许该角色使用端口转发（ssh -L）和 ProxyJump（ssh -J）
+	RequireTOTP          bool                    `mapstructure:"require_totp"`           // 该角色用户必须绑定 TOTP，SSH 登录需输入验证码
+	Permissions          []*RolePermissionConfig `mapstructure:"permissions"`
+	PermissionScope      []*RoleScopeConfig      `mapstructure:"scopes"` // optional legacy support
 }
 
 type RolePermissionConfig struct {
-	Target  string               `mapstructure:"target"`
-	Actions []string             `mapstructure:"actions"`
-	Scope   *RolePermissionScope `mapstructure:"scope"`
+	Effect     string                    `mapstructure:"effect"` // allow（默认）或 deny，deny 规则命中时总是拒绝
+	Target     string                    `mapstructure:"target"`
+	Actions    []string                  `mapstructure:"actions"`
+	Scope      *RolePermissionScope      `mapstructure:"scope"`
+	Conditions *RolePermissionConditions `mapstructure:"conditions"`
 }
 
+// RolePermissionScope 资源范围，限定 resource 权限适用的资源
+// 配置的各类选择器需同时满足；同一类选择器中任一项匹配即可（tags 例外，需全部匹配）
 type RolePermissionScope struct {
-	Type  string `mapstructure:"type"`
-	Value string `mapstructure:"value"`
+	Type          string   `mapstructure:"type"`           // include（默认）只适用于匹配的资源；exclude 适用于不匹配的资源
+	Value         string   `mapstructure:"value"`          // 资源名称包含该字符串（旧写法）
+	Tags          []string `mapstructure:"tags"`           // 标签选择器，"env=staging" 要求标签取值，"env" 只要求有该标签
+	Spaces        []string `mapstructure:"spaces"`         // 资源所在空间名称，未分配空间的资源属于默认空间
+	Names         []string `mapstructure:"names"`          // 资源名称 glob，如 "web-*"
+	ResourceTypes []string `mapstructure:"resource_types"` // 资源类型，如 ["linux"]
+}
+
+// RolePermissionConditions 权限生效条件，配置的条件全部满足时该权限才生效
+type RolePermissionConditions struct {
+	TimeWindows []string `mapstructure:"time_windows"` // 每日时段，如 "09:00-18:00"，结束早于开始表示跨午夜，如 "22:00-06:00"
+	Weekdays    []string `mapstructure:"weekdays"`     // 星期，如 ["mon", "wed"] 或 ["mon-fri"]；跨午夜时段按开始那天计算
+	Timezone    string   `mapstructure:"timezone"`     // 时段和星期使用的时区，如 "Asia/Shanghai"，默认服务器本地时区
+	SourceCIDRs []string `mapstructure:"source_cidrs"` // 允许的来源网段，如 ["10.0.0.0/8"]，也可以写单个 IP
+	ExpiresAt   string   `mapstructure:"expires_at"`   // 过期时间，"2026-12-31"（当天结束时过期）或 RFC3339
 }
 
 type RoleScopeConfig struct {
@@ -105,6 +139,110 @@ type SpaceConfig struct {
 	DefaultRole string   `mapstructure:"default_role"` // 默认空间角色
 }
 
+// LDAPConfig LDAP / Active Directory 用户源配置
+type LDAPConfig struct {
+	// 是否启用 LDAP 登录
+	Enabled bool `mapstructure:"enabled"`
+	// 服务器地址，如 ldap://ldap.example.com:389 或 ldaps://dc.example.com:636
+	URL string `mapstructure:"url"`
+	// 在 ldap:// 连接上使用 StartTLS
+	StartTLS bool `mapstructure:"start_tls"`
+	// 跳过 TLS 证书校验（仅用于测试环境）
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+	// 查询用户使用的服务账号
+	BindDN       string `mapstructure:"bind_dn"`
+	BindPassword string `mapstructure:"bind_password"`
+	// 用户搜索起点
+	BaseDN string `mapstructure:"base_dn"`
+	// 用户过滤器，%s 替换为用户名，默认 (&(objectClass=person)(uid=%s))
+	UserFilter string `mapstructure:"user_filter"`
+	// 同步时列出所有用户的过滤器，默认 (objectClass=person)
+	SyncFilter string `mapstructure:"sync_filter"`
+	// 属性名，AD 一般为 sAMAccountName / displayName / mail / memberOf
+	UsernameAttribute string `mapstructure:"username_attribute"`
+	NameAttribute     string `mapstructure:"name_attribute"`
+	EmailAttribute    string `mapstructure:"email_attribute"`
+	SSHKeyAttribute   string `mapstructure:"ssh_key_attribute"`
+	GroupAttribute    string `mapstructure:"group_attribute"`
+	// LDAP 组到 ROMA 角色和空间的映射
+	GroupMappings []*LDAPGroupMapping `mapstructure:"group_mappings"`
+	// 没有匹配任何组时分配的角色，为空时拒绝登录
+	DefaultRoles []string `mapstructure:"default_roles"`
+	// 同步间隔（分钟），0 表示不做定期同步
+	SyncIntervalMinutes int `mapstructure:"sync_interval_minutes"`
+}
+
+// LDAPGroupMapping LDAP 组映射
+type LDAPGroupMapping struct {
+	// 组 DN 或组名（CN），不区分大小写
+	Group  string   `mapstructure:"group"`
+	Roles  []string `mapstructure:"roles"`
+	Spaces []string `mapstructure:"spaces"`
+}
+
+// OIDCConfig OIDC 单点登录配置
+type OIDCConfig struct {
+	// 是否启用 OIDC 登录
+	Enabled bool `mapstructure:"enabled"`
+	// 身份提供方地址，需提供 /.well-known/openid-configuration
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// 回调地址，需在身份提供方登记，如 https://roma.example.com/api/v1/auth/oidc/callback
+	RedirectURL string `mapstructure:"redirect_url"`
+	// 登录完成后跳转的前端地址，token 放在 URL fragment 中；为空时回调直接返回 JSON
+	FrontendURL string `mapstructure:"frontend_url"`
+	// 申请的 scope，默认 openid profile email
+	Scopes []string `mapstructure:"scopes"`
+	// 首次登录时作为 ROMA 用户名的 claim，默认 preferred_username；之后按 iss + sub 识别用户
+	UsernameClaim string `mapstructure:"username_claim"`
+	// 角色使用的 claim，支持用 . 访问嵌套字段（如 realm_access.roles），默认 roles
+	RolesClaim string `mapstructure:"roles_claim"`
+	// claim 值到 ROMA 角色的映射，只有映射中列出的值会授予角色
+	RoleMappings []*OIDCRoleMapping `mapstructure:"role_mappings"`
+	// 没有匹配的映射时分配的角色，为空时拒绝登录
+	DefaultRoles []string `mapstructure:"default_roles"`
+}
+
+// OIDCRoleMapping OIDC 角色映射
+type OIDCRoleMapping struct {
+	Value string   `mapstructure:"value"`
+	Roles []string `mapstructure:"roles"`
+}
+
+// MCPConfig 内置 MCP 服务配置
+type MCPConfig struct {
+	// 是否在 API 服务上开放 streamable HTTP 端点（stdio 模式通过 roma mcp 命令启动，不受此项影响）
+	Enabled bool `mapstructure:"enabled"`
+	// HTTP 端点路径，默认 /mcp
+	Path string `mapstructure:"path"`
+	// MCP 令牌有效天数，默认 90 天
+	TokenExpireDays int `mapstructure:"token_expire_days"`
+}
+
+// AccessRequestConfig 临时访问申请配置
+type AccessRequestConfig struct {
+	// 单次申请允许的最长时长（小时），默认 24 小时
+	MaxDurationHours int `mapstructure:"max_duration_hours"`
+}
+
+// CommandPolicyConfig 命令策略，按配置顺序匹配用户提交的命令行，第一条命中的策略生效，都不命中时放行
+type CommandPolicyConfig struct {
+	Name          string   `mapstructure:"name"`
+	Roles         []string `mapstructure:"roles"`          // 适用的角色，为空时适用所有用户
+	Spaces        []string `mapstructure:"spaces"`         // 适用的空间（按资源所属空间），为空时不限空间
+	ResourceTypes []string `mapstructure:"resource_types"` // 适用的资源类型，为空时不限类型
+	Patterns      []string `mapstructure:"patterns"`       // 正则表达式，命令行匹配任意一条即命中
+	Action        string   `mapstructure:"action"`         // allow 放行 | deny 拦截 | confirm 需用户确认 | approve 需第二人审批
+	Message       string   `mapstructure:"message"`        // 命中时展示给用户的说明
+}
+
+// CommandApprovalConfig 命令审批配置
+type CommandApprovalConfig struct {
+	// 等待第二审批人的最长时间（秒），默认 300
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+}
+
 // PermissionPolicyConfig 权限策略配置
 type PermissionPolicyConfig struct {
 	// 是否启用资源角色检查
@@ -134,12 +272,40 @@ type SecurityConfig struct {
 	EncryptionKey string `mapstructure:"encryption_key"`
 	// JWT 配置
 	JWT *JWTConfig `mapstructure:"jwt"`
+	// 上游主机密钥严格模式：拒绝从未固定过的主机密钥（默认首次连接自动固定）
+	HostKeyStrict bool `mapstructure:"host_key_strict"`
+	// OpenSSH 用户证书登录
+	UserCA *UserCAConfig `mapstructure:"user_ca"`
+	// 内置 SSH CA：连接上游主机时签发短期证书
+	SSHCA *SSHCAConfig `mapstructure:"ssh_ca"`
+}
+
+// SSHCAConfig 内置 SSH CA 配置
+type SSHCAConfig struct {
+	// 是否使用 CA 证书登录上游主机（上游需在 TrustedUserCAKeys 中配置 CA 公钥）
+	Enabled bool `mapstructure:"enabled"`
+	// 证书有效期（分钟），默认 5 分钟
+	ValidityMinutes int `mapstructure:"validity_minutes"`
+}
+
+// UserCAConfig 受信任的 OpenSSH 用户证书 CA
+type UserCAConfig struct {
+	// 受信任的 CA 公钥（authorized_keys 格式），与 TrustedKeysFile 合并
+	TrustedKeys []string `mapstructure:"trusted_keys"`
+	// 受信任的 CA 公钥文件，每行一个（同 sshd 的 TrustedUserCAKeys）
+	TrustedKeysFile string `mapstructure:"trusted_keys_file"`
+	// CA 发布的 KRL 吊销列表（ssh-keygen -k 生成），文件变化后自动重新加载
+	KRLFile string `mapstructure:"krl_file"`
+	// 证书 principal 到 ROMA 用户名的映射，未列出的 principal 按同名用户处理
+	Principals map[string]string `mapstructure:"principals"`
 }
 
 // JWTConfig JWT 配置
 type JWTConfig struct {
 	// JWT 签名密钥（用于生成和验证 token）
 	Secret string `mapstructure:"secret"`
-	// Token 过期时间（小时），默认24小时
+	// 登录会话（刷新令牌）过期时间（小时），默认24小时
 	ExpireHours int `mapstructure:"expire_hours"`
+	// 访问令牌过期时间（分钟），默认15分钟
+	AccessExpireMinutes int `mapstructure:"access_expire_minutes"`
 }
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"binrc.com/roma/core/jitaccess"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type AccessRequestController struct{}
+
+func NewAccessRequestController() *AccessRequestController {
+	return &AccessRequestController{}
+}
+
+// CreateAccessRequest 临时访问申请，ResourceName 与 Space 二选一
+type CreateAccessRequest struct {
+	ResourceType string `json:"resource_type"` // 资源类型，默认 linux
+	ResourceName string `json:"resource_name"` // 资源名称
+	Space        string `json:"space"`         // 空间名称，申请整个空间时填写
+	Duration     string `json:"duration"`      // 时长，如 30m、2h、1d
+	Reason       string `json:"reason"`        // 申请理由
+}
+
+// DecideAccessRequest 审批意见
+type DecideAccessRequest struct {
+	Comment string `json:"comment"`
+}
+
+// CreateMyAccessRequest 申请临时访问资源或空间
+// @Summary 申请临时访问
+// @Description 审批通过后在有效期内获得资源（或空间内所有资源）的 list/get/use 权限，到期自动收回
+// @Tags access-request
+// @Accept json
+// @Produce json
+// @Param request body CreateAccessRequest true "申请对象、时长和理由"
+// @Success 200 {object} utils.Response{data=model.AccessRequest}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/access-requests [post]
+func (ac *AccessRequestController) CreateMyAccessRequest(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	currentUser := user.(*model.User)
+
+	var req CreateAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的请求参数")
+		return
+	}
+	duration, err := jitaccess.ParseDuration(req.Duration)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, err.Error())
+		return
+	}
+
+	var record *model.AccessRequest
+	switch {
+	case req.Space != "" && req.ResourceName == "":
+		record, err = jitaccess.RequestSpace(currentUser, req.Space, duration, req.Reason, c.ClientIP())
+	case req.ResourceName != "" && req.Space == "":
+		if req.ResourceType == "" {
+			req.ResourceType = "linux"
+		}
+		record, err = jitaccess.RequestResource(currentUser, req.ResourceType, req.ResourceName, duration, req.Reason, c.ClientIP())
+	default:
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "resource_name 与 space 必须且只能填写一个")
+		return
+	}
+	if err != nil {
+		responseAccessRequestError(utilG, err)
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, record)
+}
+
+// GetMyAccessRequests 列出当前用户的临时访问申请
+// @Summary 我的临时访问申请
+// @Tags access-request
+// @Produce json
+// @Param status query string false "按状态过滤：pending/approved/denied/cancelled/expired/revoked"
+// @Success 200 {object} utils.Response{data=[]model.AccessRequest}
+// @Router /api/v1/users/me/access-requests [get]
+func (ac *AccessRequestController) GetMyAccessRequests(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	records, err := jitaccess.List(user.(*model.User).ID, c.Query("status"))
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取访问申请失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, records)
+}
+
+// CancelMyAccessRequest 撤回自己的申请，已生效的授权会被提前收回
+// @Summary 撤回临时访问申请
+// @Tags access-request
+// @Produce json
+// @Param id path int true "申请ID"
+// @Success 200 {object} utils.Response{data=model.AccessRequest}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/access-requests/:id [delete]
+func (ac *AccessRequestController) CancelMyAccessRequest(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	id, ok := accessRequestID(utilG)
+	if !ok {
+		return
+	}
+	record, err := jitaccess.Cancel(user.(*model.User), id, c.ClientIP())
+	if err != nil {
+		responseAccessRequestError(utilG, err)
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, record)
+}
+
+// GetAccessRequests 列出所有人的临时访问申请
+// @Summary 临时访问申请列表
+// @Tags access-request
+// @Produce json
+// @Param status query string false "按状态过滤，如 pending 为待审批队列"
+// @Success 200 {object} utils.Response{data=[]model.AccessRequest}
+// @Router /api/v1/access-requests [get]
+func (ac *AccessRequestController) GetAccessRequests(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	records, err := jitaccess.List(0, c.Query("status"))
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取访问申请失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, records)
+}
+
+// ApproveAccessRequest 批准临时访问申请
+// @Summary 批准临时访问申请
+// @Description 不能审批自己的申请；授权从批准时刻开始计时
+// @Tags access-request
+// @Accept json
+// @Produce json
+// @Param id path int true "申请ID"
+// @Param request body DecideAccessRequest false "审批意见"
+// @Success 200 {object} utils.Response{data=model.AccessRequest}
+// @Failure 409 {object} utils.Response{data=""}
+// @Router /api/v1/access-requests/:id/approve [post]
+func (ac *AccessRequestController) ApproveAccessRequest(c *gin.Context) {
+	ac.decide(c, jitaccess.Approve)
+}
+
+// DenyAccessRequest 拒绝临时访问申请
+// @Summary 拒绝临时访问申请
+// @Tags access-request
+// @Accept json
+// @Produce json
+// @Param id path int true "申请ID"
+// @Param request body DecideAccessRequest false "审批意见"
+// @Success 200 {object} utils.Response{data=model.AccessRequest}
+// @Failure 409 {object} utils.Response{data=""}
+// @Router /api/v1/access-requests/:id/deny [post]
+func (ac *AccessRequestController) DenyAccessRequest(c *gin.Context) {
+	ac.decide(c, jitaccess.Deny)
+}
+
+// RevokeAccessRequest 提前收回生效中的授权，并断开因此失去权限的会话
+// @Summary 收回临时访问授权
+// @Tags access-request
+// @Accept json
+// @Produce json
+// @Param id path int true "申请ID"
+// @Param request body DecideAccessRequest false "收回原因"
+// @Success 200 {object} utils.Response{data=model.AccessRequest}
+// @Failure 409 {object} utils.Response{data=""}
+// @Router /api/v1/access-requests/:id/revoke [post]
+func (ac *AccessRequestController) RevokeAccessRequest(c *gin.Context) {
+	ac.decide(c, jitaccess.Revoke)
+}
+
+func (ac *AccessRequestController) decide(c *gin.Context, fn func(*model.User, uint, string, string) (*model.AccessRequest, error)) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	id, ok := accessRequestID(utilG)
+	if !ok {
+		return
+	}
+	var req DecideAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req = DecideAccessRequest{}
+	}
+	record, err := fn(user.(*model.User), id, req.Comment, c.ClientIP())
+	if err != nil {
+		responseAccessRequestError(utilG, err)
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, record)
+}
+
+func accessRequestID(utilG utils.Gin) (uint, bool) {
+	id, err := strconv.ParseUint(utilG.C.Param("id"), 10, 64)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的申请ID")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// responseAccessRequestError 将 jitaccess 的错误映射为 HTTP 状态码
+func responseAccessRequestError(utilG utils.Gin, err error) {
+	switch {
+	case errors.Is(err, jitaccess.ErrNotFound), errors.Is(err, jitaccess.ErrTargetNotFound):
+		utilG.Response(http.StatusNotFound, utils.ERROR, err.Error())
+	case errors.Is(err, jitaccess.ErrNotApprover), errors.Is(err, jitaccess.ErrSelfApproval):
+		utilG.Response(http.StatusForbidden, utils.ERROR, err.Error())
+	case errors.Is(err, jitaccess.ErrDuplicate), errors.Is(err, jitaccess.ErrInvalidState):
+		utilG.Response(http.StatusConflict, utils.ERROR, err.Error())
+	case errors.Is(err, jitaccess.ErrInvalidDuration), errors.Is(err, jitaccess.ErrReasonRequired):
+		utilG.Response(http.StatusBadRequest, utils.ERROR, err.Error())
+	default:
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "处理访问申请失败")
+	}
+}
@@ -188,3 +188,34 @@ func recordTUIAuditLog(userID uint, username, command, resourceType string, reso
 		}
 	}()
 }
+
+// RecordTUIActionAuditLog 记录 SSH/TUI 侧非命令类操作的审计日志（不依赖gin.Context）
+func RecordTUIActionAuditLog(username, action, actionType, resourceType string, resourceID uint, resourceName, description, ipAddress, status, errorMessage string) {
+	var userID uint
+	opUser := operation.NewUserOperation()
+	if user, err := opUser.GetUserByUsername(username); err == nil {
+		userID = user.ID
+	}
+
+	auditLog := &model.AuditLog{
+		UserID:       userID,
+		Username:     username,
+		Action:       action,
+		ActionType:   actionType,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		ResourceName: resourceName,
+		Description:  description,
+		IPAddress:    ipAddress,
+		Status:       status,
+		ErrorMessage: errorMessage,
+	}
+
+	// 异步记录审计日志
+	go func() {
+		opAudit := operation.NewAuditOperation()
+		if err := opAudit.CreateAuditLog(auditLog); err != nil {
+			// 记录失败不影响主流程
+		}
+	}()
+}
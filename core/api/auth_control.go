@@ -1,8 +1,14 @@
 package api
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
+	"binrc.com/roma/core/ldapauth"
+	"binrc.com/roma/core/loginsession"
+	"binrc.com/roma/core/mfa"
+	securityMiddleware "binrc.com/roma/core/middleware"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/utils"
@@ -21,8 +27,28 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string      `json:"token"` // JWT token
-	User  *model.User `json:"user"`  // 用户信息
+	Token        string      `json:"token,omitempty"`         // JWT 访问令牌（短期有效）
+	RefreshToken string      `json:"refresh_token,omitempty"` // 刷新令牌，调用 /auth/refresh 换取新的访问令牌，每次使用后轮换
+	ExpiresIn    int64       `json:"expires_in,omitempty"`    // 访问令牌有效期（秒）
+	User         *model.User `json:"user,omitempty"`          // 用户信息
+	// 已绑定 TOTP 时不返回 token，需用 mfa_token 和验证码调用 /auth/login/mfa
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"` // 等待验证码的临时令牌（5 分钟有效）
+	// 角色要求 TOTP 但尚未绑定，前端应引导用户绑定
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"` // 登录接口返回的临时令牌
+	Code     string `json:"code" binding:"required"`      // 6 位验证码或恢复码
 }
 
 // Login 用户登录
@@ -37,38 +63,182 @@ func (ac *AuthController) Login(c *gin.Context) {
 	// 查找用户
 	opUser := operation.NewUserOperation()
 	user, err := opUser.GetUserByUsername(req.Username)
+	if ldapauth.Enabled() && (err != nil || user.IsLDAP()) {
+		// 本地不存在的用户和目录用户通过 LDAP 校验密码，并按组映射同步角色
+		user, err = ac.ldapLogin(req.Username, req.Password)
+		if err != nil {
+			utilG.Response(http.StatusUnauthorized, utils.ERROR, "用户名或密码错误")
+			return
+		}
+	} else {
+		if err != nil {
+			utilG.Response(http.StatusUnauthorized, utils.ERROR, "用户名或密码错误")
+			return
+		}
+
+		// 使用 bcrypt 验证用户密码（不可逆加密）
+		if !utils.CheckPassword(user.Password, req.Password) {
+			utilG.Response(http.StatusUnauthorized, utils.ERROR, "用户名或密码错误")
+			return
+		}
+	}
+
+	response, err := ac.loginResult(c, user)
 	if err != nil {
-		utilG.Response(http.StatusUnauthorized, utils.ERROR, "用户名或密码错误")
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, err.Error())
 		return
 	}
+	if response.MFARequired {
+		c.Set(securityMiddleware.ContextKeyMFAPending, true)
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, response)
+}
+
+// loginResult 第一步认证通过后的结果
+// 已绑定 TOTP：返回临时令牌，验证码通过后再签发 JWT；否则直接签发 JWT
+func (ac *AuthController) loginResult(c *gin.Context, user *model.User) (*LoginResponse, error) {
+	enabled, err := mfa.IsEnabled(user.ID)
+	if err != nil {
+		return nil, errors.New("获取二次验证状态失败")
+	}
+	if enabled {
+		mfaToken, err := utils.GenerateMFAPendingToken(user.ID, user.Username)
+		if err != nil {
+			return nil, errors.New("生成认证令牌失败")
+		}
+		return &LoginResponse{MFARequired: true, MFAToken: mfaToken}, nil
+	}
+	return ac.tokenResult(c, user, mfa.IsRequiredByRole(user.ID))
+}
+
+// tokenResult 创建登录会话并返回访问令牌和刷新令牌
+func (ac *AuthController) tokenResult(c *gin.Context, user *model.User, enrollmentRequired bool) (*LoginResponse, error) {
+	tokens, err := loginsession.Create(user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return nil, errors.New("生成认证令牌失败")
+	}
+	return &LoginResponse{
+		Token:                 tokens.AccessToken,
+		RefreshToken:          tokens.RefreshToken,
+		ExpiresIn:             tokens.ExpiresIn,
+		User:                  user,
+		MFAEnrollmentRequired: enrollmentRequired,
+	}, nil
+}
+
+// ldapLogin 通过 LDAP 校验密码并同步用户
+func (ac *AuthController) ldapLogin(username, password string) (*model.User, error) {
+	entry, err := ldapauth.Authenticate(username, password)
+	if err != nil {
+		if !errors.Is(err, ldapauth.ErrInvalidCredentials) && !errors.Is(err, ldapauth.ErrUserNotFound) {
+			log.Printf("Login: LDAP 认证用户 %s 失败: %v", username, err)
+		}
+		return nil, err
+	}
+	user, err := ldapauth.ProvisionUser(entry)
+	if err != nil {
+		log.Printf("Login: 同步 LDAP 用户 %s 失败: %v", username, err)
+		return nil, err
+	}
+	return user, nil
+}
 
-	// 使用 bcrypt 验证用户密码（不可逆加密）
-	if !utils.CheckPassword(user.Password, req.Password) {
-		utilG.Response(http.StatusUnauthorized, utils.ERROR, "用户名或密码错误")
+// LoginMFA 登录第二步：用临时令牌和 TOTP 验证码换取 JWT
+func (ac *AuthController) LoginMFA(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "请输入验证码")
 		return
 	}
 
-	// 生成 JWT token
-	token, err := utils.GenerateJWT(user.ID, user.Username)
+	claims, err := utils.ParseMFAPendingToken(req.MFAToken)
+	if err != nil {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "登录已过期，请重新输入用户名和密码")
+		return
+	}
+	user, err := operation.NewUserOperation().GetUserByID(claims.UserID)
 	if err != nil {
-		utilG.Response(http.StatusInternalServerError, utils.ERROR, "生成认证令牌失败")
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "用户不存在")
 		return
 	}
 
-	// 返回登录信息
-	response := LoginResponse{
-		Token: token,
-		User:  user,
+	if _, err := mfa.VerifyLogin(user.ID, claims.ID, claims.ExpiresAt.Time, req.Code); err != nil {
+		if errors.Is(err, mfa.ErrInvalidCode) || errors.Is(err, mfa.ErrNotEnrolled) {
+			utilG.Response(http.StatusUnauthorized, utils.ERROR, "验证码错误")
+			return
+		}
+		if errors.Is(err, mfa.ErrTooManyAttempts) || errors.Is(err, mfa.ErrTokenUsed) {
+			utilG.Response(http.StatusUnauthorized, utils.ERROR, "验证码错误次数过多或登录已失效，请重新输入用户名和密码")
+			return
+		}
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "验证失败")
+		return
 	}
 
+	ac.respondLogin(c, user, false)
+}
+
+// respondLogin 生成 JWT 并返回登录信息
+func (ac *AuthController) respondLogin(c *gin.Context, user *model.User, enrollmentRequired bool) {
+	utilG := utils.Gin{C: c}
+
+	response, err := ac.tokenResult(c, user, enrollmentRequired)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, err.Error())
+		return
+	}
 	utilG.Response(http.StatusOK, utils.SUCCESS, response)
 }
 
-// Logout 用户登出
+// Refresh 用刷新令牌换取新的访问令牌，刷新令牌同时轮换，旧刷新令牌立即失效
+func (ac *AuthController) Refresh(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "缺少刷新令牌")
+		return
+	}
+
+	user, tokens, err := loginsession.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, loginsession.ErrInvalidRefreshToken) || errors.Is(err, loginsession.ErrSessionInactive) {
+			utilG.Response(http.StatusUnauthorized, utils.ERROR, "登录已失效，请重新登录")
+			return
+		}
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "刷新令牌失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, LoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         user,
+	})
+}
+
+// Logout 用户登出：吊销当前会话，该会话的访问令牌和刷新令牌立即失效
 func (ac *AuthController) Logout(c *gin.Context) {
 	utilG := utils.Gin{C: c}
-	// 登出主要是客户端删除 token/API Key
-	// 服务端可以选择使当前的 API Key 失效，但这里简化处理
+
+	token := c.GetHeader("Authorization")
+	if len(token) > 7 && token[:7] == "Bearer " {
+		token = token[7:]
+	}
+	var err error
+	if claims, parseErr := loginsession.ParseAccessToken(token); token != "" && parseErr == nil {
+		_, err = loginsession.Revoke(claims.ID, loginsession.RevokeLogout)
+	} else {
+		// 访问令牌已过期时用刷新令牌登出
+		var req LogoutRequest
+		if c.ShouldBindJSON(&req) == nil && req.RefreshToken != "" {
+			_, err = loginsession.RevokeByRefreshToken(req.RefreshToken, loginsession.RevokeLogout)
+		}
+	}
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "登出失败")
+		return
+	}
 	utilG.Response(http.StatusOK, utils.SUCCESS, "登出成功")
 }
 
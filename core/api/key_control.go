@@ -1,10 +1,13 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"binrc.com/roma/core/apikeyauth"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/utils"
@@ -19,38 +22,83 @@ func NewApikeyController() *ApikeyController {
 	return &ApikeyController{}
 }
 
-// 创建API Key
-// CreateApikey generates a new API key and returns it
-func (ac *ApikeyController) CreateApikey(c *gin.Context) {
-	utilG := utils.Gin{C: c}
+// CreateApikeyRequest 创建 API Key 的请求
+type CreateApikeyRequest struct {
+	UserID      uint                `json:"user_id"`      // 所属用户，为空表示当前用户（仅管理员接口）
+	Description string              `json:"description"`  // 描述
+	ExpiresDays int                 `json:"expires_days"` // 过期天数，默认 30 天
+	Scopes      []model.ApikeyScope `json:"scopes"`       // 权限范围，如 [{"target":"resource","actions":["list","use"],"space_id":2}]，为空表示继承用户权限
+}
 
-	// Generate a new API Key
-	newApiKey := utils.GenerateKey()
+// CreateApikeyResponse 明文 API Key 只在创建时返回这一次
+type CreateApikeyResponse struct {
+	ApiKey    string        `json:"api_key"`
+	Apikey    *model.Apikey `json:"apikey"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
 
-	// Create a new Apikey model instance
-	newApikey := model.Apikey{
-		Apikey:      "apikey." + newApiKey,
-		Description: "New API Key",
-		ExpiresAt:   time.Now().AddDate(1, 0, 0), // Set expiration date to 1 year from now
+// requestApikey 当前请求使用的 API Key，JWT 认证时返回 nil
+func requestApikey(c *gin.Context) *model.Apikey {
+	if v, exists := c.Get("apikey"); exists {
+		if key, ok := v.(*model.Apikey); ok {
+			return key
+		}
 	}
+	return nil
+}
 
-	// Save the new API Key to the database
-	opKey := operation.NewApikeyOperation()
-	_, err := opKey.Create(&newApikey)
-	if err != nil {
-		utilG.Response(http.StatusInternalServerError, utils.ERROR, "创建API Key失败")
+// CreateApikey 管理员为用户创建 API Key
+// @Summary 创建 API Key
+// @Tags apikeys
+// @Accept json
+// @Produce json
+// @Param request body CreateApikeyRequest true "所属用户、描述、过期天数和权限范围"
+// @Success 200 {object} utils.Response{data=CreateApikeyResponse}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/apikeys [post]
+func (ac *ApikeyController) CreateApikey(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	var req CreateApikeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "请求参数错误")
 		return
 	}
-
-	// Return the newly generated API Key
-	utilG.Response(http.StatusOK, utils.SUCCESS, gin.H{"message": "API Key创建成功", "api_key": newApiKey})
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	currentUser := user.(*model.User)
+	owner := currentUser
+	if req.UserID != 0 && req.UserID != currentUser.ID {
+		user, err := operation.NewUserOperation().GetUserByID(req.UserID)
+		if err != nil {
+			utilG.Response(http.StatusNotFound, utils.ERROR, "用户不存在")
+			return
+		}
+		owner = user
+	}
+	ac.createApikey(c, &utilG, owner, req)
 }
 
-// 获取所有API Keys
+// 获取所有API Keys，可按 user_id 过滤
 func (ac *ApikeyController) GetAllApikeys(c *gin.Context) {
 	utilG := utils.Gin{C: c}
 	opKey := operation.NewApikeyOperation()
-	apikeys, err := opKey.GetAllApiKeys()
+	var (
+		apikeys []*model.Apikey
+		err     error
+	)
+	if userID := c.Query("user_id"); userID != "" {
+		id, parseErr := strconv.ParseUint(userID, 10, 64)
+		if parseErr != nil {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的用户ID")
+			return
+		}
+		apikeys, err = opKey.GetApiKeysByUser(uint(id))
+	} else {
+		apikeys, err = opKey.GetAllApiKeys()
+	}
 	if err != nil {
 		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取API Key列表失败")
 		return
@@ -84,20 +132,23 @@ func (ac *ApikeyController) DeleteApikeyByID(c *gin.Context) {
 		return
 	}
 	opKey := operation.NewApikeyOperation()
-	err = opKey.ExpiresApikeyById(uint(apikeyID))
+	apikey, err := opKey.GetApiKeyById(uint(apikeyID))
 	if err != nil {
-		utilG.Response(http.StatusInternalServerError, utils.ERROR, "删除API Key失败")
+		utilG.Response(http.StatusNotFound, utils.ERROR, "API Key未找到")
 		return
 	}
-	utilG.Response(http.StatusOK, utils.SUCCESS, "API Key删除成功")
-}
-
-type CreateMyApikeyRequest struct {
-	Description string `json:"description"`
-	ExpiresDays int    `json:"expires_days"` // 过期天数，默认30天
+	ac.expireApikey(c, &utilG, apikey)
 }
 
-// CreateMyApikey 创建当前用户自己的 API Key
+// CreateMyApikey 创建当前用户自己的 API Key，权限范围不能超出自己的权限
+// @Summary 创建我的 API Key
+// @Tags apikeys
+// @Accept json
+// @Produce json
+// @Param request body CreateApikeyRequest true "描述、过期天数和权限范围"
+// @Success 200 {object} utils.Response{data=CreateApikeyResponse}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/apikeys [post]
 func (ac *ApikeyController) CreateMyApikey(c *gin.Context) {
 	utilG := utils.Gin{C: c}
 
@@ -110,60 +161,27 @@ func (ac *ApikeyController) CreateMyApikey(c *gin.Context) {
 
 	currentUser := user.(*model.User)
 
-	var req CreateMyApikeyRequest
+	var req CreateApikeyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		// 如果没有提供，使用默认值
-		req.Description = "用户自己创建的 API Key"
-		req.ExpiresDays = 30
-	}
-
-	if req.Description == "" {
-		req.Description = "用户自己创建的 API Key"
-	}
-	if req.ExpiresDays <= 0 {
-		req.ExpiresDays = 30
+		req = CreateApikeyRequest{}
 	}
-
-	// 生成新的 API Key
-	newApiKey := utils.GenerateKey()
-	fullApiKey := "apikey." + newApiKey
-
-	// 创建 API Key
-	newApikey := model.Apikey{
-		Apikey:      fullApiKey,
-		Description: req.Description + " (用户: " + currentUser.Username + ")",
-		ExpiresAt:   time.Now().AddDate(0, 0, req.ExpiresDays),
-	}
-
-	opKey := operation.NewApikeyOperation()
-	_, err := opKey.Create(&newApikey)
-	if err != nil {
-		utilG.Response(http.StatusInternalServerError, utils.ERROR, "创建API Key失败")
-		return
-	}
-
-	utilG.Response(http.StatusOK, utils.SUCCESS, gin.H{
-		"message":    "API Key创建成功",
-		"api_key":    fullApiKey,
-		"expires_at": newApikey.ExpiresAt,
-	})
+	ac.createApikey(c, &utilG, currentUser, req)
 }
 
 // GetMyApikeys 获取当前用户自己的 API Keys
-// 注意：当前 Apikey 模型没有 user_id 字段，所以返回所有有效的 API Keys
-// 后续可以添加 user_id 字段来关联用户
 func (ac *ApikeyController) GetMyApikeys(c *gin.Context) {
 	utilG := utils.Gin{C: c}
 
 	// 从上下文获取用户
-	_, exists := c.Get("user")
+	user, exists := c.Get("user")
 	if !exists {
 		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
 		return
 	}
 
 	opKey := operation.NewApikeyOperation()
-	apikeys, err := opKey.GetAllApiKeys()
+	apikeys, err := opKey.GetApiKeysByUser(user.(*model.User).ID)
 	if err != nil {
 		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取API Key列表失败")
 		return
@@ -186,7 +204,7 @@ func (ac *ApikeyController) DeleteMyApikey(c *gin.Context) {
 	utilG := utils.Gin{C: c}
 
 	// 从上下文获取用户
-	_, exists := c.Get("user")
+	user, exists := c.Get("user")
 	if !exists {
 		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
 		return
@@ -199,11 +217,56 @@ func (ac *ApikeyController) DeleteMyApikey(c *gin.Context) {
 	}
 
 	opKey := operation.NewApikeyOperation()
-	err = opKey.ExpiresApikeyById(uint(apikeyID))
+	apikey, err := opKey.GetApiKeyById(uint(apikeyID))
+	if err != nil || apikey.UserID != user.(*model.User).ID {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "API Key未找到")
+		return
+	}
+	ac.expireApikey(c, &utilG, apikey)
+}
+
+// createApikey 生成 API Key 并返回明文
+func (ac *ApikeyController) createApikey(c *gin.Context, utilG *utils.Gin, owner *model.User, req CreateApikeyRequest) {
+	// API Key 不能再创建 API Key，避免凭证泄露后被用来扩散
+	if requestApikey(c) != nil {
+		utilG.Response(http.StatusForbidden, utils.ERROR, "不能使用 API Key 创建 API Key")
+		return
+	}
+	if req.Description == "" {
+		req.Description = "用户自己创建的 API Key"
+	}
+	if req.ExpiresDays <= 0 {
+		req.ExpiresDays = 30
+	}
+
+	key, apikey, err := apikeyauth.Create(owner, req.Description, time.Now().AddDate(0, 0, req.ExpiresDays), req.Scopes)
 	if err != nil {
-		utilG.Response(http.StatusInternalServerError, utils.ERROR, "删除API Key失败")
+		if errors.Is(err, apikeyauth.ErrScopeNotAllowed) {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, err.Error())
+			return
+		}
+		RecordAuditLog(c, "create_apikey", "high_risk", "apikey", 0, owner.Username, "创建 API Key", "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "创建API Key失败")
 		return
 	}
+	RecordAuditLog(c, "create_apikey", "high_risk", "apikey", apikey.ID, apikey.KeyPrefix,
+		fmt.Sprintf("为用户 %s 创建 API Key，权限范围 %d 项", owner.Username, len(apikey.Scopes)), "success", "")
+
+	utilG.Response(http.StatusOK, utils.SUCCESS, CreateApikeyResponse{
+		ApiKey:    key,
+		Apikey:    apikey,
+		ExpiresAt: apikey.ExpiresAt,
+	})
+}
 
+// expireApikey 设置 API Key 过期（保留记录用于审计）
+func (ac *ApikeyController) expireApikey(c *gin.Context, utilG *utils.Gin, apikey *model.Apikey) {
+	opKey := operation.NewApikeyOperation()
+	if err := opKey.ExpiresApikeyById(apikey.ID); err != nil {
+		RecordAuditLog(c, "delete_apikey", "high_risk", "apikey", apikey.ID, apikey.KeyPrefix, "删除 API Key", "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "删除API Key失败")
+		return
+	}
+	RecordAuditLog(c, "delete_apikey", "high_risk", "apikey", apikey.ID, apikey.KeyPrefix, fmt.Sprintf("删除用户 %d 的 API Key", apikey.UserID), "success", "")
 	utilG.Response(http.StatusOK, utils.SUCCESS, "API Key删除成功")
 }
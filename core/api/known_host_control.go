@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type KnownHostController struct{}
+
+func NewKnownHostController() *KnownHostController {
+	return &KnownHostController{}
+}
+
+// GetKnownHosts 获取已固定的上游主机密钥
+// @Summary 获取上游主机密钥列表
+// @Description 列出按资源固定的上游主机密钥，包含等待确认的轮换密钥
+// @Tags known_hosts
+// @Produce json
+// @Param resource_type query string false "资源类型"
+// @Param resource_id query int false "资源ID"
+// @Success 200 {object} utils.Response{data=[]model.KnownHost}
+// @Router /api/v1/known-hosts [get]
+func (kc *KnownHostController) GetKnownHosts(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	var resourceID uint64
+	if id := c.Query("resource_id"); id != "" {
+		var err error
+		if resourceID, err = strconv.ParseUint(id, 10, 64); err != nil {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的资源ID")
+			return
+		}
+	}
+
+	knownHosts, err := operation.NewKnownHostOperation().ListKnownHosts(strings.ToLower(c.Query("resource_type")), uint(resourceID))
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取主机密钥列表失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, gin.H{
+		"list":  knownHosts,
+		"total": len(knownHosts),
+	})
+}
+
+// AcceptKnownHost 确认上游主机的新密钥（密钥轮换或严格模式下首次固定）
+// @Summary 确认待定的上游主机密钥
+// @Tags known_hosts
+// @Produce json
+// @Param id path int true "主机密钥记录ID"
+// @Success 200 {object} utils.Response{data=model.KnownHost}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/known-hosts/:id/accept [post]
+func (kc *KnownHostController) AcceptKnownHost(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的记录ID")
+		return
+	}
+
+	op := operation.NewKnownHostOperation()
+	before, err := op.GetKnownHostByID(uint(id))
+	if err != nil {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "主机密钥记录不存在")
+		return
+	}
+
+	knownHost, err := op.AcceptPendingKey(uint(id))
+	if err != nil {
+		RecordAuditLog(c, "host_key_accept", "high_risk", before.ResourceType, before.ResourceID, before.Host,
+			fmt.Sprintf("确认上游主机 %s 的新密钥", before.Host), "failed", err.Error())
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "没有待确认的主机密钥")
+		return
+	}
+
+	RecordAuditLog(c, "host_key_accept", "high_risk", knownHost.ResourceType, knownHost.ResourceID, knownHost.Host,
+		fmt.Sprintf("确认上游主机 %s 的新密钥，原指纹: %s，新指纹: %s", knownHost.Host, before.Fingerprint, knownHost.Fingerprint),
+		"success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, knownHost)
+}
+
+// DeleteKnownHost 删除已固定的上游主机密钥，下次连接时重新固定
+// @Summary 删除上游主机密钥
+// @Tags known_hosts
+// @Produce json
+// @Param id path int true "主机密钥记录ID"
+// @Success 200 {object} utils.Response{data=""}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/known-hosts/:id [delete]
+func (kc *KnownHostController) DeleteKnownHost(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的记录ID")
+		return
+	}
+
+	op := operation.NewKnownHostOperation()
+	knownHost, err := op.GetKnownHostByID(uint(id))
+	if err != nil {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "主机密钥记录不存在")
+		return
+	}
+
+	if err := op.DeleteKnownHost(knownHost.ID); err != nil {
+		RecordAuditLog(c, "host_key_delete", "high_risk", knownHost.ResourceType, knownHost.ResourceID, knownHost.Host,
+			fmt.Sprintf("删除上游主机 %s 的固定密钥", knownHost.Host), "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "删除主机密钥失败")
+		return
+	}
+
+	RecordAuditLog(c, "host_key_delete", "high_risk", knownHost.ResourceType, knownHost.ResourceID, knownHost.Host,
+		fmt.Sprintf("删除上游主机 %s 的固定密钥，指纹: %s", knownHost.Host, knownHost.Fingerprint), "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, "主机密钥已删除")
+}
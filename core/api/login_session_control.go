@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"binrc.com/roma/core/loginsession"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type LoginSessionController struct{}
+
+func NewLoginSessionController() *LoginSessionController {
+	return &LoginSessionController{}
+}
+
+// sessionUser 按路径参数 id 获取用户，失败时写入响应并返回 nil
+func sessionUser(c *gin.Context, utilG *utils.Gin) *model.User {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的用户ID")
+		return nil
+	}
+	user, err := operation.NewUserOperation().GetUserByID(uint(userID))
+	if err != nil || user == nil {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "用户不存在")
+		return nil
+	}
+	return user
+}
+
+// ListUserSessions 列出用户的有效登录会话
+// @Summary 列出用户的登录会话
+// @Tags login-sessions
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} utils.Response{data=[]model.UserSession}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/users/{id}/sessions [get]
+func (sc *LoginSessionController) ListUserSessions(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user := sessionUser(c, &utilG)
+	if user == nil {
+		return
+	}
+	sessions, err := loginsession.List(user.ID)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取会话失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, sessions)
+}
+
+// RevokeUserSession 吊销用户的指定会话，该会话的访问令牌和刷新令牌立即失效
+// @Summary 吊销登录会话
+// @Tags login-sessions
+// @Produce json
+// @Param id path int true "用户ID"
+// @Param session_id path string true "会话ID"
+// @Success 200 {object} utils.Response{data=""}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/users/{id}/sessions/{session_id} [delete]
+func (sc *LoginSessionController) RevokeUserSession(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user := sessionUser(c, &utilG)
+	if user == nil {
+		return
+	}
+	sessionID := c.Param("session_id")
+	session, err := operation.NewUserSessionOperation().GetSession(sessionID)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取会话失败")
+		return
+	}
+	if session == nil || session.UserID != user.ID {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "会话不存在")
+		return
+	}
+
+	if _, err := loginsession.Revoke(sessionID, loginsession.RevokeAdmin); err != nil {
+		RecordAuditLog(c, "revoke_session", "high_risk", "user", user.ID, user.Username,
+			fmt.Sprintf("吊销用户 %s 的会话 %s", user.Username, sessionID), "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "吊销会话失败")
+		return
+	}
+	RecordAuditLog(c, "revoke_session", "high_risk", "user", user.ID, user.Username,
+		fmt.Sprintf("吊销用户 %s 的会话 %s", user.Username, sessionID), "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, "会话已吊销")
+}
+
+// RevokeUserSessions 吊销用户的所有会话（强制下线）
+// @Summary 吊销用户的所有登录会话
+// @Tags login-sessions
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} utils.Response{data=int64}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/users/{id}/sessions [delete]
+func (sc *LoginSessionController) RevokeUserSessions(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user := sessionUser(c, &utilG)
+	if user == nil {
+		return
+	}
+	count, err := loginsession.RevokeUser(user.ID, loginsession.RevokeAdmin)
+	if err != nil {
+		RecordAuditLog(c, "revoke_sessions", "high_risk", "user", user.ID, user.Username,
+			fmt.Sprintf("吊销用户 %s 的所有会话", user.Username), "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "吊销会话失败")
+		return
+	}
+	RecordAuditLog(c, "revoke_sessions", "high_risk", "user", user.ID, user.Username,
+		fmt.Sprintf("吊销用户 %s 的所有会话（%d 个）", user.Username, count), "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, count)
+}
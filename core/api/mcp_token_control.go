@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"binrc.com/roma/core/mcpauth"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type MCPTokenController struct{}
+
+func NewMCPTokenController() *MCPTokenController {
+	return &MCPTokenController{}
+}
+
+// CreateMCPTokenRequest 签发 MCP 令牌的请求
+type CreateMCPTokenRequest struct {
+	Name        string `json:"name"`         // 用途说明，如 "claude-desktop"
+	ExpiresDays int    `json:"expires_days"` // 有效天数，默认使用配置 mcp.token_expire_days
+}
+
+// CreateMCPTokenResponse 明文令牌只在签发时返回这一次
+type CreateMCPTokenResponse struct {
+	Token     string          `json:"token"`
+	MCPToken  *model.MCPToken `json:"mcp_token"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// CreateMyMCPToken 为当前用户签发 MCP 令牌
+// @Summary 签发我的 MCP 令牌
+// @Description MCP 工具以当前用户身份执行，权限与当前用户一致
+// @Tags mcp
+// @Accept json
+// @Produce json
+// @Param request body CreateMCPTokenRequest false "用途和有效天数"
+// @Success 200 {object} utils.Response{data=CreateMCPTokenResponse}
+// @Failure 403 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/mcp-tokens [post]
+func (mc *MCPTokenController) CreateMyMCPToken(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	currentUser := user.(*model.User)
+
+	// API Key 不能签发 MCP 令牌，避免凭证泄露后被用来扩散
+	if requestApikey(c) != nil {
+		utilG.Response(http.StatusForbidden, utils.ERROR, "不能使用 API Key 签发 MCP 令牌")
+		return
+	}
+
+	var req CreateMCPTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req = CreateMCPTokenRequest{}
+	}
+	if req.ExpiresDays <= 0 {
+		req.ExpiresDays = mcpauth.ExpireDays()
+	}
+
+	token, record, err := mcpauth.Issue(currentUser, req.Name, time.Duration(req.ExpiresDays)*24*time.Hour)
+	if err != nil {
+		RecordAuditLog(c, "create_mcp_token", "high_risk", "mcp_token", 0, currentUser.Username, "签发 MCP 令牌", "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "签发MCP令牌失败")
+		return
+	}
+	RecordAuditLog(c, "create_mcp_token", "high_risk", "mcp_token", record.ID, record.Prefix,
+		fmt.Sprintf("签发 MCP 令牌 %s，有效期 %d 天", record.Name, req.ExpiresDays), "success", "")
+
+	utilG.Response(http.StatusOK, utils.SUCCESS, CreateMCPTokenResponse{
+		Token:     token,
+		MCPToken:  record,
+		ExpiresAt: time.Unix(record.ExpiresAt, 0),
+	})
+}
+
+// GetMyMCPTokens 列出当前用户未过期的 MCP 令牌
+// @Summary 我的 MCP 令牌列表
+// @Tags mcp
+// @Produce json
+// @Success 200 {object} utils.Response{data=[]model.MCPToken}
+// @Router /api/v1/users/me/mcp-tokens [get]
+func (mc *MCPTokenController) GetMyMCPTokens(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	tokens, err := mcpauth.List(user.(*model.User).ID)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取MCP令牌列表失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, tokens)
+}
+
+// DeleteMyMCPToken 吊销当前用户的 MCP 令牌
+// @Summary 吊销我的 MCP 令牌
+// @Tags mcp
+// @Produce json
+// @Param id path int true "令牌ID"
+// @Success 200 {object} utils.Response{data=""}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/mcp-tokens/:id [delete]
+func (mc *MCPTokenController) DeleteMyMCPToken(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	currentUser := user.(*model.User)
+
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的令牌ID")
+		return
+	}
+	if err := mcpauth.Revoke(currentUser.ID, uint(tokenID)); err != nil {
+		if errors.Is(err, mcpauth.ErrInvalidToken) {
+			utilG.Response(http.StatusNotFound, utils.ERROR, "MCP令牌未找到")
+			return
+		}
+		RecordAuditLog(c, "delete_mcp_token", "high_risk", "mcp_token", uint(tokenID), "", "吊销 MCP 令牌", "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "吊销MCP令牌失败")
+		return
+	}
+	RecordAuditLog(c, "delete_mcp_token", "high_risk", "mcp_token", uint(tokenID), "", fmt.Sprintf("吊销用户 %s 的 MCP 令牌", currentUser.Username), "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, "MCP令牌已吊销")
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"binrc.com/roma/core/mfa"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type MFAController struct{}
+
+func NewMFAController() *MFAController {
+	return &MFAController{}
+}
+
+// TOTPEnrollResponse 开始绑定 TOTP 的返回
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret"`      // base32 密钥，可手动输入验证器 App
+	URI    string `json:"otpauth_uri"` // otpauth:// 地址，可生成二维码
+}
+
+// TOTPCodeRequest 需要验证码的请求
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"` // 6 位验证码或恢复码
+}
+
+// RecoveryCodesResponse 恢复码（只返回这一次）
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// currentMFAUser 从上下文获取当前用户，未认证时返回 nil 并写入响应
+func currentMFAUser(c *gin.Context, utilG *utils.Gin) *model.User {
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return nil
+	}
+	return user.(*model.User)
+}
+
+// GetMyMFA 获取当前用户的二次验证状态
+// @Summary 获取二次验证状态
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} utils.Response{data=mfa.Status}
+// @Router /api/v1/users/me/mfa [get]
+func (mc *MFAController) GetMyMFA(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	currentUser := currentMFAUser(c, &utilG)
+	if currentUser == nil {
+		return
+	}
+	status, err := mfa.GetStatus(currentUser)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取二次验证状态失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, status)
+}
+
+// EnrollMyTOTP 开始绑定 TOTP，返回密钥和 otpauth 地址，需调用 confirm 接口确认后生效
+// @Summary 开始绑定 TOTP
+// @Tags mfa
+// @Produce json
+// @Success 200 {object} utils.Response{data=TOTPEnrollResponse}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/mfa/totp [post]
+func (mc *MFAController) EnrollMyTOTP(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	currentUser := currentMFAUser(c, &utilG)
+	if currentUser == nil {
+		return
+	}
+	secret, uri, err := mfa.BeginEnrollment(currentUser)
+	if err != nil {
+		if errors.Is(err, mfa.ErrAlreadyEnrolled) {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "已绑定 TOTP，请先重置")
+			return
+		}
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "生成 TOTP 密钥失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, TOTPEnrollResponse{Secret: secret, URI: uri})
+}
+
+// ConfirmMyTOTP 用验证码确认绑定 TOTP，返回恢复码
+// @Summary 确认绑定 TOTP
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body TOTPCodeRequest true "验证码"
+// @Success 200 {object} utils.Response{data=RecoveryCodesResponse}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/mfa/totp/confirm [post]
+func (mc *MFAController) ConfirmMyTOTP(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	currentUser := currentMFAUser(c, &utilG)
+	if currentUser == nil {
+		return
+	}
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "请提供验证码")
+		return
+	}
+
+	codes, err := mfa.ConfirmEnrollment(currentUser, req.Code)
+	if err != nil {
+		RecordAuditLog(c, "mfa_enroll", "high_risk", "user", currentUser.ID, currentUser.Username,
+			"绑定 TOTP 二次验证", "failed", err.Error())
+		switch {
+		case errors.Is(err, mfa.ErrInvalidCode):
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "验证码错误")
+		case errors.Is(err, mfa.ErrNotEnrolled):
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "请先开始绑定 TOTP")
+		case errors.Is(err, mfa.ErrAlreadyEnrolled):
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "已绑定 TOTP")
+		default:
+			utilG.Response(http.StatusInternalServerError, utils.ERROR, "绑定 TOTP 失败")
+		}
+		return
+	}
+
+	RecordAuditLog(c, "mfa_enroll", "high_risk", "user", currentUser.ID, currentUser.Username,
+		"绑定 TOTP 二次验证", "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ResetMyTOTP 解除当前用户的 TOTP 绑定（需要验证码或恢复码）
+// @Summary 重置 TOTP
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body TOTPCodeRequest true "验证码或恢复码"
+// @Success 200 {object} utils.Response{data=""}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/mfa/totp/reset [post]
+func (mc *MFAController) ResetMyTOTP(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	currentUser := currentMFAUser(c, &utilG)
+	if currentUser == nil {
+		return
+	}
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "请提供验证码")
+		return
+	}
+
+	// 未确认的绑定可以直接重置，已启用的需要验证码
+	enabled, err := mfa.IsEnabled(currentUser.ID)
+	if err == nil && enabled {
+		_, err = mfa.Verify(currentUser.ID, req.Code)
+	}
+	if err == nil {
+		err = mfa.Reset(currentUser.ID)
+	}
+	if err != nil {
+		RecordAuditLog(c, "mfa_reset", "high_risk", "user", currentUser.ID, currentUser.Username,
+			"重置 TOTP 二次验证", "failed", err.Error())
+		if errors.Is(err, mfa.ErrInvalidCode) {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "验证码错误")
+			return
+		}
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "重置 TOTP 失败")
+		return
+	}
+
+	RecordAuditLog(c, "mfa_reset", "high_risk", "user", currentUser.ID, currentUser.Username,
+		"重置 TOTP 二次验证", "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, "TOTP 已重置")
+}
+
+// RegenerateMyRecoveryCodes 重新生成恢复码（需要验证码或恢复码），旧恢复码作废
+// @Summary 重新生成恢复码
+// @Tags mfa
+// @Accept json
+// @Produce json
+// @Param request body TOTPCodeRequest true "验证码或恢复码"
+// @Success 200 {object} utils.Response{data=RecoveryCodesResponse}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/users/me/mfa/recovery-codes [post]
+func (mc *MFAController) RegenerateMyRecoveryCodes(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	currentUser := currentMFAUser(c, &utilG)
+	if currentUser == nil {
+		return
+	}
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "请提供验证码")
+		return
+	}
+
+	codes, err := mfa.RegenerateRecoveryCodes(currentUser.ID, req.Code)
+	if err != nil {
+		RecordAuditLog(c, "mfa_recovery_codes", "high_risk", "user", currentUser.ID, currentUser.Username,
+			"重新生成 TOTP 恢复码", "failed", err.Error())
+		switch {
+		case errors.Is(err, mfa.ErrInvalidCode):
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "验证码错误")
+		case errors.Is(err, mfa.ErrNotEnrolled):
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "未绑定 TOTP")
+		default:
+			utilG.Response(http.StatusInternalServerError, utils.ERROR, "生成恢复码失败")
+		}
+		return
+	}
+
+	RecordAuditLog(c, "mfa_recovery_codes", "high_risk", "user", currentUser.ID, currentUser.Username,
+		"重新生成 TOTP 恢复码", "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ResetUserMFA 管理员重置指定用户的 TOTP（用户丢失手机和恢复码时）
+// 需要 user.reset_mfa 权限；不能重置自己的 TOTP，自己解除绑定需通过 ResetMyTOTP 输入验证码
+// @Summary 管理员重置用户 TOTP
+// @Tags mfa
+// @Produce json
+// @Param id path int true "用户ID"
+// @Success 200 {object} utils.Response{data=""}
+// @Failure 403 {object} utils.Response{data=""}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/users/:id/mfa [delete]
+func (mc *MFAController) ResetUserMFA(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的用户ID")
+		return
+	}
+	caller := currentMFAUser(c, &utilG)
+	if caller == nil {
+		return
+	}
+	// 无需验证码的重置只能由他人执行，否则被盗的密码或令牌即可解除二次验证
+	if uint64(caller.ID) == userID {
+		utilG.Response(http.StatusForbidden, utils.ERROR, "不能重置自己的 TOTP，请输入验证码解除绑定")
+		return
+	}
+	user, err := operation.NewUserOperation().GetUserByID(uint(userID))
+	if err != nil || user == nil {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "用户不存在")
+		return
+	}
+
+	if err := mfa.Reset(user.ID); err != nil {
+		RecordAuditLog(c, "mfa_reset", "high_risk", "user", user.ID, user.Username,
+			fmt.Sprintf("管理员重置用户 %s 的 TOTP", user.Username), "failed", err.Error())
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "重置 TOTP 失败")
+		return
+	}
+	RecordAuditLog(c, "mfa_reset", "high_risk", "user", user.ID, user.Username,
+		fmt.Sprintf("管理员重置用户 %s 的 TOTP", user.Username), "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, "TOTP 已重置")
+}
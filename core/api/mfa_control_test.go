@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"binrc.com/roma/core/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestResetUserMFARejectsSelf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	caller := &model.User{ID: 7, Username: "admin"}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "own id", path: fmt.Sprintf("/users/%d/mfa", caller.ID), want: http.StatusForbidden},
+		{name: "invalid id", path: "/users/abc/mfa", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.DELETE("/users/:id/mfa", func(c *gin.Context) { c.Set("user", caller) }, NewMFAController().ResetUserMFA)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("DELETE %s = %d, want %d (%s)", tt.path, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,13 +1,22 @@
 package middleware
 
 import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"binrc.com/roma/core/apikeyauth"
+	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/utils"
 	"github.com/gin-gonic/gin"
 )
 
+// ContextKeyApikey 通过 API Key 认证时，上下文中保存的 *model.Apikey
+const ContextKeyApikey = "apikey"
+
 // ApiKeyAuth API Key 认证中间件
-// 验证 API Key 的有效性，但不进行权限检查
+// 验证 API Key 的有效性并以所属用户身份执行，但不进行权限检查
 func ApiKeyAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		utilG := utils.Gin{C: c}
@@ -20,29 +29,56 @@ func ApiKeyAuth() gin.HandlerFunc {
 				return
 			}
 		}
-		if !isValidApiKey(apiKey) {
+		key, user, err := apikeyauth.Authenticate(apiKey, c.ClientIP())
+		if err != nil {
 			utilG.Response(utils.ERROR, utils.ERROR, "Invalid API key")
 			c.Abort()
 			return
 		}
-		// 将 API Key 存储到上下文，供后续使用
-		c.Set("api_key", apiKey)
+		// 将 API Key 和所属用户存储到上下文，供后续使用
+		c.Set(ContextKeyApikey, key)
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
 		c.Next()
+		recordApikeyRequest(c, key, user)
 	}
 }
 
-func isValidApiKey(apiKey string) bool {
-	op := operation.NewApikeyOperation()
-	exists, err := op.ApiKeyExists(apiKey)
-	if err != nil {
-		return false
+// ApikeyFromContext 获取当前请求使用的 API Key，JWT 认证时返回 nil
+func ApikeyFromContext(c *gin.Context) *model.Apikey {
+	if v, exists := c.Get(ContextKeyApikey); exists {
+		if key, ok := v.(*model.Apikey); ok {
+			return key
+		}
 	}
-	valid, err := op.ApiKeyIsValid(apiKey)
-	if err != nil {
-		return false
+	return nil
+}
+
+// recordApikeyRequest 以所属用户身份记录每一次 API Key 请求
+func recordApikeyRequest(c *gin.Context, key *model.Apikey, user *model.User) {
+	status := "success"
+	errorMessage := ""
+	if c.Writer.Status() >= http.StatusBadRequest {
+		status = "failed"
+		errorMessage = http.StatusText(c.Writer.Status())
 	}
-	if !exists || !valid {
-		return false
+	auditLog := &model.AuditLog{
+		UserID:       user.ID,
+		Username:     user.Username,
+		Action:       "apikey_request",
+		ActionType:   "normal",
+		ResourceType: "apikey",
+		ResourceID:   key.ID,
+		ResourceName: key.KeyPrefix,
+		Description:  fmt.Sprintf("%s %s -> %d", c.Request.Method, c.Request.URL.Path, c.Writer.Status()),
+		IPAddress:    c.ClientIP(),
+		Status:       status,
+		ErrorMessage: errorMessage,
 	}
-	return exists
+	go func() {
+		if err := operation.NewAuditOperation().CreateAuditLog(auditLog); err != nil {
+			log.Printf("ApiKey: 记录审计日志失败: %v", err)
+		}
+	}()
 }
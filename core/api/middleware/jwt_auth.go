@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"binrc.com/roma/core/apikeyauth"
+	"binrc.com/roma/core/loginsession"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/utils"
 	"github.com/gin-gonic/gin"
@@ -25,7 +27,7 @@ func JWTAuth() gin.HandlerFunc {
 		}
 
 		// 解析 JWT token
-		claims, err := utils.ParseJWT(token)
+		claims, err := loginsession.ParseAccessToken(token)
 		if err != nil {
 			utilG.Response(401, utils.ERROR, "无效的认证令牌")
 			c.Abort()
@@ -55,11 +57,15 @@ func JWTAuthOrApiKey() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 先尝试 JWT 认证
 		token := c.GetHeader("Authorization")
+		if token == "" && c.GetHeader("Upgrade") == "websocket" {
+			// 浏览器 WebSocket 无法设置请求头，允许通过 query 传递 token
+			token = c.Query("token")
+		}
 		if token != "" {
 			if len(token) > 7 && token[:7] == "Bearer " {
 				token = token[7:]
 			}
-			claims, err := utils.ParseJWT(token)
+			claims, err := loginsession.ParseAccessToken(token)
 			if err == nil {
 				// JWT 认证成功
 				opUser := operation.NewUserOperation()
@@ -81,35 +87,16 @@ func JWTAuthOrApiKey() gin.HandlerFunc {
 		}
 
 		if apiKey != "" {
-			opKey := operation.NewApikeyOperation()
-			valid, err := opKey.ApiKeyIsValid(apiKey)
-			if err == nil && valid {
-				// API Key 认证成功，使用 GetUserFromContext 的逻辑
-				opUser := operation.NewUserOperation()
-				users, err := opUser.GetAllUsers()
-				if err == nil && len(users) > 0 {
-					// 优先查找 super 角色的用户
-					for _, u := range users {
-						roles, err := opUser.GetUserRoles(u.ID)
-						if err == nil {
-							for _, role := range roles {
-								if role.Name == "super" {
-									c.Set("user", u)
-									c.Set("user_id", u.ID)
-									c.Set("username", u.Username)
-									c.Next()
-									return
-								}
-							}
-						}
-					}
-					// 如果没有 super 用户，返回第一个用户
-					c.Set("user", users[0])
-					c.Set("user_id", users[0].ID)
-					c.Set("username", users[0].Username)
-					c.Next()
-					return
-				}
+			// API Key 认证成功后以所属用户身份执行，权限范围由 RequirePermission 检查
+			key, user, err := apikeyauth.Authenticate(apiKey, c.ClientIP())
+			if err == nil {
+				c.Set("user", user)
+				c.Set("user_id", user.ID)
+				c.Set("username", user.Username)
+				c.Set(ContextKeyApikey, key)
+				c.Next()
+				recordApikeyRequest(c, key, user)
+				return
 			}
 		}
 
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"binrc.com/roma/core/mcpauth"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKeyMCPToken 通过 MCP 令牌认证时，上下文中保存的 *model.MCPToken
+const ContextKeyMCPToken = "mcp_token"
+
+// MCPTokenAuth MCP 令牌认证中间件
+// 只接受 Authorization: Bearer mcp.xxx，以所属用户身份执行；工具的权限检查在 MCP 服务内完成
+func MCPTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		utilG := utils.Gin{C: c}
+
+		token := c.GetHeader("Authorization")
+		if token == "" {
+			c.Header("WWW-Authenticate", "Bearer")
+			utilG.Response(401, utils.ERROR, "未提供MCP令牌")
+			c.Abort()
+			return
+		}
+		if len(token) > 7 && token[:7] == "Bearer " {
+			token = token[7:]
+		}
+
+		user, record, err := mcpauth.Authenticate(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", "Bearer")
+			utilG.Response(401, utils.ERROR, "无效的MCP令牌")
+			c.Abort()
+			return
+		}
+
+		c.Set(ContextKeyMCPToken, record)
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		c.Next()
+	}
+}
+
+// MCPTokenFromContext 获取当前请求使用的 MCP 令牌，其他认证方式返回 nil
+func MCPTokenFromContext(c *gin.Context) *model.MCPToken {
+	if v, exists := c.Get(ContextKeyMCPToken); exists {
+		if token, ok := v.(*model.MCPToken); ok {
+			return token
+		}
+	}
+	return nil
+}
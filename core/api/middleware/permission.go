@@ -11,6 +11,8 @@ import (
 	"strconv"
 	"strings"
 
+	"binrc.com/roma/core/apikeyauth"
+	"binrc.com/roma/core/loginsession"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/permissions"
@@ -86,17 +88,29 @@ func ParsePermissionRule(desc string) []PermissionRule {
 
 // CheckPermission 检查用户是否有权限执行指定操作
 func CheckPermission(user *model.User, target string, opName string, resourceScope string) bool {
+	allowed, _ := CheckPermissionFrom(user, target, opName, resourceScope, "")
+	return allowed
+}
+
+// CheckPermissionFrom 检查来自 clientIP 的请求是否有权限执行指定操作
+// 输出: bool - 是否允许；string - 角色有对应权限但生效条件（时段、来源网段、过期时间）不满足时的原因
+func CheckPermissionFrom(user *model.User, target string, opName string, resourceScope string, clientIP string) (bool, string) {
 	opUser := operation.NewUserOperation()
 	roles, err := opUser.GetUserRoles(user.ID)
 	if err != nil {
 		log.Printf("CheckPermission: 获取用户角色失败 user_id=%d, error=%v", user.ID, err)
-		return false
+		return false, ""
 	}
 
 	target = strings.ToLower(strings.TrimSpace(target))
 	opName = strings.ToLower(strings.TrimSpace(opName))
 	resourceScope = strings.ToLower(strings.TrimSpace(resourceScope))
 
+	// 拒绝规则总是优先，先于 super 角色判断
+	if denied, reason := denyRuleMatched(user, roles, target, opName, resourceScope, clientIP); denied {
+		return false, reason
+	}
+
 	// 检查是否有 super 角色（通过权限描述符判断，不硬编码角色名称）
 	for _, role := range roles {
 		if role == nil {
@@ -104,42 +118,68 @@ func CheckPermission(user *model.User, target string, opName string, resourceSco
 		}
 		if permissions.IsSuperRole(role) {
 			log.Printf("CheckPermission: 用户 %d 拥有 super 角色 %s (id=%d), 允许操作 %s.%s", user.ID, role.Name, role.ID, target, opName)
-			return true
+			return true, ""
 		}
 		// 也检查是否有所有权限的角色
 		if permissions.HasAllPermissions(role) {
 			log.Printf("CheckPermission: 用户 %d 拥有所有权限角色 %s (id=%d), 允许操作 %s.%s", user.ID, role.Name, role.ID, target, opName)
-			return true
+			return true, ""
 		}
 	}
 
 	// 检查每个角色的权限规则
+	reason := ""
 	for _, role := range roles {
 		if role == nil {
 			continue
 		}
 
-		if handled, allowed := evaluateStructuredPermission(role, target, opName, resourceScope); handled {
+		if handled, allowed, why := evaluateStructuredPermission(role, target, opName, resourceScope, clientIP); handled {
 			if allowed {
-				return true
+				return true, ""
+			}
+			if why != "" && reason == "" {
+				reason = fmt.Sprintf("角色 %s 的 %s.%s 权限%s", role.Name, target, opName, why)
 			}
 			continue
 		}
 
 		if legacyHasPermission(role, target, opName, resourceScope) {
-			return true
+			return true, ""
 		}
 	}
 
-	return false
+	return false, reason
+}
+
+// checkDenyRules 只检查用户角色的拒绝规则，用于不需要角色权限的操作（如访问自己的信息）
+// 输出: bool - 是否被拒绝（角色加载失败时也视为拒绝）；string - 拒绝原因
+func checkDenyRules(user *model.User, target, opName, resourceScope, clientIP string) (bool, string) {
+	roles, err := operation.NewUserOperation().GetUserRoles(user.ID)
+	if err != nil {
+		log.Printf("CheckDenyRules: 获取用户角色失败 user_id=%d, error=%v", user.ID, err)
+		return true, ""
+	}
+	return denyRuleMatched(user, roles, strings.ToLower(strings.TrimSpace(target)), strings.ToLower(strings.TrimSpace(opName)),
+		strings.ToLower(strings.TrimSpace(resourceScope)), clientIP)
+}
+
+func denyRuleMatched(user *model.User, roles []*model.Role, target, opName, resourceScope, clientIP string) (bool, string) {
+	d := permissions.EvaluateRoles(roles, target, opName, resourceScope, clientIP)
+	if d.Step != permissions.StepDeny {
+		return false, ""
+	}
+	log.Printf("CheckPermission: 用户 %d 的 %s.%s 被拒绝规则禁止: %s", user.ID, target, opName, d.Rule)
+	return true, d.Reason
 }
 
-func evaluateStructuredPermission(role *model.Role, target, opName, resourceScope string) (bool, bool) {
+func evaluateStructuredPermission(role *model.Role, target, opName, resourceScope, clientIP string) (bool, bool, string) {
 	desc, err := permissions.ParseRoleDescriptor(role.Desc)
 	if err != nil || desc == nil {
-		return false, false
+		return false, false, ""
 	}
-	return true, permissions.HasPermission(desc, target, opName, resourceScope)
+	allowed, reason := permissions.EvaluatePermission(desc, target, opName, resourceScope, clientIP)
+	return true, allowed, reason
 }
 
 func legacyHasPermission(role *model.Role, target, opName, resourceScope string) bool {
@@ -210,7 +250,7 @@ func GetUserFromContext(c *gin.Context) (*model.User, error) {
 		if len(token) > 7 && token[:7] == "Bearer " {
 			token = token[7:]
 		}
-		claims, err := utils.ParseJWT(token)
+		claims, err := loginsession.ParseAccessToken(token)
 		if err == nil {
 			opUser := operation.NewUserOperation()
 			user, err := opUser.GetUserByID(claims.UserID)
@@ -227,34 +267,13 @@ func GetUserFromContext(c *gin.Context) (*model.User, error) {
 	}
 
 	if apiKey != "" {
-		opKey := operation.NewApikeyOperation()
-		// 验证 API Key 是否有效
-		valid, err := opKey.ApiKeyIsValid(apiKey)
-		if err != nil || !valid {
+		key, user, err := apikeyauth.Authenticate(apiKey, c.ClientIP())
+		if err != nil {
 			return nil, fmt.Errorf("invalid API key")
 		}
-
-		// API Key 默认拥有 super 权限
-		// 查找 super 角色的用户作为代表
-		opUser := operation.NewUserOperation()
-		users, err := opUser.GetAllUsers()
-		if err == nil && len(users) > 0 {
-			// 优先查找 super 角色的用户（通过权限描述符判断）
-			for _, u := range users {
-				roles, err := opUser.GetUserRoles(u.ID)
-				if err == nil {
-					for _, role := range roles {
-						if permissions.IsSuperRole(role) {
-							return u, nil
-						}
-					}
-				}
-			}
-			// 如果没有 super 用户，返回第一个用户（临时方案）
-			return users[0], nil
-		}
-
-		return nil, fmt.Errorf("no user found for API key")
+		// 以所属用户身份执行，权限范围由 RequirePermission 检查
+		c.Set(ContextKeyApikey, key)
+		return user, nil
 	}
 
 	return nil, fmt.Errorf("no user found in context")
@@ -273,27 +292,28 @@ func RequirePermission(target string, opName string) gin.HandlerFunc {
 			return
 		}
 
-		// 检查是否是访问自己的信息（/me 或 /me/xxx 路径）
-		// 用户总是可以访问和更新自己的信息
-		path := c.Request.URL.Path
-		if strings.HasSuffix(path, "/me") || strings.Contains(path, "/me/") {
-			// 访问自己的信息，直接允许
-			c.Set("user", user)
-			c.Next()
+		// API Key 只能执行其权限范围内的操作（在所属用户权限的基础上再做限制）
+		apikey := ApikeyFromContext(c)
+		if !apikeyauth.Allows(apikey, target, opName) {
+			apikeyDenied(c, target, opName)
 			return
 		}
 
-		// 检查是否是更新自己的信息（通过 ID 参数判断）
-		if target == "user" && (opName == "get" || opName == "update") {
-			userID := c.Param("id")
-			if userID != "" {
-				// 如果请求的是自己的 ID，允许访问
-				if fmt.Sprintf("%d", user.ID) == userID {
-					c.Set("user", user)
-					c.Next()
-					return
-				}
+		// 访问自己的信息（/me 或 /me/xxx 路径，或 user.get/update 的 ID 是自己）不需要角色权限，
+		// 但拒绝规则仍然优先
+		path := c.Request.URL.Path
+		self := strings.HasSuffix(path, "/me") || strings.Contains(path, "/me/")
+		if target == "user" && (opName == "get" || opName == "update") && c.Param("id") == fmt.Sprintf("%d", user.ID) {
+			self = true
+		}
+		if self {
+			if denied, reason := checkDenyRules(user, target, opName, "", c.ClientIP()); denied {
+				permissionDenied(c, target, opName, reason)
+				return
 			}
+			c.Set("user", user)
+			c.Next()
+			return
 		}
 
 		// 获取资源范围（如果有）
@@ -334,28 +354,22 @@ func RequirePermission(target string, opName string) gin.HandlerFunc {
 				}
 			}
 
+			if !apikeyauth.AllowsResource(apikey, opName, resourceID, resourceType) {
+				apikeyDenied(c, target, opName)
+				return
+			}
+
 			if resourceID > 0 {
-				allowed, reason := permissions.CheckResourceAccess(user, resourceID, resourceType, opName)
+				allowed, reason := permissions.CheckResourceAccessFrom(user, nil, resourceID, resourceType, opName, c.ClientIP())
 				if !allowed {
-					msg := fmt.Sprintf("Permission denied: %s.%s", target, opName)
-					if reason != "" {
-						msg = fmt.Sprintf("%s (%s)", msg, reason)
-					}
-					// 使用 403 作为 HTTP 状态码和 JSON code，确保前端能正确识别权限错误
-					c.JSON(http.StatusForbidden, utils.Response{
-						Code: http.StatusForbidden,
-						Msg:  "Permission denied",
-						Data: msg,
-						URI:  c.Request.RequestURI,
-					})
-					c.Abort()
+					permissionDenied(c, target, opName, reason)
 					return
 				}
 			}
 		}
 
 		// 检查全局角色权限（对于非资源操作或资源列表操作）
-		hasPermission := CheckPermission(user, target, opName, resourceScope)
+		hasPermission, reason := CheckPermissionFrom(user, target, opName, resourceScope, c.ClientIP())
 		if !hasPermission {
 			// 记录详细的权限检查失败信息，便于调试
 			log.Printf("RequirePermission: 权限检查失败 - user_id=%d, username=%s, target=%s, opName=%s, path=%s",
@@ -369,14 +383,7 @@ func RequirePermission(target string, opName string) gin.HandlerFunc {
 			}
 
 			// 权限检查失败，返回 403 Forbidden，并阻止后续 handler 执行
-			// 使用 403 作为 HTTP 状态码和 JSON code，确保前端能正确识别权限错误
-			c.JSON(http.StatusForbidden, utils.Response{
-				Code: http.StatusForbidden,
-				Msg:  "Permission denied",
-				Data: fmt.Sprintf("Permission denied: %s.%s", target, opName),
-				URI:  c.Request.RequestURI,
-			})
-			c.Abort()
+			permissionDenied(c, target, opName, reason)
 			return
 		}
 
@@ -385,3 +392,30 @@ func RequirePermission(target string, opName string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// permissionDenied 返回 403 并阻止后续 handler 执行
+// 使用 403 作为 HTTP 状态码和 JSON code，确保前端能正确识别权限错误
+func permissionDenied(c *gin.Context, target, opName, reason string) {
+	msg := fmt.Sprintf("Permission denied: %s.%s", target, opName)
+	if reason != "" {
+		msg = fmt.Sprintf("%s (%s)", msg, reason)
+	}
+	c.JSON(http.StatusForbidden, utils.Response{
+		Code: http.StatusForbidden,
+		Msg:  "Permission denied",
+		Data: msg,
+		URI:  c.Request.RequestURI,
+	})
+	c.Abort()
+}
+
+// apikeyDenied 操作超出 API Key 的权限范围
+func apikeyDenied(c *gin.Context, target, opName string) {
+	c.JSON(http.StatusForbidden, utils.Response{
+		Code: http.StatusForbidden,
+		Msg:  "Permission denied",
+		Data: fmt.Sprintf("Permission denied: %s.%s (api key scope)", target, opName),
+		URI:  c.Request.RequestURI,
+	})
+	c.Abort()
+}
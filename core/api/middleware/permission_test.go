@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/permissions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupPermissionDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:permission_test?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Role{}); err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevConfig := global.CDB, global.CONFIG
+	global.CDB = db
+	global.CONFIG = &configs.Config{PermissionPolicy: &configs.PermissionPolicyConfig{}}
+	t.Cleanup(func() {
+		global.CDB, global.CONFIG = prevDB, prevConfig
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// userWithRole 创建用户并关联按配置构造的角色
+func userWithRole(t *testing.T, username string, perms ...*configs.RolePermissionConfig) *model.User {
+	t.Helper()
+	desc, err := permissions.BuildRoleDescriptor(&configs.RoleConfig{Name: username + "-role", Permissions: perms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &model.User{Username: username, Name: username, Nickname: username, Email: username + "@example.com",
+		Roles: []model.Role{{Name: username + "-role", Desc: desc}}}
+	if err := global.CDB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestRequirePermissionSelfAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupPermissionDB(t)
+	plain := userWithRole(t, "plain", &configs.RolePermissionConfig{Target: "session", Actions: []string{"list"}})
+	locked := userWithRole(t, "locked", &configs.RolePermissionConfig{Effect: permissions.EffectDeny, Target: "user", Actions: []string{"update"}})
+	other := userWithRole(t, "other")
+	admin := userWithRole(t, "admin", &configs.RolePermissionConfig{Target: "user", Actions: []string{"reset_mfa"}})
+
+	tests := []struct {
+		name   string
+		user   *model.User
+		method string
+		path   string
+		op     string
+		want   int
+	}{
+		{name: "get own profile", user: plain, method: http.MethodGet, path: "/users/me", op: "get", want: http.StatusOK},
+		{name: "update own profile", user: plain, method: http.MethodPut, path: "/users/me", op: "update", want: http.StatusOK},
+		{name: "update own id", user: plain, method: http.MethodPut, path: fmt.Sprintf("/users/%d", plain.ID), op: "update", want: http.StatusOK},
+		{name: "update other id", user: plain, method: http.MethodPut, path: fmt.Sprintf("/users/%d", other.ID), op: "update", want: http.StatusForbidden},
+		{name: "deny rule on own profile", user: locked, method: http.MethodPut, path: "/users/me", op: "update", want: http.StatusForbidden},
+		{name: "deny rule on own id", user: locked, method: http.MethodPut, path: fmt.Sprintf("/users/%d", locked.ID), op: "update", want: http.StatusForbidden},
+		{name: "deny rule leaves get alone", user: locked, method: http.MethodGet, path: "/users/me", op: "get", want: http.StatusOK},
+		// 重置 TOTP 不走访问自己信息的捷径
+		{name: "reset own mfa without permission", user: plain, method: http.MethodDelete, path: fmt.Sprintf("/users/%d/mfa", plain.ID), op: "reset_mfa", want: http.StatusForbidden},
+		{name: "reset other mfa without permission", user: plain, method: http.MethodDelete, path: fmt.Sprintf("/users/%d/mfa", other.ID), op: "reset_mfa", want: http.StatusForbidden},
+		{name: "reset other mfa as admin", user: admin, method: http.MethodDelete, path: fmt.Sprintf("/users/%d/mfa", other.ID), op: "reset_mfa", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			setUser := func(c *gin.Context) { c.Set("user", tt.user) }
+			ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+			r.Handle(tt.method, "/users/me", setUser, RequirePermission("user", tt.op), ok)
+			r.Handle(tt.method, "/users/:id", setUser, RequirePermission("user", tt.op), ok)
+			r.Handle(tt.method, "/users/:id/mfa", setUser, RequirePermission("user", tt.op), ok)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("%s %s as %s = %d, want %d (%s)", tt.method, tt.path, tt.user.Username, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
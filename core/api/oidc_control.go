@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"binrc.com/roma/core/oidcauth"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStatePath state cookie 的作用路径，登录和回调都在其下
+const oidcStatePath = "/api/v1/auth/oidc"
+
+// OIDCLogin 跳转到身份提供方登录（授权码 + PKCE）
+// @Summary OIDC 单点登录
+// @Tags auth
+// @Success 302
+// @Failure 404 {object} utils.Response{data=""}
+// @Failure 503 {object} utils.Response{data=""}
+// @Router /api/v1/auth/oidc/login [get]
+func (ac *AuthController) OIDCLogin(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	if !oidcauth.Enabled() {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "未启用单点登录")
+		return
+	}
+	authURL, state, err := oidcauth.Begin(c.Request.Context())
+	if err != nil {
+		log.Printf("OIDC: 发起登录失败: %v", err)
+		if errors.Is(err, oidcauth.ErrTooManyLogins) {
+			utilG.Response(http.StatusServiceUnavailable, utils.ERROR, "登录请求过多，请稍后重试")
+			return
+		}
+		utilG.Response(http.StatusBadGateway, utils.ERROR, "连接身份提供方失败")
+		return
+	}
+	// 回调是从身份提供方跳转回来的顶级 GET 请求，SameSite=Lax 时 cookie 仍会发送
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcauth.StateCookie, state, int(oidcauth.PendingTTL.Seconds()), oidcStatePath, "", oidcauth.SecureCookie(), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback 身份提供方回调：校验 id_token，创建用户并签发与密码登录相同的 JWT
+// 配置了 frontend_url 时跳转到前端，结果放在 URL fragment 中；否则返回 JSON
+// @Summary OIDC 登录回调
+// @Tags auth
+// @Produce json
+// @Param code query string true "授权码"
+// @Param state query string true "state"
+// @Success 200 {object} utils.Response{data=LoginResponse}
+// @Success 302
+// @Failure 401 {object} utils.Response{data=""}
+// @Router /api/v1/auth/oidc/callback [get]
+func (ac *AuthController) OIDCCallback(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	if !oidcauth.Enabled() {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "未启用单点登录")
+		return
+	}
+	if idpErr := c.Query("error"); idpErr != "" {
+		ac.oidcFail(c, http.StatusUnauthorized, "身份提供方拒绝登录: "+idpErr)
+		return
+	}
+
+	cookieState, _ := c.Cookie(oidcauth.StateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcauth.StateCookie, "", -1, oidcStatePath, "", oidcauth.SecureCookie(), true)
+
+	claims, err := oidcauth.Complete(c.Request.Context(), c.Query("state"), cookieState, c.Query("code"))
+	if err != nil {
+		log.Printf("OIDC: 回调校验失败: %v", err)
+		if errors.Is(err, oidcauth.ErrInvalidState) || errors.Is(err, oidcauth.ErrStateMismatch) {
+			ac.oidcFail(c, http.StatusUnauthorized, "登录已过期，请重新登录")
+			return
+		}
+		ac.oidcFail(c, http.StatusUnauthorized, "单点登录校验失败")
+		return
+	}
+	user, err := oidcauth.ProvisionUser(claims)
+	if err != nil {
+		log.Printf("OIDC: 同步用户失败: %v", err)
+		switch {
+		case errors.Is(err, oidcauth.ErrNoRoles):
+			ac.oidcFail(c, http.StatusForbidden, "没有可用的角色")
+		case errors.Is(err, oidcauth.ErrUserConflict), errors.Is(err, oidcauth.ErrUserDisabled):
+			ac.oidcFail(c, http.StatusForbidden, "用户已存在或已被禁用")
+		default:
+			ac.oidcFail(c, http.StatusUnauthorized, "单点登录失败")
+		}
+		return
+	}
+
+	response, err := ac.loginResult(c, user)
+	if err != nil {
+		ac.oidcFail(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	frontend := oidcauth.FrontendURL()
+	if frontend == "" {
+		utilG.Response(http.StatusOK, utils.SUCCESS, response)
+		return
+	}
+	fragment := url.Values{}
+	if response.MFARequired {
+		fragment.Set("mfa_required", "true")
+		fragment.Set("mfa_token", response.MFAToken)
+	} else {
+		fragment.Set("token", response.Token)
+		fragment.Set("refresh_token", response.RefreshToken)
+		fragment.Set("expires_in", strconv.FormatInt(response.ExpiresIn, 10))
+		if response.MFAEnrollmentRequired {
+			fragment.Set("mfa_enrollment_required", "true")
+		}
+	}
+	c.Redirect(http.StatusFound, withFragment(frontend, fragment))
+}
+
+// oidcFail 回调失败：有前端地址时带 error 跳转，否则返回 JSON
+func (ac *AuthController) oidcFail(c *gin.Context, status int, msg string) {
+	frontend := oidcauth.FrontendURL()
+	if frontend == "" {
+		utilG := utils.Gin{C: c}
+		utilG.Response(status, utils.ERROR, msg)
+		return
+	}
+	c.Redirect(http.StatusFound, withFragment(frontend, url.Values{"error": {msg}}))
+}
+
+// withFragment 令牌放在 fragment 中，不会出现在服务端访问日志和 Referer 中
+func withFragment(base string, values url.Values) string {
+	if i := strings.Index(base, "#"); i >= 0 {
+		base = base[:i]
+	}
+	return base + "#" + values.Encode()
+}
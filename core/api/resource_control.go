@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"binrc.com/roma/core/apikeyauth"
 	"binrc.com/roma/core/constants"
 	"binrc.com/roma/core/global"
 	"binrc.com/roma/core/model"
@@ -29,11 +30,16 @@ func (r *ResourceControl) AddResource(c *gin.Context) {
 		Data    []json.RawMessage `json:"data"`     // 使用 json.RawMessage 保存未解码的 JSON 字符串
 		Role    string            `json:"role"`     // 可选的角色名称
 		SpaceID *uint             `json:"space_id"` // 可选的空间ID
+		Tags    map[string]string `json:"tags"`     // 可选的资源标签，如 {"env": "staging"}
 	}
 	if err := c.ShouldBindJSON(&resourceData); err != nil {
 		utilG.Response(utils.ERROR, utils.ERROR, err.Error())
 		return
 	}
+	if err := validateResourceTags(resourceData.Tags); err != nil {
+		utilG.Response(utils.ERROR, utils.ERROR, err.Error())
+		return
+	}
 	// 检查 role 参数是否为空，如果为空，则设置默认值为 "ops"
 	roleName := "ops"
 	if resourceData.Role != "" {
@@ -51,6 +57,7 @@ func (r *ResourceControl) AddResource(c *gin.Context) {
 	opRes := operation.NewResourceOperation()
 	opRole := operation.NewRoleOperation()
 	opSpace := operation.NewSpaceOperation()
+	opTag := operation.NewTagOperation()
 
 	// 确定要使用的空间ID
 	var targetSpaceID uint
@@ -136,6 +143,18 @@ func (r *ResourceControl) AddResource(c *gin.Context) {
 			tx.Rollback() // 回滚事务
 			continue
 		}
+
+		// 设置资源标签
+		if len(resourceData.Tags) > 0 {
+			if err := opTag.SetResourceTags(resModel.GetID(), resourceData.Type, resourceData.Tags); err != nil {
+				errMsg := fmt.Sprintf("资源标签设置失败:原因.%s 数据No.%d", err.Error(), id)
+				failedMsgs = append(failedMsgs, errMsg)
+				log.Println(errMsg) // 记录错误到日志
+				failedCount++
+				tx.Rollback() // 回滚事务
+				continue
+			}
+		}
 	}
 
 	if failedCount > 0 {
@@ -156,11 +175,16 @@ func (r *ResourceControl) UpdateResource(c *gin.Context) {
 		Data    []json.RawMessage `json:"data"`     // 使用 json.RawMessage 保存未解码的 JSON 字符串
 		Role    string            `json:"role"`     // 可选的角色名称
 		SpaceID *uint             `json:"space_id"` // 可选的空间ID
+		Tags    map[string]string `json:"tags"`     // 可选的资源标签，不传时保持不变，传 {} 时清除
 	}
 	if err := c.ShouldBindJSON(&resourceData); err != nil {
 		utilG.Response(utils.ERROR, utils.ERROR, err.Error())
 		return
 	}
+	if err := validateResourceTags(resourceData.Tags); err != nil {
+		utilG.Response(utils.ERROR, utils.ERROR, err.Error())
+		return
+	}
 	// 开启事务
 	tx := global.GetDB().Begin()
 	if tx.Error != nil {
@@ -173,6 +197,7 @@ func (r *ResourceControl) UpdateResource(c *gin.Context) {
 	opRes := operation.NewResourceOperation()
 	opRole := operation.NewRoleOperation()
 	opSpace := operation.NewSpaceOperation()
+	opTag := operation.NewTagOperation()
 
 	for id, r := range resourceData.Data {
 		var resModel model.Resource
@@ -253,7 +278,18 @@ func (r *ResourceControl) UpdateResource(c *gin.Context) {
 				continue
 			}
 		}
-		// 如果没有提供角色信息，则保持现有关联不变
+		// 如果提供了标签，替换资源的全部标签
+		if resourceData.Tags != nil {
+			if err := opTag.SetResourceTags(resModel.GetID(), resourceData.Type, resourceData.Tags); err != nil {
+				errMsg := fmt.Sprintf("资源标签设置失败:原因.%s 数据No.%d", err.Error(), id)
+				failedMsgs = append(failedMsgs, errMsg)
+				log.Println(errMsg) // 记录错误到日志
+				failedCount++
+				tx.Rollback() // 回滚事务
+				continue
+			}
+		}
+		// 如果没有提供角色、空间或标签信息，则保持现有关联不变
 	}
 
 	if failedCount > 0 {
@@ -267,6 +303,16 @@ func (r *ResourceControl) UpdateResource(c *gin.Context) {
 	utilG.Response(utils.SUCCESS, utils.SUCCESS, "资源更新成功")
 }
 
+// validateResourceTags 校验资源标签，标签键不能为空，也不能包含 "="（角色资源范围用 key=value 选择标签）
+func validateResourceTags(tags map[string]string) error {
+	for key := range tags {
+		if strings.TrimSpace(key) == "" || strings.Contains(key, "=") {
+			return fmt.Errorf("无效的标签键 %q", key)
+		}
+	}
+	return nil
+}
+
 func (r *ResourceControl) DeleteResource(c *gin.Context) {
 	utilG := utils.Gin{C: c}
 	var resourceData struct {
@@ -366,6 +412,7 @@ func (r *ResourceControl) GetAllResource(c *gin.Context) {
 		return
 	}
 
+	apikey := requestApikey(c)
 	opRes := operation.NewResourceOperation()
 	opUser := operation.NewUserOperation()
 
@@ -385,6 +432,9 @@ func (r *ResourceControl) GetAllResource(c *gin.Context) {
 		}
 	}
 
+	// 配置了拒绝规则时不跳过逐个资源的检查，保证拒绝规则总是生效
+	hasDenyRules := permissions.HasDenyRules(roles)
+
 	var resList []model.Resource
 
 	if isSuperOrSystem {
@@ -456,6 +506,20 @@ func (r *ResourceControl) GetAllResource(c *gin.Context) {
 				}
 			}
 		}
+		// 角色资源范围（标签、空间、名称、类型）选中的资源，权限检查和去重在下面统一进行
+		for _, resType := range []string{
+			constants.ResourceTypeLinux,
+			constants.ResourceTypeWindows,
+			constants.ResourceTypeDocker,
+			constants.ResourceTypeDatabase,
+			constants.ResourceTypeRouter,
+			constants.ResourceTypeSwitch,
+		} {
+			if resourceType != "" && resType != resourceType {
+				continue
+			}
+			resList = append(resList, permissions.ScopedResources(roles, resType, nil)...)
+		}
 	}
 
 	// 去重（基于资源 ID 和类型）并过滤已删除的资源，同时进行权限检查
@@ -493,18 +557,23 @@ func (r *ResourceControl) GetAllResource(c *gin.Context) {
 		// 对于 super/system 角色，如果配置允许绕过，则跳过检查
 		policy := global.CONFIG.PermissionPolicy
 		skipCheck := false
-		if policy != nil && policy.SuperBypassAll && isSuperOrSystem {
+		if policy != nil && policy.SuperBypassAll && isSuperOrSystem && !hasDenyRules {
 			skipCheck = true
 		}
 
 		if !skipCheck {
 			// 传入已获取的用户角色，避免重复查询
-			allowed, _ := permissions.CheckResourceAccessWithRoles(user, roles, res.GetID(), resType, "list")
+			allowed, _ := permissions.CheckResourceAccessFrom(user, roles, res.GetID(), resType, "list", c.ClientIP())
 			if !allowed {
 				continue
 			}
 		}
 
+		// API Key 限定了空间时只返回该空间的资源
+		if !apikeyauth.AllowsResource(apikey, "list", res.GetID(), resType) {
+			continue
+		}
+
 		// 使用资源名称和 ID 作为唯一键
 		key := fmt.Sprintf("%s-%d", res.GetName(), res.GetID())
 		uniqueResources[key] = res
@@ -744,9 +813,9 @@ func (r *ResourceControl) GetResourceByID(c *gin.Context) {
 		return
 	}
 
-	// 检查用户是否有权限访问该资源（使用多维度权限检查）
-	if !isSuperOrSystem {
-		allowed, reason := permissions.CheckResourceAccessWithRoles(user, roles, resource.GetID(), resourceType, "get")
+	// 检查用户是否有权限访问该资源（使用多维度权限检查），配置了拒绝规则时 super 角色也要检查
+	if !isSuperOrSystem || permissions.HasDenyRules(roles) {
+		allowed, reason := permissions.CheckResourceAccessFrom(user, roles, resource.GetID(), resourceType, "get", c.ClientIP())
 		if !allowed {
 			utilG.Response(utils.ERROR, utils.ERROR, "Permission denied: "+reason)
 			return
@@ -788,6 +857,9 @@ func (r *ResourceControl) GetResourceByID(c *gin.Context) {
 	if space != nil {
 		response["space"] = space
 	}
+	if tags, err := operation.NewTagOperation().GetResourceTags(idInt, resourceType); err == nil && len(tags) > 0 {
+		response["tags"] = tags
+	}
 
 	utilG.Response(utils.SUCCESS, utils.SUCCESS, response)
 }
@@ -3,9 +3,11 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
 	"binrc.com/roma/core/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -102,3 +104,59 @@ func (rc *RoleController) DeleteRoleByID(c *gin.Context) {
 	}
 	utilG.Response(http.StatusOK, utils.SUCCESS, "角色删除成功")
 }
+
+// ExplainAccess 用途: 解释某个用户的一次权限判定，返回结论、决定结果的步骤与规则以及每一步的过程
+// 输入: c - Gin 上下文，查询参数 user_id（默认当前用户）、action、resource_id 与 type（检查具体资源）或 target（检查全局操作）、ip（模拟来源地址）
+// 输出: 无（统一通过 utilG 返回 permissions.Decision）
+// 必要性: 拒绝规则、资源角色、空间隔离与 super 绕过叠加后难以推断结果，需要能直接看到判定过程
+func (rc *RoleController) ExplainAccess(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	currentUser, ok := c.Get("user")
+	if !ok {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未登录")
+		return
+	}
+	user := currentUser.(*model.User)
+	if raw := c.Query("user_id"); raw != "" {
+		userID, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的用户ID")
+			return
+		}
+		if user, err = operation.NewUserOperation().GetUserByID(uint(userID)); err != nil {
+			utilG.Response(http.StatusNotFound, utils.ERROR, "用户未找到")
+			return
+		}
+	}
+
+	action := strings.ToLower(strings.TrimSpace(c.Query("action")))
+	if action == "" {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "action 不能为空")
+		return
+	}
+	clientIP := c.DefaultQuery("ip", c.ClientIP())
+
+	roles, err := operation.NewUserOperation().GetUserRoles(user.ID)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "无法获取用户角色")
+		return
+	}
+
+	var decision *permissions.Decision
+	if raw := c.Query("resource_id"); raw != "" {
+		resourceID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || c.Query("type") == "" {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "需要有效的 resource_id 和 type")
+			return
+		}
+		decision = permissions.EvaluateResourceAccess(user, roles, resourceID, c.Query("type"), action, clientIP)
+	} else {
+		target := strings.TrimSpace(c.Query("target"))
+		if target == "" {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "需要 resource_id 和 type，或 target")
+			return
+		}
+		decision = permissions.EvaluateRoles(roles, target, action, "", clientIP)
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, decision)
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"binrc.com/roma/core/cmdpolicy"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/sshd"
+	"binrc.com/roma/core/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type SessionController struct{}
+
+func NewSessionController() *SessionController {
+	return &SessionController{}
+}
+
+// shadowUpgrader 旁观会话使用的 WebSocket 升级器
+// 认证通过 token/apikey 完成而非 Cookie，因此不限制 Origin
+var shadowUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 32 * 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// GetActiveSessions 获取当前所有活动会话
+// @Summary 获取活动会话列表
+// @Description 列出所有正在代理中的终端会话（用户、资源、来源IP、开始时间、流量）
+// @Tags sessions
+// @Produce json
+// @Success 200 {object} utils.Response{data=[]sshd.ActiveSessionInfo}
+// @Router /api/v1/sessions/active [get]
+func (sc *SessionController) GetActiveSessions(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	sessions := sshd.ListActiveSessions()
+	utilG.Response(http.StatusOK, utils.SUCCESS, gin.H{
+		"list":  sessions,
+		"total": len(sessions),
+	})
+}
+
+// GetActiveSession 获取单个活动会话
+// @Summary 获取活动会话详情
+// @Tags sessions
+// @Produce json
+// @Param id path string true "会话ID"
+// @Success 200 {object} utils.Response{data=sshd.ActiveSessionInfo}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/sessions/active/:id [get]
+func (sc *SessionController) GetActiveSession(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	live, err := sshd.GetActiveSession(c.Param("id"))
+	if err != nil {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "会话不存在或已结束")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, live.Info())
+}
+
+// ShadowSession 通过 WebSocket 只读旁观活动会话
+// @Summary 旁观活动会话
+// @Description 升级为 WebSocket，以二进制消息推送会话终端输出，客户端发送的消息会被忽略
+// @Tags sessions
+// @Param id path string true "会话ID"
+// @Router /api/v1/sessions/active/:id/shadow [get]
+func (sc *SessionController) ShadowSession(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	live, err := sshd.GetActiveSession(c.Param("id"))
+	if err != nil {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "会话不存在或已结束")
+		return
+	}
+	if !live.Watchable() {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "只能旁观终端会话")
+		return
+	}
+
+	conn, err := shadowUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失败时已写回 HTTP 错误
+		return
+	}
+	defer conn.Close()
+
+	info := live.Info()
+	RecordAuditLog(c, "shadow_session", "high_risk", info.ResourceType, info.ResourceID, info.ResourceName,
+		fmt.Sprintf("旁观会话 %s（用户: %s, 上游: %s）", info.ID, info.Username, info.Host), "success", "")
+
+	output, cancel := live.Shadow()
+	defer cancel()
+
+	// 只读：丢弃客户端发来的消息，仅用于感知连接关闭
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case data, ok := <-output:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"), time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// KillSession 强制结束活动会话
+// @Summary 强制结束活动会话
+// @Description 关闭客户端和上游通道，并记录审计日志
+// @Tags sessions
+// @Produce json
+// @Param id path string true "会话ID"
+// @Param reason query string false "结束原因（会显示给会话用户）"
+// @Success 200 {object} utils.Response{data=sshd.ActiveSessionInfo}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/sessions/active/:id [delete]
+func (sc *SessionController) KillSession(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	id := c.Param("id")
+	reason := c.Query("reason")
+
+	info, err := sshd.KillActiveSession(id, reason)
+	if err != nil {
+		RecordAuditLog(c, "kill_session", "high_risk", "session", 0, id,
+			fmt.Sprintf("强制结束会话 %s", id), "failed", err.Error())
+		utilG.Response(http.StatusNotFound, utils.ERROR, "会话不存在或已结束")
+		return
+	}
+
+	RecordAuditLog(c, "kill_session", "high_risk", info.ResourceType, info.ResourceID, info.ResourceName,
+		fmt.Sprintf("强制结束会话 %s（用户: %s, 来源: %s, 上游: %s, 原因: %s）", info.ID, info.Username, info.ClientIP, info.Host, reason),
+		"success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, info)
+}
+
+// GetPendingCommands 获取等待第二审批人的命令
+// @Summary 待审批命令列表
+// @Description 列出命中 approve 命令策略、正在等待审批的命令
+// @Tags sessions
+// @Produce json
+// @Success 200 {object} utils.Response{data=[]cmdpolicy.PendingCommandInfo}
+// @Router /api/v1/sessions/commands/pending [get]
+func (sc *SessionController) GetPendingCommands(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	commands := cmdpolicy.ListPending()
+	utilG.Response(http.StatusOK, utils.SUCCESS, gin.H{
+		"list":  commands,
+		"total": len(commands),
+	})
+}
+
+// ApproveCommand 批准等待审批的命令
+// @Summary 批准命令
+// @Description 不能批准自己提交的命令，批准后命令立即在原会话中执行
+// @Tags sessions
+// @Produce json
+// @Param id path string true "审批编号"
+// @Success 200 {object} utils.Response{data=cmdpolicy.PendingCommandInfo}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/sessions/commands/:id/approve [post]
+func (sc *SessionController) ApproveCommand(c *gin.Context) {
+	sc.decideCommand(c, true)
+}
+
+// RejectCommand 拒绝等待审批的命令
+// @Summary 拒绝命令
+// @Tags sessions
+// @Produce json
+// @Param id path string true "审批编号"
+// @Success 200 {object} utils.Response{data=cmdpolicy.PendingCommandInfo}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/sessions/commands/:id/reject [post]
+func (sc *SessionController) RejectCommand(c *gin.Context) {
+	sc.decideCommand(c, false)
+}
+
+func (sc *SessionController) decideCommand(c *gin.Context, approve bool) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	info, err := cmdpolicy.Decide(user.(*model.User).Username, c.Param("id"), approve, c.ClientIP())
+	switch {
+	case err == nil:
+		utilG.Response(http.StatusOK, utils.SUCCESS, info)
+	case errors.Is(err, cmdpolicy.ErrPendingNotFound):
+		utilG.Response(http.StatusNotFound, utils.ERROR, "命令不存在或已不在等待审批")
+	case errors.Is(err, cmdpolicy.ErrNotApprover), errors.Is(err, cmdpolicy.ErrSelfApproval):
+		utilG.Response(http.StatusForbidden, utils.ERROR, err.Error())
+	default:
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "处理命令审批失败")
+	}
+}
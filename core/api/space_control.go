@@ -56,24 +56,8 @@ func (sc *SpaceController) CreateSpace(c *gin.Context) {
 		return
 	}
 
-	hasPermission := false
-	for _, role := range roles {
-		if role != nil {
-			// 检查是否是 super 角色或拥有所有权限的角色
-			if permissions.IsSuperRole(role) || permissions.HasAllPermissions(role) {
-				hasPermission = true
-				break
-			}
-			// 检查是否有 user.add 权限（用于创建空间）
-			desc, err := permissions.ParseRoleDescriptor(role.Desc)
-			if err == nil && desc != nil {
-				if permissions.HasPermission(desc, "user", "add", "") {
-					hasPermission = true
-					break
-				}
-			}
-		}
-	}
+	// 检查是否有 user.add 权限（用于创建空间），拒绝规则优先，super 角色和拥有所有权限的角色直接通过
+	hasPermission, _ := permissions.CheckRolesPermission(roles, "user", "add", c.ClientIP())
 
 	if !hasPermission {
 		utilG.Response(http.StatusForbidden, utils.ERROR, "需要管理员权限才能创建空间")
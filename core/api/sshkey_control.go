@@ -1,8 +1,13 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
@@ -19,8 +24,9 @@ func NewSSHKeyController() *SSHKeyController {
 }
 
 type SSHKeyResponse struct {
-	PublicKey  string `json:"public_key"`  // SSH 公钥
-	PrivateKey string `json:"private_key"` // SSH 私钥（仅创建时返回）
+	PublicKey  string              `json:"public_key"`     // SSH 公钥
+	PrivateKey string              `json:"private_key"`    // SSH 私钥（仅创建时返回）
+	Keys       []*model.UserSSHKey `json:"keys,omitempty"` // 额外添加的多把公钥（user_ssh_keys）
 }
 
 // GetMySSHKey 获取当前用户的 SSH 公钥
@@ -36,11 +42,18 @@ func (sc *SSHKeyController) GetMySSHKey(c *gin.Context) {
 
 	currentUser := user.(*model.User)
 
+	keys, err := operation.NewUserSSHKeyOperation().ListUserSSHKeys(currentUser.ID)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取 SSH 公钥列表失败")
+		return
+	}
+
 	// 如果用户没有公钥，返回空
 	if currentUser.PublicKey == "" {
 		utilG.Response(http.StatusOK, utils.SUCCESS, SSHKeyResponse{
 			PublicKey:  "",
 			PrivateKey: "",
+			Keys:       keys,
 		})
 		return
 	}
@@ -51,6 +64,7 @@ func (sc *SSHKeyController) GetMySSHKey(c *gin.Context) {
 	utilG.Response(http.StatusOK, utils.SUCCESS, SSHKeyResponse{
 		PublicKey:  maskedPublicKey,
 		PrivateKey: "", // 不返回私钥
+		Keys:       keys,
 	})
 }
 
@@ -171,3 +185,145 @@ func (sc *SSHKeyController) GenerateSSHKey(c *gin.Context) {
 		PrivateKey: string(privateKeyBytes), // 返回原始 PEM 格式的私钥
 	})
 }
+
+// ListMySSHKeys 获取当前用户的所有 SSH 公钥
+// @Summary 获取我的 SSH 公钥列表
+// @Tags ssh_keys
+// @Produce json
+// @Success 200 {object} utils.Response{data=[]model.UserSSHKey}
+// @Router /api/v1/ssh-keys/me/keys [get]
+func (sc *SSHKeyController) ListMySSHKeys(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	currentUser := user.(*model.User)
+
+	keys, err := operation.NewUserSSHKeyOperation().ListUserSSHKeys(currentUser.ID)
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取 SSH 公钥列表失败")
+		return
+	}
+	utilG.Response(http.StatusOK, utils.SUCCESS, gin.H{
+		"list":  keys,
+		"total": len(keys),
+	})
+}
+
+type AddSSHKeyRequest struct {
+	Label     string     `json:"label"`                         // 标签，例如 laptop、ci-runner
+	PublicKey string     `json:"public_key" binding:"required"` // SSH 公钥（authorized_keys 格式）
+	SourceIPs []string   `json:"source_ips"`                    // 允许登录的来源 IP/CIDR，为空表示不限制
+	ExpiresAt *time.Time `json:"expires_at"`                    // 过期时间（RFC3339），为空表示永不过期
+}
+
+// AddMySSHKey 为当前用户添加一把 SSH 公钥
+// @Summary 添加 SSH 公钥
+// @Tags ssh_keys
+// @Accept json
+// @Produce json
+// @Param request body AddSSHKeyRequest true "公钥信息"
+// @Success 200 {object} utils.Response{data=model.UserSSHKey}
+// @Failure 400 {object} utils.Response{data=""}
+// @Router /api/v1/ssh-keys/me/keys [post]
+func (sc *SSHKeyController) AddMySSHKey(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	currentUser := user.(*model.User)
+
+	var req AddSSHKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "请提供公钥")
+		return
+	}
+
+	publicKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(req.PublicKey)))
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "公钥格式无效")
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "过期时间必须晚于当前时间")
+		return
+	}
+	sourceIPs := make([]string, 0, len(req.SourceIPs))
+	for _, entry := range req.SourceIPs {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的来源 IP: "+entry)
+			return
+		}
+		sourceIPs = append(sourceIPs, entry)
+	}
+	label := strings.TrimSpace(req.Label)
+	if label == "" {
+		label = comment
+	}
+
+	key := &model.UserSSHKey{
+		UserID:      currentUser.ID,
+		Label:       label,
+		KeyType:     publicKey.Type(),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))),
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		SourceIPs:   strings.Join(sourceIPs, ","),
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if _, err := operation.NewUserSSHKeyOperation().CreateUserSSHKey(key); err != nil {
+		RecordAuditLog(c, "ssh_key_add", "normal", "user", currentUser.ID, currentUser.Username,
+			fmt.Sprintf("添加 SSH 公钥 %s (%s)", label, key.Fingerprint), "failed", err.Error())
+		if errors.Is(err, operation.ErrSSHKeyExists) {
+			utilG.Response(http.StatusBadRequest, utils.ERROR, "该公钥已添加")
+			return
+		}
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "添加 SSH 公钥失败")
+		return
+	}
+
+	RecordAuditLog(c, "ssh_key_add", "normal", "user", currentUser.ID, currentUser.Username,
+		fmt.Sprintf("添加 SSH 公钥 %s (%s)", label, key.Fingerprint), "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, key)
+}
+
+// RevokeMySSHKey 吊销当前用户的一把 SSH 公钥
+// @Summary 吊销 SSH 公钥
+// @Tags ssh_keys
+// @Produce json
+// @Param id path int true "公钥ID"
+// @Success 200 {object} utils.Response{data=""}
+// @Failure 404 {object} utils.Response{data=""}
+// @Router /api/v1/ssh-keys/me/keys/:id [delete]
+func (sc *SSHKeyController) RevokeMySSHKey(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+	user, exists := c.Get("user")
+	if !exists {
+		utilG.Response(http.StatusUnauthorized, utils.ERROR, "未认证")
+		return
+	}
+	currentUser := user.(*model.User)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utilG.Response(http.StatusBadRequest, utils.ERROR, "无效的公钥ID")
+		return
+	}
+
+	key, err := operation.NewUserSSHKeyOperation().RevokeUserSSHKey(currentUser.ID, uint(id))
+	if err != nil {
+		utilG.Response(http.StatusNotFound, utils.ERROR, "公钥不存在")
+		return
+	}
+
+	RecordAuditLog(c, "ssh_key_revoke", "normal", "user", currentUser.ID, currentUser.Username,
+		fmt.Sprintf("吊销 SSH 公钥 %s (%s)", key.Label, key.Fingerprint), "success", "")
+	utilG.Response(http.StatusOK, utils.SUCCESS, "SSH 公钥已吊销")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	"binrc.com/roma/core/global"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/pkg/k8s"
+	"binrc.com/roma/core/usercert"
 	"binrc.com/roma/core/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -138,3 +140,20 @@ func (s *SystemController) GetHealth(c *gin.Context) {
 		"time":   time.Now().Format("2006-01-02 15:04:05"),
 	})
 }
+
+// GetSSHCAPublicKey 获取内置 SSH CA 公钥
+// 上游主机将其写入 sshd 的 TrustedUserCAKeys 后，即可接受 ROMA 签发的短期证书
+func (s *SystemController) GetSSHCAPublicKey(c *gin.Context) {
+	utilG := utils.Gin{C: c}
+
+	publicKey, err := usercert.CAPublicKey()
+	if err != nil {
+		utilG.Response(http.StatusInternalServerError, utils.ERROR, "获取 SSH CA 公钥失败: "+err.Error())
+		return
+	}
+	utilG.Response(utils.SUCCESS, utils.SUCCESS, map[string]interface{}{
+		"public_key":       publicKey,
+		"enabled":          usercert.CAEnabled(),
+		"validity_minutes": int(usercert.CertValidity().Minutes()),
+	})
+}
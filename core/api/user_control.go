@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"binrc.com/roma/core/loginsession"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/utils"
@@ -215,7 +216,7 @@ func (uc *UserController) DeleteUserByID(c *gin.Context) {
 		username = user.Username
 	}
 
-	err = opUser.DisabledUser(userID)
+	err = opUser.DisabledUser(userID, model.UserDisabledByAdmin)
 	if err != nil {
 		RecordAuditLog(c, "delete_user", "high_risk", "user", uint(userID), username,
 			fmt.Sprintf("删除用户失败: %s", err.Error()), "failed", err.Error())
@@ -223,6 +224,11 @@ func (uc *UserController) DeleteUserByID(c *gin.Context) {
 		return
 	}
 
+	// 已签发的令牌立即失效
+	if _, err := loginsession.RevokeUser(uint(userID), loginsession.RevokeUserDeleted); err != nil {
+		log.Printf("DeleteUserByID: 吊销用户 %d 的会话失败: %v", userID, err)
+	}
+
 	// 记录审计日志（成功）
 	RecordAuditLog(c, "delete_user", "high_risk", "user", uint(userID), username,
 		fmt.Sprintf("删除用户: %s (ID: %d)", username, userID), "success", "")
@@ -0,0 +1,247 @@
+package apikeyauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils"
+	"binrc.com/roma/core/utils/logger"
+)
+
+var (
+	// ErrInvalidKey API Key 不存在或已过期
+	ErrInvalidKey = errors.New("invalid or expired api key")
+	// ErrOwnerNotFound API Key 所属用户不存在或已被禁用
+	ErrOwnerNotFound = errors.New("api key owner not found or disabled")
+	// ErrScopeNotAllowed 申请的权限范围超出所属用户的权限
+	ErrScopeNotAllowed = errors.New("api key scope exceeds the owner's permissions")
+)
+
+// KeyPrefix 新生成的 API Key 的前缀
+const KeyPrefix = "apikey."
+
+// displayPrefixLen 保存的明文前缀长度，用于在列表中识别凭证
+const displayPrefixLen = 12
+
+// touchInterval 最近使用时间的更新间隔，IP 变化时立即更新
+const touchInterval = time.Minute
+
+// Create 为用户生成 API Key，数据库中只保存其 SHA-256
+// 输入: owner - 所属用户；description - 描述；expiresAt - 过期时间；scopes - 权限范围，为空表示继承用户权限
+// 输出: string - 明文 API Key（只返回这一次）；*model.Apikey - 记录；error - 失败原因
+func Create(owner *model.User, description string, expiresAt time.Time, scopes []model.ApikeyScope) (string, *model.Apikey, error) {
+	scopes, err := ValidateScopes(owner, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	key := KeyPrefix + utils.GenerateKey()
+	record, err := CreateWithKey(owner, key, description, expiresAt, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, record, nil
+}
+
+// CreateWithKey 用指定的明文创建 API Key（配置文件中的默认凭证），不校验权限范围
+func CreateWithKey(owner *model.User, key, description string, expiresAt time.Time, scopes []model.ApikeyScope) (*model.Apikey, error) {
+	record := &model.Apikey{
+		Apikey:      HashKey(key),
+		KeyPrefix:   displayPrefix(key),
+		UserID:      owner.ID,
+		Scopes:      scopes,
+		Description: description,
+		ExpiresAt:   expiresAt,
+	}
+	return operation.NewApikeyOperation().Create(record)
+}
+
+// Authenticate 校验 API Key 并返回所属用户
+// 输入: key - 请求携带的明文；clientIP - 请求来源，记录为最近一次使用的 IP
+// 输出: *model.Apikey - 凭证；*model.User - 所属用户（含角色）；error - 失败原因
+// 必要性: 请求以所属用户身份执行和审计，用户被删除或禁用后凭证随之失效
+func Authenticate(key, clientIP string) (*model.Apikey, *model.User, error) {
+	op := operation.NewApikeyOperation()
+	record, err := op.GetApiKeyByHash(HashKey(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if record == nil || !now.Before(record.ExpiresAt) {
+		return nil, nil, ErrInvalidKey
+	}
+	user, err := operation.NewUserOperation().GetUserByID(record.UserID)
+	if err != nil {
+		return nil, nil, ErrOwnerNotFound
+	}
+	if record.LastUsedAt == nil || record.LastUsedIP != clientIP || now.Sub(*record.LastUsedAt) > touchInterval {
+		if err := op.TouchApiKey(record.ID, clientIP, now); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("Failed to update last used time of api key %d: %v", record.ID, err))
+		}
+	}
+	return record, user, nil
+}
+
+// ValidateScopes 规范化权限范围，并校验每一项都在所属用户的权限之内
+func ValidateScopes(owner *model.User, scopes []model.ApikeyScope) ([]model.ApikeyScope, error) {
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	roles, err := operation.NewUserOperation().GetUserRoles(owner.ID)
+	if err != nil {
+		return nil, err
+	}
+	isSuper := false
+	for _, role := range roles {
+		if permissions.IsSuperRole(role) {
+			isSuper = true
+			break
+		}
+	}
+
+	opSpace := operation.NewSpaceOperation()
+	result := make([]model.ApikeyScope, 0, len(scopes))
+	for _, scope := range scopes {
+		target := strings.ToLower(strings.TrimSpace(scope.Target))
+		if target == "" {
+			return nil, fmt.Errorf("%w: scope target is empty", ErrScopeNotAllowed)
+		}
+		var actions []string
+		for _, action := range scope.Actions {
+			action = strings.ToLower(strings.TrimSpace(action))
+			if action == "" {
+				continue
+			}
+			if !permissions.HasRolesPermission(roles, target, action) {
+				return nil, fmt.Errorf("%w: %s.%s", ErrScopeNotAllowed, target, action)
+			}
+			actions = append(actions, action)
+		}
+		if len(actions) == 0 {
+			return nil, fmt.Errorf("%w: scope %s has no actions", ErrScopeNotAllowed, target)
+		}
+		if scope.SpaceID != 0 {
+			if target != "resource" {
+				return nil, fmt.Errorf("%w: space_id only applies to resource scopes", ErrScopeNotAllowed)
+			}
+			if _, err := opSpace.GetSpaceByID(scope.SpaceID); err != nil {
+				return nil, fmt.Errorf("%w: space %d not found", ErrScopeNotAllowed, scope.SpaceID)
+			}
+			if !isSuper {
+				member, err := opSpace.IsUserInSpace(owner.ID, scope.SpaceID)
+				if err != nil || !member {
+					return nil, fmt.Errorf("%w: not a member of space %d", ErrScopeNotAllowed, scope.SpaceID)
+				}
+			}
+		}
+		result = append(result, model.ApikeyScope{Target: target, Actions: actions, SpaceID: scope.SpaceID})
+	}
+	return result, nil
+}
+
+// Allows 检查 API Key 的权限范围是否包含该操作（不含空间限制）
+// 所属用户是否拥有该权限仍由角色检查决定
+func Allows(key *model.Apikey, target, action string) bool {
+	if key == nil || len(key.Scopes) == 0 {
+		return true
+	}
+	return len(matchingScopes(key, target, action)) > 0
+}
+
+// AllowsResource 检查 API Key 是否可以对该资源执行操作（含空间限制）
+// resourceID 为 0（如新增资源）时只有不限空间的范围才允许
+func AllowsResource(key *model.Apikey, action string, resourceID int64, resourceType string) bool {
+	if key == nil || len(key.Scopes) == 0 {
+		return true
+	}
+	scopes := matchingScopes(key, "resource", action)
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if scope.SpaceID == 0 {
+			return true
+		}
+	}
+	if resourceID <= 0 {
+		return false
+	}
+	spaceID := permissions.ResourceSpaceID(resourceID, resourceType)
+	if spaceID == 0 {
+		return false
+	}
+	for _, scope := range scopes {
+		if scope.SpaceID == spaceID {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateLegacyKeys 把明文保存的旧 API Key 改为哈希保存，没有所属用户的归属 owner
+// 旧凭证原本以 super 用户身份执行，归属初始管理员后行为不变
+func MigrateLegacyKeys(owner *model.User) error {
+	op := operation.NewApikeyOperation()
+	keys, err := op.GetLegacyApiKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		userID := key.UserID
+		if userID == 0 && owner != nil {
+			userID = owner.ID
+		}
+		if err := op.HashLegacyApiKey(key.ID, HashKey(key.Apikey), displayPrefix(key.Apikey), userID); err != nil {
+			return fmt.Errorf("failed to hash api key %d: %w", key.ID, err)
+		}
+		if userID == 0 {
+			logger.Logger.Warning(fmt.Sprintf("API key %d has no owner and will be rejected", key.ID))
+		}
+	}
+	if len(keys) > 0 {
+		logger.Logger.Info(fmt.Sprintf("Hashed %d legacy api keys", len(keys)))
+	}
+	return nil
+}
+
+// HashKey 返回 API Key 的 SHA-256（十六进制）
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func matchingScopes(key *model.Apikey, target, action string) []model.ApikeyScope {
+	target = strings.ToLower(strings.TrimSpace(target))
+	action = strings.ToLower(strings.TrimSpace(action))
+	var result []model.ApikeyScope
+	for _, scope := range key.Scopes {
+		if scope.Target != "*" && scope.Target != target {
+			continue
+		}
+		for _, a := range scope.Actions {
+			if a == "*" || a == action {
+				result = append(result, scope)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// displayPrefix 保存的明文前缀，过短的凭证只保留一半，避免前缀泄露整个凭证
+func displayPrefix(key string) string {
+	n := displayPrefixLen
+	if len(key) < 2*n {
+		n = len(key) / 2
+	}
+	if n == 0 {
+		return "*"
+	}
+	return key[:n]
+}
@@ -0,0 +1,156 @@
+package apikeyauth
+
+import (
+	"os"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file:apikeyauth?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.AutoMigrate(&model.Space{}, &model.ResourceSpace{}); err != nil {
+		panic(err)
+	}
+	global.CDB = db
+	global.CONFIG = &configs.Config{PermissionPolicy: &configs.PermissionPolicyConfig{}}
+	os.Exit(m.Run())
+}
+
+// createSpace 新建空间并把资源分配到该空间
+func createSpace(t *testing.T, name string, resourceIDs ...int64) uint {
+	t.Helper()
+	opSpace := operation.NewSpaceOperation()
+	space, err := opSpace.CreateSpace(&model.Space{Name: name, IsActive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range resourceIDs {
+		if err := opSpace.AssignResourceToSpace(space.ID, id, "linux"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return space.ID
+}
+
+func scopedKey(scopes ...model.ApikeyScope) *model.Apikey {
+	return &model.Apikey{Scopes: scopes}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    *model.Apikey
+		target string
+		action string
+		want   bool
+	}{
+		{name: "no key", key: nil, target: "user", action: "delete", want: true},
+		{name: "no scopes inherits owner", key: scopedKey(), target: "user", action: "delete", want: true},
+		{name: "matching scope", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"list", "get"}}), target: "resource", action: "get", want: true},
+		{name: "case and spaces", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}}), target: " Resource ", action: "GET", want: true},
+		{name: "action not in scope", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"list"}}), target: "resource", action: "delete", want: false},
+		{name: "target not in scope", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"*"}}), target: "user", action: "list", want: false},
+		{name: "wildcard target", key: scopedKey(model.ApikeyScope{Target: "*", Actions: []string{"list"}}), target: "user", action: "list", want: true},
+		{name: "wildcard action", key: scopedKey(model.ApikeyScope{Target: "session", Actions: []string{"*"}}), target: "session", action: "kill", want: true},
+		// 空间限制只在 AllowsResource 中检查
+		{name: "space scope ignored", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: 99}), target: "resource", action: "get", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allows(tt.key, tt.target, tt.action); got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.target, tt.action, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowsResource(t *testing.T) {
+	const (
+		prodHost     int64 = 1
+		devHost      int64 = 2
+		unassigned   int64 = 3
+		newResource  int64 = 0
+		resourceType       = "linux"
+	)
+	prod := createSpace(t, "prod", prodHost)
+	dev := createSpace(t, "dev", devHost)
+	defaultDev := "dev"
+
+	tests := []struct {
+		name         string
+		key          *model.Apikey
+		action       string
+		resourceID   int64
+		defaultSpace *string
+		want         bool
+	}{
+		{name: "no key", key: nil, action: "delete", resourceID: prodHost, want: true},
+		{name: "no scopes", key: scopedKey(), action: "delete", resourceID: prodHost, want: true},
+		{name: "action not in scope", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}}), action: "delete", resourceID: prodHost, want: false},
+		{name: "non-resource scope", key: scopedKey(model.ApikeyScope{Target: "user", Actions: []string{"*"}}), action: "get", resourceID: prodHost, want: false},
+		{name: "unrestricted scope", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}}), action: "get", resourceID: prodHost, want: true},
+		{name: "unrestricted scope new resource", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"add"}}), action: "add", resourceID: newResource, want: true},
+		{name: "space scope in space", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: prod}), action: "get", resourceID: prodHost, want: true},
+		{name: "space scope other space", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: prod}), action: "get", resourceID: devHost, want: false},
+		{name: "space scope new resource", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"add"}, SpaceID: prod}), action: "add", resourceID: newResource, want: false},
+		{name: "space scope unassigned resource", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: dev}), action: "get", resourceID: unassigned, want: false},
+		// 未分配空间的资源属于默认空间
+		{name: "unassigned resource in default space", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: dev}), action: "get", resourceID: unassigned, defaultSpace: &defaultDev, want: true},
+		{name: "unassigned resource outside default space", key: scopedKey(model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: prod}), action: "get", resourceID: unassigned, defaultSpace: &defaultDev, want: false},
+		{
+			name: "any matching space scope",
+			key: scopedKey(
+				model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: prod},
+				model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: dev},
+			),
+			action: "get", resourceID: devHost, want: true,
+		},
+		{
+			name: "space scope for another action",
+			key: scopedKey(
+				model.ApikeyScope{Target: "resource", Actions: []string{"get"}, SpaceID: prod},
+				model.ApikeyScope{Target: "resource", Actions: []string{"delete"}, SpaceID: dev},
+			),
+			action: "delete", resourceID: prodHost, want: false,
+		},
+		{name: "wildcard target with space", key: scopedKey(model.ApikeyScope{Target: "*", Actions: []string{"*"}, SpaceID: dev}), action: "update", resourceID: devHost, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global.CONFIG.PermissionPolicy.DefaultSpace = tt.defaultSpace
+			t.Cleanup(func() { global.CONFIG.PermissionPolicy.DefaultSpace = nil })
+			if got := AllowsResource(tt.key, tt.action, tt.resourceID, resourceType); got != tt.want {
+				t.Errorf("AllowsResource(%q, %d) = %v, want %v", tt.action, tt.resourceID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplayPrefix(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "apikey.0123456789abcdef0123456789", want: "apikey.01234"},
+		{key: "short-key", want: "shor"},
+		{key: "a", want: "*"},
+		{key: "", want: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := displayPrefix(tt.key); got != tt.want {
+				t.Errorf("displayPrefix(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package cmdpolicy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+)
+
+var (
+	ErrBlocked          = errors.New("command blocked by policy")
+	ErrConfirmRequired  = errors.New("command requires interactive confirmation")
+	ErrApprovalRequired = errors.New("command requires approval by a second user")
+	ErrRejected         = errors.New("command rejected by approver")
+	ErrApprovalTimeout  = errors.New("command approval timed out")
+	ErrPendingNotFound  = errors.New("pending command not found")
+	ErrNotApprover      = errors.New("not allowed to approve commands")
+	ErrSelfApproval     = errors.New("cannot approve your own command")
+)
+
+// ApprovalTimeout 等待第二审批人的最长时间，默认 5 分钟
+func ApprovalTimeout() time.Duration {
+	if cfg := global.CONFIG.CommandApproval; cfg != nil && cfg.TimeoutSeconds > 0 {
+		return time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// PendingCommandInfo 待审批命令的快照，用于接口和 TUI 展示
+type PendingCommandInfo struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	ClientIP     string    `json:"client_ip"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   uint      `json:"resource_id"`
+	ResourceName string    `json:"resource_name"`
+	Command      string    `json:"command"`
+	Policy       string    `json:"policy"`
+	Message      string    `json:"message,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// PendingCommand 等待第二审批人的命令
+type PendingCommand struct {
+	info     PendingCommandInfo
+	decision chan approvalResult
+	decided  bool
+}
+
+type approvalResult struct {
+	approved bool
+	approver string
+}
+
+var pendingCommands = struct {
+	sync.Mutex
+	m map[string]*PendingCommand
+}{m: make(map[string]*PendingCommand)}
+
+// RequestApproval 登记待审批命令，调用方随后通过 Wait 等待结果
+func RequestApproval(t Target, command string, d *Decision) *PendingCommand {
+	now := time.Now()
+	p := &PendingCommand{
+		info: PendingCommandInfo{
+			ID:           newPendingID(),
+			Username:     t.Username,
+			ClientIP:     t.ClientIP,
+			ResourceType: t.ResourceType,
+			ResourceID:   t.ResourceID,
+			ResourceName: t.ResourceName,
+			Command:      command,
+			Policy:       d.Policy,
+			Message:      d.Message,
+			CreatedAt:    now,
+			ExpiresAt:    now.Add(ApprovalTimeout()),
+		},
+		decision: make(chan approvalResult, 1),
+	}
+	pendingCommands.Lock()
+	pendingCommands.m[p.info.ID] = p
+	pendingCommands.Unlock()
+
+	audit(t.Username, "command_approval_request", "high_risk", t,
+		fmt.Sprintf("命令需要审批 #%s（策略 %s）: %s", p.info.ID, d.Policy, command), "pending", "")
+	return p
+}
+
+func newPendingID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// ID 审批编号
+func (p *PendingCommand) ID() string {
+	return p.info.ID
+}
+
+// Wait 等待审批结果，返回时从待审批列表移除
+// 输出: string - 审批人；error - 被拒绝、超时或 ctx 取消（申请人放弃或断开）
+func (p *PendingCommand) Wait(ctx context.Context) (string, error) {
+	defer func() {
+		pendingCommands.Lock()
+		p.decided = true
+		delete(pendingCommands.m, p.info.ID)
+		pendingCommands.Unlock()
+	}()
+
+	timer := time.NewTimer(time.Until(p.info.ExpiresAt))
+	defer timer.Stop()
+	t := Target{Username: p.info.Username, ClientIP: p.info.ClientIP, ResourceType: p.info.ResourceType, ResourceID: p.info.ResourceID, ResourceName: p.info.ResourceName}
+	select {
+	case r := <-p.decision:
+		if r.approved {
+			return r.approver, nil
+		}
+		return r.approver, ErrRejected
+	case <-timer.C:
+		audit(p.info.Username, "command_approval_request", "high_risk", t,
+			fmt.Sprintf("命令审批 #%s 超时: %s", p.info.ID, p.info.Command), "failed", ErrApprovalTimeout.Error())
+		return "", ErrApprovalTimeout
+	case <-ctx.Done():
+		audit(p.info.Username, "command_approval_request", "high_risk", t,
+			fmt.Sprintf("申请人放弃命令审批 #%s: %s", p.info.ID, p.info.Command), "failed", "cancelled")
+		return "", ctx.Err()
+	}
+}
+
+// ListPending 列出所有待审批命令，按提交时间排序
+func ListPending() []PendingCommandInfo {
+	pendingCommands.Lock()
+	result := make([]PendingCommandInfo, 0, len(pendingCommands.m))
+	for _, p := range pendingCommands.m {
+		result = append(result, p.info)
+	}
+	pendingCommands.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// CanApprove 检查来自 ip 的用户是否拥有 session.approve 权限
+func CanApprove(username, ip string) bool {
+	roles, err := operation.NewUserOperation().GetUserRolesByUsername(username)
+	if err != nil {
+		return false
+	}
+	allowed, _ := permissions.CheckRolesPermission(roles, "session", "approve", ip)
+	return allowed
+}
+
+// Decide 第二审批人批准或拒绝待审批命令
+// 输入: approver - 审批人用户名；id - 审批编号；approve - 是否批准；ip - 审批人来源地址
+// 输出: PendingCommandInfo - 被审批命令的快照；error - 无权限、审批自己的命令或命令已不在等待中
+func Decide(approver, id string, approve bool, ip string) (PendingCommandInfo, error) {
+	if !CanApprove(approver, ip) {
+		return PendingCommandInfo{}, ErrNotApprover
+	}
+	pendingCommands.Lock()
+	p, ok := pendingCommands.m[id]
+	if !ok || p.decided {
+		pendingCommands.Unlock()
+		return PendingCommandInfo{}, ErrPendingNotFound
+	}
+	if p.info.Username == approver {
+		pendingCommands.Unlock()
+		return PendingCommandInfo{}, ErrSelfApproval
+	}
+	p.decided = true
+	p.decision <- approvalResult{approved: approve, approver: approver}
+	pendingCommands.Unlock()
+
+	t := Target{Username: p.info.Username, ClientIP: ip, ResourceType: p.info.ResourceType, ResourceID: p.info.ResourceID, ResourceName: p.info.ResourceName}
+	action, verb := "approve_command", "批准"
+	if !approve {
+		action, verb = "reject_command", "拒绝"
+	}
+	audit(approver, action, "high_risk", t,
+		fmt.Sprintf("%s %s 的命令 #%s（策略 %s）: %s", verb, p.info.Username, p.info.ID, p.info.Policy, p.info.Command), "success", "")
+	return p.info, nil
+}
+
+// Check 非交互式执行前检查命令
+// 输入: ctx - 取消等待；set - 适用的策略；command - 命令；notify - 用于提示等待审批，为 nil 时不等待审批直接拒绝
+// 输出: error - 命令被拦截、需要确认、审批被拒绝或超时时返回错误，nil 表示可以执行
+// 必要性: 非交互式执行无法让用户输入确认，confirm 策略在这里一律拒绝
+func Check(ctx context.Context, set *Set, command string, notify io.Writer) error {
+	if set.Empty() {
+		return nil
+	}
+	t := set.Target()
+	d := set.Evaluate(command)
+	switch d.Action {
+	case ActionDeny:
+		RecordBlocked(t, command, d)
+		return fmt.Errorf("%w: %s", ErrBlocked, d.Reason())
+	case ActionConfirm:
+		RecordBlocked(t, command, d)
+		return fmt.Errorf("%w: %s", ErrConfirmRequired, d.Reason())
+	case ActionApprove:
+		if notify == nil {
+			RecordBlocked(t, command, d)
+			return fmt.Errorf("%w: %s", ErrApprovalRequired, d.Reason())
+		}
+		p := RequestApproval(t, command, d)
+		fmt.Fprintf(notify, "[?] %s\r\n[?] Waiting for a second user to approve request %s (sessions --approve %s), up to %s ...\r\n",
+			d.Reason(), p.ID(), p.ID(), ApprovalTimeout())
+		approver, err := p.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(notify, "[+] Approved by %s\r\n", approver)
+	}
+	return nil
+}
+
+// RecordBlocked 记录被策略拦截的命令
+func RecordBlocked(t Target, command string, d *Decision) {
+	audit(t.Username, "command_blocked", "high_risk", t,
+		fmt.Sprintf("命令被策略 %s 拦截（%s）: %s", d.Policy, d.Action, command), "failed", d.Reason())
+}
+
+// RecordConfirmed 记录用户确认后执行的命令
+func RecordConfirmed(t Target, command string, d *Decision) {
+	audit(t.Username, "command_confirmed", "high_risk", t,
+		fmt.Sprintf("用户确认执行命中策略 %s 的命令: %s", d.Policy, command), "success", "")
+}
+
+// audit 同步写入审计日志
+func audit(username, action, actionType string, t Target, desc, status, errMsg string) {
+	var userID uint
+	if user, err := operation.NewUserOperation().GetUserByUsername(username); err == nil && user != nil {
+		userID = user.ID
+	}
+	_ = operation.NewAuditOperation().CreateAuditLog(&model.AuditLog{
+		UserID:       userID,
+		Username:     username,
+		Action:       action,
+		ActionType:   actionType,
+		ResourceType: t.ResourceType,
+		ResourceID:   t.ResourceID,
+		ResourceName: t.ResourceName,
+		Description:  desc,
+		IPAddress:    t.ClientIP,
+		Status:       status,
+		ErrorMessage: errMsg,
+	})
+}
@@ -0,0 +1,195 @@
+package cmdpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils/logger"
+)
+
+// 策略动作
+const (
+	ActionAllow   = "allow"   // 放行
+	ActionDeny    = "deny"    // 拦截
+	ActionConfirm = "confirm" // 用户确认后执行
+	ActionApprove = "approve" // 第二审批人同意后执行
+)
+
+// Target 命令执行的上下文，用于匹配策略和审计
+type Target struct {
+	Username     string
+	ClientIP     string
+	ResourceType string
+	ResourceID   uint
+	ResourceName string
+}
+
+// Decision 命令的检查结果，Policy 为空表示没有策略命中
+type Decision struct {
+	Action  string
+	Policy  string
+	Pattern string
+	Message string
+}
+
+// Reason 展示给用户的说明
+func (d *Decision) Reason() string {
+	if d.Message != "" {
+		return fmt.Sprintf("%s (policy %s)", d.Message, d.Policy)
+	}
+	return fmt.Sprintf("matched policy %s", d.Policy)
+}
+
+// rule 编译后的命令策略
+type rule struct {
+	cfg      *configs.CommandPolicyConfig
+	patterns []*regexp.Regexp
+}
+
+var (
+	compileOnce sync.Once
+	rules       []*rule
+)
+
+// compiled 编译配置中的命令策略，无效的正则和动作记录警告后跳过
+func compiled() []*rule {
+	compileOnce.Do(func() {
+		for i, cfg := range global.CONFIG.CommandPolicies {
+			if cfg == nil {
+				continue
+			}
+			if cfg.Name == "" {
+				cfg.Name = fmt.Sprintf("#%d", i+1)
+			}
+			cfg.Action = strings.ToLower(strings.TrimSpace(cfg.Action))
+			switch cfg.Action {
+			case ActionAllow, ActionDeny, ActionConfirm, ActionApprove:
+			default:
+				logger.Logger.Warning(fmt.Sprintf("command policy %s: unknown action %q, skipped", cfg.Name, cfg.Action))
+				continue
+			}
+			r := &rule{cfg: cfg}
+			for _, p := range cfg.Patterns {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					logger.Logger.Warning(fmt.Sprintf("command policy %s: invalid pattern %q: %v", cfg.Name, p, err))
+					continue
+				}
+				r.patterns = append(r.patterns, re)
+			}
+			if len(r.patterns) > 0 {
+				rules = append(rules, r)
+			}
+		}
+	})
+	return rules
+}
+
+// Set 适用于某次会话的命令策略，按配置顺序排列
+type Set struct {
+	target Target
+	rules  []*rule
+}
+
+// ForTarget 筛选适用于该用户和资源的策略
+// 输入: t - 用户与目标资源
+// 输出: *Set - 适用的策略集合（可能为空）
+// 必要性: 角色和资源空间只在会话开始时查询一次，之后每条命令只做正则匹配
+func ForTarget(t Target) *Set {
+	set := &Set{target: t}
+	all := compiled()
+	if len(all) == 0 {
+		return set
+	}
+
+	roleNames := map[string]bool{}
+	if roles, err := operation.NewUserOperation().GetUserRolesByUsername(t.Username); err == nil {
+		for _, role := range roles {
+			if role != nil {
+				roleNames[role.Name] = true
+			}
+		}
+	}
+
+	spaceResolved := false
+	spaceName := ""
+	resourceSpace := func() string {
+		if !spaceResolved {
+			spaceResolved = true
+			if t.ResourceID != 0 {
+				if id := permissions.ResourceSpaceID(int64(t.ResourceID), t.ResourceType); id != 0 {
+					if space, err := operation.NewSpaceOperation().GetSpaceByID(id); err == nil && space != nil {
+						spaceName = space.Name
+					}
+				}
+			}
+		}
+		return spaceName
+	}
+
+	for _, r := range all {
+		if len(r.cfg.ResourceTypes) > 0 && !containsFold(r.cfg.ResourceTypes, t.ResourceType) {
+			continue
+		}
+		if len(r.cfg.Roles) > 0 && !anyRole(r.cfg.Roles, roleNames) {
+			continue
+		}
+		if len(r.cfg.Spaces) > 0 {
+			if name := resourceSpace(); name == "" || !containsFold(r.cfg.Spaces, name) {
+				continue
+			}
+		}
+		set.rules = append(set.rules, r)
+	}
+	return set
+}
+
+// Empty 没有适用的策略
+func (s *Set) Empty() bool {
+	return s == nil || len(s.rules) == 0
+}
+
+// Target 策略集合对应的用户与资源
+func (s *Set) Target() Target {
+	return s.target
+}
+
+// Evaluate 按顺序匹配命令行，返回第一条命中的策略；都不命中时放行
+func (s *Set) Evaluate(command string) *Decision {
+	command = strings.TrimSpace(command)
+	if s == nil || command == "" {
+		return &Decision{Action: ActionAllow}
+	}
+	for _, r := range s.rules {
+		for _, re := range r.patterns {
+			if re.MatchString(command) {
+				return &Decision{Action: r.cfg.Action, Policy: r.cfg.Name, Pattern: re.String(), Message: r.cfg.Message}
+			}
+		}
+	}
+	return &Decision{Action: ActionAllow}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyRole(names []string, roles map[string]bool) bool {
+	for _, name := range names {
+		if roles[name] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package cmdpolicy
+
+import (
+	"regexp"
+	"testing"
+
+	"binrc.com/roma/configs"
+)
+
+func testSet(policies ...*configs.CommandPolicyConfig) *Set {
+	set := &Set{}
+	for _, cfg := range policies {
+		r := &rule{cfg: cfg}
+		for _, p := range cfg.Patterns {
+			r.patterns = append(r.patterns, regexp.MustCompile(p))
+		}
+		set.rules = append(set.rules, r)
+	}
+	return set
+}
+
+func TestSetEvaluate(t *testing.T) {
+	set := testSet(
+		&configs.CommandPolicyConfig{Name: "allow-tmp", Patterns: []string{`^rm\s+-rf\s+/tmp/`}, Action: ActionAllow},
+		&configs.CommandPolicyConfig{Name: "no-rm-root", Patterns: []string{`^rm\s+-rf\s+/`}, Action: ActionDeny, Message: "not allowed"},
+		&configs.CommandPolicyConfig{Name: "reboot", Patterns: []string{`^reboot\b`, `^shutdown\b`}, Action: ActionConfirm},
+		&configs.CommandPolicyConfig{Name: "db-drop", Patterns: []string{`(?i)drop\s+database`}, Action: ActionApprove},
+	)
+	tests := []struct {
+		command    string
+		wantAction string
+		wantPolicy string
+	}{
+		{command: "ls -l", wantAction: ActionAllow},
+		{command: "", wantAction: ActionAllow},
+		{command: "   ", wantAction: ActionAllow},
+		{command: "rm -rf /var/lib", wantAction: ActionDeny, wantPolicy: "no-rm-root"},
+		{command: "  rm  -rf /  ", wantAction: ActionDeny, wantPolicy: "no-rm-root"},
+		{command: "rm -rf /tmp/build", wantAction: ActionAllow, wantPolicy: "allow-tmp"},
+		{command: "rm -rf build", wantAction: ActionAllow},
+		{command: "shutdown -h now", wantAction: ActionConfirm, wantPolicy: "reboot"},
+		{command: "rebooted", wantAction: ActionAllow},
+		{command: "mysql -e 'DROP DATABASE app'", wantAction: ActionApprove, wantPolicy: "db-drop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			d := set.Evaluate(tt.command)
+			if d.Action != tt.wantAction || d.Policy != tt.wantPolicy {
+				t.Errorf("Evaluate(%q) = %s/%s, want %s/%s", tt.command, d.Action, d.Policy, tt.wantAction, tt.wantPolicy)
+			}
+		})
+	}
+}
+
+func TestSetEvaluateEmpty(t *testing.T) {
+	var set *Set
+	if !set.Empty() {
+		t.Error("nil set should be empty")
+	}
+	if d := set.Evaluate("rm -rf /"); d.Action != ActionAllow {
+		t.Errorf("nil set Evaluate = %s, want allow", d.Action)
+	}
+}
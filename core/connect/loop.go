@@ -2,6 +2,7 @@ package connect
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -17,8 +18,10 @@ import (
 	postgrescli "binrc.com/dbcli/postgres-cli"
 	rediscli "binrc.com/dbcli/redis-cli"
 	"binrc.com/roma/core/api"
+	"binrc.com/roma/core/cmdpolicy"
 	"binrc.com/roma/core/connector"
 	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/knownhosts"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/sshd"
 	"binrc.com/roma/core/types"
@@ -34,6 +37,12 @@ func NewConnectionWithCommand(sess *ssh.Session, resModel model.Resource, resTyp
 		return nil, errors.New("缺少连接方式")
 	}
 
+	// 命令策略：需要审批时在会话中提示并等待第二审批人
+	set := cmdpolicy.ForTarget(commandTarget((*sess).User(), sshd.GetClientIP(*sess), resModel, resType))
+	if err := cmdpolicy.Check((*sess).Context(), set, command, *sess); err != nil {
+		return nil, err
+	}
+
 	// 根据资源类型处理不同的连接逻辑
 	switch strings.ToLower(resType) {
 	case "database":
@@ -46,6 +55,71 @@ func NewConnectionWithCommand(sess *ssh.Session, resModel model.Resource, resTyp
 	}
 }
 
+// ExecuteCommand 不依赖 SSH 会话非交互式执行命令，返回命令输出（供 MCP 等调用）
+// 输入: username、ipAddress - 发起者，用于主机密钥校验和审计；resModel - 资源；resType - 资源类型；command - 命令或 SQL
+// 输出: string - 命令输出；error - 错误信息
+func ExecuteCommand(username, ipAddress string, resModel model.Resource, resType string, command string) (string, error) {
+	connections := resModel.GetConnect()
+	if connections == nil {
+		return "", errors.New("缺少连接方式")
+	}
+
+	// 命令策略：没有交互终端，需要确认或审批的命令直接拒绝
+	set := cmdpolicy.ForTarget(commandTarget(username, ipAddress, resModel, resType))
+	if err := cmdpolicy.Check(context.Background(), set, command, nil); err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(resType) {
+	case "database":
+		return runDatabaseCommand(username, ipAddress, resModel, command)
+	case "linux", "docker", "router", "switch":
+		target := knownhosts.ForResource(resType, resModel)
+		target.Username = username
+		target.IPAddress = ipAddress
+		return runSSHCommand(target, username, ipAddress, connections, resModel, resType, command)
+	default:
+		return "", fmt.Errorf("资源类型 %s 不支持非交互式命令执行", resType)
+	}
+}
+
+// commandSessionInfo 非交互式命令的活动会话信息
+func commandSessionInfo(username, ipAddress string, resModel model.Resource, resType, host string) sshd.ActiveSessionInfo {
+	info := sshd.ActiveSessionInfo{
+		Type:         sshd.SessionTypeCommand,
+		Username:     username,
+		ClientIP:     ipAddress,
+		ResourceType: strings.ToLower(resType),
+		ResourceName: resModel.GetName(),
+		Host:         host,
+	}
+	if resModel.GetID() > 0 {
+		info.ResourceID = uint(resModel.GetID())
+	}
+	return info
+}
+
+// databaseAddr 数据库连接配置中的第一个地址，用于活动会话展示
+func databaseAddr(connections []*types.Connection) string {
+	for _, c := range connections {
+		if c != nil && c.Type == constants.ConnectDatabase {
+			return fmt.Sprintf("%s:%d", c.Host, c.Port)
+		}
+	}
+	return ""
+}
+
+// commandTarget 构造命令策略的匹配对象
+func commandTarget(username, ipAddress string, resModel model.Resource, resType string) cmdpolicy.Target {
+	return cmdpolicy.Target{
+		Username:     username,
+		ClientIP:     ipAddress,
+		ResourceType: resType,
+		ResourceID:   uint(resModel.GetID()),
+		ResourceName: resModel.GetName(),
+	}
+}
+
 func NewConnectionLoop(sess *ssh.Session, resModel model.Resource, resType string) error {
 	// 将 r 转换为相应的资源类型并创建资源
 	ConnectionLoop := resModel.GetConnect()
@@ -53,6 +127,13 @@ func NewConnectionLoop(sess *ssh.Session, resModel model.Resource, resType strin
 		return errors.New("缺少连接方式")
 	}
 
+	// 记录目标资源，供终端录像和审计关联
+	resourceID := uint(0)
+	if resModel.GetID() > 0 {
+		resourceID = uint(resModel.GetID())
+	}
+	sshd.SetSessionResource(*sess, sshd.SessionResource{Type: strings.ToLower(resType), ID: resourceID, Name: resModel.GetName()})
+
 	// 根据资源类型处理不同的连接逻辑
 	switch strings.ToLower(resType) {
 	case "linux":
@@ -60,6 +141,12 @@ func NewConnectionLoop(sess *ssh.Session, resModel model.Resource, resType strin
 	case "docker":
 		return handleDockerConnection(sess, ConnectionLoop, resModel)
 	case "database":
+		// 数据库 CLI 在本进程中运行，登记后可以被强制结束、随临时授权收回
+		live := sshd.RegisterSession(sshd.NewSessionInfo(*sess, sshd.SessionTypeDatabase, resModel, "database", databaseAddr(ConnectionLoop)), func(msg string) {
+			fmt.Fprintf(*sess, "\r\n%s\r\n", msg)
+			(*sess).Close()
+		})
+		defer live.Unregister()
 		return handleDatabaseConnection(sess, ConnectionLoop, resModel)
 	case "windows":
 		return handleWindowsConnection(sess, ConnectionLoop, resModel)
@@ -76,15 +163,9 @@ func NewConnectionLoop(sess *ssh.Session, resModel model.Resource, resType strin
 // handleLinuxConnection 处理 Linux 服务器连接（标准 SSH）
 func handleLinuxConnection(sess *ssh.Session, connections []*types.Connection) error {
 	// 收集所有 SSH 连接配置
-	sshConnections := []*types.Connection{}
-	for _, connection := range connections {
-		if connection.Type == constants.ConnectSSH && connection.Host != "" && connection.Port != 0 {
-			sshConnections = append(sshConnections, connection)
-		}
-	}
-
+	sshConnections := sshd.SSHConnections(connections)
 	if len(sshConnections) == 0 {
-		return errors.New("没有可用的 SSH 连接配置")
+		return sshd.ErrNoSSHConnection
 	}
 
 	// 显示连接提示
@@ -94,70 +175,20 @@ func handleLinuxConnection(sess *ssh.Session, connections []*types.Connection) e
 		fmt.Fprintf(*sess, "[*] Trying %d addresses ...\n", len(sshConnections))
 	}
 
-	// 使用 channel 来接收第一个成功的连接
-	type result struct {
-		conn *types.Connection
-		err  error
-	}
-	resultCh := make(chan result, len(sshConnections))
-
-	// 并发测试所有连接（只测试连通性，不建立 Terminal）
-	for _, conn := range sshConnections {
-		go func(c *types.Connection) {
-			// 解密密码（如果存在）
-			password := c.Password
-			if password != "" {
-				decryptedPassword, err := utils.DecryptPassword(password)
-				if err != nil {
-					logger.Logger.Warning(fmt.Sprintf("Failed to decrypt password for %s:%d: %v", c.Host, c.Port, err))
-					// 如果解密失败，尝试使用原始密码（可能是未加密的）
-					password = c.Password
-				} else {
-					password = decryptedPassword
-				}
-			}
-			// 测试 SSH 连接是否能建立（支持私钥和密码认证）
-			client, err := sshd.NewSSHClient(c.Host, c.Port, c.Username, c.PrivateKey, "linux", password)
-			if client != nil {
-				client.Close() // 立即关闭测试连接
-			}
-			resultCh <- result{conn: c, err: err}
-		}(conn)
-	}
-
-	// 等待第一个成功的连接
-	var successConn *types.Connection
-	var lastErr error
-	for i := 0; i < len(sshConnections); i++ {
-		res := <-resultCh
-		if res.err == nil && successConn == nil {
-			// 找到第一个成功的连接
-			successConn = res.conn
-			break
-		}
-		lastErr = res.err
-	}
+	// 上游主机密钥按会话中的目标资源校验
+	target := sshd.SessionHostKeyTarget(*sess, "linux")
 
-	if successConn == nil {
+	// 并发测试所有连接，取第一个成功的（只测试连通性，不建立 Terminal）
+	client, successConn, err := sshd.DialSSHConnections(target, sshConnections, "linux")
+	if err != nil {
 		// 所有连接都失败
-		return fmt.Errorf("[-] Connection failed: %v", lastErr)
+		return fmt.Errorf("[-] Connection failed: %v", err)
 	}
+	client.Close() // 立即关闭测试连接
 
 	// 使用成功的连接建立 Terminal
 	fmt.Fprintf(*sess, "[+] Connected to %s:%d\n", successConn.Host, successConn.Port)
-	// 解密密码（如果存在）
-	password := successConn.Password
-	if password != "" {
-		decryptedPassword, err := utils.DecryptPassword(password)
-		if err != nil {
-			logger.Logger.Warning(fmt.Sprintf("Failed to decrypt password for %s:%d: %v", successConn.Host, successConn.Port, err))
-			// 如果解密失败，尝试使用原始密码（可能是未加密的）
-			password = successConn.Password
-		} else {
-			password = decryptedPassword
-		}
-	}
-	return sshd.NewTerminal(sess, successConn.Host, successConn.Port, successConn.Username, successConn.PrivateKey, "linux", password)
+	return sshd.NewTerminal(sess, successConn.Host, successConn.Port, successConn.Username, successConn.PrivateKey, "linux", sshd.DecryptConnectionPassword(successConn))
 }
 
 // handleDockerConnection 处理 Docker 容器连接（直接 SSH 到容器）
@@ -179,11 +210,29 @@ func handleDockerConnection(sess *ssh.Session, connections []*types.Connection,
 
 // handleDatabaseCommand 非交互式执行数据库命令
 func handleDatabaseCommand(sess *ssh.Session, connections []*types.Connection, resModel model.Resource, command string) (interface{}, error) {
+	output, err := runDatabaseCommand((*sess).User(), sshd.GetClientIP(*sess), resModel, command)
+	if err != nil {
+		return nil, err
+	}
+	// 输出到 SSH 会话
+	fmt.Fprint(*sess, output)
+	// 返回空字符串，避免在 TUI 中重复输出（已经在上面输出到 sess 了）
+	return "", nil
+}
+
+// runDatabaseCommand 执行一条或多条 SQL 并返回格式化后的结果
+// 执行期间登记为活动会话，被强制结束时中断正在执行的查询，不再执行后续语句
+func runDatabaseCommand(username, ipAddress string, resModel model.Resource, command string) (string, error) {
 	dbConfig, ok := resModel.(*model.DatabaseConfig)
 	if !ok {
-		return nil, errors.New("资源类型不是数据库配置")
+		return "", errors.New("资源类型不是数据库配置")
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	live := sshd.RegisterSession(commandSessionInfo(username, ipAddress, resModel, "database", databaseAddr(resModel.GetConnect())), func(string) { cancel() })
+	defer live.Unregister()
+
 	// 使用 DatabaseConnector 执行查询
 	connector := connector.NewDatabaseConnector(dbConfig)
 
@@ -227,9 +276,12 @@ func handleDatabaseCommand(sess *ssh.Session, connections []*types.Connection, r
 			allOutput.WriteString("------------------------------------------------------------\n")
 		}
 
-		result, err := connector.ExecuteQuery(stmt)
+		if ctx.Err() != nil {
+			return "", errors.New("会话已被终止")
+		}
+		result, err := connector.ExecuteQueryContext(ctx, stmt)
 		if err != nil {
-			return nil, fmt.Errorf("执行失败 [%s]: %v", stmt, err)
+			return "", fmt.Errorf("执行失败 [%s]: %v", stmt, err)
 		}
 
 		// 格式化输出结果
@@ -311,10 +363,7 @@ func handleDatabaseCommand(sess *ssh.Session, connections []*types.Connection, r
 		allOutput.WriteString(output)
 	}
 
-	// 输出到 SSH 会话
-	fmt.Fprint(*sess, allOutput.String())
-	// 返回空字符串，避免在 TUI 中重复输出（已经在上面输出到 sess 了）
-	return "", nil
+	return allOutput.String(), nil
 }
 
 // splitSQLStatements 按分号分割 SQL 语句，但保留字符串中的分号
@@ -365,18 +414,6 @@ func splitSQLStatements(sql string) []string {
 
 // handleSSHCommand 非交互式执行 SSH 命令（适用于 Linux、Docker、Router、Switch）
 func handleSSHCommand(sess *ssh.Session, connections []*types.Connection, resModel model.Resource, resType string, command string) (interface{}, error) {
-	// 收集所有 SSH 连接配置
-	sshConnections := []*types.Connection{}
-	for _, connection := range connections {
-		if connection.Type == constants.ConnectSSH && connection.Host != "" && connection.Port != 0 {
-			sshConnections = append(sshConnections, connection)
-		}
-	}
-
-	if len(sshConnections) == 0 {
-		return nil, errors.New("没有可用的 SSH 连接配置")
-	}
-
 	// 获取用户名和IP地址用于审计日志
 	username := (*sess).User()
 	remoteAddr := (*sess).RemoteAddr()
@@ -389,6 +426,27 @@ func handleSSHCommand(sess *ssh.Session, connections []*types.Connection, resMod
 		}
 	}
 
+	output, err := runSSHCommand(sshd.ResourceHostKeyTarget(*sess, resModel, resType), username, ipAddress, connections, resModel, resType, command)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// runSSHCommand 通过第一个可用的 SSH 连接执行命令，高危命令记录审计日志
+func runSSHCommand(target knownhosts.Target, username, ipAddress string, connections []*types.Connection, resModel model.Resource, resType string, command string) (string, error) {
+	// 收集所有 SSH 连接配置
+	sshConnections := []*types.Connection{}
+	for _, connection := range connections {
+		if connection.Type == constants.ConnectSSH && connection.Host != "" && connection.Port != 0 {
+			sshConnections = append(sshConnections, connection)
+		}
+	}
+
+	if len(sshConnections) == 0 {
+		return "", errors.New("没有可用的 SSH 连接配置")
+	}
+
 	// 获取资源信息
 	resourceID := uint(0)
 	resourceName := resModel.GetName()
@@ -416,14 +474,16 @@ func handleSSHCommand(sess *ssh.Session, connections []*types.Connection, resMod
 			password = decryptedPassword
 		}
 	}
-	client, err := sshd.NewSSHClient(successConn.Host, successConn.Port, successConn.Username, successConn.PrivateKey, "linux", password)
+	client, err := sshd.NewSSHClientWithTarget(target, successConn.Host, successConn.Port, successConn.Username, successConn.PrivateKey, "linux", password)
 	if err != nil {
 		if highRisk {
 			recordTUICommandAuditLog(username, command, resType, resourceID, resourceName, ipAddress, "failed", fmt.Sprintf("连接失败: %v", err))
 		}
-		return nil, fmt.Errorf("连接失败: %v", err)
+		return "", fmt.Errorf("连接失败: %v", err)
 	}
 	defer client.Close()
+	live := sshd.RegisterSession(commandSessionInfo(username, ipAddress, resModel, resType, fmt.Sprintf("%s:%d", successConn.Host, successConn.Port)), func(string) { client.Close() })
+	defer live.Unregister()
 
 	// 创建会话并执行命令
 	session, err := client.NewSession()
@@ -431,7 +491,7 @@ func handleSSHCommand(sess *ssh.Session, connections []*types.Connection, resMod
 		if highRisk {
 			recordTUICommandAuditLog(username, command, resType, resourceID, resourceName, ipAddress, "failed", fmt.Sprintf("创建会话失败: %v", err))
 		}
-		return nil, fmt.Errorf("创建会话失败: %v", err)
+		return "", fmt.Errorf("创建会话失败: %v", err)
 	}
 	defer session.Close()
 
@@ -442,7 +502,7 @@ func handleSSHCommand(sess *ssh.Session, connections []*types.Connection, resMod
 		if highRisk {
 			recordTUICommandAuditLog(username, command, resType, resourceID, resourceName, ipAddress, "failed", errMsg)
 		}
-		return nil, fmt.Errorf("%s, 输出: %s", errMsg, string(output))
+		return "", fmt.Errorf("%s, 输出: %s", errMsg, string(output))
 	}
 
 	// 如果之前记录了审计日志，更新状态为成功
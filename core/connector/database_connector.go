@@ -224,6 +224,11 @@ func (d *DatabaseConnector) connectRedis() (interface{}, error) {
 
 // ExecuteQuery 执行数据库查询
 func (d *DatabaseConnector) ExecuteQuery(query string) (interface{}, error) {
+	return d.ExecuteQueryContext(context.Background(), query)
+}
+
+// ExecuteQueryContext 执行数据库查询，ctx 取消时中断正在执行的查询
+func (d *DatabaseConnector) ExecuteQueryContext(ctx context.Context, query string) (interface{}, error) {
 	conn, err := d.Connect()
 	if err != nil {
 		return nil, err
@@ -236,7 +241,7 @@ func (d *DatabaseConnector) ExecuteQuery(query string) (interface{}, error) {
 		db := conn.(*sql.DB)
 		defer db.Close()
 
-		rows, err := db.Query(query)
+		rows, err := db.QueryContext(ctx, query)
 		if err != nil {
 			return nil, fmt.Errorf("查询失败: %v", err)
 		}
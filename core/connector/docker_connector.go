@@ -2,8 +2,12 @@ package connector
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/knownhosts"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/utils"
 	gossh "golang.org/x/crypto/ssh"
@@ -43,7 +47,7 @@ func (d *DockerConnector) Connect() error {
 	config := &gossh.ClientConfig{
 		User:            d.Config.Username, // 宿主机用户
 		Auth:            []gossh.AuthMethod{},
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		HostKeyCallback: knownhosts.HostKeyCallback(knownhosts.ForResource(constants.ResourceTypeDocker, d.Config)),
 	}
 
 	// 优先使用私钥
@@ -65,7 +69,7 @@ func (d *DockerConnector) Connect() error {
 		config.Auth = append(config.Auth, gossh.Password(decryptedPassword))
 	}
 
-	client, err := gossh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), config)
+	client, err := gossh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
 	if err != nil {
 		return fmt.Errorf("连接宿主机失败: %v", err)
 	}
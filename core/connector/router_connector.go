@@ -2,9 +2,13 @@ package connector
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/knownhosts"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/utils"
 	gossh "golang.org/x/crypto/ssh"
@@ -105,7 +109,7 @@ func (r *RouterConnector) ConnectSSH() error {
 	config := &gossh.ClientConfig{
 		User:            r.Config.Username,
 		Auth:            []gossh.AuthMethod{},
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		HostKeyCallback: knownhosts.HostKeyCallback(knownhosts.ForResource(constants.ResourceTypeRouter, r.Config)),
 	}
 
 	if r.Config.PrivateKey != "" {
@@ -126,7 +130,7 @@ func (r *RouterConnector) ConnectSSH() error {
 		config.Auth = append(config.Auth, gossh.Password(decryptedPassword))
 	}
 
-	client, err := gossh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), config)
+	client, err := gossh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
 	if err != nil {
 		return fmt.Errorf("SSH 连接失败: %v", err)
 	}
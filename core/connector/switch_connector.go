@@ -2,8 +2,12 @@ package connector
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/knownhosts"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/utils"
 	gossh "golang.org/x/crypto/ssh"
@@ -40,7 +44,7 @@ func (s *SwitchConnector) ConnectSSH() error {
 	config := &gossh.ClientConfig{
 		User:            s.Config.Username,
 		Auth:            []gossh.AuthMethod{},
-		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		HostKeyCallback: knownhosts.HostKeyCallback(knownhosts.ForResource(constants.ResourceTypeSwitch, s.Config)),
 	}
 
 	// 交换机通常只使用密码认证
@@ -53,7 +57,7 @@ func (s *SwitchConnector) ConnectSSH() error {
 		config.Auth = append(config.Auth, gossh.Password(decryptedPassword))
 	}
 
-	client, err := gossh.Dial("tcp", fmt.Sprintf("%s:%d", host, port), config)
+	client, err := gossh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
 	if err != nil {
 		return fmt.Errorf("SSH 连接失败: %v", err)
 	}
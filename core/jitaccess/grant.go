@@ -0,0 +1,92 @@
+package jitaccess
+
+import (
+	"fmt"
+	"time"
+
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/sshd"
+	"binrc.com/roma/core/utils/logger"
+)
+
+// expiryInterval 到期检查间隔，决定授权到期后会话最多还能保留多久
+const expiryInterval = time.Minute
+
+// StartExpiry 定期收回到期的授权
+func StartExpiry() {
+	go func() {
+		for {
+			ExpireDue(time.Now())
+			time.Sleep(expiryInterval)
+		}
+	}()
+}
+
+// ExpireDue 将 now 之前到期的授权标记为已到期，并断开因此失去权限的会话
+// 输出: int - 本次处理的授权数量
+func ExpireDue(now time.Time) int {
+	grants, err := operation.NewAccessRequestOperation().ListDueGrants(now)
+	if err != nil {
+		logger.Logger.Warning(fmt.Sprintf("access request: failed to list due grants: %v", err))
+		return 0
+	}
+	expired := 0
+	for _, g := range grants {
+		if _, err := end(g.UserID, g.Username, g.ID, model.AccessRequestExpired, "access_request_expire", "", ""); err != nil {
+			// 已被并发收回时跳过
+			if err != ErrInvalidState {
+				logger.Logger.Warning(fmt.Sprintf("access request: failed to expire #%d: %v", g.ID, err))
+			}
+			continue
+		}
+		expired++
+	}
+	return expired
+}
+
+// revokeSessions 断开授权覆盖范围内、申请人已不再有 use 权限的活动会话
+func revokeSessions(req *model.AccessRequest, actorID uint, actor, ip string) {
+	user, err := operation.NewUserOperation().GetUserByID(req.UserID)
+	if err != nil {
+		user = nil
+	}
+	for _, s := range sshd.ListActiveSessions() {
+		if s.Username != req.Username || s.ResourceID == 0 || !covers(req, int64(s.ResourceID), s.ResourceType) {
+			continue
+		}
+		// 用户仍可通过角色或其他授权访问时保留会话
+		if user != nil {
+			if ok, _ := permissions.CheckResourceAccessFrom(user, nil, int64(s.ResourceID), s.ResourceType, "use", s.ClientIP); ok {
+				continue
+			}
+		}
+		reason := fmt.Sprintf("temporary access to %s has ended", req.Target())
+		info, err := sshd.KillActiveSession(s.ID, reason)
+		if err != nil {
+			// 会话已自行结束
+			continue
+		}
+		_ = operation.NewAuditOperation().CreateAuditLog(&model.AuditLog{
+			UserID:       actorID,
+			Username:     actor,
+			Action:       "kill_session",
+			ActionType:   "high_risk",
+			ResourceType: info.ResourceType,
+			ResourceID:   info.ResourceID,
+			ResourceName: info.ResourceName,
+			Description:  fmt.Sprintf("临时访问申请 #%d 结束，断开 %s 的会话 %s", req.ID, info.Username, info.ID),
+			IPAddress:    ip,
+			Status:       "success",
+		})
+	}
+}
+
+// covers 判断授权是否覆盖该资源
+func covers(req *model.AccessRequest, resourceID int64, resourceType string) bool {
+	if req.SpaceID == 0 {
+		return req.ResourceID == resourceID && req.ResourceType == resourceType
+	}
+	return permissions.ResourceSpaceID(resourceID, resourceType) == req.SpaceID
+}
@@ -0,0 +1,232 @@
+package jitaccess
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/sshd"
+	"github.com/loganchef/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:jitaccess?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Role{}, &model.LinuxConfig{}, &model.ResourceRole{}, &model.Space{}, &model.SpaceMember{},
+		&model.ResourceSpace{}, &model.Tag{}, &model.ResourceTag{}, &model.AccessRequest{}, &model.AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	prevDB, prevConfig := global.CDB, global.CONFIG
+	global.CDB = db
+	global.CONFIG = &configs.Config{PermissionPolicy: &configs.PermissionPolicyConfig{}}
+	t.Cleanup(func() {
+		global.CDB, global.CONFIG = prevDB, prevConfig
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// echoServer 上游服务，把收到的数据原样返回
+func echoServer(t *testing.T) *net.TCPAddr {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr)
+}
+
+// connContext 端口转发所在 SSH 连接的上下文
+type connContext struct {
+	context.Context
+	sync.Mutex
+	mu     sync.Mutex
+	values map[interface{}]interface{}
+	user   string
+	remote net.Addr
+}
+
+func newConnContext(t *testing.T, user string) *connContext {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &connContext{Context: ctx, values: map[interface{}]interface{}{}, user: user,
+		remote: &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000}}
+}
+
+func (c *connContext) Value(key interface{}) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.values[key]; ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+func (c *connContext) SetValue(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+func (c *connContext) User() string          { return c.user }
+func (c *connContext) SessionID() string     { return "jitaccess-test" }
+func (c *connContext) ClientVersion() string { return "SSH-2.0-test" }
+func (c *connContext) ServerVersion() string { return "SSH-2.0-roma" }
+func (c *connContext) RemoteAddr() net.Addr  { return c.remote }
+func (c *connContext) LocalAddr() net.Addr   { return nil }
+func (c *connContext) Permissions() *ssh.Permissions {
+	return &ssh.Permissions{Permissions: &gossh.Permissions{}}
+}
+
+// pipeChannel 以 net.Pipe 模拟的 SSH 通道
+type pipeChannel struct {
+	net.Conn
+}
+
+func (pipeChannel) CloseWrite() error { return nil }
+func (pipeChannel) SendRequest(string, bool, []byte) (bool, error) {
+	return false, nil
+}
+func (pipeChannel) Stderr() io.ReadWriter { return nil }
+
+// tunnelRequest 客户端发起的 direct-tcpip 通道请求
+type tunnelRequest struct {
+	extra    []byte
+	server   net.Conn
+	rejected chan string
+}
+
+func (r *tunnelRequest) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	reqs := make(chan *gossh.Request)
+	close(reqs)
+	return pipeChannel{r.server}, reqs, nil
+}
+
+func (r *tunnelRequest) Reject(reason gossh.RejectionReason, message string) error {
+	r.rejected <- message
+	return nil
+}
+
+func (r *tunnelRequest) ChannelType() string { return "direct-tcpip" }
+func (r *tunnelRequest) ExtraData() []byte   { return r.extra }
+
+// openTunnel 通过 DirectTCPIPHandler 打开到 host:port 的隧道，返回客户端一端
+func openTunnel(t *testing.T, ctx *connContext, host string, port int) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	req := &tunnelRequest{
+		extra: gossh.Marshal(struct {
+			DestAddr   string
+			DestPort   uint32
+			OriginAddr string
+			OriginPort uint32
+		}{host, uint32(port), "127.0.0.1", 50000}),
+		server:   server,
+		rejected: make(chan string, 1),
+	}
+	sshd.DirectTCPIPHandler(nil, nil, req, ctx)
+	select {
+	case msg := <-req.rejected:
+		t.Fatalf("tunnel to %s:%d rejected: %s", host, port, msg)
+	default:
+	}
+	return client
+}
+
+func TestExpireClosesTunnel(t *testing.T) {
+	setupDB(t)
+	upstream := echoServer(t)
+
+	// 角色只开启端口转发，不授予任何资源权限，资源访问完全来自临时授权
+	forwarder := model.Role{Name: "forwarder", Desc: `{"version":"1.0","allow_port_forwarding":true}`}
+	user := &model.User{Username: "dev", Name: "dev", Nickname: "dev", Email: "dev@example.com", Roles: []model.Role{forwarder}}
+	if err := global.CDB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	res := &model.LinuxConfig{Hostname: "web-01", IPv4Pub: "127.0.0.1", Port: upstream.Port}
+	if err := global.CDB.Create(res).Error; err != nil {
+		t.Fatal(err)
+	}
+	approvedAt := time.Now()
+	expires := approvedAt.Add(time.Hour)
+	grant := &model.AccessRequest{UserID: user.ID, Username: user.Username, ResourceType: "linux", ResourceID: res.ID,
+		DurationSeconds: 3600, Status: model.AccessRequestApproved, DecidedAt: &approvedAt, ExpiresAt: &expires}
+	if err := global.CDB.Create(grant).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel := openTunnel(t, newConnContext(t, user.Username), "web-01", upstream.Port)
+	if _, err := tunnel.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(tunnel, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo through tunnel = %q, %v", buf, err)
+	}
+
+	var tunnelID string
+	for _, s := range sshd.ListActiveSessions() {
+		if s.Type == sshd.SessionTypeTunnel && s.Username == user.Username {
+			tunnelID = s.ID
+			if s.ResourceID != uint(res.ID) || s.ResourceType != "linux" || s.Host != net.JoinHostPort("127.0.0.1", strconv.Itoa(upstream.Port)) {
+				t.Errorf("tunnel session = %+v", s)
+			}
+		}
+	}
+	if tunnelID == "" {
+		t.Fatal("tunnel not registered as an active session")
+	}
+
+	if n := ExpireDue(expires.Add(time.Minute)); n != 1 {
+		t.Fatalf("ExpireDue() = %d, want 1", n)
+	}
+
+	tunnel.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := tunnel.Read(buf); err == nil {
+		t.Fatal("tunnel still open after the grant expired")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("tunnel still open after the grant expired (read timed out)")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := sshd.GetActiveSession(tunnelID); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tunnel still listed after it was closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,295 @@
+package jitaccess
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+)
+
+var (
+	ErrInvalidDuration = errors.New("invalid duration")
+	ErrReasonRequired  = errors.New("reason is required")
+	ErrTargetNotFound  = errors.New("resource or space not found")
+	ErrDuplicate       = errors.New("an open request for this target already exists")
+	ErrNotFound        = errors.New("access request not found")
+	ErrNotApprover     = errors.New("not allowed to approve access requests")
+	ErrSelfApproval    = errors.New("cannot decide on your own access request")
+	ErrInvalidState    = errors.New("access request is not in a state that allows this action")
+)
+
+// MaxDuration 单次申请允许的最长时长，默认 24 小时
+func MaxDuration() time.Duration {
+	if cfg := global.CONFIG.AccessRequest; cfg != nil && cfg.MaxDurationHours > 0 {
+		return time.Duration(cfg.MaxDurationHours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// ParseDuration 解析申请时长，支持 Go 时长格式（30m、2h）及天数（1d）
+// 输入: s - 时长字符串
+// 输出: time.Duration - 时长；error - 格式错误、非正数或超过 MaxDuration
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, ErrInvalidDuration
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return 0, ErrInvalidDuration
+		}
+	}
+	if d < time.Minute {
+		return 0, ErrInvalidDuration
+	}
+	if max := MaxDuration(); d > max {
+		return 0, fmt.Errorf("%w: exceeds maximum of %s", ErrInvalidDuration, max)
+	}
+	return d, nil
+}
+
+// RequestResource 申请单个资源的临时访问
+// 输入: user - 申请人；resourceType/name - 资源类型与名称；duration - 批准后的有效时长；reason - 申请理由；ip - 来源地址
+// 输出: *model.AccessRequest - 待审批的申请；error - 参数无效、资源不存在或已有未结束的同类申请
+func RequestResource(user *model.User, resourceType, name string, duration time.Duration, reason, ip string) (*model.AccessRequest, error) {
+	res, err := operation.NewResourceOperation().GetResourceByName(name, resourceType)
+	if err != nil || res == nil {
+		return nil, ErrTargetNotFound
+	}
+	req := &model.AccessRequest{
+		ResourceType: resourceType,
+		ResourceID:   res.GetID(),
+		ResourceName: res.GetName(),
+	}
+	return submit(user, req, duration, reason, ip)
+}
+
+// RequestSpace 申请整个空间的临时访问，批准后可访问空间内所有资源
+func RequestSpace(user *model.User, spaceName string, duration time.Duration, reason, ip string) (*model.AccessRequest, error) {
+	space, err := operation.NewSpaceOperation().GetSpaceByName(spaceName)
+	if err != nil || space == nil || !space.IsActive {
+		return nil, ErrTargetNotFound
+	}
+	req := &model.AccessRequest{
+		SpaceID:   space.ID,
+		SpaceName: space.Name,
+	}
+	return submit(user, req, duration, reason, ip)
+}
+
+func submit(user *model.User, req *model.AccessRequest, duration time.Duration, reason, ip string) (*model.AccessRequest, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	if duration < time.Minute || duration > MaxDuration() {
+		return nil, ErrInvalidDuration
+	}
+	op := operation.NewAccessRequestOperation()
+	open, err := op.HasOpenRequest(user.ID, req.ResourceID, req.ResourceType, req.SpaceID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if open {
+		return nil, ErrDuplicate
+	}
+	req.UserID = user.ID
+	req.Username = user.Username
+	req.Reason = reason
+	req.DurationSeconds = int64(duration / time.Second)
+	req.Status = model.AccessRequestPending
+	if err := op.CreateRequest(req); err != nil {
+		return nil, err
+	}
+	audit(user.ID, user.Username, "access_request_create", "normal", req,
+		fmt.Sprintf("申请临时访问 %s，时长 %s，理由: %s", req.Target(), duration, reason), ip, "success", "")
+	return req, nil
+}
+
+// CanApprove 检查来自 ip 的用户是否拥有 access_request.approve 权限
+func CanApprove(userID uint, ip string) bool {
+	roles, err := operation.NewUserOperation().GetUserRoles(userID)
+	if err != nil {
+		return false
+	}
+	allowed, _ := permissions.CheckRolesPermission(roles, "access_request", "approve", ip)
+	return allowed
+}
+
+// Approve 批准待审批的申请，授权从批准时刻开始计时
+// 输入: approver - 审批人；id - 申请ID；comment - 审批意见；ip - 来源地址
+// 输出: *model.AccessRequest - 更新后的申请；error - 无审批权限、审批自己的申请或申请不处于待审批状态
+func Approve(approver *model.User, id uint, comment, ip string) (*model.AccessRequest, error) {
+	req, err := decidable(approver, id, ip)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(req.DurationSeconds) * time.Second)
+	ok, err := operation.NewAccessRequestOperation().UpdateStatus(id, model.AccessRequestPending, map[string]interface{}{
+		"status":           model.AccessRequestApproved,
+		"approver_id":      approver.ID,
+		"approver_name":    approver.Username,
+		"decision_comment": comment,
+		"decided_at":       now,
+		"expires_at":       expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	audit(approver.ID, approver.Username, "access_request_approve", "high_risk", req,
+		fmt.Sprintf("批准 %s 对 %s 的临时访问，有效期至 %s", req.Username, req.Target(), expiresAt.Format(time.DateTime)), ip, "success", "")
+	return operation.NewAccessRequestOperation().GetRequestByID(id)
+}
+
+// Deny 拒绝待审批的申请
+func Deny(approver *model.User, id uint, comment, ip string) (*model.AccessRequest, error) {
+	req, err := decidable(approver, id, ip)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	ok, err := operation.NewAccessRequestOperation().UpdateStatus(id, model.AccessRequestPending, map[string]interface{}{
+		"status":           model.AccessRequestDenied,
+		"approver_id":      approver.ID,
+		"approver_name":    approver.Username,
+		"decision_comment": comment,
+		"decided_at":       now,
+		"ended_at":         now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	audit(approver.ID, approver.Username, "access_request_deny", "normal", req,
+		fmt.Sprintf("拒绝 %s 对 %s 的临时访问申请", req.Username, req.Target()), ip, "success", "")
+	return operation.NewAccessRequestOperation().GetRequestByID(id)
+}
+
+// Revoke 审批人提前收回生效中的授权，并断开因此失去权限的会话
+func Revoke(approver *model.User, id uint, comment, ip string) (*model.AccessRequest, error) {
+	if !CanApprove(approver.ID, ip) {
+		return nil, ErrNotApprover
+	}
+	return end(approver.ID, approver.Username, id, model.AccessRequestRevoked, "access_request_revoke", comment, ip)
+}
+
+// Cancel 申请人撤回自己的申请：待审批的申请标记为已撤回，生效中的授权提前收回
+func Cancel(user *model.User, id uint, ip string) (*model.AccessRequest, error) {
+	op := operation.NewAccessRequestOperation()
+	req, err := op.GetRequestByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil || req.UserID != user.ID {
+		return nil, ErrNotFound
+	}
+	if req.Status == model.AccessRequestApproved {
+		return end(user.ID, user.Username, id, model.AccessRequestRevoked, "access_request_revoke", "withdrawn by requester", ip)
+	}
+	ok, err := op.UpdateStatus(id, model.AccessRequestPending, map[string]interface{}{
+		"status":   model.AccessRequestCancelled,
+		"ended_at": time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	audit(user.ID, user.Username, "access_request_cancel", "normal", req,
+		fmt.Sprintf("撤回对 %s 的临时访问申请", req.Target()), ip, "success", "")
+	return op.GetRequestByID(id)
+}
+
+// List 列出访问申请，userID 为 0 时列出所有人的申请
+func List(userID uint, status string) ([]*model.AccessRequest, error) {
+	return operation.NewAccessRequestOperation().ListRequests(userID, status)
+}
+
+// decidable 获取可由 approver 审批的待审批申请
+func decidable(approver *model.User, id uint, ip string) (*model.AccessRequest, error) {
+	if !CanApprove(approver.ID, ip) {
+		return nil, ErrNotApprover
+	}
+	req, err := operation.NewAccessRequestOperation().GetRequestByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, ErrNotFound
+	}
+	if req.UserID == approver.ID {
+		return nil, ErrSelfApproval
+	}
+	if req.Status != model.AccessRequestPending {
+		return nil, ErrInvalidState
+	}
+	return req, nil
+}
+
+// end 结束生效中的授权（收回或到期），随后断开因此失去权限的会话
+func end(actorID uint, actor string, id uint, status, action, comment, ip string) (*model.AccessRequest, error) {
+	op := operation.NewAccessRequestOperation()
+	req, err := op.GetRequestByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if req == nil {
+		return nil, ErrNotFound
+	}
+	updates := map[string]interface{}{
+		"status":   status,
+		"ended_at": time.Now(),
+	}
+	if comment != "" {
+		updates["decision_comment"] = comment
+	}
+	ok, err := op.UpdateStatus(id, model.AccessRequestApproved, updates)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	desc := fmt.Sprintf("收回 %s 对 %s 的临时访问", req.Username, req.Target())
+	if status == model.AccessRequestExpired {
+		desc = fmt.Sprintf("%s 对 %s 的临时访问已到期", req.Username, req.Target())
+	}
+	audit(actorID, actor, action, "high_risk", req, desc, ip, "success", "")
+	revokeSessions(req, actorID, actor, ip)
+	return op.GetRequestByID(id)
+}
+
+// audit 同步写入审计日志，保证审批链路完整可查
+func audit(userID uint, username, action, actionType string, req *model.AccessRequest, desc, ip, status, errMsg string) {
+	_ = operation.NewAuditOperation().CreateAuditLog(&model.AuditLog{
+		UserID:       userID,
+		Username:     username,
+		Action:       action,
+		ActionType:   actionType,
+		ResourceType: "access_request",
+		ResourceID:   req.ID,
+		ResourceName: req.Target(),
+		Description:  desc,
+		IPAddress:    ip,
+		Status:       status,
+		ErrorMessage: errMsg,
+	})
+}
@@ -0,0 +1,183 @@
+package knownhosts
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils/logger"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrHostKeyMismatch 上游主机密钥与已固定的密钥不一致
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+	// ErrHostKeyNotPinned 严格模式下上游主机密钥尚未固定
+	ErrHostKeyNotPinned = errors.New("host key not pinned")
+)
+
+// Target 主机密钥校验对象，用于定位 known_hosts 记录和写审计日志
+type Target struct {
+	ResourceType string
+	ResourceID   uint
+	ResourceName string
+	Host         string // 资源配置中的上游地址 host:port（解析 DNS 之前），为空时使用连接地址
+	Username     string // 触发连接的 ROMA 用户（可为空）
+	IPAddress    string // 触发连接的客户端 IP（可为空）
+	SessionID    string // 触发连接的 SSH 会话 ID（可为空）
+}
+
+// IsStrict 是否启用严格模式（拒绝未固定的主机密钥）
+func IsStrict() bool {
+	return global.CONFIG != nil && global.CONFIG.Security != nil && global.CONFIG.Security.HostKeyStrict
+}
+
+// HostKeyCallback 返回按资源校验上游主机密钥的回调
+// 输入: target - 资源标识
+// 输出: gossh.HostKeyCallback - 首次连接固定密钥（TOFU），之后不匹配则拒绝并审计
+// 必要性: 避免伪造的上游主机骗取资源凭据
+func HostKeyCallback(target Target) gossh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		return Verify(target, hostname, key)
+	}
+}
+
+// Verify 校验上游主机密钥
+// 输入: target - 资源标识；hostname - 连接地址 host:port；key - 上游提供的公钥
+// 输出: error - 校验失败原因
+// 记录按资源和配置中的地址定位，域名解析到新的 IP 时仍按已固定的密钥校验
+func Verify(target Target, hostname string, key gossh.PublicKey) error {
+	if target.Host != "" {
+		hostname = target.Host
+	}
+	host := normalizeHost(hostname)
+	resourceType := strings.ToLower(target.ResourceType)
+	fingerprint := gossh.FingerprintSHA256(key)
+	authorizedKey := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+
+	op := operation.NewKnownHostOperation()
+	known, err := op.GetKnownHost(resourceType, target.ResourceID, host)
+	if err != nil {
+		return fmt.Errorf("failed to load known host for %s: %v", host, err)
+	}
+
+	if known == nil {
+		now := time.Now()
+		known = &model.KnownHost{
+			ResourceType: resourceType,
+			ResourceID:   target.ResourceID,
+			Host:         host,
+		}
+		if IsStrict() {
+			// 严格模式：只记录待确认密钥，由管理员确认后才能连接
+			known.PendingPublicKey = authorizedKey
+			known.PendingFingerprint = fingerprint
+		} else {
+			known.KeyType = key.Type()
+			known.PublicKey = authorizedKey
+			known.Fingerprint = fingerprint
+			known.LastSeenAt = &now
+		}
+		if err := op.CreateKnownHost(known); err != nil {
+			// 并发首次连接时可能已被其他连接写入，重新读取后按正常流程校验
+			existing, getErr := op.GetKnownHost(resourceType, target.ResourceID, host)
+			if getErr != nil || existing == nil {
+				return fmt.Errorf("failed to pin host key for %s: %v", host, err)
+			}
+			known = existing
+		} else if !IsStrict() {
+			logger.Logger.Info(fmt.Sprintf("Pinned host key for %s (%s/%d): %s", host, resourceType, target.ResourceID, fingerprint))
+			recordAudit(target, "host_key_pinned", "normal", "success",
+				fmt.Sprintf("首次连接固定上游主机 %s 的密钥，指纹: %s", host, fingerprint), "")
+			return nil
+		}
+	}
+
+	if known.Fingerprint == "" {
+		// 从未固定（严格模式下首次连接，或管理员尚未确认）
+		if known.PendingFingerprint != fingerprint {
+			if err := op.SetPendingKey(known.ID, authorizedKey, fingerprint); err != nil {
+				logger.Logger.Warning(fmt.Sprintf("Failed to save pending host key for %s: %v", host, err))
+			}
+		}
+		recordAudit(target, "host_key_rejected", "high_risk", "failed",
+			fmt.Sprintf("上游主机 %s 的密钥未固定（严格模式），指纹: %s，等待管理员确认（known_host #%d）", host, fingerprint, known.ID),
+			ErrHostKeyNotPinned.Error())
+		return fmt.Errorf("%w: %s (%s)", ErrHostKeyNotPinned, host, fingerprint)
+	}
+
+	if known.Fingerprint == fingerprint {
+		if err := op.TouchKnownHost(known.ID); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("Failed to update known host %d: %v", known.ID, err))
+		}
+		return nil
+	}
+
+	if known.PendingFingerprint != fingerprint {
+		if err := op.SetPendingKey(known.ID, authorizedKey, fingerprint); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("Failed to save pending host key for %s: %v", host, err))
+		}
+	}
+	recordAudit(target, "host_key_mismatch", "high_risk", "failed",
+		fmt.Sprintf("上游主机 %s 的密钥与已固定的不一致，已固定: %s，收到: %s（known_host #%d）", host, known.Fingerprint, fingerprint, known.ID),
+		ErrHostKeyMismatch.Error())
+	logger.Logger.Warning(fmt.Sprintf("Host key mismatch for %s: pinned %s, got %s", host, known.Fingerprint, fingerprint))
+	return fmt.Errorf("%w: %s (expected %s, got %s)", ErrHostKeyMismatch, host, known.Fingerprint, fingerprint)
+}
+
+// normalizeHost 统一地址格式为 host:port（IPv6 带方括号）
+func normalizeHost(hostname string) string {
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return strings.ToLower(hostname)
+	}
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// recordAudit 异步记录主机密钥相关审计日志
+func recordAudit(target Target, action, actionType, status, description, errorMessage string) {
+	username := target.Username
+	if username == "" {
+		username = "system"
+	}
+	auditLog := &model.AuditLog{
+		Username:     username,
+		Action:       action,
+		ActionType:   actionType,
+		ResourceType: target.ResourceType,
+		ResourceID:   target.ResourceID,
+		ResourceName: target.ResourceName,
+		Description:  description,
+		IPAddress:    target.IPAddress,
+		Status:       status,
+		ErrorMessage: errorMessage,
+	}
+	go func() {
+		opUser := operation.NewUserOperation()
+		if target.Username != "" {
+			if user, err := opUser.GetUserByUsername(target.Username); err == nil {
+				auditLog.UserID = user.ID
+			}
+		}
+		if err := operation.NewAuditOperation().CreateAuditLog(auditLog); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("Failed to record host key audit log: %v", err))
+		}
+	}()
+}
+
+// ForResource 根据资源构造校验对象
+func ForResource(resourceType string, resource model.Resource) Target {
+	target := Target{ResourceType: resourceType}
+	if resource != nil {
+		target.ResourceName = resource.GetName()
+		if resource.GetID() > 0 {
+			target.ResourceID = uint(resource.GetID())
+		}
+	}
+	return target
+}
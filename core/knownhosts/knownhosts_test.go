@@ -0,0 +1,100 @@
+package knownhosts
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	gossh "golang.org/x/crypto/ssh"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.AuditLog{}, &model.KnownHost{}); err != nil {
+		panic(err)
+	}
+	global.CDB = db
+	os.Exit(m.Run())
+}
+
+func newHostKey(t *testing.T) gossh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerify(t *testing.T) {
+	keyA, keyB := newHostKey(t), newHostKey(t)
+	web := Target{ResourceType: "linux", ResourceID: 1, ResourceName: "web-01", Host: "web-01.example.com:22"}
+	db := Target{ResourceType: "linux", ResourceID: 2, ResourceName: "db-01", Host: "web-01.example.com:22"}
+	legacy := Target{ResourceType: "docker", ResourceID: 3}
+
+	// 各步骤依次执行，后面的步骤依赖前面固定的密钥
+	steps := []struct {
+		name     string
+		target   Target
+		hostname string
+		key      gossh.PublicKey
+		strict   bool
+		wantErr  error
+	}{
+		{name: "first connection pins the key", target: web, hostname: "10.0.0.1:22", key: keyA},
+		{name: "same key", target: web, hostname: "10.0.0.1:22", key: keyA},
+		{name: "new dns answer keeps the pin", target: web, hostname: "10.0.0.99:22", key: keyA},
+		{name: "spoofed host behind new ip", target: web, hostname: "10.0.0.99:22", key: keyB, wantErr: ErrHostKeyMismatch},
+		{name: "case-insensitive host", target: Target{ResourceType: "LINUX", ResourceID: 1, Host: "WEB-01.example.com:22"}, hostname: "10.0.0.1:22", key: keyA},
+		{name: "other resource has its own pin", target: db, hostname: "10.0.0.1:22", key: keyB},
+		{name: "other resource mismatch", target: db, hostname: "10.0.0.1:22", key: keyA, wantErr: ErrHostKeyMismatch},
+		{name: "strict mode refuses unpinned host", target: Target{ResourceType: "linux", ResourceID: 4, Host: "new:22"}, hostname: "10.0.0.4:22", key: keyA, strict: true, wantErr: ErrHostKeyNotPinned},
+		{name: "strict mode accepts pinned host", target: web, hostname: "10.0.0.1:22", key: keyA, strict: true},
+		{name: "connection address without configured host", target: legacy, hostname: "[FE80::1]:2222", key: keyA},
+		{name: "connection address normalized", target: legacy, hostname: "[fe80::1]:2222", key: keyB, wantErr: ErrHostKeyMismatch},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			global.CONFIG = &configs.Config{Security: &configs.SecurityConfig{HostKeyStrict: step.strict}}
+			defer func() { global.CONFIG = nil }()
+			err := Verify(step.target, step.hostname, step.key)
+			if step.wantErr == nil && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if step.wantErr != nil && !errors.Is(err, step.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, step.wantErr)
+			}
+		})
+	}
+
+	// 不匹配的密钥记录为待确认，已固定的密钥不变
+	known, err := operation.NewKnownHostOperation().GetKnownHost("linux", 1, "web-01.example.com:22")
+	if err != nil || known == nil {
+		t.Fatalf("known host not found: %v", err)
+	}
+	if known.Fingerprint != gossh.FingerprintSHA256(keyA) {
+		t.Errorf("pinned fingerprint = %s, want %s", known.Fingerprint, gossh.FingerprintSHA256(keyA))
+	}
+	if known.PendingFingerprint != gossh.FingerprintSHA256(keyB) {
+		t.Errorf("pending fingerprint = %s, want %s", known.PendingFingerprint, gossh.FingerprintSHA256(keyB))
+	}
+	if pinned, _ := operation.NewKnownHostOperation().GetKnownHost("linux", 1, "10.0.0.99:22"); pinned != nil {
+		t.Error("resolved address should not be pinned")
+	}
+}
@@ -0,0 +1,215 @@
+package ldapauth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"github.com/go-ldap/ldap/v3"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrUserNotFound 目录中没有该用户（或匹配到多个条目）
+	ErrUserNotFound = errors.New("ldap user not found")
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid ldap credentials")
+)
+
+const (
+	defaultUserFilter = "(&(objectClass=person)(uid=%s))"
+	defaultSyncFilter = "(objectClass=person)"
+	dialTimeout       = 10 * time.Second
+	syncPageSize      = 500
+)
+
+// Entry 目录中的用户条目
+type Entry struct {
+	DN       string
+	Username string
+	Name     string
+	Email    string
+	SSHKeys  []string
+	Groups   []string // 组 DN（memberOf）
+}
+
+// Enabled 是否启用 LDAP 用户源
+func Enabled() bool {
+	cfg := config()
+	return cfg != nil && cfg.Enabled && cfg.URL != ""
+}
+
+func config() *configs.LDAPConfig {
+	if global.CONFIG == nil {
+		return nil
+	}
+	return global.CONFIG.LDAP
+}
+
+// Authenticate 用目录中的密码校验用户
+// 输入: username - 登录用户名；password - 密码
+// 输出: *Entry - 用户条目；error - 用户不存在返回 ErrUserNotFound，密码错误返回 ErrInvalidCredentials
+// 必要性: 先用服务账号查出用户 DN，再以该 DN 绑定验证密码
+func Authenticate(username, password string) (*Entry, error) {
+	// 空密码在大多数目录上会被当作匿名绑定而“成功”
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	cfg := config()
+	conn, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := findUser(conn, cfg, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap bind as %s failed: %w", entry.DN, err)
+	}
+	return entry, nil
+}
+
+// Lookup 用服务账号查询用户条目（SSH 公钥登录时读取 sshPublicKey）
+func Lookup(username string) (*Entry, error) {
+	cfg := config()
+	conn, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return findUser(conn, cfg, username)
+}
+
+// HasPublicKey 目录中的 SSH 公钥是否包含 key
+func (e *Entry) HasPublicKey(key gossh.PublicKey) bool {
+	for _, line := range e.SSHKeys {
+		allowed, _, _, _, err := gossh.ParseAuthorizedKey([]byte(strings.TrimSpace(line)))
+		if err != nil {
+			continue
+		}
+		if string(allowed.Marshal()) == string(key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// dial 建立到目录的连接，测试中替换为内存实现
+var dial = func(url string, tlsConfig *tls.Config) (ldap.Client, error) {
+	return ldap.DialURL(url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: dialTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+}
+
+// connect 连接目录并用服务账号绑定
+func connect(cfg *configs.LDAPConfig) (ldap.Client, error) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, errors.New("ldap is not enabled")
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if host, _, err := net.SplitHostPort(strings.TrimPrefix(strings.TrimPrefix(cfg.URL, "ldaps://"), "ldap://")); err == nil {
+		tlsConfig.ServerName = host
+	}
+	conn, err := dial(cfg.URL, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap %s: %w", cfg.URL, err)
+	}
+	conn.SetTimeout(dialTimeout)
+
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls failed: %w", err)
+		}
+	}
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap service bind failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findUser 按 UserFilter 查找唯一的用户条目
+func findUser(conn ldap.Client, cfg *configs.LDAPConfig, username string) (*Entry, error) {
+	filterTpl := cfg.UserFilter
+	if filterTpl == "" {
+		filterTpl = defaultUserFilter
+	}
+	req := ldap.NewSearchRequest(cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(dialTimeout/time.Second), false,
+		fmt.Sprintf(filterTpl, ldap.EscapeFilter(username)), attributes(cfg), nil)
+	res, err := conn.Search(req)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap search for %s failed: %w", username, err)
+	}
+	if res == nil || len(res.Entries) != 1 {
+		return nil, ErrUserNotFound
+	}
+	entry := newEntry(res.Entries[0], cfg)
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	return entry, nil
+}
+
+// searchAll 分页列出 SyncFilter 匹配的所有用户
+func searchAll(conn ldap.Client, cfg *configs.LDAPConfig) ([]*Entry, error) {
+	filter := cfg.SyncFilter
+	if filter == "" {
+		filter = defaultSyncFilter
+	}
+	req := ldap.NewSearchRequest(cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, filter, attributes(cfg), nil)
+	res, err := conn.SearchWithPaging(req, syncPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("ldap sync search failed: %w", err)
+	}
+	entries := make([]*Entry, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		if entry := newEntry(e, cfg); entry.Username != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func newEntry(e *ldap.Entry, cfg *configs.LDAPConfig) *Entry {
+	return &Entry{
+		DN:       e.DN,
+		Username: e.GetEqualFoldAttributeValue(attr(cfg.UsernameAttribute, "uid")),
+		Name:     e.GetEqualFoldAttributeValue(attr(cfg.NameAttribute, "cn")),
+		Email:    e.GetEqualFoldAttributeValue(attr(cfg.EmailAttribute, "mail")),
+		SSHKeys:  e.GetEqualFoldAttributeValues(attr(cfg.SSHKeyAttribute, "sshPublicKey")),
+		Groups:   e.GetEqualFoldAttributeValues(attr(cfg.GroupAttribute, "memberOf")),
+	}
+}
+
+func attributes(cfg *configs.LDAPConfig) []string {
+	return []string{
+		attr(cfg.UsernameAttribute, "uid"),
+		attr(cfg.NameAttribute, "cn"),
+		attr(cfg.EmailAttribute, "mail"),
+		attr(cfg.SSHKeyAttribute, "sshPublicKey"),
+		attr(cfg.GroupAttribute, "memberOf"),
+	}
+}
+
+func attr(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
@@ -0,0 +1,240 @@
+package ldapauth
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file:ldapauth?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Role{}, &model.Space{}, &model.SpaceMember{}); err != nil {
+		panic(err)
+	}
+	global.CDB = db
+	os.Exit(m.Run())
+}
+
+const (
+	testBaseDN    = "ou=people,dc=example,dc=com"
+	testServiceDN = "cn=svc,dc=example,dc=com"
+	testOpsGroup  = "cn=ops,ou=groups,dc=example,dc=com"
+)
+
+// fakeDirectory 内存目录：按 uid 保存条目和密码，记录收到的搜索过滤器
+type fakeDirectory struct {
+	mu          sync.Mutex
+	entries     map[string]*ldap.Entry // uid -> 条目
+	passwords   map[string]string      // DN -> 密码
+	filters     []string
+	bindErr     error // 非空时所有非服务账号的绑定都返回该错误
+	dialErr     error
+	servicePass string
+}
+
+func newFakeDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		entries:     make(map[string]*ldap.Entry),
+		passwords:   map[string]string{testServiceDN: "svc-secret"},
+		servicePass: "svc-secret",
+	}
+}
+
+// add 添加用户条目，groups 为 memberOf 的组 DN
+func (d *fakeDirectory) add(uid, password string, groups ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dn := "uid=" + uid + "," + testBaseDN
+	d.entries[uid] = ldap.NewEntry(dn, map[string][]string{
+		"uid":      {uid},
+		"cn":       {strings.ToUpper(uid)},
+		"mail":     {uid + "@example.com"},
+		"memberOf": groups,
+	})
+	d.passwords[dn] = password
+}
+
+func (d *fakeDirectory) remove(uid string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.entries, uid)
+}
+
+func (d *fakeDirectory) lastFilter() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.filters) == 0 {
+		return ""
+	}
+	return d.filters[len(d.filters)-1]
+}
+
+// fakeConn 只实现本包用到的 ldap.Client 方法，其余方法调用时 panic
+type fakeConn struct {
+	ldap.Client
+	dir *fakeDirectory
+}
+
+func (c *fakeConn) SetTimeout(time.Duration)   {}
+func (c *fakeConn) StartTLS(*tls.Config) error { return nil }
+func (c *fakeConn) Close() error               { return nil }
+
+func (c *fakeConn) Bind(dn, password string) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	if dn != testServiceDN && c.dir.bindErr != nil {
+		return c.dir.bindErr
+	}
+	if want, ok := c.dir.passwords[dn]; !ok || want != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	return nil
+}
+
+// Search 只识别默认用户过滤器中的 (uid=...)，按转义后的字面值精确匹配
+func (c *fakeConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	c.dir.filters = append(c.dir.filters, req.Filter)
+	res := &ldap.SearchResult{}
+	for uid, entry := range c.dir.entries {
+		if strings.Contains(req.Filter, "(uid="+uid+")") {
+			res.Entries = append(res.Entries, entry)
+		}
+	}
+	return res, nil
+}
+
+func (c *fakeConn) SearchWithPaging(req *ldap.SearchRequest, _ uint32) (*ldap.SearchResult, error) {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	c.dir.filters = append(c.dir.filters, req.Filter)
+	res := &ldap.SearchResult{}
+	for _, entry := range c.dir.entries {
+		res.Entries = append(res.Entries, entry)
+	}
+	return res, nil
+}
+
+// withDirectory 启用 LDAP 配置并把连接替换为内存目录
+func withDirectory(t *testing.T, dir *fakeDirectory, mappings ...*configs.LDAPGroupMapping) *configs.LDAPConfig {
+	t.Helper()
+	cfg := &configs.LDAPConfig{
+		Enabled:       true,
+		URL:           "ldap://ldap.example.com:389",
+		BindDN:        testServiceDN,
+		BindPassword:  dir.servicePass,
+		BaseDN:        testBaseDN,
+		GroupMappings: mappings,
+	}
+	prevCfg, prevDial := global.CONFIG, dial
+	global.CONFIG = &configs.Config{LDAP: cfg}
+	dial = func(string, *tls.Config) (ldap.Client, error) {
+		if dir.dialErr != nil {
+			return nil, dir.dialErr
+		}
+		return &fakeConn{dir: dir}, nil
+	}
+	t.Cleanup(func() { global.CONFIG, dial = prevCfg, prevDial })
+	return cfg
+}
+
+func TestLookupEscapesFilter(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.add("alice", "pw")
+	withDirectory(t, dir)
+
+	tests := []struct {
+		name     string
+		username string
+		filter   string
+		wantErr  error
+	}{
+		{name: "plain", username: "alice", filter: "(&(objectClass=person)(uid=alice))"},
+		{name: "wildcard", username: "*", filter: `(&(objectClass=person)(uid=\2a))`, wantErr: ErrUserNotFound},
+		{name: "filter injection", username: "x)(uid=*", filter: `(&(objectClass=person)(uid=x\29\28uid=\2a))`, wantErr: ErrUserNotFound},
+		{name: "backslash and nul", username: "a\\b\x00", filter: `(&(objectClass=person)(uid=a\5cb\00))`, wantErr: ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := Lookup(tt.username)
+			if got := dir.lastFilter(); got != tt.filter {
+				t.Fatalf("filter = %s, want %s", got, tt.filter)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && entry.Username != tt.username {
+				t.Fatalf("username = %q, want %q", entry.Username, tt.username)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(dir *fakeDirectory)
+		username string
+		password string
+		wantErr  error
+		errText  string
+	}{
+		{name: "ok", username: "alice", password: "pw"},
+		{name: "wrong password", username: "alice", password: "nope", wantErr: ErrInvalidCredentials},
+		{name: "empty password is never an anonymous bind", username: "alice", password: "", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", username: "mallory", password: "pw", wantErr: ErrUserNotFound},
+		{name: "service bind fails", setup: func(dir *fakeDirectory) { dir.servicePass = "wrong" }, username: "alice", password: "pw", errText: "service bind failed"},
+		{name: "connection fails", setup: func(dir *fakeDirectory) { dir.dialErr = errors.New("connection refused") }, username: "alice", password: "pw", errText: "failed to connect"},
+		{name: "server error on user bind", setup: func(dir *fakeDirectory) {
+			dir.bindErr = ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("unwilling"))
+		}, username: "alice", password: "pw", errText: "ldap bind as uid=alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newFakeDirectory()
+			dir.add("alice", "pw", testOpsGroup)
+			if tt.setup != nil {
+				tt.setup(dir)
+			}
+			withDirectory(t, dir)
+
+			entry, err := Authenticate(tt.username, tt.password)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.errText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.errText)
+				}
+				if errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("infrastructure error reported as bad credentials: %v", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if entry.Username != "alice" || entry.Email != "alice@example.com" || len(entry.Groups) != 1 {
+					t.Fatalf("unexpected entry %+v", entry)
+				}
+			}
+		})
+	}
+}
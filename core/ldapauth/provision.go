@@ -0,0 +1,217 @@
+package ldapauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils/logger"
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	// ErrNoRoles 用户不在任何映射的组中，且没有配置默认角色
+	ErrNoRoles = errors.New("ldap user is not a member of any mapped group")
+	// ErrLocalUser 同名的本地用户已存在，不允许目录账号接管
+	ErrLocalUser = errors.New("a local user with the same name already exists")
+	// ErrUserDisabled 用户被管理员禁用，目录中仍存在也不自动恢复
+	ErrUserDisabled = errors.New("ldap user has been disabled by an administrator")
+)
+
+// ProvisionUser 按目录条目创建或更新 ROMA 用户，并根据组映射设置角色和空间
+// 输入: entry - 目录中的用户条目
+// 输出: *model.User - 同步后的用户（含角色）；error - 失败原因
+// 必要性: 目录是 LDAP 用户的唯一来源，每次登录和同步时都以目录中的组为准
+func ProvisionUser(entry *Entry) (*model.User, error) {
+	cfg := config()
+	if cfg == nil {
+		return nil, errors.New("ldap is not configured")
+	}
+	roleNames, spaceNames := mapGroups(cfg, entry.Groups)
+	roles := lookupRoles(roleNames)
+	if len(roles) == 0 {
+		return nil, ErrNoRoles
+	}
+
+	opUser := operation.NewUserOperation()
+	user, err := opUser.GetUserByUsernameUnscoped(entry.Username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil && !user.IsLDAP() {
+		return nil, ErrLocalUser
+	}
+	// 只恢复目录同步禁用的用户，管理员禁用或删除的用户保持禁用
+	if user != nil && user.DeletedAt.Valid && user.DisabledBy != model.UserDisabledByLDAPSync {
+		return nil, ErrUserDisabled
+	}
+
+	name := entry.Name
+	if name == "" {
+		name = entry.Username
+	}
+	// users.email 唯一且不为空，目录中没有邮箱时用用户名占位
+	email := entry.Email
+	if email == "" {
+		email = entry.Username
+	}
+
+	if user == nil {
+		user, err = opUser.CreateUser(&model.User{
+			Username: entry.Username,
+			Name:     name,
+			Nickname: name,
+			Email:    email,
+			Source:   model.UserSourceLDAP,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ldap user %s: %w", entry.Username, err)
+		}
+		logger.Logger.Info(fmt.Sprintf("LDAP: provisioned user %s (%s)", entry.Username, entry.DN))
+	} else {
+		if user.DeletedAt.Valid {
+			if err := opUser.RestoreUser(user.ID); err != nil {
+				return nil, err
+			}
+			logger.Logger.Info(fmt.Sprintf("LDAP: re-enabled user %s", entry.Username))
+		}
+		if user.Name != name || user.Email != email {
+			user.Name, user.Email = name, email
+			if user.Nickname == "" {
+				user.Nickname = name
+			}
+			user.Password = ""
+			if _, err := opUser.UpdateUser(user); err != nil {
+				return nil, fmt.Errorf("failed to update ldap user %s: %w", entry.Username, err)
+			}
+		}
+	}
+
+	if err := opUser.ReplaceUserRoles(user, roles); err != nil {
+		return nil, fmt.Errorf("failed to set roles of ldap user %s: %w", entry.Username, err)
+	}
+	syncSpaces(cfg, user, spaceNames)
+	return opUser.GetUserByID(user.ID)
+}
+
+// MappedRoles 按组映射计算目录条目对应的角色，不修改数据库
+// 用于同步用户之前的判断，如 SSH 公钥认证时尚未同步的用户是否有角色、角色是否要求 TOTP
+func MappedRoles(entry *Entry) []*model.Role {
+	cfg := config()
+	if cfg == nil {
+		return nil
+	}
+	roleNames, _ := mapGroups(cfg, entry.Groups)
+	roles := lookupRoles(roleNames)
+	result := make([]*model.Role, 0, len(roles))
+	for i := range roles {
+		result = append(result, &roles[i])
+	}
+	return result
+}
+
+// mapGroups 根据组映射计算角色和空间，没有匹配任何组时使用默认角色
+func mapGroups(cfg *configs.LDAPConfig, groups []string) ([]string, []string) {
+	var roles, spaces []string
+	for _, mapping := range cfg.GroupMappings {
+		if mapping == nil || !memberOf(groups, mapping.Group) {
+			continue
+		}
+		roles = appendUnique(roles, mapping.Roles...)
+		spaces = appendUnique(spaces, mapping.Spaces...)
+	}
+	if len(roles) == 0 {
+		roles = appendUnique(roles, cfg.DefaultRoles...)
+	}
+	return roles, spaces
+}
+
+// memberOf 组可以写完整 DN，也可以只写 CN，均不区分大小写
+func memberOf(groups []string, group string) bool {
+	for _, dn := range groups {
+		if strings.EqualFold(dn, group) || strings.EqualFold(groupCN(dn), group) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupCN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return dn
+	}
+	for _, a := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(a.Type, "cn") {
+			return a.Value
+		}
+	}
+	return dn
+}
+
+func lookupRoles(names []string) []model.Role {
+	opRole := operation.NewRoleOperation()
+	roles := make([]model.Role, 0, len(names))
+	for _, name := range names {
+		role, err := opRole.GetRoleByName(name)
+		if err != nil || role == nil {
+			logger.Logger.Warning(fmt.Sprintf("LDAP: mapped role %s does not exist", name))
+			continue
+		}
+		roles = append(roles, *role)
+	}
+	return roles
+}
+
+// syncSpaces 只管理组映射中出现过的空间：应在则加入，不应在则移出，其他空间的成员关系保持不变
+func syncSpaces(cfg *configs.LDAPConfig, user *model.User, want []string) {
+	opSpace := operation.NewSpaceOperation()
+	var managed []string
+	for _, mapping := range cfg.GroupMappings {
+		if mapping != nil {
+			managed = appendUnique(managed, mapping.Spaces...)
+		}
+	}
+	for _, name := range managed {
+		space, err := opSpace.GetSpaceByName(name)
+		if err != nil {
+			logger.Logger.Warning(fmt.Sprintf("LDAP: mapped space %s does not exist", name))
+			continue
+		}
+		in, err := opSpace.IsUserInSpace(user.ID, space.ID)
+		if err != nil {
+			continue
+		}
+		should := contains(want, name)
+		if should && !in {
+			if _, err := opSpace.AddSpaceMember(space.ID, user.ID); err != nil {
+				logger.Logger.Warning(fmt.Sprintf("LDAP: failed to add %s to space %s: %v", user.Username, name, err))
+			}
+		} else if !should && in {
+			if err := opSpace.RemoveSpaceMember(space.ID, user.ID); err != nil {
+				logger.Logger.Warning(fmt.Sprintf("LDAP: failed to remove %s from space %s: %v", user.Username, name, err))
+			}
+		}
+	}
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if item != "" && !contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package ldapauth
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+)
+
+// resetDB 清空用户、角色和空间，并创建给定的角色和空间
+func resetDB(t *testing.T, roles []string, spaces ...string) {
+	t.Helper()
+	for _, table := range []string{"user_roles", "space_members", "spaces", "users", "roles"} {
+		if err := global.CDB.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range roles {
+		if err := global.CDB.Create(&model.Role{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range spaces {
+		if err := global.CDB.Create(&model.Space{Name: name, IsActive: true}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func roleNames(user *model.User) []string {
+	names := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		names = append(names, role.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMapGroups(t *testing.T) {
+	mappings := []*configs.LDAPGroupMapping{
+		{Group: "ops", Roles: []string{"ops"}, Spaces: []string{"production"}},
+		{Group: "cn=dev,ou=groups,dc=example,dc=com", Roles: []string{"dev"}, Spaces: []string{"staging"}},
+		{Group: "leads", Roles: []string{"ops", "dev"}},
+	}
+	tests := []struct {
+		name       string
+		defaults   []string
+		groups     []string
+		wantRoles  []string
+		wantSpaces []string
+	}{
+		{name: "group by cn", groups: []string{testOpsGroup}, wantRoles: []string{"ops"}, wantSpaces: []string{"production"}},
+		{name: "group by dn ignores case", groups: []string{"CN=Dev,OU=Groups,DC=example,DC=com"}, wantRoles: []string{"dev"}, wantSpaces: []string{"staging"}},
+		{name: "roles are merged without duplicates", groups: []string{testOpsGroup, "cn=leads,dc=example,dc=com"}, wantRoles: []string{"ops", "dev"}, wantSpaces: []string{"production"}},
+		{name: "cn of another attribute does not match", groups: []string{"ou=ops,dc=example,dc=com"}},
+		{name: "no match uses default roles", defaults: []string{"viewer"}, groups: []string{"cn=other,dc=example,dc=com"}, wantRoles: []string{"viewer"}},
+		{name: "match ignores default roles", defaults: []string{"viewer"}, groups: []string{testOpsGroup}, wantRoles: []string{"ops"}, wantSpaces: []string{"production"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &configs.LDAPConfig{GroupMappings: mappings, DefaultRoles: tt.defaults}
+			roles, spaces := mapGroups(cfg, tt.groups)
+			if !reflect.DeepEqual(roles, tt.wantRoles) || !reflect.DeepEqual(spaces, tt.wantSpaces) {
+				t.Fatalf("mapGroups(%v) = %v %v, want %v %v", tt.groups, roles, spaces, tt.wantRoles, tt.wantSpaces)
+			}
+		})
+	}
+}
+
+func TestProvisionUser(t *testing.T) {
+	resetDB(t, []string{"ops", "dev"}, "production")
+	dir := newFakeDirectory()
+	withDirectory(t, dir, &configs.LDAPGroupMapping{Group: "ops", Roles: []string{"ops", "missing"}, Spaces: []string{"production"}})
+
+	entry := &Entry{DN: "uid=alice," + testBaseDN, Username: "alice", Name: "Alice", Groups: []string{testOpsGroup}}
+	user, err := ProvisionUser(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsLDAP() || user.Email != "alice" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if got := roleNames(user); !reflect.DeepEqual(got, []string{"ops"}) {
+		t.Fatalf("roles = %v, want [ops]", got)
+	}
+	space, err := operation.NewSpaceOperation().GetSpaceByName("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in, _ := operation.NewSpaceOperation().IsUserInSpace(user.ID, space.ID); !in {
+		t.Fatal("user was not added to the mapped space")
+	}
+
+	// 离开映射组后移出空间；没有任何角色时拒绝
+	entry.Groups = nil
+	if _, err := ProvisionUser(entry); !errors.Is(err, ErrNoRoles) {
+		t.Fatalf("without groups: err = %v, want %v", err, ErrNoRoles)
+	}
+
+	local, err := operation.NewUserOperation().CreateUser(&model.User{Username: "bob", Name: "bob", Nickname: "bob", Email: "bob@local", Source: model.UserSourceLocal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProvisionUser(&Entry{Username: local.Username, Groups: []string{testOpsGroup}}); !errors.Is(err, ErrLocalUser) {
+		t.Fatalf("local user: err = %v, want %v", err, ErrLocalUser)
+	}
+}
+
+func TestProvisionUserRestore(t *testing.T) {
+	tests := []struct {
+		name       string
+		disabledBy string
+		wantErr    error
+	}{
+		{name: "disabled by sync is restored", disabledBy: model.UserDisabledByLDAPSync},
+		{name: "disabled by admin stays disabled", disabledBy: model.UserDisabledByAdmin, wantErr: ErrUserDisabled},
+		{name: "disabled without a recorded source stays disabled", disabledBy: "", wantErr: ErrUserDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetDB(t, []string{"ops"})
+			withDirectory(t, newFakeDirectory(), &configs.LDAPGroupMapping{Group: "ops", Roles: []string{"ops"}})
+			entry := &Entry{Username: "alice", Groups: []string{testOpsGroup}}
+			user, err := ProvisionUser(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opUser := operation.NewUserOperation()
+			if err := opUser.DisabledUser(uint64(user.ID), tt.disabledBy); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = ProvisionUser(entry)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			got, _ := opUser.GetUserByUsernameUnscoped("alice")
+			if restored := !got.DeletedAt.Valid; restored != (tt.wantErr == nil) {
+				t.Fatalf("restored = %v, disabled_by = %q", restored, got.DisabledBy)
+			}
+			if tt.wantErr == nil && got.DisabledBy != "" {
+				t.Fatalf("disabled_by = %q after restore, want empty", got.DisabledBy)
+			}
+		})
+	}
+}
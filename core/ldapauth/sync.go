@@ -0,0 +1,79 @@
+package ldapauth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils/logger"
+)
+
+// StartSync 按 SyncIntervalMinutes 定期同步目录用户，未启用或间隔为 0 时不启动
+func StartSync() {
+	cfg := config()
+	if !Enabled() || cfg.SyncIntervalMinutes <= 0 {
+		return
+	}
+	interval := time.Duration(cfg.SyncIntervalMinutes) * time.Minute
+	go func() {
+		for {
+			if err := Sync(); err != nil {
+				logger.Logger.Warning(fmt.Sprintf("LDAP: sync failed: %v", err))
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Sync 同步一次目录用户
+// 输入: 无
+// 输出: error - 无法读取目录时返回错误，此时不会禁用任何用户
+// 必要性: 更新目录用户的角色和空间，并禁用已从目录删除或不再属于任何映射组的 LDAP 用户
+func Sync() error {
+	cfg := config()
+	conn, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	entries, err := searchAll(conn, cfg)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	// 目录返回空结果多半是过滤器或权限配置错误，不据此禁用所有人
+	if len(entries) == 0 {
+		return errors.New("ldap sync returned no users")
+	}
+
+	active := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if _, err := ProvisionUser(entry); err != nil {
+			if !errors.Is(err, ErrNoRoles) && !errors.Is(err, ErrLocalUser) && !errors.Is(err, ErrUserDisabled) {
+				logger.Logger.Warning(fmt.Sprintf("LDAP: failed to sync user %s: %v", entry.Username, err))
+				// 同步出错时保留账号，下次再试
+				active[entry.Username] = true
+			}
+			continue
+		}
+		active[entry.Username] = true
+	}
+
+	opUser := operation.NewUserOperation()
+	users, err := opUser.GetUsersBySource(model.UserSourceLDAP)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if active[user.Username] {
+			continue
+		}
+		if err := opUser.DisabledUser(uint64(user.ID), model.UserDisabledByLDAPSync); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("LDAP: failed to disable user %s: %v", user.Username, err))
+			continue
+		}
+		logger.Logger.Info(fmt.Sprintf("LDAP: disabled user %s (removed from directory or mapped groups)", user.Username))
+	}
+	return nil
+}
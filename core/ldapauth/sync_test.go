@@ -0,0 +1,99 @@
+package ldapauth
+
+import (
+	"errors"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+)
+
+// userState 返回用户是否处于启用状态及禁用来源，用户不存在时 exists 为 false
+func userState(t *testing.T, username string) (exists, active bool, disabledBy string) {
+	t.Helper()
+	user, err := operation.NewUserOperation().GetUserByUsernameUnscoped(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user == nil {
+		return false, false, ""
+	}
+	return true, !user.DeletedAt.Valid, user.DisabledBy
+}
+
+func TestSync(t *testing.T) {
+	resetDB(t, []string{"ops"})
+	dir := newFakeDirectory()
+	dir.add("alice", "pw", testOpsGroup)
+	dir.add("bob", "pw", testOpsGroup)
+	dir.add("carol", "pw")
+	withDirectory(t, dir, &configs.LDAPGroupMapping{Group: "ops", Roles: []string{"ops"}})
+
+	type state struct {
+		exists     bool
+		active     bool
+		disabledBy string
+	}
+	check := func(step string, want map[string]state) {
+		t.Helper()
+		for username, w := range want {
+			exists, active, by := userState(t, username)
+			if got := (state{exists, active, by}); got != w {
+				t.Fatalf("%s: %s = %+v, want %+v", step, username, got, w)
+			}
+		}
+	}
+
+	if err := Sync(); err != nil {
+		t.Fatal(err)
+	}
+	check("initial sync", map[string]state{
+		"alice": {exists: true, active: true},
+		"bob":   {exists: true, active: true},
+		"carol": {},
+	})
+
+	dir.remove("bob")
+	if err := Sync(); err != nil {
+		t.Fatal(err)
+	}
+	check("bob removed", map[string]state{
+		"alice": {exists: true, active: true},
+		"bob":   {exists: true, disabledBy: model.UserDisabledByLDAPSync},
+	})
+
+	dir.add("bob", "pw", testOpsGroup)
+	if err := Sync(); err != nil {
+		t.Fatal(err)
+	}
+	check("bob back", map[string]state{"bob": {exists: true, active: true}})
+
+	// 管理员禁用的用户即使仍在目录中也不被同步恢复
+	alice, _ := operation.NewUserOperation().GetUserByUsernameUnscoped("alice")
+	if err := operation.NewUserOperation().DisabledUser(uint64(alice.ID), model.UserDisabledByAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sync(); err != nil {
+		t.Fatal(err)
+	}
+	check("alice disabled by admin", map[string]state{
+		"alice": {exists: true, disabledBy: model.UserDisabledByAdmin},
+		"bob":   {exists: true, active: true},
+	})
+
+	// 目录返回空结果时不禁用任何人
+	dir.remove("alice")
+	dir.remove("bob")
+	dir.remove("carol")
+	if err := Sync(); err == nil {
+		t.Fatal("sync of an empty directory should fail")
+	}
+	check("empty directory", map[string]state{"bob": {exists: true, active: true}})
+
+	dir.dialErr = errors.New("connection refused")
+	if err := Sync(); err == nil {
+		t.Fatal("sync should fail when the directory is unreachable")
+	}
+	check("unreachable directory", map[string]state{"bob": {exists: true, active: true}})
+}
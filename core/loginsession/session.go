@@ -0,0 +1,216 @@
+package loginsession
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils"
+	"binrc.com/roma/core/utils/logger"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌不存在、已被轮换或已过期
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrSessionInactive 会话已吊销或已过期
+	ErrSessionInactive = errors.New("session has been revoked or expired")
+)
+
+// 吊销原因
+const (
+	RevokeLogout       = "logout"
+	RevokeAdmin        = "admin"
+	RevokeRefreshReuse = "refresh_reuse"
+	RevokeUserDeleted  = "user_deleted"
+)
+
+// touchInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+const touchInterval = time.Minute
+
+// expiredRetention 过期会话保留多久后删除
+const expiredRetention = 30 * 24 * time.Hour
+
+// Tokens 登录或刷新后签发的令牌
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // 访问令牌有效期（秒）
+}
+
+// Create 为用户创建登录会话并签发访问令牌和刷新令牌
+// 输入: user - 已完成认证的用户；clientIP、userAgent - 用于会话列表展示
+// 输出: *Tokens - 令牌；error - 失败原因
+// 必要性: 访问令牌短期有效，会话记录在服务端，登出或管理员吊销后立即失效
+func Create(user *model.User, clientIP, userAgent string) (*Tokens, error) {
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	op := operation.NewUserSessionOperation()
+	if err := op.DeleteExpiredSessions(now.Add(-expiredRetention)); err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Failed to delete expired login sessions: %v", err))
+	}
+	session := &model.UserSession{
+		SessionID:        sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ClientIP:         clientIP,
+		UserAgent:        userAgent,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(utils.SessionTTL()),
+	}
+	if err := op.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return issue(user, sessionID, refreshToken)
+}
+
+// Refresh 用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+// 已被轮换的旧刷新令牌再次出现时，说明令牌可能被盗用，整个会话被吊销
+func Refresh(refreshToken string) (*model.User, *Tokens, error) {
+	hash := hashToken(refreshToken)
+	op := operation.NewUserSessionOperation()
+	session, err := op.GetSessionByRefreshHash(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	now := time.Now()
+	if session.RefreshTokenHash != hash {
+		if session.RevokedAt == nil {
+			if _, err := op.RevokeSession(session.SessionID, RevokeRefreshReuse, now); err != nil {
+				return nil, nil, err
+			}
+			logger.Logger.Warning(fmt.Sprintf("Refresh token reuse detected, session %s of user %d revoked", session.SessionID, session.UserID))
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if !session.IsActive(now) {
+		return nil, nil, ErrSessionInactive
+	}
+
+	user, err := operation.NewUserOperation().GetUserByID(session.UserID)
+	if err != nil {
+		return nil, nil, ErrSessionInactive
+	}
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	ok, err := op.RotateRefreshToken(session.ID, hash, hashToken(newToken), now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	tokens, err := issue(user, session.SessionID, newToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// ParseAccessToken 解析访问令牌并检查所属会话仍然有效
+func ParseAccessToken(token string) (*utils.Claims, error) {
+	claims, err := utils.ParseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	// 没有 jti 的令牌不属于任何会话，无法吊销，不再接受
+	if claims.ID == "" {
+		return nil, ErrSessionInactive
+	}
+	op := operation.NewUserSessionOperation()
+	session, err := op.GetSession(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if session == nil || session.UserID != claims.UserID || !session.IsActive(now) {
+		return nil, ErrSessionInactive
+	}
+	if now.Sub(session.LastUsedAt) > touchInterval {
+		if err := op.TouchSession(session.ID, now); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("Failed to update last used time of session %s: %v", session.SessionID, err))
+		}
+	}
+	return claims, nil
+}
+
+// List 列出用户的有效会话
+func List(userID uint) ([]*model.UserSession, error) {
+	return operation.NewUserSessionOperation().ListActiveSessions(userID, time.Now())
+}
+
+// Revoke 吊销会话
+func Revoke(sessionID, reason string) (bool, error) {
+	return operation.NewUserSessionOperation().RevokeSession(sessionID, reason, time.Now())
+}
+
+// RevokeByRefreshToken 按刷新令牌吊销会话（访问令牌已过期时登出）
+func RevokeByRefreshToken(refreshToken, reason string) (bool, error) {
+	op := operation.NewUserSessionOperation()
+	session, err := op.GetSessionByRefreshHash(hashToken(refreshToken))
+	if err != nil || session == nil || session.RefreshTokenHash != hashToken(refreshToken) {
+		return false, err
+	}
+	return op.RevokeSession(session.SessionID, reason, time.Now())
+}
+
+// RevokeUser 吊销用户的所有会话
+func RevokeUser(userID uint, reason string) (int64, error) {
+	return operation.NewUserSessionOperation().RevokeUserSessions(userID, reason, time.Now())
+}
+
+func issue(user *model.User, sessionID, refreshToken string) (*Tokens, error) {
+	accessToken, err := utils.GenerateJWT(user.ID, user.Username, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.AccessTokenTTL() / time.Second),
+	}, nil
+}
+
+// newSessionID 生成 32 位十六进制的会话 ID
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// newRefreshToken 生成 256 位随机刷新令牌，数据库中只保存其哈希
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,115 @@
+package mcpauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"binrc.com/roma/core/apikeyauth"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils"
+	"binrc.com/roma/core/utils/logger"
+)
+
+var (
+	// ErrInvalidToken MCP 令牌不存在或已过期
+	ErrInvalidToken = errors.New("invalid or expired mcp token")
+	// ErrOwnerNotFound MCP 令牌所属用户不存在或已被禁用
+	ErrOwnerNotFound = errors.New("mcp token owner not found or disabled")
+)
+
+// TokenPrefix MCP 令牌的前缀，便于和 API Key、JWT 区分
+const TokenPrefix = "mcp."
+
+// defaultExpireDays 未配置时 MCP 令牌的有效天数
+const defaultExpireDays = 90
+
+// displayPrefixLen 保存的明文前缀长度
+const displayPrefixLen = 12
+
+// touchInterval 最近使用时间的更新间隔
+const touchInterval = time.Minute
+
+// Issue 为用户签发 MCP 令牌，数据库中只保存其 SHA-256
+// 输入: owner - 所属用户；name - 令牌用途；ttl - 有效期，<=0 时使用配置的天数
+// 输出: string - 明文令牌（只返回这一次）；*model.MCPToken - 记录；error - 失败原因
+func Issue(owner *model.User, name string, ttl time.Duration) (string, *model.MCPToken, error) {
+	if ttl <= 0 {
+		ttl = time.Duration(ExpireDays()) * 24 * time.Hour
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "mcp"
+	}
+	token := TokenPrefix + utils.GenerateKey()
+	record := &model.MCPToken{
+		Token:     apikeyauth.HashKey(token),
+		Prefix:    token[:displayPrefixLen],
+		Name:      name,
+		UserID:    owner.ID,
+		Username:  owner.Username,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	if err := operation.NewMCPTokenOperation().CreateToken(record); err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// Authenticate 校验 MCP 令牌并返回所属用户
+// 输入: token - 明文令牌
+// 输出: *model.User - 所属用户（含角色）；*model.MCPToken - 令牌记录；error - 失败原因
+// 必要性: MCP 工具以所属用户身份执行和审计，用户被删除或禁用后令牌随之失效
+func Authenticate(token string) (*model.User, *model.MCPToken, error) {
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, nil, ErrInvalidToken
+	}
+	op := operation.NewMCPTokenOperation()
+	record, err := op.GetTokenByHash(apikeyauth.HashKey(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	if record == nil || now.Unix() >= record.ExpiresAt {
+		return nil, nil, ErrInvalidToken
+	}
+	user, err := operation.NewUserOperation().GetUserByID(record.UserID)
+	if err != nil {
+		return nil, nil, ErrOwnerNotFound
+	}
+	if now.Unix()-record.LastUsedAt > int64(touchInterval/time.Second) {
+		if err := op.TouchToken(record.ID, now.Unix()); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("Failed to update last used time of mcp token %d: %v", record.ID, err))
+		}
+	}
+	return user, record, nil
+}
+
+// List 列出用户未过期的 MCP 令牌
+func List(userID uint) ([]*model.MCPToken, error) {
+	return operation.NewMCPTokenOperation().ListUserTokens(userID, time.Now().Unix())
+}
+
+// Revoke 吊销用户的 MCP 令牌，令牌不存在或不属于该用户时返回 ErrInvalidToken
+func Revoke(userID, id uint) error {
+	deleted, err := operation.NewMCPTokenOperation().DeleteUserToken(userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// ExpireDays 配置的 MCP 令牌有效天数
+func ExpireDays() int {
+	if cfg := global.CONFIG.MCP; cfg != nil && cfg.TokenExpireDays > 0 {
+		return cfg.TokenExpireDays
+	}
+	return defaultExpireDays
+}
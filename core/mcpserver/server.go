@@ -0,0 +1,120 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/mcpauth"
+	"binrc.com/roma/core/model"
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// serverName、serverVersion MCP initialize 时返回的服务信息
+const (
+	serverName    = "roma"
+	serverVersion = "1.0.0"
+)
+
+// defaultPath 未配置时 streamable HTTP 端点的路径
+const defaultPath = "/mcp"
+
+// Caller MCP 工具的调用者，所有工具以该用户身份执行和审计
+type Caller struct {
+	User        *model.User
+	IPAddress   string // 请求来源，stdio 模式为 local
+	TokenPrefix string // 使用的 MCP 令牌前缀，写入审计描述
+	token       string // stdio 模式下的明文令牌，每次调用重新校验
+}
+
+type callerKey struct{}
+
+// WithCaller 把调用者放入 context，工具从中读取当前用户
+func WithCaller(ctx context.Context, caller *Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// callerFromContext 读取调用者，未认证的请求返回错误
+// stdio 进程长期运行，每次调用都重新校验令牌，令牌吊销或用户被禁用后立即失效
+func callerFromContext(ctx context.Context) (*Caller, error) {
+	caller, ok := ctx.Value(callerKey{}).(*Caller)
+	if !ok || caller == nil || caller.User == nil {
+		return nil, errors.New("未认证的 MCP 请求")
+	}
+	if caller.token == "" {
+		return caller, nil
+	}
+	user, _, err := mcpauth.Authenticate(caller.token)
+	if err != nil {
+		return nil, err
+	}
+	return &Caller{User: user, IPAddress: caller.IPAddress, TokenPrefix: caller.TokenPrefix}, nil
+}
+
+// NewServer 创建 MCP 服务并注册工具
+// 必要性: AI 工具只能通过这些工具访问资源，每次调用都经过资源权限检查并记录审计
+func NewServer() *server.MCPServer {
+	s := server.NewMCPServer(serverName, serverVersion,
+		server.WithToolCapabilities(false),
+		server.WithRecovery(),
+		server.WithInstructions("ROMA 跳板机：先用 list_resources 查看可用资源，再用 run_command 或 query_database 操作；所有调用以令牌所属用户身份执行并记录审计。"),
+	)
+	registerTools(s)
+	return s
+}
+
+// ServeStdio 以 stdio 方式为令牌所属用户提供 MCP 服务，直到 in 关闭或 ctx 取消
+// 输入: token - MCP 令牌；in、out - JSON-RPC 输入输出（out 不能有其他输出混入）；errLog - 错误日志输出
+// 输出: error - 令牌无效或服务异常
+func ServeStdio(ctx context.Context, token string, in io.Reader, out io.Writer, errLog io.Writer) error {
+	user, record, err := mcpauth.Authenticate(token)
+	if err != nil {
+		return err
+	}
+	caller := &Caller{User: user, IPAddress: "local", TokenPrefix: record.Prefix, token: token}
+
+	stdio := server.NewStdioServer(NewServer())
+	stdio.SetErrorLogger(log.New(errLog, "mcp: ", log.LstdFlags))
+	stdio.SetContextFunc(func(ctx context.Context) context.Context {
+		return WithCaller(ctx, caller)
+	})
+	return stdio.Listen(ctx, in, out)
+}
+
+// GinHandler streamable HTTP 端点（无状态），需要在 MCPTokenAuth 之后挂载
+func GinHandler() gin.HandlerFunc {
+	// 工具的 context 派生自请求的 context，调用者随请求传入
+	httpServer := server.NewStreamableHTTPServer(NewServer(), server.WithStateLess(true))
+	return func(c *gin.Context) {
+		v, _ := c.Get("user")
+		user, ok := v.(*model.User)
+		if !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		caller := &Caller{User: user, IPAddress: c.ClientIP()}
+		if v, exists := c.Get("mcp_token"); exists {
+			if token, ok := v.(*model.MCPToken); ok {
+				caller.TokenPrefix = token.Prefix
+			}
+		}
+		httpServer.ServeHTTP(c.Writer, c.Request.WithContext(WithCaller(c.Request.Context(), caller)))
+	}
+}
+
+// Path streamable HTTP 端点路径
+func Path() string {
+	if cfg := global.CONFIG.MCP; cfg != nil && cfg.Path != "" {
+		return cfg.Path
+	}
+	return defaultPath
+}
+
+// Enabled 是否开放 streamable HTTP 端点
+func Enabled() bool {
+	return global.CONFIG.MCP != nil && global.CONFIG.MCP.Enabled
+}
@@ -0,0 +1,249 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"binrc.com/roma/core/api"
+	"binrc.com/roma/core/connect"
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils/logger"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxOutputBytes 单次工具调用返回的最大输出，超出部分截断，避免撑爆模型上下文
+const maxOutputBytes = 64 * 1024
+
+// listableTypes list_resources 支持的资源类型
+var listableTypes = []string{
+	constants.ResourceTypeLinux,
+	constants.ResourceTypeWindows,
+	constants.ResourceTypeDocker,
+	constants.ResourceTypeDatabase,
+	constants.ResourceTypeRouter,
+	constants.ResourceTypeSwitch,
+}
+
+// commandTypes run_command 支持的资源类型（通过 SSH 执行）
+var commandTypes = []string{
+	constants.ResourceTypeLinux,
+	constants.ResourceTypeDocker,
+	constants.ResourceTypeRouter,
+	constants.ResourceTypeSwitch,
+}
+
+// resourceItem list_resources 返回的资源
+type resourceItem struct {
+	Type string `json:"type"`
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func registerTools(s *server.MCPServer) {
+	s.AddTool(mcp.NewTool("list_resources",
+		mcp.WithDescription("列出当前用户可以访问的资源（主机、容器、数据库、网络设备）"),
+		mcp.WithString("type", mcp.Description("资源类型，为空表示全部"), mcp.Enum(listableTypes...)),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithDestructiveHintAnnotation(false),
+	), listResources)
+
+	s.AddTool(mcp.NewTool("run_command",
+		mcp.WithDescription("通过 SSH 在资源上非交互式执行一条命令并返回输出"),
+		mcp.WithString("type", mcp.Required(), mcp.Description("资源类型"), mcp.Enum(commandTypes...)),
+		mcp.WithNumber("id", mcp.Required(), mcp.Description("资源ID，来自 list_resources")),
+		mcp.WithString("command", mcp.Required(), mcp.Description("要执行的命令")),
+		mcp.WithDestructiveHintAnnotation(true),
+	), runCommand)
+
+	s.AddTool(mcp.NewTool("query_database",
+		mcp.WithDescription("在数据库资源上执行 SQL（多条语句用分号分隔）并返回结果"),
+		mcp.WithNumber("id", mcp.Required(), mcp.Description("数据库资源ID，来自 list_resources")),
+		mcp.WithString("query", mcp.Required(), mcp.Description("要执行的 SQL")),
+		mcp.WithDestructiveHintAnnotation(true),
+	), queryDatabase)
+}
+
+// listResources 返回调用者有 list 权限的资源
+func listResources(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	types := listableTypes
+	if t := strings.ToLower(req.GetString("type", "")); t != "" {
+		if !contains(listableTypes, t) {
+			return mcp.NewToolResultErrorf("不支持的资源类型 %s", t), nil
+		}
+		types = []string{t}
+	}
+
+	opUser := operation.NewUserOperation()
+	userRoles, err := opUser.GetUserRoles(caller.User.ID)
+	if err != nil {
+		return mcp.NewToolResultError("无法获取用户角色"), nil
+	}
+	// super/system 角色可以看到所有角色下的资源，其他用户只扫描自己的角色
+	scanRoles := userRoles
+	for _, role := range userRoles {
+		if permissions.IsSuperRole(role) || permissions.HasAllPermissions(role) {
+			allRoles, err := operation.NewRoleOperation().GetAllRoles()
+			if err != nil {
+				return mcp.NewToolResultError("无法获取角色列表"), nil
+			}
+			scanRoles = make([]*model.Role, 0, len(allRoles))
+			for i := range allRoles {
+				scanRoles = append(scanRoles, &allRoles[i])
+			}
+			break
+		}
+	}
+
+	opRes := operation.NewResourceOperation()
+	seen := make(map[string]bool)
+	items := []resourceItem{}
+	for _, resourceType := range types {
+		for _, role := range scanRoles {
+			resList, err := opRes.GetResourceListByRoleId(role.ID, resourceType)
+			if err != nil {
+				logger.Logger.Warning(fmt.Sprintf("MCP: failed to list %s resources for role %d: %v", resourceType, role.ID, err))
+				continue
+			}
+			for _, res := range resList {
+				key := fmt.Sprintf("%s/%d", resourceType, res.GetID())
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				if allowed, _ := permissions.CheckResourceAccessFrom(caller.User, userRoles, res.GetID(), resourceType, "list", caller.IPAddress); !allowed {
+					continue
+				}
+				items = append(items, resourceItem{Type: resourceType, ID: res.GetID(), Name: res.GetName()})
+			}
+		}
+		// 角色资源范围（标签、空间、名称、类型）选中的资源
+		for _, res := range permissions.ScopedResources(userRoles, resourceType, nil) {
+			key := fmt.Sprintf("%s/%d", resourceType, res.GetID())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if allowed, _ := permissions.CheckResourceAccessFrom(caller.User, userRoles, res.GetID(), resourceType, "list", caller.IPAddress); !allowed {
+				continue
+			}
+			items = append(items, resourceItem{Type: resourceType, ID: res.GetID(), Name: res.GetName()})
+		}
+		// 临时访问授权覆盖的资源
+		granted, err := permissions.GrantedResources(caller.User.ID, resourceType)
+		if err != nil {
+			logger.Logger.Warning(fmt.Sprintf("MCP: failed to list granted %s resources: %v", resourceType, err))
+		}
+		for _, res := range granted {
+			key := fmt.Sprintf("%s/%d", resourceType, res.GetID())
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			items = append(items, resourceItem{Type: resourceType, ID: res.GetID(), Name: res.GetName()})
+		}
+	}
+
+	recordToolCall(caller, "mcp_list_resources", "normal", "", nil, fmt.Sprintf("列出资源，共 %d 个", len(items)), "success", "")
+	return mcp.NewToolResultJSON(map[string]interface{}{"resources": items})
+}
+
+// runCommand 在 SSH 类资源上执行命令
+func runCommand(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	resourceType, err := req.RequireString("type")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	resourceType = strings.ToLower(resourceType)
+	if !contains(commandTypes, resourceType) {
+		return mcp.NewToolResultErrorf("资源类型 %s 不支持执行命令", resourceType), nil
+	}
+	id, err := req.RequireInt("id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	command, err := req.RequireString("command")
+	if err != nil || strings.TrimSpace(command) == "" {
+		return mcp.NewToolResultError("命令不能为空"), nil
+	}
+	return execute(caller, "mcp_run_command", resourceType, int64(id), command)
+}
+
+// queryDatabase 在数据库资源上执行 SQL
+func queryDatabase(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	caller, err := callerFromContext(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	id, err := req.RequireInt("id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	query, err := req.RequireString("query")
+	if err != nil || strings.TrimSpace(query) == "" {
+		return mcp.NewToolResultError("SQL 不能为空"), nil
+	}
+	return execute(caller, "mcp_query_database", constants.ResourceTypeDatabase, int64(id), query)
+}
+
+// execute 检查资源的 use 权限后执行命令，无论成功与否都记录审计
+func execute(caller *Caller, action, resourceType string, resourceID int64, command string) (*mcp.CallToolResult, error) {
+	res, err := operation.NewResourceOperation().GetResourceByID(resourceID, resourceType)
+	if err != nil {
+		return mcp.NewToolResultErrorf("资源 %s/%d 不存在", resourceType, resourceID), nil
+	}
+	description := fmt.Sprintf("执行: %s", command)
+	if allowed, reason := permissions.CheckResourceAccessFrom(caller.User, nil, resourceID, resourceType, "use", caller.IPAddress); !allowed {
+		recordToolCall(caller, action, "high_risk", resourceType, res, description, "failed", "permission denied: "+reason)
+		return mcp.NewToolResultErrorf("没有权限访问资源 %s: %s", res.GetName(), reason), nil
+	}
+
+	output, err := connect.ExecuteCommand(caller.User.Username, caller.IPAddress, res, resourceType, command)
+	if err != nil {
+		recordToolCall(caller, action, "high_risk", resourceType, res, description, "failed", err.Error())
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	recordToolCall(caller, action, "high_risk", resourceType, res, description, "success", "")
+
+	if len(output) > maxOutputBytes {
+		output = output[:maxOutputBytes] + fmt.Sprintf("\n... 输出已截断（共 %d 字节）", len(output))
+	}
+	return mcp.NewToolResultText(output), nil
+}
+
+// recordToolCall 以令牌所属用户身份记录 MCP 工具调用
+func recordToolCall(caller *Caller, action, actionType, resourceType string, res model.Resource, description, status, errorMessage string) {
+	var resourceID uint
+	resourceName := ""
+	if res != nil {
+		resourceID = uint(res.GetID())
+		resourceName = res.GetName()
+	}
+	if caller.TokenPrefix != "" {
+		description = fmt.Sprintf("[MCP %s] %s", caller.TokenPrefix, description)
+	} else {
+		description = "[MCP] " + description
+	}
+	api.RecordTUIActionAuditLog(caller.User.Username, action, actionType, resourceType, resourceID, resourceName, description, caller.IPAddress, status, errorMessage)
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package mfa
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTooManyAttempts 临时令牌或用户的验证码错误次数已达上限
+	ErrTooManyAttempts = errors.New("too many verification attempts")
+	// ErrTokenUsed 临时令牌已经完成过登录
+	ErrTokenUsed = errors.New("login token already used")
+)
+
+const (
+	// maxLoginAttempts 每个临时令牌允许的验证码错误次数，同一用户在 loginAttemptWindow 内的错误次数上限也是它
+	maxLoginAttempts = 5
+	// loginAttemptWindow 用户验证码错误次数的统计窗口，达到上限后在窗口结束前拒绝该用户的第二步登录
+	loginAttemptWindow = 15 * time.Minute
+)
+
+// pendingToken 临时令牌的使用情况
+type pendingToken struct {
+	failures int
+	used     bool
+	expires  time.Time
+}
+
+// userAttempts 用户最近的验证码错误次数
+type userAttempts struct {
+	failures int
+	last     time.Time
+}
+
+// loginAttempts 登录第二步的验证码尝试记录：按临时令牌和用户分别计数，不依赖客户端提供的标识
+type loginAttempts struct {
+	mu     sync.Mutex
+	tokens map[string]*pendingToken
+	users  map[uint]*userAttempts
+}
+
+var attempts = &loginAttempts{
+	tokens: make(map[string]*pendingToken),
+	users:  make(map[uint]*userAttempts),
+}
+
+// VerifyLogin 登录第二步校验验证码
+// 输入: userID - 临时令牌中的用户ID；tokenID - 临时令牌 ID；expires - 临时令牌到期时间；code - 验证码或恢复码
+// 输出: bool - 是否使用了恢复码；error - 除 Verify 的错误外，令牌已使用返回 ErrTokenUsed，错误次数达到上限返回 ErrTooManyAttempts
+// 必要性: 临时令牌在 5 分钟内可重复提交，需要限制每个令牌和每个用户的猜测次数，登录成功后令牌作废
+func VerifyLogin(userID uint, tokenID string, expires time.Time, code string) (bool, error) {
+	if err := attempts.begin(userID, tokenID, expires, time.Now()); err != nil {
+		return false, err
+	}
+	usedRecovery, err := Verify(userID, code)
+	if err != nil {
+		attempts.fail(userID, tokenID, errors.Is(err, ErrInvalidCode), time.Now())
+		return false, err
+	}
+	if !attempts.succeed(userID, tokenID) {
+		return false, ErrTokenUsed
+	}
+	return usedRecovery, nil
+}
+
+// begin 检查令牌和用户是否还能尝试，并预先计入一次错误，防止并发请求绕过次数限制
+func (a *loginAttempts) begin(userID uint, tokenID string, expires, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.prune(now)
+
+	token := a.tokens[tokenID]
+	if token == nil {
+		token = &pendingToken{expires: expires}
+		a.tokens[tokenID] = token
+	}
+	if token.used {
+		return ErrTokenUsed
+	}
+	user := a.users[userID]
+	if user == nil {
+		user = &userAttempts{}
+		a.users[userID] = user
+	}
+	if token.failures >= maxLoginAttempts || user.failures >= maxLoginAttempts {
+		return ErrTooManyAttempts
+	}
+	token.failures++
+	user.failures++
+	user.last = now
+	return nil
+}
+
+// fail 校验未通过；不是验证码错误（如数据库错误）时撤销预先计入的错误
+func (a *loginAttempts) fail(userID uint, tokenID string, invalidCode bool, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if invalidCode {
+		if user := a.users[userID]; user != nil {
+			user.last = now
+		}
+		return
+	}
+	if token := a.tokens[tokenID]; token != nil && token.failures > 0 {
+		token.failures--
+	}
+	if user := a.users[userID]; user != nil && user.failures > 0 {
+		user.failures--
+	}
+}
+
+// succeed 校验通过：令牌作废并清除用户的错误次数，令牌已被并发请求使用时返回 false
+func (a *loginAttempts) succeed(userID uint, tokenID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	token := a.tokens[tokenID]
+	if token == nil || token.used {
+		return false
+	}
+	token.used = true
+	delete(a.users, userID)
+	return true
+}
+
+// prune 清理已过期的令牌和统计窗口已结束的用户记录
+func (a *loginAttempts) prune(now time.Time) {
+	for id, token := range a.tokens {
+		if now.After(token.expires) {
+			delete(a.tokens, id)
+		}
+	}
+	for id, user := range a.users {
+		if now.Sub(user.last) > loginAttemptWindow {
+			delete(a.users, id)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils"
+)
+
+var (
+	// ErrNotEnrolled 用户没有绑定 TOTP
+	ErrNotEnrolled = errors.New("totp is not enrolled")
+	// ErrAlreadyEnrolled 用户已经绑定 TOTP，需要先重置
+	ErrAlreadyEnrolled = errors.New("totp is already enabled")
+	// ErrInvalidCode 验证码或恢复码错误（或已使用过）
+	ErrInvalidCode = errors.New("invalid verification code")
+)
+
+const (
+	// issuer 验证器 App 中显示的服务名称
+	issuer = "ROMA"
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+)
+
+// Status 用户的二次验证状态
+type Status struct {
+	Enabled                bool       `json:"enabled"`                  // 已绑定 TOTP
+	Pending                bool       `json:"pending"`                  // 已开始绑定，等待验证码确认
+	Required               bool       `json:"required"`                 // 用户的角色要求 TOTP
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"` // 剩余可用的恢复码数量
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+}
+
+// GetStatus 获取用户的二次验证状态
+func GetStatus(user *model.User) (*Status, error) {
+	userMFA, err := operation.NewUserMFAOperation().GetUserMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{Required: IsRequiredByRole(user.ID)}
+	if userMFA != nil {
+		status.Enabled = userMFA.Enabled
+		status.Pending = !userMFA.Enabled
+		status.EnabledAt = userMFA.EnabledAt
+		status.RecoveryCodesRemaining = len(decodeRecoveryCodes(userMFA.RecoveryCodes))
+	}
+	return status, nil
+}
+
+// IsEnabled 用户是否已绑定并启用 TOTP
+func IsEnabled(userID uint) (bool, error) {
+	userMFA, err := operation.NewUserMFAOperation().GetUserMFA(userID)
+	if err != nil {
+		return false, err
+	}
+	return userMFA != nil && userMFA.Enabled, nil
+}
+
+// IsRequiredByRole 用户的角色是否要求 TOTP（require_totp）
+func IsRequiredByRole(userID uint) bool {
+	roles, err := operation.NewUserOperation().GetUserRoles(userID)
+	if err != nil {
+		return false
+	}
+	return permissions.IsTOTPRequired(roles)
+}
+
+// BeginEnrollment 开始绑定 TOTP：生成新密钥（加密保存），确认前不生效
+// 输出: secret - base32 密钥；uri - otpauth:// 地址（可生成二维码）
+func BeginEnrollment(user *model.User) (string, string, error) {
+	op := operation.NewUserMFAOperation()
+	userMFA, err := op.GetUserMFA(user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if userMFA != nil && userMFA.Enabled {
+		return "", "", ErrAlreadyEnrolled
+	}
+	if userMFA == nil {
+		userMFA = &model.UserMFA{UserID: user.ID}
+	}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	encrypted, err := utils.EncryptPassword(secret)
+	if err != nil {
+		return "", "", err
+	}
+	userMFA.Secret = encrypted
+	userMFA.RecoveryCodes = ""
+	userMFA.LastUsedStep = 0
+	if err := op.SaveUserMFA(userMFA); err != nil {
+		return "", "", err
+	}
+	return secret, ProvisioningURI(issuer, user.Username, secret), nil
+}
+
+// ConfirmEnrollment 用验证码确认绑定，成功后启用 TOTP 并返回恢复码（只显示这一次）
+func ConfirmEnrollment(user *model.User, code string) ([]string, error) {
+	op := operation.NewUserMFAOperation()
+	userMFA, err := op.GetUserMFA(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if userMFA == nil {
+		return nil, ErrNotEnrolled
+	}
+	if userMFA.Enabled {
+		return nil, ErrAlreadyEnrolled
+	}
+	step, ok := validateTOTP(userMFA, code)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	userMFA.Enabled = true
+	userMFA.EnabledAt = &now
+	userMFA.LastUsedStep = step
+	userMFA.RecoveryCodes = hashed
+	if err := op.SaveUserMFA(userMFA); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify 校验已启用 TOTP 用户的验证码或恢复码
+// 输入: userID - 用户ID；code - 6 位验证码或恢复码
+// 输出: bool - 是否使用了恢复码；error - 未绑定时返回 ErrNotEnrolled，校验失败返回 ErrInvalidCode
+// 同一个验证码只能使用一次，恢复码使用后作废
+func Verify(userID uint, code string) (bool, error) {
+	op := operation.NewUserMFAOperation()
+	userMFA, err := op.GetUserMFA(userID)
+	if err != nil {
+		return false, err
+	}
+	if userMFA == nil || !userMFA.Enabled {
+		return false, ErrNotEnrolled
+	}
+
+	if step, ok := validateTOTP(userMFA, code); ok {
+		used, err := op.UseTOTPStep(userMFA.ID, step)
+		if err != nil {
+			return false, err
+		}
+		if !used {
+			return false, ErrInvalidCode
+		}
+		return false, nil
+	}
+
+	remaining, ok := consumeRecoveryCode(userMFA.RecoveryCodes, code)
+	if !ok {
+		return false, ErrInvalidCode
+	}
+	used, err := op.UseRecoveryCodes(userMFA.ID, userMFA.RecoveryCodes, remaining)
+	if err != nil {
+		return false, err
+	}
+	if !used {
+		return false, ErrInvalidCode
+	}
+	return true, nil
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧恢复码全部作废
+func RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	if _, err := Verify(userID, code); err != nil {
+		return nil, err
+	}
+	op := operation.NewUserMFAOperation()
+	userMFA, err := op.GetUserMFA(userID)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	userMFA.RecoveryCodes = hashed
+	if err := op.SaveUserMFA(userMFA); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Reset 删除用户的 TOTP 绑定
+func Reset(userID uint) error {
+	return operation.NewUserMFAOperation().DeleteUserMFA(userID)
+}
+
+// validateTOTP 解密密钥并校验 6 位验证码
+func validateTOTP(userMFA *model.UserMFA, code string) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	secret, err := utils.DecryptPassword(userMFA.Secret)
+	if err != nil {
+		return 0, false
+	}
+	return ValidateCode(secret, code, time.Now())
+}
+
+// generateRecoveryCodes 生成恢复码，返回明文（展示给用户）和 bcrypt 哈希列表（保存）
+func generateRecoveryCodes() ([]string, string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 6)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf)[:10])
+		hash, err := utils.HashPassword(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hash)
+	}
+	payload, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", err
+	}
+	return codes, string(payload), nil
+}
+
+// consumeRecoveryCode 查找匹配的恢复码，返回去掉它之后的列表
+func consumeRecoveryCode(stored, code string) (string, bool) {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	if code == "" {
+		return "", false
+	}
+	hashes := decodeRecoveryCodes(stored)
+	for i, hash := range hashes {
+		if utils.CheckPassword(hash, code) {
+			remaining := append(append([]string{}, hashes[:i]...), hashes[i+1:]...)
+			payload, err := json.Marshal(remaining)
+			if err != nil {
+				return "", false
+			}
+			return string(payload), true
+		}
+	}
+	return "", false
+}
+
+func decodeRecoveryCodes(stored string) []string {
+	var hashes []string
+	if stored == "" {
+		return hashes
+	}
+	if err := json.Unmarshal([]byte(stored), &hashes); err != nil {
+		return nil
+	}
+	return hashes
+}
@@ -0,0 +1,176 @@
+package mfa
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/utils"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("ROMA_ENCRYPTION_KEY", "mfa-test-encryption-key-32bytes!")
+	db, err := gorm.Open(sqlite.Open("file:mfa?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.AutoMigrate(&model.UserMFA{}); err != nil {
+		panic(err)
+	}
+	global.CDB = db
+	os.Exit(m.Run())
+}
+
+// enroll 为用户写入已启用的 TOTP 绑定，返回密钥和恢复码
+func enroll(t *testing.T, userID uint) (string, []string) {
+	t.Helper()
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := utils.EncryptPassword(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashed, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	userMFA := &model.UserMFA{UserID: userID, Secret: encrypted, Enabled: true, EnabledAt: &now, RecoveryCodes: hashed}
+	if err := global.CDB.Create(userMFA).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { global.CDB.Where("user_id = ?", userID).Delete(&model.UserMFA{}) })
+	return secret, codes
+}
+
+func codeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := GenerateCode(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// resetAttempts 每个测试使用新的尝试记录
+func resetAttempts(t *testing.T) {
+	t.Helper()
+	old := attempts
+	attempts = &loginAttempts{tokens: make(map[string]*pendingToken), users: make(map[uint]*userAttempts)}
+	t.Cleanup(func() { attempts = old })
+}
+
+func TestVerify(t *testing.T) {
+	secret, recovery := enroll(t, 1)
+	now := time.Now()
+	current := codeAt(t, secret, now)
+
+	// 按顺序执行：后面的步骤依赖前面已使用的验证码
+	steps := []struct {
+		name         string
+		userID       uint
+		code         string
+		wantRecovery bool
+		wantErr      error
+	}{
+		{name: "not enrolled", userID: 2, code: current, wantErr: ErrNotEnrolled},
+		{name: "wrong code", userID: 1, code: "000000x", wantErr: ErrInvalidCode},
+		{name: "current code", userID: 1, code: " " + current[:3] + " " + current[3:], wantErr: nil},
+		{name: "replayed code", userID: 1, code: current, wantErr: ErrInvalidCode},
+		{name: "older step after newer", userID: 1, code: codeAt(t, secret, now.Add(-totpPeriod*time.Second)), wantErr: ErrInvalidCode},
+		{name: "recovery code", userID: 1, code: recovery[0], wantRecovery: true},
+		{name: "recovery code reused", userID: 1, code: recovery[0], wantErr: ErrInvalidCode},
+		{name: "recovery code without dash", userID: 1, code: recovery[1][:5] + recovery[1][6:], wantRecovery: true},
+	}
+	for _, step := range steps {
+		usedRecovery, err := Verify(step.userID, step.code)
+		if !errors.Is(err, step.wantErr) || usedRecovery != step.wantRecovery {
+			t.Fatalf("%s: Verify() = %v, %v, want %v, %v", step.name, usedRecovery, err, step.wantRecovery, step.wantErr)
+		}
+	}
+	status, err := GetStatus(&model.User{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.RecoveryCodesRemaining != recoveryCodeCount-2 {
+		t.Errorf("RecoveryCodesRemaining = %d, want %d", status.RecoveryCodesRemaining, recoveryCodeCount-2)
+	}
+}
+
+func TestVerifyLogin(t *testing.T) {
+	expires := time.Now().Add(5 * time.Minute)
+
+	t.Run("token is single use", func(t *testing.T) {
+		resetAttempts(t)
+		secret, recovery := enroll(t, 10)
+		if _, err := VerifyLogin(10, "token-a", expires, codeAt(t, secret, time.Now())); err != nil {
+			t.Fatalf("VerifyLogin() error: %v", err)
+		}
+		if _, err := VerifyLogin(10, "token-a", expires, recovery[0]); !errors.Is(err, ErrTokenUsed) {
+			t.Fatalf("reused token: err = %v, want ErrTokenUsed", err)
+		}
+	})
+
+	t.Run("token rejected after too many wrong codes", func(t *testing.T) {
+		resetAttempts(t)
+		_, recovery := enroll(t, 11)
+		for i := 0; i < maxLoginAttempts; i++ {
+			if _, err := VerifyLogin(11, "token-b", expires, "000000"); !errors.Is(err, ErrInvalidCode) {
+				t.Fatalf("attempt %d: err = %v, want ErrInvalidCode", i+1, err)
+			}
+		}
+		if _, err := VerifyLogin(11, "token-b", expires, recovery[0]); !errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+		}
+	})
+
+	t.Run("user limited across tokens", func(t *testing.T) {
+		resetAttempts(t)
+		_, recovery := enroll(t, 12)
+		for i := 0; i < maxLoginAttempts; i++ {
+			VerifyLogin(12, "token-"+string(rune('c'+i)), expires, "000000")
+		}
+		if _, err := VerifyLogin(12, "token-new", expires, recovery[0]); !errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+		}
+		// 其他用户不受影响
+		_, other := enroll(t, 13)
+		if _, err := VerifyLogin(13, "token-other", expires, other[0]); err != nil {
+			t.Fatalf("other user: %v", err)
+		}
+	})
+
+	t.Run("success clears user failures", func(t *testing.T) {
+		resetAttempts(t)
+		_, recovery := enroll(t, 14)
+		for i := 0; i < maxLoginAttempts-1; i++ {
+			VerifyLogin(14, "token-d", expires, "000000")
+		}
+		if _, err := VerifyLogin(14, "token-e", expires, recovery[0]); err != nil {
+			t.Fatalf("VerifyLogin() error: %v", err)
+		}
+		if _, err := VerifyLogin(14, "token-f", expires, "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("err = %v, want ErrInvalidCode", err)
+		}
+	})
+
+	t.Run("expired entries pruned", func(t *testing.T) {
+		resetAttempts(t)
+		start := time.Now()
+		if err := attempts.begin(15, "token-g", start.Add(time.Minute), start); err != nil {
+			t.Fatal(err)
+		}
+		attempts.prune(start.Add(loginAttemptWindow + time.Minute))
+		if len(attempts.tokens) != 0 || len(attempts.users) != 0 {
+			t.Errorf("prune left %d tokens, %d users", len(attempts.tokens), len(attempts.users))
+		}
+	})
+}
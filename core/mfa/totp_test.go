@@ -0,0 +1,85 @@
+package mfa
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录 B 的 SHA1 测试密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := GenerateCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateCode(%d) error: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+	// 密钥大小写、空格和填充不影响结果
+	got, err := GenerateCode(" "+strings.ToLower(rfcSecret[:16])+" "+rfcSecret[16:]+"==", time.Unix(59, 0))
+	if err != nil || got != "287082" {
+		t.Errorf("GenerateCode(normalized secret) = %s, %v", got, err)
+	}
+	if _, err := GenerateCode("not base32!", time.Now()); err == nil {
+		t.Error("GenerateCode accepted an invalid secret")
+	}
+}
+
+func TestValidateCode(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+	codeAt := func(offset int64) string {
+		code, err := GenerateCode(rfcSecret, now.Add(time.Duration(offset)*totpPeriod*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: rfcSecret, code: codeAt(0), wantStep: step, wantOK: true},
+		{name: "previous step", secret: rfcSecret, code: codeAt(-1), wantStep: step - 1, wantOK: true},
+		{name: "next step", secret: rfcSecret, code: codeAt(1), wantStep: step + 1, wantOK: true},
+		{name: "two steps behind", secret: rfcSecret, code: codeAt(-2)},
+		{name: "two steps ahead", secret: rfcSecret, code: codeAt(2)},
+		{name: "wrong length", secret: rfcSecret, code: codeAt(0)[:5]},
+		{name: "invalid secret", secret: "not base32!", code: codeAt(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateCode(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateCode() = %d, %v, want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	got := ProvisioningURI("ROMA", "alice", rfcSecret)
+	for _, part := range []string{"otpauth://totp/ROMA:alice?", "secret=" + rfcSecret, "issuer=ROMA", "digits=6", "period=30"} {
+		if !strings.Contains(got, part) {
+			t.Errorf("ProvisioningURI() = %s, missing %s", got, part)
+		}
+	}
+}
@@ -31,6 +31,18 @@ type AuthFailureTracker struct {
 
 var globalAuthFailureTracker *AuthFailureTracker
 
+// ContextKeyMFAPending 登录接口在密码通过、等待 TOTP 验证码时设置，此时不清除失败计数
+const ContextKeyMFAPending = "auth_mfa_pending"
+
+// mfaLoginPath 登录第二步（TOTP 验证码）的路由
+const mfaLoginPath = "/api/v1/auth/login/mfa"
+
+// authFailurePaths 需要追踪认证失败的路由（密码登录和 TOTP 验证码）
+var authFailurePaths = map[string]bool{
+	"/api/v1/auth/login": true,
+	mfaLoginPath:         true,
+}
+
 // InitAuthFailureTracker 初始化认证失败追踪器
 // 输入: maxFailures - 最大失败次数；banDuration - 封禁时长；failureWindow - 失败计数窗口；exponentialBackoff - 是否启用指数退避
 // 输出: 无
@@ -176,10 +188,11 @@ func (aft *AuthFailureTracker) IsBanned(identifier string) (bool, time.Time) {
 }
 
 // getIdentifier 获取客户端标识符（优先使用浏览器指纹，否则使用IP）
+// 验证码接口只按 IP 计数：浏览器指纹由客户端提供，可以随意更换；每个临时令牌和用户的错误次数由 mfa.VerifyLogin 限制
 func getIdentifier(c *gin.Context) string {
 	// 优先使用浏览器指纹
 	fingerprint := c.GetHeader("X-Browser-Fingerprint")
-	if fingerprint != "" {
+	if fingerprint != "" && c.Request.URL.Path != mfaLoginPath {
 		return fingerprint
 	}
 
@@ -202,7 +215,7 @@ func getIdentifier(c *gin.Context) string {
 func AuthFailureMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 仅对认证相关路由生效
-		if c.Request.URL.Path != "/api/v1/auth/login" {
+		if !authFailurePaths[c.Request.URL.Path] {
 			c.Next()
 			return
 		}
@@ -242,8 +255,8 @@ func AuthFailureMiddleware() gin.HandlerFunc {
 					return
 				}
 			}
-		} else if c.Writer.Status() == http.StatusOK {
-			// 认证成功，清除失败记录
+		} else if c.Writer.Status() == http.StatusOK && !c.GetBool(ContextKeyMFAPending) {
+			// 认证成功，清除失败记录（只验证了密码时不清除，避免无限次猜测验证码）
 			globalAuthFailureTracker.RecordSuccess(identifier)
 		}
 	}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// 临时访问申请的状态
+const (
+	AccessRequestPending   = "pending"   // 等待审批
+	AccessRequestApproved  = "approved"  // 已批准，有效期内生效
+	AccessRequestDenied    = "denied"    // 已拒绝
+	AccessRequestCancelled = "cancelled" // 申请人在审批前撤回
+	AccessRequestExpired   = "expired"   // 到期自动失效
+	AccessRequestRevoked   = "revoked"   // 到期前被提前收回
+)
+
+// AccessRequest 临时访问申请，批准后在有效期内视同拥有资源（或整个空间）的 list/get/use 权限
+type AccessRequest struct {
+	ID              uint       `gorm:"column:id;primaryKey" json:"id"`                                      // 申请的唯一标识，作为主键
+	UserID          uint       `gorm:"column:user_id;index;not null" json:"user_id"`                        // 申请人
+	Username        string     `gorm:"column:username;size:100" json:"username"`                            // 申请人用户名
+	ResourceType    string     `gorm:"column:resource_type;size:50;index" json:"resource_type,omitempty"`   // 申请单个资源时的资源类型
+	ResourceID      int64      `gorm:"column:resource_id;index" json:"resource_id,omitempty"`               // 申请单个资源时的资源ID
+	ResourceName    string     `gorm:"column:resource_name;size:255" json:"resource_name,omitempty"`        // 资源名称
+	SpaceID         uint       `gorm:"column:space_id;index" json:"space_id,omitempty"`                     // 申请整个空间时的空间ID
+	SpaceName       string     `gorm:"column:space_name;size:100" json:"space_name,omitempty"`              // 空间名称
+	Reason          string     `gorm:"column:reason;type:text" json:"reason"`                               // 申请理由
+	DurationSeconds int64      `gorm:"column:duration_seconds;not null" json:"duration_seconds"`            // 申请时长，批准时开始计时
+	Status          string     `gorm:"column:status;size:20;index;not null" json:"status"`                  // 状态
+	ApproverID      uint       `gorm:"column:approver_id" json:"approver_id,omitempty"`                     // 审批人
+	ApproverName    string     `gorm:"column:approver_name;size:100" json:"approver_name,omitempty"`        // 审批人用户名
+	DecisionComment string     `gorm:"column:decision_comment;type:text" json:"decision_comment,omitempty"` // 审批意见或收回原因
+	DecidedAt       *time.Time `gorm:"column:decided_at" json:"decided_at,omitempty"`                       // 审批时间
+	ExpiresAt       *time.Time `gorm:"column:expires_at;index" json:"expires_at,omitempty"`                 // 授权到期时间（批准时间 + 时长）
+	EndedAt         *time.Time `gorm:"column:ended_at" json:"ended_at,omitempty"`                           // 撤回、到期或收回的时间
+	CreatedAt       time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`                  // 申请时间
+	UpdatedAt       time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                  // 更新时间
+}
+
+// TableName 指定表名
+func (AccessRequest) TableName() string {
+	return "access_requests"
+}
+
+// Target 申请对象的描述，如 linux/web-01 或 space/production
+func (r *AccessRequest) Target() string {
+	if r.SpaceID != 0 {
+		return "space/" + r.SpaceName
+	}
+	return r.ResourceType + "/" + r.ResourceName
+}
+
+// IsActive 已批准且未到期
+func (r *AccessRequest) IsActive(now time.Time) bool {
+	return r.Status == AccessRequestApproved && r.ExpiresAt != nil && now.Before(*r.ExpiresAt)
+}
@@ -3,11 +3,24 @@ package model
 import "time"
 
 // Apikey 访问凭证结构体
+// 凭证属于某个用户，请求以该用户身份执行，权限为用户权限与 Scopes 的交集
 type Apikey struct {
-	ID          uint      `gorm:"column:id;primaryKey;autoIncrement:true" json:"id"`                  // 凭据的唯一标识，作为主键
-	Apikey      string    `gorm:"column:api_key;unique;not null" json:"api_key"`                      // 访问凭证据标识符
-	Description string    `gorm:"type:varchar(1024);column:description" json:"description,omitempty"` // 凭据描述
-	ExpiresAt   time.Time `gorm:"not null;default:'2129-09-09 09:09:09'" json:"expires_at"`           // 凭据的过期日期
-	CreatedAt   time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`                 // 创建时间
-	UpdatedAt   time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                 // 更新时间
+	ID          uint          `gorm:"column:id;primaryKey;autoIncrement:true" json:"id"`                  // 凭据的唯一标识，作为主键
+	Apikey      string        `gorm:"column:api_key;unique;not null" json:"-"`                            // 访问凭证的 SHA-256，明文只在创建时返回一次
+	KeyPrefix   string        `gorm:"column:key_prefix;size:32" json:"key_prefix"`                        // 明文前缀，用于识别凭证
+	UserID      uint          `gorm:"column:user_id;index" json:"user_id"`                                // 所属用户
+	Scopes      []ApikeyScope `gorm:"column:scopes;type:text;serializer:json" json:"scopes"`              // 权限范围，为空表示继承用户的全部权限
+	Description string        `gorm:"type:varchar(1024);column:description" json:"description,omitempty"` // 凭据描述
+	ExpiresAt   time.Time     `gorm:"not null;default:'2129-09-09 09:09:09'" json:"expires_at"`           // 凭据的过期日期
+	LastUsedAt  *time.Time    `gorm:"column:last_used_at" json:"last_used_at,omitempty"`                  // 最近一次使用时间
+	LastUsedIP  string        `gorm:"column:last_used_ip;size:64" json:"last_used_ip,omitempty"`          // 最近一次使用的 IP
+	CreatedAt   time.Time     `gorm:"column:created_at;autoCreateTime" json:"created_at"`                 // 创建时间
+	UpdatedAt   time.Time     `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                 // 更新时间
+}
+
+// ApikeyScope API Key 的一条权限范围，如 resource 的 list、use 操作，限定在某个空间
+type ApikeyScope struct {
+	Target  string   `json:"target"`             // 权限目标：user、resource、session 等，* 表示全部
+	Actions []string `json:"actions"`            // 允许的操作，* 表示全部
+	SpaceID uint     `json:"space_id,omitempty"` // 限定空间（仅对 resource 生效），0 表示不限
 }
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// KnownHost 上游主机密钥记录（按资源 + 地址固定，类似 known_hosts）
+type KnownHost struct {
+	ID                 uint       `gorm:"column:id;primaryKey" json:"id"`                                                               // 记录的唯一标识，作为主键
+	ResourceType       string     `gorm:"column:resource_type;type:varchar(50);uniqueIndex:idx_known_host_target" json:"resource_type"` // 资源类型
+	ResourceID         uint       `gorm:"column:resource_id;uniqueIndex:idx_known_host_target" json:"resource_id"`                      // 资源ID（未知时为0）
+	Host               string     `gorm:"column:host;type:varchar(255);uniqueIndex:idx_known_host_target" json:"host"`                  // 上游地址 host:port
+	KeyType            string     `gorm:"column:key_type;type:varchar(64)" json:"key_type"`                                             // 已固定的密钥类型
+	PublicKey          string     `gorm:"column:public_key;type:text" json:"public_key"`                                                // 已固定的公钥（authorized_keys 格式）
+	Fingerprint        string     `gorm:"column:fingerprint;type:varchar(128)" json:"fingerprint"`                                      // 已固定公钥的 SHA256 指纹
+	PendingPublicKey   string     `gorm:"column:pending_public_key;type:text" json:"pending_public_key"`                                // 最近一次不匹配时上游提供的公钥，等待管理员确认
+	PendingFingerprint string     `gorm:"column:pending_fingerprint;type:varchar(128)" json:"pending_fingerprint"`                      // 待确认公钥的 SHA256 指纹
+	LastSeenAt         *time.Time `gorm:"column:last_seen_at" json:"last_seen_at"`                                                      // 最近一次校验通过的时间
+	CreatedAt          time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`                                           // 首次固定时间
+	UpdatedAt          time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`                                           // 更新时间
+}
+
+// TableName 指定表名
+func (KnownHost) TableName() string {
+	return "known_hosts"
+}
+
+// HasPendingKey 是否存在待确认的新密钥
+func (k *KnownHost) HasPendingKey() bool {
+	return k.PendingFingerprint != ""
+}
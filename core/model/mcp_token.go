@@ -0,0 +1,15 @@
+package model
+
+// MCPToken MCP 访问令牌，AI 工具通过它以所属用户的身份调用 MCP 工具
+type MCPToken struct {
+	ID         uint   `gorm:"primarykey" json:"id"`
+	Token      string `gorm:"type:varchar(255);uniqueIndex;not null;comment:令牌哈希" json:"-"` // 令牌的 SHA-256，明文只在签发时返回一次
+	Prefix     string `gorm:"type:varchar(32);comment:令牌前缀" json:"prefix"`                  // 明文前缀，用于识别令牌
+	Name       string `gorm:"type:varchar(100);comment:令牌名称" json:"name"`                   // 用途说明，如使用该令牌的 AI 工具
+	UserID     uint   `gorm:"not null;index;comment:用户ID" json:"user_id"`                   // 所属用户
+	Username   string `gorm:"type:varchar(100);comment:用户名" json:"username"`                // 签发时的用户名
+	ExpiresAt  int64  `gorm:"not null;comment:过期时间戳" json:"expires_at"`                     // 过期时间（Unix 秒）
+	LastUsedAt int64  `gorm:"comment:最近使用时间戳" json:"last_used_at,omitempty"`                // 最近一次使用时间（Unix 秒）
+	CreatedAt  int64  `gorm:"autoCreateTime;comment:创建时间" json:"created_at"`                // 签发时间（Unix 秒）
+	UpdatedAt  int64  `gorm:"autoUpdateTime;comment:更新时间" json:"updated_at"`                // 更新时间（Unix 秒）
+}
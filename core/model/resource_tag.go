@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// ResourceTag 资源标签关联，标签为 Tag 中的键值对（Label=Value）
+type ResourceTag struct {
+	ID           uint      `gorm:"column:id;primaryKey" json:"id"`
+	ResourceID   int64     `gorm:"column:resource_id;index" json:"resource_id"`     // 资源ID
+	ResourceType string    `gorm:"column:resource_type;index" json:"resource_type"` // 资源类型
+	TagID        int64     `gorm:"column:tag_id;index" json:"tag_id"`               // 标签ID
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+
+	// 关联关系
+	Tag *Tag `gorm:"foreignKey:TagID" json:"tag,omitempty"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// SessionRecording 终端会话录像记录（asciicast v2 格式）
+type SessionRecording struct {
+	ID           uint       `gorm:"column:id;primaryKey" json:"id"`                                // 录像记录的唯一标识，作为主键
+	AuditLogID   uint       `gorm:"column:audit_log_id;index" json:"audit_log_id"`                 // 关联的审计日志ID
+	SessionID    string     `gorm:"column:session_id;type:varchar(128);index" json:"session_id"`   // SSH 会话ID
+	UserID       uint       `gorm:"column:user_id;index" json:"user_id"`                           // 发起会话的用户ID
+	Username     string     `gorm:"column:username;type:varchar(255);not null" json:"username"`    // 发起会话的用户名
+	ResourceType string     `gorm:"column:resource_type;type:varchar(255)" json:"resource_type"`   // 资源类型
+	ResourceID   uint       `gorm:"column:resource_id;index" json:"resource_id"`                   // 资源ID
+	ResourceName string     `gorm:"column:resource_name;type:varchar(255)" json:"resource_name"`   // 资源名称
+	Host         string     `gorm:"column:host;type:varchar(255)" json:"host"`                     // 实际连接的上游地址
+	IPAddress    string     `gorm:"column:ip_address;type:varchar(45)" json:"ip_address"`          // 客户端来源IP
+	FilePath     string     `gorm:"column:file_path;type:varchar(1024);not null" json:"file_path"` // 录像文件路径
+	Size         int64      `gorm:"column:size" json:"size"`                                       // 录像文件大小（字节）
+	StartedAt    time.Time  `gorm:"column:started_at" json:"started_at"`                           // 会话开始时间
+	EndedAt      *time.Time `gorm:"column:ended_at" json:"ended_at"`                               // 会话结束时间（nil 表示仍在进行）
+	CreatedAt    time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`            // 记录创建时间
+}
+
+// TableName 指定表名
+func (SessionRecording) TableName() string {
+	return "session_recordings"
+}
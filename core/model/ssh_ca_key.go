@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SSHCAKey 内置 SSH CA 的签名密钥，用于给上游主机签发短期用户证书
+type SSHCAKey struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	PrivateKey []byte         `gorm:"type:text" json:"-"`
+	PublicKey  []byte         `gorm:"type:text" json:"public_key"` // authorized_keys 格式，配置到上游的 TrustedUserCAKeys
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	CreatedAt  time.Time      `gorm:"index" json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// 设置 SSHCAKey 对应的数据库表名
+func (SSHCAKey) TableName() string {
+	return "ssh_ca_keys"
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// UserMFA 用户的 TOTP 二次验证设置
+type UserMFA struct {
+	ID            uint       `gorm:"column:id;primaryKey" json:"id"`                     // 记录的唯一标识，作为主键
+	UserID        uint       `gorm:"column:user_id;uniqueIndex;not null" json:"user_id"` // 所属用户
+	Secret        string     `gorm:"column:secret;type:text" json:"-"`                   // TOTP 密钥（utils.EncryptPassword 加密）
+	Enabled       bool       `gorm:"column:enabled" json:"enabled"`                      // 是否已确认绑定；未确认前不参与登录校验
+	RecoveryCodes string     `gorm:"column:recovery_codes;type:text" json:"-"`           // 未使用的恢复码哈希（JSON 数组），每个只能使用一次
+	LastUsedStep  int64      `gorm:"column:last_used_step" json:"-"`                     // 最近一次通过校验的时间步，防止验证码重放
+	EnabledAt     *time.Time `gorm:"column:enabled_at" json:"enabled_at"`                // 绑定确认时间
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"` // 创建时间
+	UpdatedAt     time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"` // 更新时间
+}
+
+// TableName 指定表名
+func (UserMFA) TableName() string {
+	return "user_mfa"
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// UserSession 登录会话，访问令牌的 jti 即 SessionID；吊销后该会话的所有令牌立即失效
+type UserSession struct {
+	ID                  uint       `gorm:"column:id;primaryKey" json:"id"`                                   // 记录的唯一标识，作为主键
+	SessionID           string     `gorm:"column:session_id;size:64;uniqueIndex;not null" json:"session_id"` // 会话 ID，写入访问令牌的 jti
+	UserID              uint       `gorm:"column:user_id;index;not null" json:"user_id"`                     // 所属用户
+	RefreshTokenHash    string     `gorm:"column:refresh_token_hash;size:64;index" json:"-"`                 // 当前刷新令牌的 SHA-256
+	PreviousRefreshHash string     `gorm:"column:previous_refresh_hash;size:64;index" json:"-"`              // 上一个刷新令牌的 SHA-256，再次出现说明令牌被盗用
+	ClientIP            string     `gorm:"column:client_ip;size:64" json:"client_ip"`                        // 登录 IP
+	UserAgent           string     `gorm:"column:user_agent;size:255" json:"user_agent"`                     // 登录客户端
+	LastUsedAt          time.Time  `gorm:"column:last_used_at" json:"last_used_at"`                          // 最近一次使用时间
+	ExpiresAt           time.Time  `gorm:"column:expires_at;index" json:"expires_at"`                        // 会话（刷新令牌）过期时间
+	RevokedAt           *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`                    // 吊销时间，为空表示有效
+	RevokeReason        string     `gorm:"column:revoke_reason;size:50" json:"revoke_reason,omitempty"`      // 吊销原因：logout、admin、refresh_reuse
+	CreatedAt           time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`               // 登录时间
+}
+
+// TableName 指定表名
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// IsActive 会话未吊销且未过期
+func (s *UserSession) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserSSHKey 用户登录堡垒机的 SSH 公钥（一个用户可以有多把，例如笔记本和 CI）
+type UserSSHKey struct {
+	ID          uint           `gorm:"column:id;primaryKey" json:"id"`                                // 记录的唯一标识，作为主键
+	UserID      uint           `gorm:"column:user_id;index;not null" json:"user_id"`                  // 所属用户ID
+	Label       string         `gorm:"column:label;type:varchar(100)" json:"label"`                   // 标签，例如 laptop、ci-runner
+	KeyType     string         `gorm:"column:key_type;type:varchar(64)" json:"key_type"`              // 密钥类型
+	PublicKey   string         `gorm:"column:public_key;type:text;not null" json:"public_key"`        // 公钥（authorized_keys 格式）
+	Fingerprint string         `gorm:"column:fingerprint;type:varchar(128);index" json:"fingerprint"` // 公钥的 SHA256 指纹
+	SourceIPs   string         `gorm:"column:source_ips;type:varchar(1024)" json:"source_ips"`        // 允许登录的来源 IP/CIDR，逗号分隔，为空表示不限制
+	ExpiresAt   *time.Time     `gorm:"column:expires_at" json:"expires_at"`                           // 过期时间，为空表示永不过期
+	LastUsedAt  *time.Time     `gorm:"column:last_used_at" json:"last_used_at"`                       // 最近一次登录时间
+	LastUsedIP  string         `gorm:"column:last_used_ip;type:varchar(64)" json:"last_used_ip"`      // 最近一次登录的来源 IP
+	DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at;index" json:"-"`                              // 吊销时间（软删除）
+	CreatedAt   time.Time      `gorm:"column:created_at;autoCreateTime" json:"created_at"`            // 添加时间
+	UpdatedAt   time.Time      `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`            // 更新时间
+}
+
+// TableName 指定表名
+func (UserSSHKey) TableName() string {
+	return "user_ssh_keys"
+}
+
+// IsExpired 密钥在 now 时是否已过期
+func (k *UserSSHKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// AllowsIP 来源 IP 是否在允许范围内，未配置限制时总是允许
+func (k *UserSSHKey) AllowsIP(ip string) bool {
+	if strings.TrimSpace(k.SourceIPs) == "" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range strings.Split(k.SourceIPs, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
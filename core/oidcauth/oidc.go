@@ -0,0 +1,207 @@
+package oidcauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrInvalidState state 不存在或已过期（登录超时或被重放）
+	ErrInvalidState = errors.New("invalid or expired oidc state")
+	// ErrStateMismatch 回调的 state 与发起登录的浏览器 cookie 不一致（登录 CSRF）
+	ErrStateMismatch = errors.New("oidc state does not match the login cookie")
+	// ErrTooManyLogins 等待回调的登录请求已达上限
+	ErrTooManyLogins = errors.New("too many pending oidc logins")
+	// ErrNoIDToken 令牌响应中没有 id_token
+	ErrNoIDToken = errors.New("no id_token in token response")
+	// ErrNonceMismatch id_token 中的 nonce 与登录请求不一致
+	ErrNonceMismatch = errors.New("id_token nonce mismatch")
+)
+
+const (
+	// PendingTTL 从跳转到身份提供方到回调的最长时间，也是 state cookie 的有效期
+	PendingTTL = 10 * time.Minute
+	// StateCookie 保存 state 的 cookie 名，只在 /api/v1/auth/oidc 路径下发送
+	StateCookie = "roma_oidc_state"
+	// maxPending 同时等待回调的登录请求上限，防止未认证请求无限占用内存
+	maxPending = 1000
+)
+
+// pendingLogin 等待回调的登录请求
+type pendingLogin struct {
+	verifier string // PKCE code_verifier
+	nonce    string
+	expires  time.Time
+}
+
+var pending = struct {
+	sync.Mutex
+	logins map[string]*pendingLogin
+}{logins: make(map[string]*pendingLogin)}
+
+// provider 缓存 discovery 结果，失败时下次登录重试
+var provider struct {
+	sync.Mutex
+	issuer string
+	p      *oidc.Provider
+}
+
+// Enabled 是否启用 OIDC 登录
+func Enabled() bool {
+	cfg := config()
+	return cfg != nil && cfg.Enabled && cfg.Issuer != "" && cfg.ClientID != ""
+}
+
+func config() *configs.OIDCConfig {
+	if global.CONFIG == nil {
+		return nil
+	}
+	return global.CONFIG.OIDC
+}
+
+// FrontendURL 登录完成后跳转的前端地址
+func FrontendURL() string {
+	if cfg := config(); cfg != nil {
+		return cfg.FrontendURL
+	}
+	return ""
+}
+
+// SecureCookie 回调地址为 https 时 state cookie 只允许通过 https 发送
+func SecureCookie() bool {
+	cfg := config()
+	return cfg != nil && strings.HasPrefix(strings.ToLower(cfg.RedirectURL), "https://")
+}
+
+// Begin 发起授权码 + PKCE 登录
+// 输入: ctx - 请求上下文（用于 discovery）
+// 输出: authURL - 跳转到身份提供方的授权地址；state - 需写入 HttpOnly cookie 的 state；error - 失败原因
+// 必要性: nonce 和 code_verifier 只保存在服务端，state 同时绑定到发起登录的浏览器，回调时一次性取出校验
+func Begin(ctx context.Context) (authURL, state string, err error) {
+	oauthCfg, _, err := clients(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, err = randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	pending.Lock()
+	now := time.Now()
+	for k, v := range pending.logins {
+		if now.After(v.expires) {
+			delete(pending.logins, k)
+		}
+	}
+	if len(pending.logins) >= maxPending {
+		pending.Unlock()
+		return "", "", ErrTooManyLogins
+	}
+	pending.logins[state] = &pendingLogin{verifier: verifier, nonce: nonce, expires: now.Add(PendingTTL)}
+	pending.Unlock()
+
+	return oauthCfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), state, nil
+}
+
+// Complete 处理回调：用授权码换取令牌并校验 id_token
+// 输入: ctx - 请求上下文；state、code - 回调参数；cookieState - 发起登录时写入浏览器的 state cookie
+// 输出: map[string]interface{} - id_token 中的 claims；error - 校验失败原因
+// 必要性: state 必须与 cookie 一致，否则攻击者可以把自己的授权码塞给受害者完成登录（登录 CSRF）
+func Complete(ctx context.Context, state, cookieState, code string) (map[string]interface{}, error) {
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		return nil, ErrStateMismatch
+	}
+	pending.Lock()
+	login, ok := pending.logins[state]
+	delete(pending.logins, state)
+	pending.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, ErrInvalidState
+	}
+
+	oauthCfg, verifier, err := clients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oauthCfg.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("oidc code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, ErrNoIDToken
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("oidc id_token verification failed: %w", err)
+	}
+	if idToken.Nonce != login.nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse id_token claims: %w", err)
+	}
+	return claims, nil
+}
+
+// clients 返回 oauth2 配置和 id_token 校验器
+func clients(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	cfg := config()
+	if !Enabled() {
+		return nil, nil, errors.New("oidc is not enabled")
+	}
+
+	provider.Lock()
+	if provider.p == nil || provider.issuer != cfg.Issuer {
+		// Provider 会保存该 context 用于之后拉取 JWKS，不能随请求一起取消
+		p, err := oidc.NewProvider(context.WithoutCancel(ctx), cfg.Issuer)
+		if err != nil {
+			provider.Unlock()
+			return nil, nil, fmt.Errorf("oidc discovery for %s failed: %w", cfg.Issuer, err)
+		}
+		provider.p, provider.issuer = p, cfg.Issuer
+	}
+	p := provider.p
+	provider.Unlock()
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	oauthCfg := &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     p.Endpoint(),
+		Scopes:       scopes,
+	}
+	return oauthCfg, p.Verifier(&oidc.Config{ClientID: cfg.ClientID}), nil
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,287 @@
+package oidcauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file:oidcauth?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Role{}); err != nil {
+		panic(err)
+	}
+	global.CDB = db
+	os.Exit(m.Run())
+}
+
+// mockProvider 最小的 OIDC 身份提供方：discovery、JWKS 和校验 PKCE 的 token 端点
+type mockProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string                 // 授权请求中的 code_challenge
+	nonce     string                 // 签入 id_token 的 nonce
+	claims    map[string]interface{} // id_token 的其他 claims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := &mockProvider{key: key, claims: map[string]interface{}{"sub": "u-1"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                mp.URL,
+			"authorization_endpoint":                mp.URL + "/authorize",
+			"token_endpoint":                        mp.URL + "/token",
+			"jwks_uri":                              mp.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", mp.token)
+	mp.Server = httptest.NewServer(mux)
+	t.Cleanup(mp.Close)
+
+	prev := global.CONFIG
+	global.CONFIG = &configs.Config{OIDC: &configs.OIDCConfig{
+		Enabled:     true,
+		Issuer:      mp.URL,
+		ClientID:    "roma",
+		RedirectURL: "https://roma.example.com/api/v1/auth/oidc/callback",
+	}}
+	t.Cleanup(func() { global.CONFIG = prev })
+	return mp
+}
+
+// token 只接受 code=good，且 code_verifier 必须与授权请求中的 code_challenge 对应
+func (mp *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if r.PostForm.Get("code") != "good" || base64.RawURLEncoding.EncodeToString(sum[:]) != mp.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":   mp.URL,
+		"aud":   "roma",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": mp.nonce,
+	}
+	for k, v := range mp.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	idToken, err := token.SignedString(mp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "at",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// authorize 模拟浏览器访问授权地址：记录 code_challenge 和 nonce，返回 state
+func (mp *mockProvider) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	mp.mu.Lock()
+	mp.challenge, mp.nonce = q.Get("code_challenge"), q.Get("nonce")
+	mp.mu.Unlock()
+	return q.Get("state")
+}
+
+func TestBegin(t *testing.T) {
+	mp := newMockProvider(t)
+	authURL, state, err := Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, mp.URL+"/authorize?") {
+		t.Fatalf("auth url %q does not use the discovered endpoint", authURL)
+	}
+	q, _ := url.ParseQuery(authURL[strings.Index(authURL, "?")+1:])
+	checks := map[string]string{
+		"state":                 state,
+		"client_id":             "roma",
+		"response_type":         "code",
+		"code_challenge_method": "S256",
+		"redirect_uri":          "https://roma.example.com/api/v1/auth/oidc/callback",
+	}
+	for k, want := range checks {
+		if got := q.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if q.Get("nonce") == "" || q.Get("code_challenge") == "" {
+		t.Errorf("auth url is missing nonce or code_challenge: %s", authURL)
+	}
+	if !SecureCookie() {
+		t.Error("https redirect url should use a secure state cookie")
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie func(state string) string
+		code   string
+		tamper func(mp *mockProvider, state string)
+		want   error
+		// exchangeErr 身份提供方拒绝换取令牌（授权码或 code_verifier 不对）
+		exchangeErr bool
+	}{
+		{name: "ok", code: "good"},
+		{name: "state cookie mismatch", cookie: func(string) string { return "other" }, code: "good", want: ErrStateMismatch},
+		{name: "no state cookie", cookie: func(string) string { return "" }, code: "good", want: ErrStateMismatch},
+		{name: "nonce mismatch", code: "good", tamper: func(mp *mockProvider, _ string) { mp.nonce = "forged" }, want: ErrNonceMismatch},
+		{name: "wrong pkce verifier", code: "good", tamper: func(_ *mockProvider, state string) {
+			pending.Lock()
+			pending.logins[state].verifier = "wrong-verifier-wrong-verifier-wrong-verifier"
+			pending.Unlock()
+		}, exchangeErr: true},
+		{name: "expired", code: "good", tamper: func(_ *mockProvider, state string) {
+			pending.Lock()
+			pending.logins[state].expires = time.Now().Add(-time.Second)
+			pending.Unlock()
+		}, want: ErrInvalidState},
+		{name: "bad code", code: "bad", exchangeErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := newMockProvider(t)
+			authURL, state, err := Begin(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mp.authorize(t, authURL); got != state {
+				t.Fatalf("state in url %q, returned %q", got, state)
+			}
+			if tt.tamper != nil {
+				tt.tamper(mp, state)
+			}
+			cookie := state
+			if tt.cookie != nil {
+				cookie = tt.cookie(state)
+			}
+			claims, err := Complete(context.Background(), state, cookie, tt.code)
+			switch {
+			case tt.exchangeErr:
+				if err == nil || !strings.Contains(err.Error(), "exchange failed") {
+					t.Fatalf("err = %v, want a code exchange failure", err)
+				}
+			case tt.want != nil:
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if claims["sub"] != "u-1" || claims["iss"] != mp.URL {
+					t.Fatalf("unexpected claims %v", claims)
+				}
+			}
+		})
+	}
+}
+
+func TestCompleteOnce(t *testing.T) {
+	mp := newMockProvider(t)
+	authURL, state, err := Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp.authorize(t, authURL)
+	if _, err := Complete(context.Background(), state, state, "good"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Complete(context.Background(), state, state, "good"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("replayed state: err = %v, want %v", err, ErrInvalidState)
+	}
+}
+
+func TestBeginPendingLimit(t *testing.T) {
+	newMockProvider(t)
+	pending.Lock()
+	saved := pending.logins
+	pending.logins = make(map[string]*pendingLogin)
+	for i := 0; i < maxPending; i++ {
+		pending.logins[strconv.Itoa(i)] = &pendingLogin{expires: time.Now().Add(time.Minute)}
+	}
+	pending.Unlock()
+	t.Cleanup(func() {
+		pending.Lock()
+		pending.logins = saved
+		pending.Unlock()
+	})
+
+	if _, _, err := Begin(context.Background()); !errors.Is(err, ErrTooManyLogins) {
+		t.Fatalf("err = %v, want %v", err, ErrTooManyLogins)
+	}
+
+	// 过期的登录请求会被清理，不占用名额
+	pending.Lock()
+	pending.logins["0"].expires = time.Now().Add(-time.Second)
+	pending.Unlock()
+	if _, _, err := Begin(context.Background()); err != nil {
+		t.Fatalf("after expiry: %v", err)
+	}
+}
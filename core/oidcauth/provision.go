@@ -0,0 +1,198 @@
+package oidcauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/utils/logger"
+)
+
+var (
+	// ErrNoUsername id_token 中没有用户名 claim
+	ErrNoUsername = errors.New("id_token has no username claim")
+	// ErrNoSubject id_token 中没有 iss 或 sub，无法确定身份
+	ErrNoSubject = errors.New("id_token has no iss or sub claim")
+	// ErrNoRoles claim 中没有可用的角色，且没有配置默认角色
+	ErrNoRoles = errors.New("no mapped roles in id_token")
+	// ErrUserConflict 同名用户已存在（本地、LDAP 或其他 OIDC 身份），不允许单点登录接管
+	ErrUserConflict = errors.New("a user with the same name but another identity already exists")
+	// ErrUserDisabled 用户已被管理员禁用
+	ErrUserDisabled = errors.New("user has been disabled")
+)
+
+const (
+	defaultUsernameClaim = "preferred_username"
+	defaultRolesClaim    = "roles"
+)
+
+// ProvisionUser 按 id_token claims 即时创建或更新用户，角色以 claim 为准
+// 输入: claims - 已校验的 id_token claims
+// 输出: *model.User - 用户（含角色）；error - 失败原因
+// 必要性: 单点登录用户无需管理员预先创建，角色变更在下次登录时生效；
+// 用户按 iss + sub 识别，用户名 claim 只在首次登录时决定 ROMA 用户名，改名不能接管其他用户
+func ProvisionUser(claims map[string]interface{}) (*model.User, error) {
+	cfg := config()
+	if cfg == nil {
+		return nil, errors.New("oidc is not configured")
+	}
+	issuer, subject := claimString(claims, "iss"), claimString(claims, "sub")
+	if issuer == "" || subject == "" {
+		return nil, ErrNoSubject
+	}
+	externalID := ExternalID(issuer, subject)
+	username := claimString(claims, attr(cfg.UsernameClaim, defaultUsernameClaim))
+	if username == "" {
+		return nil, ErrNoUsername
+	}
+	roles := lookupRoles(mapRoles(cfg, claimValues(claims, attr(cfg.RolesClaim, defaultRolesClaim))))
+	if len(roles) == 0 {
+		return nil, ErrNoRoles
+	}
+
+	name := claimString(claims, "name")
+	if name == "" {
+		name = username
+	}
+	// users.email 唯一且不为空，没有 email claim 时用用户名占位
+	email := claimString(claims, "email")
+	if email == "" {
+		email = username
+	}
+
+	opUser := operation.NewUserOperation()
+	user, err := opUser.GetUserByExternalID(model.UserSourceOIDC, externalID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case user == nil:
+		existing, err := opUser.GetUserByUsernameUnscoped(username)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, ErrUserConflict
+		}
+		user, err = opUser.CreateUser(&model.User{
+			Username:   username,
+			Name:       name,
+			Nickname:   name,
+			Email:      email,
+			Source:     model.UserSourceOIDC,
+			ExternalID: externalID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create oidc user %s: %w", username, err)
+		}
+		logger.Logger.Info(fmt.Sprintf("OIDC: provisioned user %s for %s", username, externalID))
+	case user.DeletedAt.Valid:
+		return nil, ErrUserDisabled
+	case user.Name != name || user.Email != email:
+		user.Name, user.Email, user.Password = name, email, ""
+		if _, err := opUser.UpdateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to update oidc user %s: %w", user.Username, err)
+		}
+	}
+
+	if err := opUser.ReplaceUserRoles(user, roles); err != nil {
+		return nil, fmt.Errorf("failed to set roles of oidc user %s: %w", user.Username, err)
+	}
+	return opUser.GetUserByID(user.ID)
+}
+
+// ExternalID 由 issuer 和 sub 组成的全局唯一身份标识，issuer 不含 #，拼接结果不会产生歧义
+func ExternalID(issuer, subject string) string {
+	return issuer + "#" + subject
+}
+
+// mapRoles 按 role_mappings 把 claim 值转换为角色名，没有匹配的映射时只使用 default_roles
+// 未配置映射时 claim 值不会直接当作角色名，避免身份提供方中的任意组名获得同名的 ROMA 角色
+func mapRoles(cfg *configs.OIDCConfig, values []string) []string {
+	var roles []string
+	for _, mapping := range cfg.RoleMappings {
+		if mapping != nil && contains(values, mapping.Value) {
+			roles = appendUnique(roles, mapping.Roles...)
+		}
+	}
+	if len(roles) == 0 {
+		roles = appendUnique(roles, cfg.DefaultRoles...)
+	}
+	return roles
+}
+
+// lookupRoles 只保留已存在的角色，映射到未知角色名时忽略
+func lookupRoles(names []string) []model.Role {
+	opRole := operation.NewRoleOperation()
+	roles := make([]model.Role, 0, len(names))
+	for _, name := range names {
+		role, err := opRole.GetRoleByName(name)
+		if err != nil || role == nil {
+			continue
+		}
+		roles = append(roles, *role)
+	}
+	return roles
+}
+
+// claimValue 按 . 分隔的路径读取嵌套 claim，如 realm_access.roles
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var cur interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+	return cur
+}
+
+func claimString(claims map[string]interface{}, path string) string {
+	s, _ := claimValue(claims, path).(string)
+	return strings.TrimSpace(s)
+}
+
+// claimValues 读取字符串数组 claim，字符串 claim 按空格或逗号拆分
+func claimValues(claims map[string]interface{}, path string) []string {
+	var values []string
+	switch v := claimValue(claims, path).(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+	case string:
+		values = strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+	}
+	return values
+}
+
+func attr(name, def string) string {
+	if name == "" {
+		return def
+	}
+	return name
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if item != "" && !contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package oidcauth
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+)
+
+const testIssuer = "https://sso.example.com"
+
+// withProvisionConfig 设置角色映射配置，并清空用户和角色
+func withProvisionConfig(t *testing.T, cfg *configs.OIDCConfig) {
+	t.Helper()
+	cfg.Enabled, cfg.Issuer, cfg.ClientID = true, testIssuer, "roma"
+	prev := global.CONFIG
+	global.CONFIG = &configs.Config{OIDC: cfg}
+	t.Cleanup(func() { global.CONFIG = prev })
+
+	for _, table := range []string{"user_roles", "users", "roles"} {
+		if err := global.CDB.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"ops", "dev", "viewer"} {
+		if err := global.CDB.Create(&model.Role{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func idClaims(sub, username string, groups ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":                testIssuer,
+		"sub":                sub,
+		"preferred_username": username,
+		"email":              username + "@example.com",
+		"roles":              groups,
+	}
+}
+
+func roleNames(user *model.User) []string {
+	names := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		names = append(names, role.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMapRoles(t *testing.T) {
+	mappings := []*configs.OIDCRoleMapping{
+		{Value: "roma-ops", Roles: []string{"ops"}},
+		{Value: "roma-dev", Roles: []string{"dev", "ops"}},
+	}
+	tests := []struct {
+		name     string
+		mappings []*configs.OIDCRoleMapping
+		defaults []string
+		values   []string
+		want     []string
+	}{
+		{name: "no mappings ignores claim values", values: []string{"ops", "admin"}, want: nil},
+		{name: "no mappings uses default roles", defaults: []string{"viewer"}, values: []string{"admin"}, want: []string{"viewer"}},
+		{name: "mapped values", mappings: mappings, values: []string{"roma-dev", "roma-ops"}, want: []string{"ops", "dev"}},
+		{name: "unmapped value is not a role name", mappings: mappings, values: []string{"ops"}, want: nil},
+		{name: "no match falls back to default", mappings: mappings, defaults: []string{"viewer"}, values: []string{"other"}, want: []string{"viewer"}},
+		{name: "match ignores default", mappings: mappings, defaults: []string{"viewer"}, values: []string{"roma-ops"}, want: []string{"ops"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &configs.OIDCConfig{RoleMappings: tt.mappings, DefaultRoles: tt.defaults}
+			if got := mapRoles(cfg, tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mapRoles(%v) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvisionUser(t *testing.T) {
+	withProvisionConfig(t, &configs.OIDCConfig{
+		RoleMappings: []*configs.OIDCRoleMapping{
+			{Value: "roma-ops", Roles: []string{"ops"}},
+			{Value: "roma-dev", Roles: []string{"dev"}},
+		},
+	})
+
+	user, err := ProvisionUser(idClaims("u-1", "alice", "roma-ops"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Source != model.UserSourceOIDC || user.ExternalID != ExternalID(testIssuer, "u-1") {
+		t.Fatalf("created user source=%q external_id=%q", user.Source, user.ExternalID)
+	}
+	if got := roleNames(user); !reflect.DeepEqual(got, []string{"ops"}) {
+		t.Fatalf("roles = %v, want [ops]", got)
+	}
+
+	// 同一 iss + sub 改名后仍是同一用户，用户名不变，角色按本次登录替换
+	again, err := ProvisionUser(idClaims("u-1", "alice-renamed", "roma-dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID || again.Username != "alice" {
+		t.Fatalf("relogin got user %d %q, want %d alice", again.ID, again.Username, user.ID)
+	}
+	if got := roleNames(again); !reflect.DeepEqual(got, []string{"dev"}) {
+		t.Fatalf("roles after relogin = %v, want [dev]", got)
+	}
+
+	local, err := operation.NewUserOperation().CreateUser(&model.User{Username: "bob", Name: "bob", Nickname: "bob", Email: "bob@local", Source: model.UserSourceLocal})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   error
+	}{
+		{name: "other subject with same username", claims: idClaims("u-2", "alice", "roma-ops"), want: ErrUserConflict},
+		{name: "local user is not taken over", claims: idClaims("u-3", "bob", "roma-ops"), want: ErrUserConflict},
+		{name: "other issuer same subject", claims: func() map[string]interface{} {
+			c := idClaims("u-1", "alice", "roma-ops")
+			c["iss"] = "https://evil.example.com"
+			return c
+		}(), want: ErrUserConflict},
+		{name: "no subject", claims: idClaims("", "carol", "roma-ops"), want: ErrNoSubject},
+		{name: "no username", claims: idClaims("u-4", "", "roma-ops"), want: ErrNoUsername},
+		{name: "unmapped groups", claims: idClaims("u-5", "dave", "ops", "admin"), want: ErrNoRoles},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ProvisionUser(tt.claims); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if got, _ := operation.NewUserOperation().GetUserByID(local.ID); got.Source != model.UserSourceLocal || got.ExternalID != "" {
+		t.Fatalf("local user was modified: %+v", got)
+	}
+
+	if err := operation.NewUserOperation().DisabledUser(uint64(user.ID), model.UserDisabledByAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ProvisionUser(idClaims("u-1", "alice", "roma-ops")); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("disabled user: err = %v, want %v", err, ErrUserDisabled)
+	}
+}
+
+func TestProvisionUserDefaultRoles(t *testing.T) {
+	withProvisionConfig(t, &configs.OIDCConfig{DefaultRoles: []string{"viewer"}})
+
+	// 未配置映射时，即使 claim 中恰好有同名角色也只得到默认角色
+	user, err := ProvisionUser(idClaims("u-1", "erin", "ops", "dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := roleNames(user); !reflect.DeepEqual(got, []string{"viewer"}) {
+		t.Fatalf("roles = %v, want [viewer]", got)
+	}
+}
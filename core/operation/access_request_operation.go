@@ -0,0 +1,90 @@
+package operation
+
+import (
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+type AccessRequestOperation struct {
+	DB *gorm.DB
+}
+
+func NewAccessRequestOperation() *AccessRequestOperation {
+	return &AccessRequestOperation{DB: global.GetDB()}
+}
+
+func NewAccessRequestOperationWithDB(db *gorm.DB) *AccessRequestOperation {
+	return &AccessRequestOperation{DB: db}
+}
+
+// CreateRequest 保存访问申请
+func (a *AccessRequestOperation) CreateRequest(req *model.AccessRequest) error {
+	return a.DB.Create(req).Error
+}
+
+// GetRequestByID 获取访问申请，不存在时返回 nil
+func (a *AccessRequestOperation) GetRequestByID(id uint) (*model.AccessRequest, error) {
+	var req model.AccessRequest
+	if err := a.DB.First(&req, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ListRequests 列出访问申请，userID 为 0 时不限申请人，status 为空时不限状态
+func (a *AccessRequestOperation) ListRequests(userID uint, status string) ([]*model.AccessRequest, error) {
+	reqs := []*model.AccessRequest{}
+	query := a.DB.Model(&model.AccessRequest{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("id DESC").Find(&reqs).Error; err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// HasOpenRequest 检查用户对同一对象是否已有待审批或生效中的申请
+func (a *AccessRequestOperation) HasOpenRequest(userID uint, resourceID int64, resourceType string, spaceID uint, now time.Time) (bool, error) {
+	var count int64
+	err := a.DB.Model(&model.AccessRequest{}).
+		Where("user_id = ? AND resource_id = ? AND resource_type = ? AND space_id = ?", userID, resourceID, resourceType, spaceID).
+		Where("status = ? OR (status = ? AND expires_at > ?)", model.AccessRequestPending, model.AccessRequestApproved, now).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateStatus 仅当申请仍处于 from 状态时更新，返回是否更新成功，避免并发审批互相覆盖
+func (a *AccessRequestOperation) UpdateStatus(id uint, from string, updates map[string]interface{}) (bool, error) {
+	result := a.DB.Model(&model.AccessRequest{}).Where("id = ? AND status = ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+// ListActiveGrants 列出用户当前生效的授权
+func (a *AccessRequestOperation) ListActiveGrants(userID uint, now time.Time) ([]*model.AccessRequest, error) {
+	grants := []*model.AccessRequest{}
+	if err := a.DB.Where("user_id = ? AND status = ? AND expires_at > ?", userID, model.AccessRequestApproved, now).
+		Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// ListDueGrants 列出已到期但尚未处理的授权
+func (a *AccessRequestOperation) ListDueGrants(now time.Time) ([]*model.AccessRequest, error) {
+	grants := []*model.AccessRequest{}
+	if err := a.DB.Where("status = ? AND expires_at <= ?", model.AccessRequestApproved, now).
+		Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
@@ -33,6 +33,15 @@ func (a *ApikeyOperation) GetAllApiKeys() ([]*model.Apikey, error) {
 	return apikeys, nil
 }
 
+// GetApiKeysByUser 获取用户的所有 API Keys
+func (a *ApikeyOperation) GetApiKeysByUser(userID uint) ([]*model.Apikey, error) {
+	apikeys := []*model.Apikey{}
+	if err := a.DB.Where("user_id = ?", userID).Order("id DESC").Find(&apikeys).Error; err != nil {
+		return nil, err
+	}
+	return apikeys, nil
+}
+
 // 创建API Key
 func (a *ApikeyOperation) Create(apikey *model.Apikey) (*model.Apikey, error) {
 	if err := a.DB.Create(apikey).Error; err != nil {
@@ -41,27 +50,6 @@ func (a *ApikeyOperation) Create(apikey *model.Apikey) (*model.Apikey, error) {
 	return apikey, nil
 }
 
-// 检查API Key是否存在
-func (a *ApikeyOperation) ApiKeyExists(apikey string) (bool, error) {
-	var count int64
-	if err := a.DB.Model(&model.Apikey{}).Where("api_key = ?", apikey).Count(&count).Error; err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
-
-// 检查API Key是否有效
-func (a *ApikeyOperation) ApiKeyIsValid(apikey string) (bool, error) {
-	apikeyModel := &model.Apikey{}
-	if err := a.DB.Where("api_key = ? AND expires_at > ?", apikey, time.Now()).First(apikeyModel).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return false, nil
-		}
-		return false, err
-	}
-	return true, nil
-}
-
 // 根据ID获取API Key
 func (a *ApikeyOperation) GetApiKeyById(id uint) (*model.Apikey, error) {
 	apikey := &model.Apikey{}
@@ -77,11 +65,40 @@ func (a *ApikeyOperation) ExpiresApikeyById(id uint) error {
 	return a.DB.Model(&model.Apikey{}).Where("id = ?", id).Update("expires_at", expiredTime).Error
 }
 
-// 根据Key获取API Key
-func (a *ApikeyOperation) GetApiKeyByKey(apiKey string) (*model.Apikey, error) {
+// GetApiKeyByHash 根据 SHA-256 获取 API Key，不存在时返回 nil
+func (a *ApikeyOperation) GetApiKeyByHash(hash string) (*model.Apikey, error) {
 	apikey := &model.Apikey{}
-	if err := a.DB.Where("api_key = ?", apiKey).First(apikey).Error; err != nil {
+	if err := a.DB.Where("api_key = ?", hash).First(apikey).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
 		return nil, err
 	}
 	return apikey, nil
 }
+
+// GetLegacyApiKeys 获取明文保存的旧 API Keys（没有 key_prefix）
+func (a *ApikeyOperation) GetLegacyApiKeys() ([]*model.Apikey, error) {
+	apikeys := []*model.Apikey{}
+	if err := a.DB.Where("key_prefix = ? OR key_prefix IS NULL", "").Find(&apikeys).Error; err != nil {
+		return nil, err
+	}
+	return apikeys, nil
+}
+
+// HashLegacyApiKey 把旧 API Key 改为哈希保存，并补充所属用户
+func (a *ApikeyOperation) HashLegacyApiKey(id uint, hash, prefix string, userID uint) error {
+	return a.DB.Model(&model.Apikey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"api_key":    hash,
+		"key_prefix": prefix,
+		"user_id":    userID,
+	}).Error
+}
+
+// TouchApiKey 记录最近一次使用的时间和 IP
+func (a *ApikeyOperation) TouchApiKey(id uint, ip string, at time.Time) error {
+	return a.DB.Model(&model.Apikey{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"last_used_at": at,
+		"last_used_ip": ip,
+	}).Error
+}
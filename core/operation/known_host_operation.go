@@ -0,0 +1,106 @@
+package operation
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+type KnownHostOperation struct {
+	DB *gorm.DB
+}
+
+func NewKnownHostOperation() *KnownHostOperation {
+	return &KnownHostOperation{DB: global.GetDB()}
+}
+
+func NewKnownHostOperationWithDB(db *gorm.DB) *KnownHostOperation {
+	return &KnownHostOperation{DB: db}
+}
+
+// GetKnownHost 根据资源和地址获取已固定的主机密钥，不存在时返回 nil, nil
+func (k *KnownHostOperation) GetKnownHost(resourceType string, resourceID uint, host string) (*model.KnownHost, error) {
+	knownHost := &model.KnownHost{}
+	err := k.DB.Where("resource_type = ? AND resource_id = ? AND host = ?", resourceType, resourceID, host).First(knownHost).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return knownHost, nil
+}
+
+// GetKnownHostByID 根据ID获取主机密钥记录
+func (k *KnownHostOperation) GetKnownHostByID(id uint) (*model.KnownHost, error) {
+	knownHost := &model.KnownHost{}
+	if err := k.DB.First(knownHost, id).Error; err != nil {
+		return nil, err
+	}
+	return knownHost, nil
+}
+
+// ListKnownHosts 获取主机密钥列表，resourceType 为空时返回全部
+func (k *KnownHostOperation) ListKnownHosts(resourceType string, resourceID uint) ([]*model.KnownHost, error) {
+	var knownHosts []*model.KnownHost
+	query := k.DB.Model(&model.KnownHost{})
+	if resourceType != "" {
+		query = query.Where("resource_type = ?", resourceType)
+	}
+	if resourceID > 0 {
+		query = query.Where("resource_id = ?", resourceID)
+	}
+	if err := query.Order("id").Find(&knownHosts).Error; err != nil {
+		return nil, err
+	}
+	return knownHosts, nil
+}
+
+// CreateKnownHost 首次连接时固定主机密钥
+func (k *KnownHostOperation) CreateKnownHost(knownHost *model.KnownHost) error {
+	return k.DB.Create(knownHost).Error
+}
+
+// TouchKnownHost 更新最近校验通过时间
+func (k *KnownHostOperation) TouchKnownHost(id uint) error {
+	return k.DB.Model(&model.KnownHost{}).Where("id = ?", id).Update("last_seen_at", time.Now()).Error
+}
+
+// SetPendingKey 记录上游提供的不匹配密钥，等待管理员确认
+func (k *KnownHostOperation) SetPendingKey(id uint, publicKey, fingerprint string) error {
+	return k.DB.Model(&model.KnownHost{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"pending_public_key":  publicKey,
+		"pending_fingerprint": fingerprint,
+	}).Error
+}
+
+// AcceptPendingKey 用待确认的密钥替换已固定的密钥（密钥轮换）
+func (k *KnownHostOperation) AcceptPendingKey(id uint) (*model.KnownHost, error) {
+	knownHost, err := k.GetKnownHostByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !knownHost.HasPendingKey() {
+		return nil, errors.New("no pending host key to accept")
+	}
+	if fields := strings.Fields(knownHost.PendingPublicKey); len(fields) > 0 {
+		knownHost.KeyType = fields[0]
+	}
+	knownHost.PublicKey = knownHost.PendingPublicKey
+	knownHost.Fingerprint = knownHost.PendingFingerprint
+	knownHost.PendingPublicKey = ""
+	knownHost.PendingFingerprint = ""
+	if err := k.DB.Save(knownHost).Error; err != nil {
+		return nil, err
+	}
+	return knownHost, nil
+}
+
+// DeleteKnownHost 删除主机密钥记录（下次连接时重新固定）
+func (k *KnownHostOperation) DeleteKnownHost(id uint) error {
+	return k.DB.Delete(&model.KnownHost{}, id).Error
+}
@@ -0,0 +1,56 @@
+package operation
+
+import (
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+type MCPTokenOperation struct {
+	DB *gorm.DB
+}
+
+func NewMCPTokenOperation() *MCPTokenOperation {
+	return &MCPTokenOperation{DB: global.GetDB()}
+}
+
+func NewMCPTokenOperationWithDB(db *gorm.DB) *MCPTokenOperation {
+	return &MCPTokenOperation{DB: db}
+}
+
+// CreateToken 保存 MCP 令牌
+func (m *MCPTokenOperation) CreateToken(token *model.MCPToken) error {
+	return m.DB.Create(token).Error
+}
+
+// GetTokenByHash 根据令牌哈希获取令牌，不存在时返回 nil
+func (m *MCPTokenOperation) GetTokenByHash(hash string) (*model.MCPToken, error) {
+	var token model.MCPToken
+	if err := m.DB.Where("token = ?", hash).First(&token).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListUserTokens 列出用户未过期的令牌
+func (m *MCPTokenOperation) ListUserTokens(userID uint, now int64) ([]*model.MCPToken, error) {
+	tokens := []*model.MCPToken{}
+	if err := m.DB.Where("user_id = ? AND expires_at > ?", userID, now).Order("id DESC").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteUserToken 删除用户的指定令牌
+func (m *MCPTokenOperation) DeleteUserToken(userID, id uint) (bool, error) {
+	result := m.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&model.MCPToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// TouchToken 更新令牌最近一次使用时间
+func (m *MCPTokenOperation) TouchToken(id uint, now int64) error {
+	return m.DB.Model(&model.MCPToken{}).Where("id = ?", id).UpdateColumn("last_used_at", now).Error
+}
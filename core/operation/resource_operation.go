@@ -392,6 +392,57 @@ func (r *ResourceOperation) DeleteResource(identifier string, resourceType strin
 	}
 }
 
+// GetResourceByName 根据资源名称（主机名、容器名、路由器/交换机名称）获取资源
+func (r *ResourceOperation) GetResourceByName(name string, resourceType string) (model.Resource, error) {
+	var resource model.Resource
+	var query interface{}
+	switch resourceType {
+	case constants.ResourceTypeLinux:
+		resource, query = &model.LinuxConfig{}, &model.LinuxConfig{Hostname: name}
+	case constants.ResourceTypeWindows:
+		resource, query = &model.WindowsConfig{}, &model.WindowsConfig{Hostname: name}
+	case constants.ResourceTypeDocker:
+		resource, query = &model.DockerConfig{}, &model.DockerConfig{ContainerName: name}
+	case constants.ResourceTypeRouter:
+		resource, query = &model.RouterConfig{}, &model.RouterConfig{RouterName: name}
+	case constants.ResourceTypeSwitch:
+		resource, query = &model.SwitchConfig{}, &model.SwitchConfig{SwitchName: name}
+	case constants.ResourceTypeDatabase:
+		resource, query = &model.DatabaseConfig{}, &model.DatabaseConfig{DatabaseNick: name}
+	default:
+		return nil, errors.New("unknown resource type: " + resourceType)
+	}
+	if err := r.DB.Where(query).First(resource).Error; err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
+// GetResourceByID 根据资源ID和资源类型获取资源
+func (r *ResourceOperation) GetResourceByID(id int64, resourceType string) (model.Resource, error) {
+	var resource model.Resource
+	switch resourceType {
+	case constants.ResourceTypeLinux:
+		resource = &model.LinuxConfig{}
+	case constants.ResourceTypeWindows:
+		resource = &model.WindowsConfig{}
+	case constants.ResourceTypeDocker:
+		resource = &model.DockerConfig{}
+	case constants.ResourceTypeRouter:
+		resource = &model.RouterConfig{}
+	case constants.ResourceTypeSwitch:
+		resource = &model.SwitchConfig{}
+	case constants.ResourceTypeDatabase:
+		resource = &model.DatabaseConfig{}
+	default:
+		return nil, errors.New("unknown resource type: " + resourceType)
+	}
+	if err := r.DB.First(resource, id).Error; err != nil {
+		return nil, err
+	}
+	return resource, nil
+}
+
 // GetResourceListByRoleId 根据角色ID和资源类型获取资源列表
 func (r *ResourceOperation) GetResourceListByRoleId(roleId uint, resourceType string) ([]model.Resource, error) {
 	var resourceList []model.Resource
@@ -606,3 +657,53 @@ func (r *ResourceOperation) GetResourceListByRoleId(roleId uint, resourceType st
 	}
 	return resourceList, nil
 }
+
+// GetResourceListByType 获取某类型的全部资源（不含已删除的资源）
+func (r *ResourceOperation) GetResourceListByType(resourceType string) ([]model.Resource, error) {
+	var resourceList []model.Resource
+	var err error
+	switch resourceType {
+	case constants.ResourceTypeLinux:
+		var list []*model.LinuxConfig
+		err = r.DB.Find(&list).Error
+		for _, res := range list {
+			resourceList = append(resourceList, res)
+		}
+	case constants.ResourceTypeWindows:
+		var list []*model.WindowsConfig
+		err = r.DB.Find(&list).Error
+		for _, res := range list {
+			resourceList = append(resourceList, res)
+		}
+	case constants.ResourceTypeDocker:
+		var list []*model.DockerConfig
+		err = r.DB.Find(&list).Error
+		for _, res := range list {
+			resourceList = append(resourceList, res)
+		}
+	case constants.ResourceTypeRouter:
+		var list []*model.RouterConfig
+		err = r.DB.Find(&list).Error
+		for _, res := range list {
+			resourceList = append(resourceList, res)
+		}
+	case constants.ResourceTypeSwitch:
+		var list []*model.SwitchConfig
+		err = r.DB.Find(&list).Error
+		for _, res := range list {
+			resourceList = append(resourceList, res)
+		}
+	case constants.ResourceTypeDatabase:
+		var list []*model.DatabaseConfig
+		err = r.DB.Find(&list).Error
+		for _, res := range list {
+			resourceList = append(resourceList, res)
+		}
+	default:
+		return nil, errors.New("unknown resource type: " + resourceType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resourceList, nil
+}
@@ -0,0 +1,53 @@
+package operation
+
+import (
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+type SessionRecordingOperation struct {
+	DB *gorm.DB
+}
+
+func NewSessionRecordingOperation() *SessionRecordingOperation {
+	return &SessionRecordingOperation{DB: global.GetDB()}
+}
+
+func NewSessionRecordingOperationWithDB(db *gorm.DB) *SessionRecordingOperation {
+	return &SessionRecordingOperation{DB: db}
+}
+
+// CreateRecording 创建录像记录
+func (s *SessionRecordingOperation) CreateRecording(recording *model.SessionRecording) error {
+	return s.DB.Create(recording).Error
+}
+
+// FinishRecording 标记录像结束并写入文件大小
+func (s *SessionRecordingOperation) FinishRecording(id uint, size int64) error {
+	now := time.Now()
+	return s.DB.Model(&model.SessionRecording{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ended_at": &now,
+		"size":     size,
+	}).Error
+}
+
+// GetRecordingByID 根据ID获取录像记录
+func (s *SessionRecordingOperation) GetRecordingByID(id uint) (*model.SessionRecording, error) {
+	recording := &model.SessionRecording{}
+	if err := s.DB.First(recording, id).Error; err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
+
+// GetRecordingByAuditLogID 根据审计日志ID获取录像记录
+func (s *SessionRecordingOperation) GetRecordingByAuditLogID(auditLogID uint) (*model.SessionRecording, error) {
+	recording := &model.SessionRecording{}
+	if err := s.DB.Where("audit_log_id = ?", auditLogID).First(recording).Error; err != nil {
+		return nil, err
+	}
+	return recording, nil
+}
@@ -133,3 +133,14 @@ func (s *SpaceOperation) GetAllSpaces() ([]*model.Space, error) {
 	}
 	return spaces, nil
 }
+
+// GetSpaceResourceIDs 获取空间内指定类型的资源ID
+func (s *SpaceOperation) GetSpaceResourceIDs(spaceID uint, resourceType string) ([]int64, error) {
+	var ids []int64
+	if err := s.DB.Model(&model.ResourceSpace{}).
+		Where("space_id = ? AND resource_type = ?", spaceID, resourceType).
+		Pluck("resource_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
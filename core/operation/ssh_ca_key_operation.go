@@ -0,0 +1,40 @@
+package operation
+
+import (
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+type SSHCAKeyOperation struct {
+	DB *gorm.DB
+}
+
+func NewSSHCAKeyOperation() *SSHCAKeyOperation {
+	return &SSHCAKeyOperation{DB: global.GetDB()}
+}
+
+func NewSSHCAKeyOperationWithDB(db *gorm.DB) *SSHCAKeyOperation {
+	return &SSHCAKeyOperation{DB: db}
+}
+
+// SaveSSHCAKey 保存 CA 密钥
+func (s *SSHCAKeyOperation) SaveSSHCAKey(privateKey []byte, publicKey []byte) (*model.SSHCAKey, error) {
+	caKey := &model.SSHCAKey{
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}
+	if err := s.DB.Create(caKey).Error; err != nil {
+		return nil, err
+	}
+	return caKey, nil
+}
+
+// GetLatestSSHCAKey 获取最新的一个作为当前 CA 密钥
+func (s *SSHCAKeyOperation) GetLatestSSHCAKey() (*model.SSHCAKey, error) {
+	var caKey model.SSHCAKey
+	if err := s.DB.Order("id desc").First(&caKey).Error; err != nil {
+		return nil, err
+	}
+	return &caKey, nil
+}
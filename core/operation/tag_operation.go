@@ -1,6 +1,9 @@
 package operation
 
 import (
+	"errors"
+	"time"
+
 	"binrc.com/roma/core/global"
 	"binrc.com/roma/core/model"
 	"gorm.io/gorm"
@@ -66,3 +69,59 @@ func (t *TagOperation) GetTagsByIds(ids []uint) ([]*model.Tag, error) {
 	}
 	return tags, nil
 }
+
+// GetOrCreateTag 按键值获取标签，不存在时创建
+func (t *TagOperation) GetOrCreateTag(label, value string) (*model.Tag, error) {
+	var tag model.Tag
+	err := t.DB.Where("label = ? AND value = ?", label, value).First(&tag).Error
+	if err == nil {
+		return &tag, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	now := time.Now().Format(time.RFC3339)
+	tag = model.Tag{Label: label, Value: value, CreatedAt: now, UpdatedAt: now}
+	if err := t.DB.Create(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// SetResourceTags 用 tags 替换资源的全部标签，tags 为空时清除资源标签
+func (t *TagOperation) SetResourceTags(resourceID int64, resourceType string, tags map[string]string) error {
+	return t.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("resource_id = ? AND resource_type = ?", resourceID, resourceType).
+			Delete(&model.ResourceTag{}).Error; err != nil {
+			return err
+		}
+		op := NewTagOperationWithDB(tx)
+		for label, value := range tags {
+			tag, err := op.GetOrCreateTag(label, value)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&model.ResourceTag{ResourceID: resourceID, ResourceType: resourceType, TagID: tag.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetResourceTags 获取资源的标签，返回 Label -> Value
+func (t *TagOperation) GetResourceTags(resourceID int64, resourceType string) (map[string]string, error) {
+	var links []*model.ResourceTag
+	if err := t.DB.Preload("Tag").
+		Where("resource_id = ? AND resource_type = ?", resourceID, resourceType).
+		Find(&links).Error; err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(links))
+	for _, link := range links {
+		if link.Tag != nil {
+			tags[link.Tag.Label] = link.Tag.Value
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,62 @@
+package operation
+
+import (
+	"errors"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+type UserMFAOperation struct {
+	DB *gorm.DB
+}
+
+func NewUserMFAOperation() *UserMFAOperation {
+	return &UserMFAOperation{DB: global.GetDB()}
+}
+
+func NewUserMFAOperationWithDB(db *gorm.DB) *UserMFAOperation {
+	return &UserMFAOperation{DB: db}
+}
+
+// GetUserMFA 获取用户的二次验证设置，不存在时返回 nil, nil
+func (u *UserMFAOperation) GetUserMFA(userID uint) (*model.UserMFA, error) {
+	mfa := &model.UserMFA{}
+	err := u.DB.Where("user_id = ?", userID).First(mfa).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+// SaveUserMFA 保存用户的二次验证设置（不存在时创建）
+func (u *UserMFAOperation) SaveUserMFA(mfa *model.UserMFA) error {
+	return u.DB.Save(mfa).Error
+}
+
+// UseTOTPStep 记录通过校验的时间步，只有大于上次时间步时才更新成功，防止并发重放
+func (u *UserMFAOperation) UseTOTPStep(id uint, step int64) (bool, error) {
+	result := u.DB.Model(&model.UserMFA{}).Where("id = ? AND last_used_step < ?", id, step).Update("last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UseRecoveryCodes 用新的恢复码列表替换旧列表，旧列表已被并发修改时不更新
+func (u *UserMFAOperation) UseRecoveryCodes(id uint, oldCodes, newCodes string) (bool, error) {
+	result := u.DB.Model(&model.UserMFA{}).Where("id = ? AND recovery_codes = ?", id, oldCodes).Update("recovery_codes", newCodes)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteUserMFA 删除用户的二次验证设置（重置）
+func (u *UserMFAOperation) DeleteUserMFA(userID uint) error {
+	return u.DB.Where("user_id = ?", userID).Delete(&model.UserMFA{}).Error
+}
@@ -144,11 +144,59 @@ func (u *UserOperation) DeleteUser(id uint64) error {
 }
 
 // 用户禁用
-func (u *UserOperation) DisabledUser(id uint64) error {
-	if err := u.DB.Model(&model.User{}).Where("id = ?", id).Update("status", 0).Error; err != nil {
-		return err
+// users 表没有 status 列，禁用即软删除（设置 deleted_at），禁用后的用户无法登录，可用 RestoreUser 恢复
+// by 记录禁用来源（model.UserDisabledByAdmin 等），目录同步只恢复自己禁用的用户
+func (u *UserOperation) DisabledUser(id uint64, by string) error {
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", id).Update("disabled_by", by).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.User{}, id).Error
+	})
+}
+
+// RestoreUser 恢复被禁用的用户
+func (u *UserOperation) RestoreUser(id uint) error {
+	return u.DB.Unscoped().Model(&model.User{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "disabled_by": ""}).Error
+}
+
+// GetUserByUsernameUnscoped 按用户名查找用户，包括已禁用的用户，不存在时返回 nil
+func (u *UserOperation) GetUserByUsernameUnscoped(username string) (*model.User, error) {
+	user := &model.User{}
+	if err := u.DB.Unscoped().Where("username = ?", username).First(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	return nil
+	return user, nil
+}
+
+// GetUserByExternalID 按来源和外部身份标识查找用户，包括已禁用的用户，不存在时返回 nil
+func (u *UserOperation) GetUserByExternalID(source, externalID string) (*model.User, error) {
+	user := &model.User{}
+	if err := u.DB.Unscoped().Where("source = ? AND external_id = ?", source, externalID).First(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUsersBySource 获取指定来源的未禁用用户
+func (u *UserOperation) GetUsersBySource(source string) ([]*model.User, error) {
+	users := []*model.User{}
+	if err := u.DB.Where("source = ?", source).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ReplaceUserRoles 用给定的角色替换用户的全部角色
+func (u *UserOperation) ReplaceUserRoles(user *model.User, roles []model.Role) error {
+	return u.DB.Model(user).Association("Roles").Replace(roles)
 }
 
 func (u *UserOperation) GetAllUsers() ([]*model.User, error) {
@@ -0,0 +1,107 @@
+package operation
+
+import (
+	"errors"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+type UserSessionOperation struct {
+	DB *gorm.DB
+}
+
+func NewUserSessionOperation() *UserSessionOperation {
+	return &UserSessionOperation{DB: global.GetDB()}
+}
+
+func NewUserSessionOperationWithDB(db *gorm.DB) *UserSessionOperation {
+	return &UserSessionOperation{DB: db}
+}
+
+// CreateSession 创建登录会话
+func (u *UserSessionOperation) CreateSession(session *model.UserSession) error {
+	return u.DB.Create(session).Error
+}
+
+// GetSession 按会话 ID 获取会话，不存在时返回 nil, nil
+func (u *UserSessionOperation) GetSession(sessionID string) (*model.UserSession, error) {
+	session := &model.UserSession{}
+	err := u.DB.Where("session_id = ?", sessionID).First(session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionByRefreshHash 按当前或上一个刷新令牌哈希获取会话，不存在时返回 nil, nil
+func (u *UserSessionOperation) GetSessionByRefreshHash(hash string) (*model.UserSession, error) {
+	session := &model.UserSession{}
+	err := u.DB.Where("refresh_token_hash = ? OR previous_refresh_hash = ?", hash, hash).First(session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// RotateRefreshToken 轮换刷新令牌，只有当前哈希仍为 oldHash 时才更新成功，防止同一令牌并发刷新
+func (u *UserSessionOperation) RotateRefreshToken(id uint, oldHash, newHash string, now time.Time) (bool, error) {
+	result := u.DB.Model(&model.UserSession{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", id, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":    newHash,
+			"previous_refresh_hash": oldHash,
+			"last_used_at":          now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// TouchSession 更新最近使用时间
+func (u *UserSessionOperation) TouchSession(id uint, now time.Time) error {
+	return u.DB.Model(&model.UserSession{}).Where("id = ?", id).Update("last_used_at", now).Error
+}
+
+// ListActiveSessions 列出用户未吊销且未过期的会话
+func (u *UserSessionOperation) ListActiveSessions(userID uint, now time.Time) ([]*model.UserSession, error) {
+	sessions := []*model.UserSession{}
+	if err := u.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_used_at DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession 吊销会话，返回是否有会话被吊销
+func (u *UserSessionOperation) RevokeSession(sessionID, reason string, now time.Time) (bool, error) {
+	result := u.DB.Model(&model.UserSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RevokeUserSessions 吊销用户的所有会话，返回吊销的数量
+func (u *UserSessionOperation) RevokeUserSessions(userID uint, reason string, now time.Time) (int64, error) {
+	result := u.DB.Model(&model.UserSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": now, "revoke_reason": reason})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteExpiredSessions 删除过期时间早于 before 的会话
+func (u *UserSessionOperation) DeleteExpiredSessions(before time.Time) error {
+	return u.DB.Where("expires_at < ?", before).Delete(&model.UserSession{}).Error
+}
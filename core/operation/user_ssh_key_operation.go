@@ -0,0 +1,82 @@
+package operation
+
+import (
+	"errors"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/gorm"
+)
+
+// ErrSSHKeyExists 用户已经添加过相同指纹的公钥
+var ErrSSHKeyExists = errors.New("ssh key already exists")
+
+type UserSSHKeyOperation struct {
+	DB *gorm.DB
+}
+
+func NewUserSSHKeyOperation() *UserSSHKeyOperation {
+	return &UserSSHKeyOperation{DB: global.GetDB()}
+}
+
+func NewUserSSHKeyOperationWithDB(db *gorm.DB) *UserSSHKeyOperation {
+	return &UserSSHKeyOperation{DB: db}
+}
+
+// CreateUserSSHKey 添加用户公钥，同一用户下指纹不能重复
+func (u *UserSSHKeyOperation) CreateUserSSHKey(key *model.UserSSHKey) (*model.UserSSHKey, error) {
+	var count int64
+	if err := u.DB.Model(&model.UserSSHKey{}).Where("user_id = ? AND fingerprint = ?", key.UserID, key.Fingerprint).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrSSHKeyExists
+	}
+	if err := u.DB.Create(key).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListUserSSHKeys 获取用户未吊销的公钥
+func (u *UserSSHKeyOperation) ListUserSSHKeys(userID uint) ([]*model.UserSSHKey, error) {
+	var keys []*model.UserSSHKey
+	if err := u.DB.Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetUserSSHKeyByFingerprint 根据指纹获取用户未吊销的公钥，不存在时返回 nil, nil
+func (u *UserSSHKeyOperation) GetUserSSHKeyByFingerprint(userID uint, fingerprint string) (*model.UserSSHKey, error) {
+	key := &model.UserSSHKey{}
+	err := u.DB.Where("user_id = ? AND fingerprint = ?", userID, fingerprint).First(key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// RevokeUserSSHKey 吊销用户的公钥（软删除），只能吊销自己的
+func (u *UserSSHKeyOperation) RevokeUserSSHKey(userID, id uint) (*model.UserSSHKey, error) {
+	key := &model.UserSSHKey{}
+	if err := u.DB.Where("id = ? AND user_id = ?", id, userID).First(key).Error; err != nil {
+		return nil, err
+	}
+	if err := u.DB.Delete(key).Error; err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchUserSSHKey 记录公钥最近一次登录的时间和来源 IP
+func (u *UserSSHKeyOperation) TouchUserSSHKey(id uint, ip string) error {
+	return u.DB.Model(&model.UserSSHKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"last_used_ip": ip,
+	}).Error
+}
@@ -0,0 +1,272 @@
+package permissions
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"binrc.com/roma/configs"
+)
+
+// ConditionDefinition 权限生效条件，配置的条件全部满足时权限才生效
+type ConditionDefinition struct {
+	TimeWindows []string   `json:"time_windows,omitempty"` // "HH:MM-HH:MM"，结束早于开始表示跨午夜
+	Weekdays    []string   `json:"weekdays,omitempty"`     // mon..sun，跨午夜时段按开始那天计算
+	Timezone    string     `json:"timezone,omitempty"`     // 时段和星期使用的时区，为空时使用服务器本地时区
+	SourceCIDRs []string   `json:"source_cidrs,omitempty"` // 允许的来源网段
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // 到达该时间后权限失效
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// buildConditions 校验并规范化配置中的权限条件，没有配置任何条件时返回 nil
+func buildConditions(cfg *configs.RolePermissionConditions) (*ConditionDefinition, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	cond := &ConditionDefinition{Timezone: strings.TrimSpace(cfg.Timezone)}
+	loc, err := conditionLocation(cond.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range cfg.TimeWindows {
+		start, end, err := parseTimeWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		cond.TimeWindows = append(cond.TimeWindows, fmt.Sprintf("%02d:%02d-%02d:%02d", start/60, start%60, end/60, end%60))
+	}
+	if cond.Weekdays, err = parseWeekdays(cfg.Weekdays); err != nil {
+		return nil, err
+	}
+	for _, c := range cfg.SourceCIDRs {
+		network, err := parseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		cond.SourceCIDRs = append(cond.SourceCIDRs, network.String())
+	}
+	if raw := strings.TrimSpace(cfg.ExpiresAt); raw != "" {
+		var expires time.Time
+		if day, err := time.ParseInLocation("2006-01-02", raw, loc); err == nil {
+			// 只写日期时，当天结束时过期
+			expires = day.AddDate(0, 0, 1)
+		} else if expires, err = time.Parse(time.RFC3339, raw); err != nil {
+			return nil, fmt.Errorf("invalid expires_at %q, use 2006-01-02 or RFC3339", raw)
+		}
+		cond.ExpiresAt = &expires
+	}
+	if len(cond.TimeWindows) == 0 && len(cond.Weekdays) == 0 && len(cond.SourceCIDRs) == 0 && cond.ExpiresAt == nil {
+		return nil, nil
+	}
+	return cond, nil
+}
+
+// Evaluate 检查条件在当前时间和来源地址下是否满足
+// 输入: now - 当前时间；clientIP - 来源地址，为空表示未知（配置了来源网段时视为不满足）
+// 输出: bool - 是否满足；string - 不满足的原因
+func (c *ConditionDefinition) Evaluate(now time.Time, clientIP string) (bool, string) {
+	return c.evaluate(now, clientIP, false)
+}
+
+// matchDeny 拒绝规则的条件检查：来源地址未知时无法排除来源网段，视为满足（失败时拒绝）
+func (c *ConditionDefinition) matchDeny(now time.Time, clientIP string) (bool, string) {
+	return c.evaluate(now, clientIP, true)
+}
+
+func (c *ConditionDefinition) evaluate(now time.Time, clientIP string, unknownSourceMatches bool) (bool, string) {
+	if c == nil {
+		return true, ""
+	}
+	loc, err := conditionLocation(c.Timezone)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+		return false, fmt.Sprintf("已于 %s 过期", c.ExpiresAt.In(loc).Format("2006-01-02 15:04 MST"))
+	}
+
+	if ip := net.ParseIP(clientIP); len(c.SourceCIDRs) > 0 && (ip != nil || !unknownSourceMatches) {
+		if ip == nil {
+			return false, fmt.Sprintf("仅允许来自 %s 的访问，无法确定来源地址", strings.Join(c.SourceCIDRs, ", "))
+		}
+		matched := false
+		for _, cidr := range c.SourceCIDRs {
+			if network, err := parseCIDR(cidr); err == nil && network.Contains(ip) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, fmt.Sprintf("仅允许来自 %s 的访问，当前来源 %s", strings.Join(c.SourceCIDRs, ", "), clientIP)
+		}
+	}
+
+	if len(c.TimeWindows) > 0 || len(c.Weekdays) > 0 {
+		local := now.In(loc)
+		if !c.inSchedule(local) {
+			return false, fmt.Sprintf("仅在 %s 生效（%s，当前 %s）", c.schedule(), loc, local.Format("Mon 15:04"))
+		}
+	}
+	return true, ""
+}
+
+// inSchedule 当前时间是否落在时段与星期内；跨午夜时段凌晨部分按前一天的星期判断
+func (c *ConditionDefinition) inSchedule(local time.Time) bool {
+	today := local.Weekday()
+	if len(c.TimeWindows) == 0 {
+		return c.onWeekday(today)
+	}
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range c.TimeWindows {
+		start, end, err := parseTimeWindow(w)
+		if err != nil {
+			continue
+		}
+		switch {
+		case start < end:
+			if minute >= start && minute < end && c.onWeekday(today) {
+				return true
+			}
+		case minute >= start:
+			if c.onWeekday(today) {
+				return true
+			}
+		case minute < end:
+			if c.onWeekday((today + 6) % 7) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *ConditionDefinition) onWeekday(day time.Weekday) bool {
+	if len(c.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range c.Weekdays {
+		if d == weekdayNames[day] {
+			return true
+		}
+	}
+	return false
+}
+
+// schedule 时段与星期的可读描述
+func (c *ConditionDefinition) schedule() string {
+	var parts []string
+	if len(c.Weekdays) > 0 {
+		parts = append(parts, strings.Join(c.Weekdays, ","))
+	}
+	if len(c.TimeWindows) > 0 {
+		parts = append(parts, strings.Join(c.TimeWindows, ", "))
+	}
+	return strings.Join(parts, " ")
+}
+
+func conditionLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", name)
+	}
+	return loc, nil
+}
+
+// parseTimeWindow 解析 "HH:MM-HH:MM"，返回一天中的起止分钟
+func parseTimeWindow(s string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid time window %q, use HH:MM-HH:MM", s)
+	}
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid time window %q, use HH:MM-HH:MM", s)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	if minutes[0] == minutes[1] {
+		return 0, 0, fmt.Errorf("invalid time window %q, start equals end", s)
+	}
+	return minutes[0], minutes[1], nil
+}
+
+// parseWeekdays 解析星期列表，支持 "mon"、"monday" 和 "mon-fri" 这样的区间，结果按周日到周六排序去重
+func parseWeekdays(list []string) ([]string, error) {
+	var selected [7]bool
+	found := false
+	for _, item := range list {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		from, err := weekdayIndex(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = weekdayIndex(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			selected[d] = true
+			if d == to {
+				break
+			}
+		}
+		found = true
+	}
+	if !found {
+		return nil, nil
+	}
+	var result []string
+	for d, ok := range selected {
+		if ok {
+			result = append(result, weekdayNames[d])
+		}
+	}
+	return result, nil
+}
+
+func weekdayIndex(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if len(name) >= 3 {
+		for i, d := range weekdayNames {
+			if strings.HasPrefix(name, d) {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", name)
+}
+
+// parseCIDR 解析网段，单个 IP 视为 /32 或 /128
+func parseCIDR(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source cidr %q", s)
+		}
+		if ip.To4() != nil {
+			s += "/32"
+		} else {
+			s += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source cidr %q", s)
+	}
+	return network, nil
+}
@@ -0,0 +1,191 @@
+package permissions
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		window    string
+		wantStart int
+		wantEnd   int
+		wantErr   bool
+	}{
+		{window: "09:00-18:00", wantStart: 9 * 60, wantEnd: 18 * 60},
+		{window: " 22:00 - 06:30 ", wantStart: 22 * 60, wantEnd: 6*60 + 30},
+		{window: "00:00-23:59", wantStart: 0, wantEnd: 23*60 + 59},
+		{window: "9:05-9:10", wantStart: 9*60 + 5, wantEnd: 9*60 + 10},
+		{window: "09:00-09:00", wantErr: true},
+		{window: "09:00", wantErr: true},
+		{window: "09:00-18:00-20:00", wantErr: true},
+		{window: "24:00-06:00", wantErr: true},
+		{window: "9am-5pm", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			start, end, err := parseTimeWindow(tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimeWindow(%q) error = %v, wantErr %v", tt.window, err, tt.wantErr)
+			}
+			if !tt.wantErr && (start != tt.wantStart || end != tt.wantEnd) {
+				t.Errorf("parseTimeWindow(%q) = %d, %d, want %d, %d", tt.window, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestParseWeekdays(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", list: nil, want: nil},
+		{name: "blank items", list: []string{"", " "}, want: nil},
+		{name: "short names", list: []string{"mon", "wed"}, want: []string{"mon", "wed"}},
+		{name: "full names and case", list: []string{"Friday", "MONDAY"}, want: []string{"mon", "fri"}},
+		{name: "range", list: []string{"mon-fri"}, want: []string{"mon", "tue", "wed", "thu", "fri"}},
+		{name: "wrapping range", list: []string{"fri-mon"}, want: []string{"sun", "mon", "fri", "sat"}},
+		{name: "duplicates", list: []string{"sat", "sat-sun"}, want: []string{"sun", "sat"}},
+		{name: "unknown", list: []string{"funday"}, wantErr: true},
+		{name: "too short", list: []string{"mo"}, wantErr: true},
+		{name: "bad range end", list: []string{"mon-x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWeekdays(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWeekdays(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWeekdays(%q) = %q, want %q", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInSchedule(t *testing.T) {
+	// 2024-01-01 是周一
+	at := func(day int, clock string) time.Time {
+		tm, _ := time.Parse("15:04", clock)
+		return time.Date(2024, 1, day, tm.Hour(), tm.Minute(), 0, 0, time.UTC)
+	}
+	nightShift := &ConditionDefinition{TimeWindows: []string{"22:00-06:00"}, Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}}
+	office := &ConditionDefinition{TimeWindows: []string{"09:00-12:00", "13:00-18:00"}, Weekdays: []string{"mon", "tue", "wed", "thu", "fri"}}
+	weekend := &ConditionDefinition{Weekdays: []string{"sat", "sun"}}
+	tests := []struct {
+		name string
+		cond *ConditionDefinition
+		now  time.Time
+		want bool
+	}{
+		{name: "office morning", cond: office, now: at(1, "09:00"), want: true},
+		{name: "office lunch break", cond: office, now: at(1, "12:30"), want: false},
+		{name: "office end is exclusive", cond: office, now: at(1, "18:00"), want: false},
+		{name: "office saturday", cond: office, now: at(6, "10:00"), want: false},
+		{name: "night shift starts monday", cond: nightShift, now: at(1, "23:00"), want: true},
+		{name: "night shift after midnight counts as monday", cond: nightShift, now: at(2, "05:59"), want: true},
+		{name: "night shift ends", cond: nightShift, now: at(2, "06:00"), want: false},
+		{name: "night shift daytime", cond: nightShift, now: at(2, "12:00"), want: false},
+		{name: "friday night continues into saturday", cond: nightShift, now: at(6, "02:00"), want: true},
+		{name: "saturday night not started", cond: nightShift, now: at(6, "23:00"), want: false},
+		{name: "sunday night after midnight belongs to sunday", cond: nightShift, now: at(1, "01:00"), want: false},
+		{name: "weekend only", cond: weekend, now: at(7, "03:00"), want: true},
+		{name: "weekend only miss", cond: weekend, now: at(3, "03:00"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond.inSchedule(tt.now); got != tt.want {
+				t.Errorf("inSchedule(%s) = %v, want %v", tt.now.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	tests := []struct {
+		name     string
+		cfg      *configs.RolePermissionConditions
+		clientIP string
+		want     bool
+		wantDeny bool // 作为拒绝规则的条件时是否命中
+	}{
+		{name: "no conditions", cfg: nil, clientIP: "203.0.113.1", want: true, wantDeny: true},
+		{name: "cidr match", cfg: &configs.RolePermissionConditions{SourceCIDRs: []string{"10.0.0.0/8"}}, clientIP: "10.1.2.3", want: true, wantDeny: true},
+		{name: "single ip", cfg: &configs.RolePermissionConditions{SourceCIDRs: []string{"192.0.2.7"}}, clientIP: "192.0.2.7", want: true, wantDeny: true},
+		{name: "cidr miss", cfg: &configs.RolePermissionConditions{SourceCIDRs: []string{"10.0.0.0/8"}}, clientIP: "203.0.113.1", want: false, wantDeny: false},
+		{name: "unknown source", cfg: &configs.RolePermissionConditions{SourceCIDRs: []string{"10.0.0.0/8"}}, clientIP: "", want: false, wantDeny: true},
+		{name: "unknown source outside schedule", cfg: &configs.RolePermissionConditions{SourceCIDRs: []string{"10.0.0.0/8"}, TimeWindows: []string{"22:00-06:00"}, Timezone: "UTC"}, clientIP: "", want: false, wantDeny: false},
+		{name: "in timezone window", cfg: &configs.RolePermissionConditions{TimeWindows: []string{"17:00-19:00"}, Timezone: "Asia/Shanghai"}, want: true, wantDeny: true},
+		{name: "expired", cfg: &configs.RolePermissionConditions{ExpiresAt: expired.Format(time.RFC3339)}, want: false, wantDeny: false},
+		{name: "expires end of day", cfg: &configs.RolePermissionConditions{ExpiresAt: "2024-01-01", Timezone: "UTC"}, want: true, wantDeny: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := buildConditions(tt.cfg)
+			if err != nil {
+				t.Fatalf("buildConditions() error = %v", err)
+			}
+			if got, why := cond.Evaluate(now, tt.clientIP); got != tt.want {
+				t.Errorf("Evaluate() = %v (%s), want %v", got, why, tt.want)
+			}
+			if got, why := cond.matchDeny(now, tt.clientIP); got != tt.wantDeny {
+				t.Errorf("matchDeny() = %v (%s), want %v", got, why, tt.wantDeny)
+			}
+		})
+	}
+}
+
+func TestBuildConditionsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *configs.RolePermissionConditions
+	}{
+		{name: "time window", cfg: &configs.RolePermissionConditions{TimeWindows: []string{"25:00-01:00"}}},
+		{name: "weekday", cfg: &configs.RolePermissionConditions{Weekdays: []string{"someday"}}},
+		{name: "cidr", cfg: &configs.RolePermissionConditions{SourceCIDRs: []string{"10.0.0.0/33"}}},
+		{name: "timezone", cfg: &configs.RolePermissionConditions{Timezone: "Mars/Olympus"}},
+		{name: "expires", cfg: &configs.RolePermissionConditions{ExpiresAt: "next week"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildConditions(tt.cfg); err == nil {
+				t.Error("buildConditions() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMatchRuleUnknownSource(t *testing.T) {
+	office := &ConditionDefinition{SourceCIDRs: []string{"10.0.0.0/8"}}
+	desc := &RoleDescriptor{Permissions: []PermissionDefinition{
+		{Effect: EffectDeny, Target: "user", Actions: []string{"delete"}, Conditions: office},
+		{Target: "user", Actions: []string{"list"}, Conditions: office},
+	}}
+	now := time.Now()
+	tests := []struct {
+		effect   string
+		action   string
+		clientIP string
+		want     bool
+	}{
+		{effect: EffectDeny, action: "delete", clientIP: "10.0.0.1", want: true},
+		{effect: EffectDeny, action: "delete", clientIP: "192.0.2.1", want: false},
+		{effect: EffectDeny, action: "delete", clientIP: "", want: true},
+		{effect: EffectAllow, action: "list", clientIP: "10.0.0.1", want: true},
+		{effect: EffectAllow, action: "list", clientIP: "", want: false},
+	}
+	for _, tt := range tests {
+		rule, _ := desc.matchRule(tt.effect, "user", tt.action, tt.clientIP, scopeSubject{}, now)
+		if got := rule != nil; got != tt.want {
+			t.Errorf("matchRule(%s, %s, %q) matched = %v, want %v", tt.effect, tt.action, tt.clientIP, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package permissions
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"binrc.com/roma/core/model"
+)
+
+// 判定步骤。资源访问检查按以下顺序执行：
+//  1. deny            任一角色的拒绝规则命中即拒绝，之后的步骤都不能推翻
+//  2. super_bypass    开启 super_bypass_all 时 super 角色直接允许
+//  3. resource_role   开启 enable_resource_role 时检查资源要求的角色
+//  4. space           开启 enable_space_isolation 时检查空间成员与空间内的资源角色
+//  5. role_permission 角色的允许规则（含资源范围与生效条件）
+//  6. access_grant    前面未允许时，未到期的临时访问授权可放行 list/get/use
+//  7. default_deny    没有步骤允许时拒绝
+//
+// 第 3、4、5 步的拒绝是暂定结果，只能被第 6 步的临时访问授权推翻
+// 全局操作权限（如 session.list）只有 deny 与 role_permission 两步
+const (
+	StepLoadRoles      = "load_roles"
+	StepDeny           = "deny"
+	StepSuperBypass    = "super_bypass"
+	StepResourceRole   = "resource_role"
+	StepSpace          = "space"
+	StepRolePermission = "role_permission"
+	StepAccessGrant    = "access_grant"
+	StepDefaultDeny    = "default_deny"
+)
+
+// 单个步骤的结果
+const (
+	ResultAllow = "allow" // 允许
+	ResultDeny  = "deny"  // 拒绝
+	ResultPass  = "pass"  // 未得出结论，进入下一步
+	ResultSkip  = "skip"  // 策略未启用或不适用，跳过
+)
+
+// Decision 权限判定结果与判定过程
+type Decision struct {
+	Allowed bool        `json:"allowed"`
+	Step    string      `json:"step"`             // 得出结论的步骤
+	Rule    string      `json:"rule,omitempty"`   // 得出结论的规则，如 "ops: deny resource(use) scope:include tag=env=prod"
+	Reason  string      `json:"reason,omitempty"` // 拒绝原因
+	Trace   []TraceStep `json:"trace"`
+}
+
+// TraceStep 判定过程中的一步
+type TraceStep struct {
+	Step   string `json:"step"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func (d *Decision) record(step, result, detail string) {
+	d.Trace = append(d.Trace, TraceStep{Step: step, Result: result, Detail: detail})
+}
+
+func (d *Decision) allow(step, rule, detail string) *Decision {
+	d.record(step, ResultAllow, detail)
+	d.Allowed, d.Step, d.Rule, d.Reason = true, step, rule, ""
+	return d
+}
+
+func (d *Decision) deny(step, rule, reason string) *Decision {
+	d.record(step, ResultDeny, reason)
+	d.Allowed, d.Step, d.Rule, d.Reason = false, step, rule, reason
+	return d
+}
+
+// String 判定过程的单行描述，用于日志
+func (d *Decision) String() string {
+	parts := make([]string, 0, len(d.Trace))
+	for _, t := range d.Trace {
+		if t.Detail != "" {
+			parts = append(parts, fmt.Sprintf("%s=%s(%s)", t.Step, t.Result, t.Detail))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=%s", t.Step, t.Result))
+		}
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// roleDescriptor 已解析权限描述符的角色；没有结构化描述符的角色不参与判定
+type roleDescriptor struct {
+	role *model.Role
+	desc *RoleDescriptor
+}
+
+func parseRoles(userRoles []*model.Role) []roleDescriptor {
+	result := make([]roleDescriptor, 0, len(userRoles))
+	for _, role := range userRoles {
+		if role == nil {
+			continue
+		}
+		desc, err := ParseRoleDescriptor(role.Desc)
+		if err != nil || desc == nil {
+			continue
+		}
+		result = append(result, roleDescriptor{role: role, desc: desc})
+	}
+	return result
+}
+
+func ruleLabel(role *model.Role, rule string) string {
+	return fmt.Sprintf("%s: %s", role.Name, rule)
+}
+
+// denyStep 第 1 步：任一角色的拒绝规则命中即拒绝，返回是否已拒绝
+func (d *Decision) denyStep(roles []roleDescriptor, target, action, clientIP string, subject scopeSubject, now time.Time) bool {
+	for _, rd := range roles {
+		if rule, _ := rd.desc.matchRule(EffectDeny, target, action, clientIP, subject, now); rule != nil {
+			d.deny(StepDeny, ruleLabel(rd.role, rule.String()),
+				fmt.Sprintf("角色 %s 的拒绝规则 %s 禁止 %s.%s", rd.role.Name, rule, target, action))
+			return true
+		}
+	}
+	d.record(StepDeny, ResultPass, "")
+	return false
+}
+
+// rolePermissionStep 第 5 步：角色的允许规则，返回是否允许
+// 不允许时返回有对应规则但生效条件不满足的原因，如 "角色 oncall 的 resource.use 权限仅在 22:00-06:00 生效"
+func (d *Decision) rolePermissionStep(roles []roleDescriptor, target, action, clientIP string, subject scopeSubject, now time.Time) (bool, string) {
+	reason := ""
+	for _, rd := range roles {
+		// 拒绝规则已在第 1 步检查过，这里 super 角色直接允许
+		if rd.desc.IsSuper {
+			d.allow(StepRolePermission, ruleLabel(rd.role, "is_super"), "")
+			return true, ""
+		}
+		rule, why := rd.desc.matchRule(EffectAllow, target, action, clientIP, subject, now)
+		if rule != nil {
+			d.allow(StepRolePermission, ruleLabel(rd.role, rule.String()), "")
+			return true, ""
+		}
+		if why != "" && reason == "" {
+			reason = fmt.Sprintf("角色 %s 的 %s.%s 权限%s", rd.role.Name, target, action, why)
+		}
+	}
+	if reason != "" {
+		d.deny(StepRolePermission, "", reason)
+	} else {
+		d.record(StepRolePermission, ResultPass, "没有匹配的允许规则")
+	}
+	return false, reason
+}
+
+// EvaluateRoles 判定角色集合是否拥有全局操作权限（如 session.list），先检查拒绝规则，再检查允许规则
+// resourceScope 为资源名称，可为空；带资源范围的拒绝规则只在针对具体资源的检查中生效
+func EvaluateRoles(userRoles []*model.Role, target, action, resourceScope, clientIP string) *Decision {
+	target = strings.ToLower(strings.TrimSpace(target))
+	action = strings.ToLower(strings.TrimSpace(action))
+	subject := scopeSubject{name: strings.TrimSpace(resourceScope)}
+	d := &Decision{}
+	roles := parseRoles(userRoles)
+	now := time.Now()
+	if d.denyStep(roles, target, action, clientIP, subject, now) {
+		return d
+	}
+	if allowed, reason := d.rolePermissionStep(roles, target, action, clientIP, subject, now); allowed || reason != "" {
+		return d
+	}
+	return d.deny(StepDefaultDeny, "", "")
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"binrc.com/roma/configs"
 	"binrc.com/roma/core/model"
@@ -14,21 +15,38 @@ const descriptorVersion = "1.0"
 
 // RoleDescriptor represents the structured permission definition stored inside role.Desc.
 type RoleDescriptor struct {
-	Version     string                 `json:"version"`
-	Description string                 `json:"description,omitempty"`
-	IsSuper     bool                   `json:"is_super,omitempty"`
-	Permissions []PermissionDefinition `json:"permissions,omitempty"`
+	Version              string                 `json:"version"`
+	Description          string                 `json:"description,omitempty"`
+	IsSuper              bool                   `json:"is_super,omitempty"`
+	DisableRecording     bool                   `json:"disable_recording,omitempty"`      // 该角色用户的终端会话不录像
+	AllowAgentForwarding bool                   `json:"allow_agent_forwarding,omitempty"` // 该角色用户可以把 ssh-agent 转发到上游
+	AllowPortForwarding  bool                   `json:"allow_port_forwarding,omitempty"`  // 该角色用户可以使用端口转发和 ProxyJump
+	RequireTOTP          bool                   `json:"require_totp,omitempty"`           // 该角色用户必须使用 TOTP 二次验证
+	Permissions          []PermissionDefinition `json:"permissions,omitempty"`
 }
 
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
 type PermissionDefinition struct {
-	Target  string           `json:"target"`
-	Actions []string         `json:"actions"`
-	Scope   *ScopeDefinition `json:"scope,omitempty"`
+	Effect     string               `json:"effect,omitempty"` // 为空表示 allow；deny 规则命中时总是拒绝
+	Target     string               `json:"target"`
+	Actions    []string             `json:"actions"`
+	Scope      *ScopeDefinition     `json:"scope,omitempty"`
+	Conditions *ConditionDefinition `json:"conditions,omitempty"` // 生效条件（时段、星期、来源网段、过期时间）
 }
 
+// ScopeDefinition 资源范围，只对 resource 权限有意义
+// 配置的选择器需同时满足；spaces、names、resource_types 中任一项匹配即可，tags 需全部匹配
 type ScopeDefinition struct {
-	Type  string `json:"type,omitempty"`
-	Value string `json:"value,omitempty"`
+	Type          string   `json:"type,omitempty"`           // include（默认）或 exclude
+	Value         string   `json:"value,omitempty"`          // 资源名称包含该字符串
+	Tags          []string `json:"tags,omitempty"`           // "key=value" 或 "key"
+	Spaces        []string `json:"spaces,omitempty"`         // 空间名称
+	Names         []string `json:"names,omitempty"`          // 资源名称 glob
+	ResourceTypes []string `json:"resource_types,omitempty"` // 资源类型
 }
 
 // BuildRoleDescriptor converts a RoleConfig into a JSON descriptor string.
@@ -37,15 +55,19 @@ func BuildRoleDescriptor(cfg *configs.RoleConfig) (string, error) {
 		return "", errors.New("role config is nil")
 	}
 
-	if len(cfg.Permissions) == 0 && !cfg.IsDefaultSuper {
+	if len(cfg.Permissions) == 0 && !cfg.IsDefaultSuper && !cfg.DisableRecording && !cfg.AllowAgentForwarding && !cfg.AllowPortForwarding && !cfg.RequireTOTP {
 		// fall back to legacy desc if provided
 		return strings.TrimSpace(cfg.Desc), nil
 	}
 
 	desc := RoleDescriptor{
-		Version:     descriptorVersion,
-		Description: fallbackDescription(cfg),
-		IsSuper:     cfg.IsDefaultSuper,
+		Version:              descriptorVersion,
+		Description:          fallbackDescription(cfg),
+		IsSuper:              cfg.IsDefaultSuper,
+		DisableRecording:     cfg.DisableRecording,
+		AllowAgentForwarding: cfg.AllowAgentForwarding,
+		AllowPortForwarding:  cfg.AllowPortForwarding,
+		RequireTOTP:          cfg.RequireTOTP,
 	}
 
 	for _, permCfg := range cfg.Permissions {
@@ -63,16 +85,27 @@ func BuildRoleDescriptor(cfg *configs.RoleConfig) (string, error) {
 			Target:  target,
 			Actions: normalizeActions(permCfg.Actions),
 		}
-		if permCfg.Scope != nil && strings.TrimSpace(permCfg.Scope.Value) != "" {
-			def.Scope = &ScopeDefinition{
-				Type:  strings.ToLower(strings.TrimSpace(permCfg.Scope.Type)),
-				Value: strings.TrimSpace(permCfg.Scope.Value),
-			}
+		switch effect := strings.ToLower(strings.TrimSpace(permCfg.Effect)); effect {
+		case "", EffectAllow:
+		case EffectDeny:
+			def.Effect = EffectDeny
+		default:
+			return "", fmt.Errorf("role %s permission %s has invalid effect %q, use allow or deny", cfg.Name, target, permCfg.Effect)
 		}
+		scope, err := buildScope(permCfg.Scope)
+		if err != nil {
+			return "", fmt.Errorf("role %s permission %s scope: %w", cfg.Name, target, err)
+		}
+		def.Scope = scope
+		conditions, err := buildConditions(permCfg.Conditions)
+		if err != nil {
+			return "", fmt.Errorf("role %s permission %s conditions: %w", cfg.Name, target, err)
+		}
+		def.Conditions = conditions
 		desc.Permissions = append(desc.Permissions, def)
 	}
 
-	if len(desc.Permissions) == 0 && !desc.IsSuper {
+	if len(desc.Permissions) == 0 && !desc.IsSuper && !desc.DisableRecording && !desc.AllowAgentForwarding && !desc.AllowPortForwarding && !desc.RequireTOTP {
 		return "", fmt.Errorf("role %s has no valid permissions", cfg.Name)
 	}
 
@@ -132,43 +165,124 @@ func ParseRoleDescriptor(raw string) (*RoleDescriptor, error) {
 }
 
 // HasPermission determines whether the descriptor grants the given action on target.
+// Conditions are evaluated at the current time with an unknown source address.
 func HasPermission(desc *RoleDescriptor, target, action, resourceScope string) bool {
+	allowed, _ := EvaluatePermission(desc, target, action, resourceScope, "")
+	return allowed
+}
+
+// EvaluatePermission determines whether the descriptor grants the given action on target
+// for a request from clientIP. Deny rules are checked first and always win, even on a super
+// descriptor. When an allow rule matches but its conditions are not met, the reason of the
+// first such rule is returned.
+// resourceScope is a resource name matched against the name selectors of scoped permissions;
+// when it is empty, scoped allow rules count, and callers that know the concrete resource
+// should use EvaluateResourceAccess instead. Scoped deny rules only apply there.
+func EvaluatePermission(desc *RoleDescriptor, target, action, resourceScope, clientIP string) (bool, string) {
 	if desc == nil {
-		return false
-	}
-	if desc.IsSuper {
-		return true
+		return false, ""
 	}
 	target = strings.ToLower(strings.TrimSpace(target))
 	action = strings.ToLower(strings.TrimSpace(action))
-	scope := strings.ToLower(strings.TrimSpace(resourceScope))
+	subject := scopeSubject{name: strings.TrimSpace(resourceScope)}
+	now := time.Now()
 
-	for _, perm := range desc.Permissions {
+	if rule, _ := desc.matchRule(EffectDeny, target, action, clientIP, subject, now); rule != nil {
+		return false, fmt.Sprintf("被拒绝规则 %s 禁止", rule)
+	}
+	if desc.IsSuper {
+		return true, ""
+	}
+	rule, reason := desc.matchRule(EffectAllow, target, action, clientIP, subject, now)
+	return rule != nil, reason
+}
+
+// matchRule 返回描述符中第一条命中的 effect 规则（目标、操作、资源范围和生效条件都满足）
+// 没有命中时，若有目标、操作和范围都匹配但生效条件不满足的规则，返回第一条的原因
+// 来源地址未知时，带来源网段条件的拒绝规则按命中处理
+func (d *RoleDescriptor) matchRule(effect, target, action, clientIP string, subject scopeSubject, now time.Time) (*PermissionDefinition, string) {
+	reason := ""
+	for i := range d.Permissions {
+		perm := &d.Permissions[i]
+		if perm.effect() != effect {
+			continue
+		}
 		if perm.Target != "*" && perm.Target != target {
 			continue
 		}
 		if !hasActionMatch(perm.Actions, action) {
 			continue
 		}
-		if perm.Scope != nil && perm.Scope.Value != "" {
-			switch perm.Scope.Type {
-			case "exclude":
-				if scope == "" {
-					// no scope specified, treat as allowed
-				} else if strings.Contains(scope, strings.ToLower(perm.Scope.Value)) {
-					continue
-				}
-			case "include":
-				if scope == "" || !strings.Contains(scope, strings.ToLower(perm.Scope.Value)) {
-					continue
-				}
+		if !subject.inScope(perm) {
+			continue
+		}
+		check := perm.Conditions.Evaluate
+		if effect == EffectDeny {
+			check = perm.Conditions.matchDeny
+		}
+		if ok, why := check(now, clientIP); !ok {
+			if reason == "" {
+				reason = why
 			}
+			continue
 		}
+		return perm, ""
+	}
+	return nil, reason
+}
+
+// hasDenyRules 描述符是否包含拒绝规则
+func (d *RoleDescriptor) hasDenyRules() bool {
+	for _, perm := range d.Permissions {
+		if perm.effect() == EffectDeny {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsEverything 描述符是否拥有全部权限：super，或有 target="*" 且 actions=["*"]、不限资源范围的无条件权限，且没有拒绝规则
+func (d *RoleDescriptor) allowsEverything() bool {
+	if d.hasDenyRules() {
+		return false
+	}
+	if d.IsSuper {
 		return true
 	}
+	for _, perm := range d.Permissions {
+		if perm.Target == "*" && perm.Scope == nil && perm.Conditions == nil {
+			for _, action := range perm.Actions {
+				if action == "*" {
+					return true
+				}
+			}
+		}
+	}
 	return false
 }
 
+func (p *PermissionDefinition) effect() string {
+	if p.Effect == EffectDeny {
+		return EffectDeny
+	}
+	return EffectAllow
+}
+
+// String 权限的可读描述，如 "deny resource(use) scope:include tag=env=prod"
+func (p *PermissionDefinition) String() string {
+	label := p.Target
+	if len(p.Actions) > 0 {
+		label = fmt.Sprintf("%s(%s)", p.Target, strings.Join(p.Actions, "|"))
+	}
+	if p.effect() == EffectDeny {
+		label = "deny " + label
+	}
+	if p.Scope != nil {
+		label = fmt.Sprintf("%s scope:%s", label, p.Scope)
+	}
+	return label
+}
+
 func hasActionMatch(actions []string, action string) bool {
 	if len(actions) == 0 {
 		return false
@@ -197,24 +311,84 @@ func IsSuperRole(role *model.Role) bool {
 }
 
 // HasAllPermissions 检查角色是否拥有所有权限（通过权限描述符判断）
+// 带拒绝规则的角色不视为拥有所有权限，避免调用方跳过检查时绕过拒绝规则
 func HasAllPermissions(role *model.Role) bool {
 	if role == nil {
 		return false
 	}
 	desc, err := ParseRoleDescriptor(role.Desc)
 	if err == nil && desc != nil {
-		if desc.IsSuper {
+		return desc.allowsEverything()
+	}
+	return false
+}
+
+// HasDenyRules 检查角色集合中是否有角色配置了拒绝规则
+// 调用方在因 super 角色跳过资源检查前需要先确认没有拒绝规则
+func HasDenyRules(roles []*model.Role) bool {
+	for _, role := range roles {
+		if role == nil {
+			continue
+		}
+		desc, err := ParseRoleDescriptor(role.Desc)
+		if err == nil && desc != nil && desc.hasDenyRules() {
 			return true
 		}
-		// 检查是否有 target="*" 且 actions=["*"] 的权限
-		for _, perm := range desc.Permissions {
-			if perm.Target == "*" {
-				for _, action := range perm.Actions {
-					if action == "*" {
-						return true
-					}
-				}
-			}
+	}
+	return false
+}
+
+// IsRecordingDisabled 检查用户角色中是否有关闭会话录像的角色
+func IsRecordingDisabled(roles []*model.Role) bool {
+	for _, role := range roles {
+		if role == nil {
+			continue
+		}
+		desc, err := ParseRoleDescriptor(role.Desc)
+		if err == nil && desc != nil && desc.DisableRecording {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAgentForwardingAllowed 检查用户角色中是否有允许 ssh-agent 转发的角色
+func IsAgentForwardingAllowed(roles []*model.Role) bool {
+	for _, role := range roles {
+		if role == nil {
+			continue
+		}
+		desc, err := ParseRoleDescriptor(role.Desc)
+		if err == nil && desc != nil && desc.AllowAgentForwarding {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPortForwardingAllowed 检查用户角色中是否有允许端口转发的角色
+func IsPortForwardingAllowed(roles []*model.Role) bool {
+	for _, role := range roles {
+		if role == nil {
+			continue
+		}
+		desc, err := ParseRoleDescriptor(role.Desc)
+		if err == nil && desc != nil && desc.AllowPortForwarding {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTOTPRequired 检查用户角色中是否有要求 TOTP 二次验证的角色
+func IsTOTPRequired(roles []*model.Role) bool {
+	for _, role := range roles {
+		if role == nil {
+			continue
+		}
+		desc, err := ParseRoleDescriptor(role.Desc)
+		if err == nil && desc != nil && desc.RequireTOTP {
+			return true
 		}
 	}
 	return false
@@ -0,0 +1,127 @@
+package permissions
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupDB 为每个测试准备独立的内存数据库和权限策略
+func setupDB(t *testing.T, policy *configs.PermissionPolicyConfig) {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Role{}, &model.LinuxConfig{}, &model.DockerConfig{}, &model.ResourceRole{},
+		&model.Space{}, &model.SpaceMember{}, &model.ResourceSpace{}, &model.Tag{}, &model.ResourceTag{}, &model.AccessRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if policy == nil {
+		policy = &configs.PermissionPolicyConfig{}
+	}
+	prevDB, prevConfig := global.CDB, global.CONFIG
+	global.CDB = db
+	global.CONFIG = &configs.Config{PermissionPolicy: policy}
+	t.Cleanup(func() {
+		global.CDB, global.CONFIG = prevDB, prevConfig
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// testRole 按配置构造角色（不写入数据库）
+func testRole(t *testing.T, name string, perms ...*configs.RolePermissionConfig) *model.Role {
+	t.Helper()
+	desc, err := BuildRoleDescriptor(&configs.RoleConfig{Name: name, Permissions: perms})
+	if err != nil {
+		t.Fatalf("BuildRoleDescriptor(%s): %v", name, err)
+	}
+	return &model.Role{ID: uint(len(name)), Name: name, Desc: desc}
+}
+
+func superRole(t *testing.T) *model.Role {
+	t.Helper()
+	desc, err := BuildRoleDescriptor(&configs.RoleConfig{Name: "super", IsDefaultSuper: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.Role{ID: 100, Name: "super", Desc: desc}
+}
+
+func testUser(t *testing.T, username string) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, Name: username, Nickname: username, Email: username + "@example.com"}
+	if err := global.CDB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// addLinux 新增 Linux 资源，space 不为空时分配到该空间（不存在时创建）
+func addLinux(t *testing.T, hostname, space string, tags map[string]string) int64 {
+	t.Helper()
+	res := &model.LinuxConfig{Hostname: hostname}
+	if err := global.CDB.Create(res).Error; err != nil {
+		t.Fatal(err)
+	}
+	if space != "" {
+		s := spaceID(t, space)
+		if err := operation.NewSpaceOperation().AssignResourceToSpace(s, res.ID, "linux"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tags) > 0 {
+		if err := operation.NewTagOperation().SetResourceTags(res.ID, "linux", tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.ID
+}
+
+func spaceID(t *testing.T, name string) uint {
+	t.Helper()
+	var space model.Space
+	if err := global.CDB.Where(model.Space{Name: name}).FirstOrCreate(&space, model.Space{Name: name, IsActive: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return space.ID
+}
+
+// grantAccess 为用户添加未到期的临时访问授权
+func grantAccess(t *testing.T, user *model.User, resourceID int64) {
+	t.Helper()
+	expires := time.Now().Add(time.Hour)
+	grant := &model.AccessRequest{UserID: user.ID, Username: user.Username, ResourceType: "linux", ResourceID: resourceID,
+		DurationSeconds: 3600, Status: model.AccessRequestApproved, ExpiresAt: &expires}
+	if err := global.CDB.Create(grant).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func allow(target string, actions ...string) *configs.RolePermissionConfig {
+	return &configs.RolePermissionConfig{Target: target, Actions: actions}
+}
+
+func deny(target string, actions ...string) *configs.RolePermissionConfig {
+	return &configs.RolePermissionConfig{Effect: EffectDeny, Target: target, Actions: actions}
+}
+
+func withScope(perm *configs.RolePermissionConfig, scope *configs.RolePermissionScope) *configs.RolePermissionConfig {
+	perm.Scope = scope
+	return perm
+}
@@ -1,6 +1,9 @@
 package permissions
 
 import (
+	"strings"
+	"time"
+
 	"binrc.com/roma/core/global"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
@@ -14,28 +17,176 @@ func CheckResourceAccess(user *model.User, resourceID int64, resourceType, actio
 }
 
 // CheckResourceAccessWithRoles 检查用户是否有权限访问资源（多维度权限检查）
-// 允许传入已获取的用户角色，避免重复查询
+// 允许传入已获取的用户角色，避免重复查询；来源地址未知，配置了来源网段条件的权限不生效
 func CheckResourceAccessWithRoles(user *model.User, userRoles []*model.Role, resourceID int64, resourceType, action string) (bool, string) {
-	var err error
+	return CheckResourceAccessFrom(user, userRoles, resourceID, resourceType, action, "")
+}
+
+// CheckResourceAccessFrom 检查来自 clientIP 的请求是否有权限访问资源，角色权限的生效条件按该来源地址和当前时间判断
+// 判定顺序见 EvaluateResourceAccess
+func CheckResourceAccessFrom(user *model.User, userRoles []*model.Role, resourceID int64, resourceType, action, clientIP string) (bool, string) {
+	d := EvaluateResourceAccess(user, userRoles, resourceID, resourceType, action, clientIP)
+	return d.Allowed, d.Reason
+}
+
+// EvaluateResourceAccess 判定来自 clientIP 的请求能否对资源执行 action，返回判定结果与每一步的过程
+// 按 decision.go 中的步骤顺序执行：拒绝规则总是优先；资源角色、空间隔离与角色权限的拒绝可被临时访问授权推翻
+// 如果 userRoles 为 nil，会自动获取用户角色
+func EvaluateResourceAccess(user *model.User, userRoles []*model.Role, resourceID int64, resourceType, action, clientIP string) *Decision {
+	action = strings.ToLower(strings.TrimSpace(action))
+	d := &Decision{}
 	if userRoles == nil {
-		opUser := operation.NewUserOperation()
-		userRoles, err = opUser.GetUserRoles(user.ID)
+		var err error
+		userRoles, err = operation.NewUserOperation().GetUserRoles(user.ID)
+		if err != nil {
+			return d.deny(StepLoadRoles, "", "无法获取用户角色")
+		}
+	}
+	roles := parseRoles(userRoles)
+	subject := scopeSubject{ref: newResourceRef(resourceID, resourceType)}
+	now := time.Now()
+
+	// 1. 拒绝规则
+	if d.denyStep(roles, "resource", action, clientIP, subject, now) {
+		return d
+	}
+
+	// 2-5. super 绕过、资源角色、空间隔离、角色权限
+	if checkResourceAccess(d, user, userRoles, roles, resourceID, resourceType, action, clientIP, subject, now) {
+		return d
+	}
+
+	// 6. 临时访问授权
+	if !grantableAction(action) {
+		d.record(StepAccessGrant, ResultSkip, "临时访问授权只放行 list/get/use")
+	} else if HasAccessGrant(user.ID, resourceID, resourceType) {
+		return d.allow(StepAccessGrant, "access grant", "")
+	} else {
+		d.record(StepAccessGrant, ResultPass, "没有覆盖该资源的临时访问授权")
+	}
+
+	// 7. 默认拒绝；前面已有暂定的拒绝时沿用其原因
+	if d.Reason == "" {
+		d.deny(StepDefaultDeny, "", "权限不足")
+	}
+	log.Debug().
+		Uint("user_id", user.ID).
+		Int64("resource_id", resourceID).
+		Str("resource_type", resourceType).
+		Str("action", action).
+		Str("trace", d.String()).
+		Msg("资源权限检查未通过")
+	return d
+}
+
+// grantableAction 临时访问授权可放行的操作
+func grantableAction(action string) bool {
+	switch action {
+	case "list", "get", "use":
+		return true
+	}
+	return false
+}
+
+// HasAccessGrant 检查用户是否持有覆盖该资源且未到期的临时访问授权
+// 授权对象为单个资源时直接匹配；为空间时匹配资源所属空间（无空间归属的资源视为默认空间）
+func HasAccessGrant(userID uint, resourceID int64, resourceType string) bool {
+	grants, err := operation.NewAccessRequestOperation().ListActiveGrants(userID, time.Now())
+	if err != nil || len(grants) == 0 {
+		return false
+	}
+	spaceID := uint(0)
+	spaceResolved := false
+	for _, g := range grants {
+		if g.SpaceID == 0 {
+			if g.ResourceID == resourceID && g.ResourceType == resourceType {
+				return true
+			}
+			continue
+		}
+		if !spaceResolved {
+			spaceID = ResourceSpaceID(resourceID, resourceType)
+			spaceResolved = true
+		}
+		if spaceID != 0 && g.SpaceID == spaceID {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantedResources 列出用户通过生效中的授权可访问的指定类型资源
+// 空间授权只列出明确分配到该空间的资源
+func GrantedResources(userID uint, resourceType string) ([]model.Resource, error) {
+	grants, err := operation.NewAccessRequestOperation().ListActiveGrants(userID, time.Now())
+	if err != nil || len(grants) == 0 {
+		return nil, err
+	}
+	opRes := operation.NewResourceOperation()
+	opSpace := operation.NewSpaceOperation()
+	seen := map[int64]bool{}
+	var result []model.Resource
+	add := func(id int64) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		if res, err := opRes.GetResourceByID(id, resourceType); err == nil && res != nil {
+			result = append(result, res)
+		}
+	}
+	for _, g := range grants {
+		if g.SpaceID == 0 {
+			if g.ResourceType == resourceType {
+				add(g.ResourceID)
+			}
+			continue
+		}
+		ids, err := opSpace.GetSpaceResourceIDs(g.SpaceID, resourceType)
 		if err != nil {
-			return false, "无法获取用户角色"
+			return nil, err
+		}
+		for _, id := range ids {
+			add(id)
 		}
 	}
+	return result, nil
+}
 
-	// 1. 检查是否是 super 角色（如果配置允许绕过）
+// ResourceSpaceID 获取资源所属空间ID，无空间归属时返回默认空间ID，都不存在时返回 0
+func ResourceSpaceID(resourceID int64, resourceType string) uint {
+	opSpace := operation.NewSpaceOperation()
+	if rs, err := opSpace.GetResourceSpace(resourceID, resourceType); err == nil && rs != nil && rs.SpaceID > 0 {
+		return rs.SpaceID
+	}
+	policy := global.CONFIG.PermissionPolicy
+	if policy == nil || policy.DefaultSpace == nil || *policy.DefaultSpace == "" {
+		return 0
+	}
+	if space, err := opSpace.GetSpaceByName(*policy.DefaultSpace); err == nil && space != nil {
+		return space.ID
+	}
+	return 0
+}
+
+// checkResourceAccess 基于 super 角色、资源角色、空间隔离与角色权限的常规检查（判定顺序第 2-5 步）
+// 返回 true 表示已允许；返回 false 时 d 中记录了暂定的拒绝原因（可能为空）
+func checkResourceAccess(d *Decision, user *model.User, userRoles []*model.Role, roles []roleDescriptor, resourceID int64, resourceType, action, clientIP string, subject scopeSubject, now time.Time) bool {
+	// 2. 检查是否是 super 角色（如果配置允许绕过）
 	policy := global.CONFIG.PermissionPolicy
 	if policy != nil && policy.SuperBypassAll {
 		for _, role := range userRoles {
 			if IsSuperRole(role) {
-				return true, ""
+				d.allow(StepSuperBypass, ruleLabel(role, "is_super"), "")
+				return true
 			}
 		}
+		d.record(StepSuperBypass, ResultPass, "")
+	} else {
+		d.record(StepSuperBypass, ResultSkip, "super_bypass_all 未开启")
 	}
 
-	// 2. 检查资源角色（如果启用）
+	// 3. 检查资源角色（如果启用）
 	if policy != nil && policy.EnableResourceRole {
 		opResourceRole := operation.NewResourceRoleOperation()
 		resourceRoles, err := opResourceRole.GetResourceRoles(resourceID, resourceType)
@@ -57,14 +208,22 @@ func CheckResourceAccessWithRoles(user *model.User, userRoles []*model.Role, res
 			if !hasMatchingRole {
 				// 如果要求完全匹配且没有匹配的角色，拒绝访问
 				if policy.RequireExactRoleMatch {
-					return false, "用户角色与资源要求的角色不匹配"
+					d.deny(StepResourceRole, "require_exact_role_match", "用户角色与资源要求的角色不匹配")
+					return false
 				}
 				// 否则继续检查其他维度
+				d.record(StepResourceRole, ResultPass, "用户没有资源要求的角色")
+			} else {
+				d.record(StepResourceRole, ResultPass, "用户拥有资源要求的角色")
 			}
+		} else {
+			d.record(StepResourceRole, ResultPass, "资源没有指定角色")
 		}
+	} else {
+		d.record(StepResourceRole, ResultSkip, "enable_resource_role 未开启")
 	}
 
-	// 3. 检查空间隔离（如果启用）- 必须同时满足：空间成员 AND 资源角色
+	// 4. 检查空间隔离（如果启用）- 必须同时满足：空间成员 AND 资源角色
 	if policy != nil && policy.EnableSpaceIsolation {
 		opSpace := operation.NewSpaceOperation()
 
@@ -81,7 +240,8 @@ func CheckResourceAccessWithRoles(user *model.User, userRoles []*model.Role, res
 					Str("resource_type", resourceType).
 					Str("action", action).
 					Msg("权限检查失败: 用户不是空间成员")
-				return false, "用户不是空间成员，无法访问空间资源"
+				d.deny(StepSpace, "enable_space_isolation", "用户不是空间成员，无法访问空间资源")
+				return false
 			}
 
 			// 检查2: 如果资源有角色要求，用户必须同时拥有匹配的角色
@@ -113,18 +273,21 @@ func CheckResourceAccessWithRoles(user *model.User, userRoles []*model.Role, res
 
 					if !hasMatchingRole {
 						if policy.RequireExactRoleMatch {
-							return false, "用户角色与资源要求的角色不匹配"
+							d.deny(StepSpace, "require_exact_role_match", "用户角色与资源要求的角色不匹配")
+							return false
 						}
-						// 如果没有匹配的角色且不要求完全匹配，继续检查用户全局角色权限（第4步）
+						// 如果没有匹配的角色且不要求完全匹配，继续检查用户全局角色权限（第5步）
 					} else {
 						// 如果用户有匹配的角色且是空间成员，允许访问
-						return true, ""
+						d.allow(StepSpace, "space member with resource role", "")
+						return true
 					}
 				}
 			}
 
 			// 检查3: 如果资源没有角色要求，但用户在空间中，检查用户全局角色权限
-			// 继续到第4步检查全局角色权限
+			// 继续到第5步检查全局角色权限
+			d.record(StepSpace, ResultPass, "用户是资源所在空间的成员")
 		} else if resourceSpace == nil || resourceSpace.SpaceID == 0 {
 			// 资源没有空间归属
 			// 如果启用了空间隔离，没有空间归属的资源应该被视为在 default 空间中
@@ -144,9 +307,11 @@ func CheckResourceAccessWithRoles(user *model.User, userRoles []*model.Role, res
 								Str("resource_type", resourceType).
 								Str("action", action).
 								Msg("权限检查失败: 资源没有空间归属，且用户不是默认空间成员")
-							return false, "资源没有空间归属，且用户不是默认空间成员"
+							d.deny(StepSpace, "enable_space_isolation", "资源没有空间归属，且用户不是默认空间成员")
+							return false
 						}
-						// 用户是 default 空间成员，继续检查角色权限（第4步）
+						// 用户是 default 空间成员，继续检查角色权限（第5步）
+						d.record(StepSpace, ResultPass, "用户是默认空间成员")
 						log.Debug().
 							Uint("user_id", user.ID).
 							Uint("default_space_id", defaultSpace.ID).
@@ -162,7 +327,8 @@ func CheckResourceAccessWithRoles(user *model.User, userRoles []*model.Role, res
 							Str("action", action).
 							Str("default_space", *policy.DefaultSpace).
 							Msg("权限检查失败: 资源没有空间归属，且默认空间不存在")
-						return false, "资源没有空间归属，且默认空间不存在"
+						d.deny(StepSpace, "enable_space_isolation", "资源没有空间归属，且默认空间不存在")
+						return false
 					}
 				} else {
 					// 如果未配置默认空间，且启用了空间隔离，拒绝访问
@@ -172,28 +338,34 @@ func CheckResourceAccessWithRoles(user *model.User, userRoles []*model.Role, res
 						Str("resource_type", resourceType).
 						Str("action", action).
 						Msg("权限检查失败: 资源没有空间归属，且未配置默认空间")
-					return false, "资源没有空间归属，且未配置默认空间"
+					d.deny(StepSpace, "enable_space_isolation", "资源没有空间归属，且未配置默认空间")
+					return false
 				}
 			}
-			// 如果没有启用空间隔离，继续检查全局角色权限（第4步）
 		}
+	} else {
+		d.record(StepSpace, ResultSkip, "enable_space_isolation 未开启")
 	}
 
-	// 4. 检查用户全局角色权限（传统方式）
+	// 5. 检查用户全局角色权限（传统方式）
 	// 注意：只有在以下情况下才会到达这里：
-	// 1. 资源有空间归属，用户是空间成员，且（资源没有角色要求 OR 用户有匹配的角色 OR 不要求完全匹配）
+	// 1. 资源有空间归属，用户是空间成员，且（资源没有角色要求 OR 不要求完全匹配）
 	// 2. 资源没有空间归属，但（未启用空间隔离 OR 用户在 default 空间中）
-	for _, role := range userRoles {
-		if role == nil {
-			continue
-		}
-		desc, err := ParseRoleDescriptor(role.Desc)
-		if err == nil && desc != nil {
-			if HasPermission(desc, "resource", action, "") {
-				return true, ""
-			}
-		}
-	}
+	allowed, _ := d.rolePermissionStep(roles, "resource", action, clientIP, subject, now)
+	return allowed
+}
+
+// HasRolesPermission 检查角色集合是否拥有某个全局操作权限（如 session.list）
+// 用于 TUI 等没有 gin 上下文的场景；来源地址未知，配置了来源网段条件的权限不生效
+func HasRolesPermission(userRoles []*model.Role, target, action string) bool {
+	allowed, _ := CheckRolesPermission(userRoles, target, action, "")
+	return allowed
+}
 
-	return false, "权限不足"
+// CheckRolesPermission 检查角色集合是否拥有某个全局操作权限，先检查拒绝规则，权限的生效条件按 clientIP 和当前时间判断
+// 输出: bool - 是否拥有；string - 被拒绝规则禁止或有对应权限但生效条件不满足时的原因，如 "角色 oncall 的 resource.use 权限仅在 22:00-06:00 生效"
+// 限定了资源范围的允许规则同样计入，针对具体资源的检查使用 EvaluateResourceAccess
+func CheckRolesPermission(userRoles []*model.Role, target, action, clientIP string) (bool, string) {
+	d := EvaluateRoles(userRoles, target, action, "", clientIP)
+	return d.Allowed, d.Reason
 }
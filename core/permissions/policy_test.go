@@ -0,0 +1,180 @@
+package permissions
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+)
+
+func TestEvaluateRolesDenyPrecedence(t *testing.T) {
+	setupDB(t, nil)
+	sup := superRole(t)
+	ops := testRole(t, "ops", allow("*", "*"))
+	auditor := testRole(t, "auditor", allow("session", "list"), deny("user", "update", "delete"))
+	noSessions := testRole(t, "no-sessions", deny("session", "*"))
+	prodOnly := testRole(t, "no-prod", withScope(deny("resource", "use"), &configs.RolePermissionScope{Names: []string{"prod-*"}}))
+
+	tests := []struct {
+		name     string
+		roles    []*model.Role
+		target   string
+		action   string
+		scope    string
+		want     bool
+		wantStep string
+	}{
+		{name: "super allowed", roles: []*model.Role{sup}, target: "user", action: "delete", want: true, wantStep: StepRolePermission},
+		{name: "deny beats super", roles: []*model.Role{sup, noSessions}, target: "session", action: "list", want: false, wantStep: StepDeny},
+		{name: "deny beats wildcard allow", roles: []*model.Role{ops, auditor}, target: "user", action: "delete", want: false, wantStep: StepDeny},
+		{name: "other actions still allowed", roles: []*model.Role{ops, auditor}, target: "user", action: "list", want: true, wantStep: StepRolePermission},
+		{name: "allow rule", roles: []*model.Role{auditor}, target: "session", action: "list", want: true, wantStep: StepRolePermission},
+		{name: "no matching rule", roles: []*model.Role{auditor}, target: "role", action: "list", want: false, wantStep: StepDefaultDeny},
+		{name: "case and spaces", roles: []*model.Role{auditor}, target: " USER ", action: "Update", want: false, wantStep: StepDeny},
+		{name: "scoped deny skipped without resource", roles: []*model.Role{ops, prodOnly}, target: "resource", action: "use", scope: "prod-db", want: true, wantStep: StepRolePermission},
+		{name: "no roles", roles: nil, target: "session", action: "list", want: false, wantStep: StepDefaultDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := EvaluateRoles(tt.roles, tt.target, tt.action, tt.scope, "10.0.0.1")
+			if d.Allowed != tt.want || d.Step != tt.wantStep {
+				t.Errorf("EvaluateRoles() = %v at %s, want %v at %s (trace %s)", d.Allowed, d.Step, tt.want, tt.wantStep, d)
+			}
+			if len(d.Trace) == 0 || d.Trace[0].Step != StepDeny {
+				t.Errorf("trace should start with the deny step: %s", d)
+			}
+		})
+	}
+}
+
+func TestEvaluateResourceAccessDenyPrecedence(t *testing.T) {
+	defaultSpace := "default"
+	policy := &configs.PermissionPolicyConfig{SuperBypassAll: true, EnableSpaceIsolation: true, DefaultSpace: &defaultSpace}
+	setupDB(t, policy)
+	alice := testUser(t, "alice")
+	if _, err := operation.NewSpaceOperation().AddSpaceMember(spaceID(t, defaultSpace), alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	web := addLinux(t, "web-01", "", nil)
+	prod := addLinux(t, "prod-db", "", map[string]string{"env": "prod"})
+	isolated := addLinux(t, "pay-01", "payments", nil)
+	grantAccess(t, alice, isolated)
+	grantAccess(t, alice, prod)
+
+	sup := superRole(t)
+	use := testRole(t, "user", allow("resource", "use", "get"))
+	noProd := testRole(t, "no-prod", withScope(deny("resource", "*"), &configs.RolePermissionScope{Tags: []string{"env=prod"}}))
+	noDelete := testRole(t, "no-delete", deny("resource", "delete"))
+
+	tests := []struct {
+		name       string
+		roles      []*model.Role
+		resourceID int64
+		action     string
+		want       bool
+		wantStep   string
+	}{
+		{name: "role permission", roles: []*model.Role{use}, resourceID: web, action: "use", want: true, wantStep: StepRolePermission},
+		{name: "super bypass", roles: []*model.Role{sup}, resourceID: web, action: "delete", want: true, wantStep: StepSuperBypass},
+		{name: "deny beats super bypass", roles: []*model.Role{sup, noDelete}, resourceID: web, action: "delete", want: false, wantStep: StepDeny},
+		{name: "scoped deny on matching resource", roles: []*model.Role{sup, noProd}, resourceID: prod, action: "use", want: false, wantStep: StepDeny},
+		{name: "scoped deny ignores other resources", roles: []*model.Role{use, noProd}, resourceID: web, action: "use", want: true, wantStep: StepRolePermission},
+		{name: "deny beats access grant", roles: []*model.Role{noProd}, resourceID: prod, action: "get", want: false, wantStep: StepDeny},
+		{name: "access grant overrides space isolation", roles: []*model.Role{use}, resourceID: isolated, action: "use", want: true, wantStep: StepAccessGrant},
+		{name: "access grant does not cover delete", roles: []*model.Role{use}, resourceID: isolated, action: "delete", want: false, wantStep: StepSpace},
+		{name: "default deny", roles: []*model.Role{noDelete}, resourceID: web, action: "use", want: false, wantStep: StepDefaultDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := EvaluateResourceAccess(alice, tt.roles, tt.resourceID, "linux", tt.action, "10.0.0.1")
+			if d.Allowed != tt.want || d.Step != tt.wantStep {
+				t.Errorf("EvaluateResourceAccess() = %v at %s, want %v at %s (trace %s)", d.Allowed, d.Step, tt.want, tt.wantStep, d)
+			}
+			if !d.Allowed && d.Reason == "" {
+				t.Errorf("denied without a reason (trace %s)", d)
+			}
+		})
+	}
+}
+
+func TestHasAllPermissionsWithDenyRules(t *testing.T) {
+	tests := []struct {
+		name string
+		role *model.Role
+		want bool
+	}{
+		{name: "super", role: superRole(t), want: true},
+		{name: "wildcard", role: testRole(t, "ops", allow("*", "*")), want: true},
+		{name: "wildcard with deny", role: testRole(t, "ops", allow("*", "*"), deny("user", "delete")), want: false},
+		{name: "scoped wildcard", role: testRole(t, "ops", withScope(allow("*", "*"), &configs.RolePermissionScope{Names: []string{"web-*"}})), want: false},
+		{name: "partial", role: testRole(t, "ops", allow("resource", "*")), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasAllPermissions(tt.role); got != tt.want {
+				t.Errorf("HasAllPermissions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrantedResources(t *testing.T) {
+	setupDB(t, nil)
+	alice, bob := testUser(t, "alice"), testUser(t, "bob")
+	web := addLinux(t, "web-01", "", nil)
+	db1 := addLinux(t, "db-01", "dba", nil)
+	db2 := addLinux(t, "db-02", "dba", nil)
+	addLinux(t, "ops-01", "ops", nil)
+	grantAccess(t, alice, web)
+	expires := time.Now().Add(time.Hour)
+	spaceGrant := &model.AccessRequest{UserID: alice.ID, Username: alice.Username, SpaceID: spaceID(t, "dba"),
+		DurationSeconds: 3600, Status: model.AccessRequestApproved, ExpiresAt: &expires}
+	expired := time.Now().Add(-time.Minute)
+	oldGrant := &model.AccessRequest{UserID: bob.ID, Username: bob.Username, ResourceType: "linux", ResourceID: web,
+		DurationSeconds: 3600, Status: model.AccessRequestApproved, ExpiresAt: &expired}
+	for _, g := range []*model.AccessRequest{spaceGrant, oldGrant} {
+		if err := global.CDB.Create(g).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		user         *model.User
+		resourceType string
+		want         []int64
+	}{
+		{name: "resource and space grants", user: alice, resourceType: "linux", want: []int64{web, db1, db2}},
+		{name: "other resource type", user: alice, resourceType: "docker", want: nil},
+		{name: "expired grant", user: bob, resourceType: "linux", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := GrantedResources(tt.user.ID, tt.resourceType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, r := range res {
+				got = append(got, r.GetID())
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GrantedResources() = %v, want %v", got, tt.want)
+			}
+			for _, id := range tt.want {
+				if !HasAccessGrant(tt.user.ID, id, tt.resourceType) {
+					t.Errorf("HasAccessGrant(%d) = false", id)
+				}
+			}
+		})
+	}
+	if HasAccessGrant(bob.ID, web, "linux") {
+		t.Error("expired grant still allows access")
+	}
+}
@@ -0,0 +1,306 @@
+package permissions
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+)
+
+// buildScope 校验并规范化配置中的资源范围，没有配置任何选择器时返回 nil
+func buildScope(cfg *configs.RolePermissionScope) (*ScopeDefinition, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	scope := &ScopeDefinition{
+		Type:  strings.ToLower(strings.TrimSpace(cfg.Type)),
+		Value: strings.TrimSpace(cfg.Value),
+	}
+	switch scope.Type {
+	case "", "include", "exclude":
+	default:
+		return nil, fmt.Errorf("invalid scope type %q, use include or exclude", cfg.Type)
+	}
+	for _, t := range cfg.Tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(t, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("invalid scope tag %q, use key=value or key", t)
+		}
+		if hasValue {
+			t = key + "=" + strings.TrimSpace(value)
+		} else {
+			t = key
+		}
+		scope.Tags = append(scope.Tags, t)
+	}
+	scope.Spaces = trimList(cfg.Spaces)
+	for _, n := range trimList(cfg.Names) {
+		if _, err := path.Match(strings.ToLower(n), ""); err != nil {
+			return nil, fmt.Errorf("invalid scope name pattern %q", n)
+		}
+		scope.Names = append(scope.Names, n)
+	}
+	for _, t := range trimList(cfg.ResourceTypes) {
+		t = strings.ToLower(t)
+		if !isResourceType(t) {
+			return nil, fmt.Errorf("invalid scope resource type %q", t)
+		}
+		scope.ResourceTypes = append(scope.ResourceTypes, t)
+	}
+	if scope.Value == "" && len(scope.Tags) == 0 && len(scope.Spaces) == 0 && len(scope.Names) == 0 && len(scope.ResourceTypes) == 0 {
+		return nil, nil
+	}
+	return scope, nil
+}
+
+// String 资源范围的可读描述，如 "include type=linux tag=env=staging"
+func (s *ScopeDefinition) String() string {
+	if s == nil {
+		return ""
+	}
+	parts := []string{s.kind()}
+	if len(s.ResourceTypes) > 0 {
+		parts = append(parts, "type="+strings.Join(s.ResourceTypes, ","))
+	}
+	if len(s.Spaces) > 0 {
+		parts = append(parts, "space="+strings.Join(s.Spaces, ","))
+	}
+	if len(s.Names) > 0 {
+		parts = append(parts, "name="+strings.Join(s.Names, ","))
+	}
+	if s.Value != "" {
+		parts = append(parts, "name~"+s.Value)
+	}
+	for _, t := range s.Tags {
+		parts = append(parts, "tag="+t)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *ScopeDefinition) kind() string {
+	if s.Type == "exclude" {
+		return "exclude"
+	}
+	return "include"
+}
+
+// matchResource 资源是否在范围内；exclude 范围对不匹配选择器的资源生效
+func (s *ScopeDefinition) matchResource(ref *resourceRef) bool {
+	if s == nil {
+		return true
+	}
+	return s.selects(ref) != (s.kind() == "exclude")
+}
+
+// matchName 只知道资源名称时的判断，只使用名称相关的选择器；名称为空时视为在范围内
+func (s *ScopeDefinition) matchName(name string) bool {
+	if s == nil || name == "" {
+		return true
+	}
+	if s.Value == "" && len(s.Names) == 0 {
+		return true
+	}
+	return s.selectsName(name) != (s.kind() == "exclude")
+}
+
+// selects 资源是否满足全部选择器：各类选择器之间为且；同类中任一项匹配即可，标签需全部满足
+// 按查询代价从低到高判断，空间和标签只在前面的选择器都满足时才查询
+func (s *ScopeDefinition) selects(ref *resourceRef) bool {
+	if len(s.ResourceTypes) > 0 && !containsFold(s.ResourceTypes, ref.resourceType) {
+		return false
+	}
+	if !s.selectsName(ref.name()) {
+		return false
+	}
+	if len(s.Spaces) > 0 && !containsFold(s.Spaces, ref.spaceName()) {
+		return false
+	}
+	if len(s.Tags) > 0 {
+		tags := ref.tags()
+		for _, sel := range s.Tags {
+			key, value, hasValue := strings.Cut(sel, "=")
+			actual, ok := tags[key]
+			if !ok || (hasValue && actual != value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *ScopeDefinition) selectsName(name string) bool {
+	name = strings.ToLower(name)
+	if s.Value != "" && !strings.Contains(name, strings.ToLower(s.Value)) {
+		return false
+	}
+	if len(s.Names) == 0 {
+		return true
+	}
+	for _, pattern := range s.Names {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceRef 权限检查中的资源，名称、所属空间和标签在第一次用到时才查询
+type resourceRef struct {
+	id           int64
+	resourceType string
+
+	resource    model.Resource
+	nameLoaded  bool
+	space       string
+	spaceLoaded bool
+	tagMap      map[string]string
+	tagsLoaded  bool
+}
+
+func newResourceRef(resourceID int64, resourceType string) *resourceRef {
+	return &resourceRef{id: resourceID, resourceType: resourceType}
+}
+
+func newResourceRefFrom(res model.Resource, resourceType string) *resourceRef {
+	return &resourceRef{id: res.GetID(), resourceType: resourceType, resource: res, nameLoaded: true}
+}
+
+func (r *resourceRef) name() string {
+	if !r.nameLoaded {
+		r.nameLoaded = true
+		if res, err := operation.NewResourceOperation().GetResourceByID(r.id, r.resourceType); err == nil {
+			r.resource = res
+		}
+	}
+	if r.resource == nil {
+		return ""
+	}
+	return r.resource.GetName()
+}
+
+// spaceName 资源所属空间名称，未分配空间的资源属于默认空间
+func (r *resourceRef) spaceName() string {
+	if !r.spaceLoaded {
+		r.spaceLoaded = true
+		if spaceID := ResourceSpaceID(r.id, r.resourceType); spaceID > 0 {
+			if space, err := operation.NewSpaceOperation().GetSpaceByID(spaceID); err == nil && space != nil {
+				r.space = space.Name
+			}
+		}
+	}
+	return r.space
+}
+
+func (r *resourceRef) tags() map[string]string {
+	if !r.tagsLoaded {
+		r.tagsLoaded = true
+		r.tagMap, _ = operation.NewTagOperation().GetResourceTags(r.id, r.resourceType)
+	}
+	return r.tagMap
+}
+
+// scopeSubject 判断资源范围时的被检查对象：ref 为具体资源；ref 为空时只知道资源名称（可能为空）
+type scopeSubject struct {
+	ref  *resourceRef
+	name string
+}
+
+// inScope 权限的资源范围是否覆盖被检查对象
+// 不知道具体资源时，带范围的允许规则按名称判断（名称为空视为覆盖，由针对具体资源的检查把关），
+// 带范围的拒绝规则视为不覆盖，只在针对具体资源的检查中生效
+func (s scopeSubject) inScope(perm *PermissionDefinition) bool {
+	if perm.Scope == nil {
+		return true
+	}
+	if s.ref != nil {
+		return perm.Scope.matchResource(s.ref)
+	}
+	if perm.effect() == EffectDeny {
+		return false
+	}
+	return perm.Scope.matchName(s.name)
+}
+
+// ScopedResources 返回角色的 resource 允许规则通过资源范围选中、且不在 existing 中的资源
+// 只用于补全资源列表，调用方仍需对每个资源做 CheckResourceAccessFrom 检查
+func ScopedResources(userRoles []*model.Role, resourceType string, existing []model.Resource) []model.Resource {
+	var scopes []*ScopeDefinition
+	for _, role := range userRoles {
+		if role == nil {
+			continue
+		}
+		desc, err := ParseRoleDescriptor(role.Desc)
+		if err != nil || desc == nil {
+			continue
+		}
+		for _, perm := range desc.Permissions {
+			if perm.Scope != nil && perm.effect() == EffectAllow && (perm.Target == "*" || perm.Target == "resource") {
+				scopes = append(scopes, perm.Scope)
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	all, err := operation.NewResourceOperation().GetResourceListByType(resourceType)
+	if err != nil {
+		return nil
+	}
+	seen := make(map[int64]bool, len(existing))
+	for _, res := range existing {
+		seen[res.GetID()] = true
+	}
+	var result []model.Resource
+	for _, res := range all {
+		if seen[res.GetID()] {
+			continue
+		}
+		ref := newResourceRefFrom(res, resourceType)
+		for _, scope := range scopes {
+			if scope.matchResource(ref) {
+				seen[res.GetID()] = true
+				result = append(result, res)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func isResourceType(t string) bool {
+	switch t {
+	case constants.ResourceTypeLinux, constants.ResourceTypeWindows, constants.ResourceTypeDocker,
+		constants.ResourceTypeDatabase, constants.ResourceTypeRouter, constants.ResourceTypeSwitch:
+		return true
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func trimList(list []string) []string {
+	var result []string
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
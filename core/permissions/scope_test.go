@@ -0,0 +1,121 @@
+package permissions
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/model"
+)
+
+func TestBuildScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *configs.RolePermissionScope
+		want    *ScopeDefinition
+		wantErr bool
+	}{
+		{name: "nil", cfg: nil, want: nil},
+		{name: "no selectors", cfg: &configs.RolePermissionScope{Type: "include"}, want: nil},
+		{name: "normalized", cfg: &configs.RolePermissionScope{Type: " Exclude ", Tags: []string{" env = prod ", "team", ""}, Spaces: []string{" ops "}, Names: []string{"web-*"}, ResourceTypes: []string{"Linux"}},
+			want: &ScopeDefinition{Type: "exclude", Tags: []string{"env=prod", "team"}, Spaces: []string{"ops"}, Names: []string{"web-*"}, ResourceTypes: []string{"linux"}}},
+		{name: "legacy value", cfg: &configs.RolePermissionScope{Value: "web"}, want: &ScopeDefinition{Value: "web"}},
+		{name: "bad type", cfg: &configs.RolePermissionScope{Type: "only", Names: []string{"a"}}, wantErr: true},
+		{name: "empty tag key", cfg: &configs.RolePermissionScope{Tags: []string{"=prod"}}, wantErr: true},
+		{name: "bad glob", cfg: &configs.RolePermissionScope{Names: []string{"web-["}}, wantErr: true},
+		{name: "unknown resource type", cfg: &configs.RolePermissionScope{ResourceTypes: []string{"mainframe"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildScope(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildScope() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeMatchResource(t *testing.T) {
+	setupDB(t, nil)
+	web := addLinux(t, "web-01", "ops", map[string]string{"env": "prod", "team": "core"})
+	staging := addLinux(t, "web-02", "", map[string]string{"env": "staging"})
+	db := addLinux(t, "DB-01", "dba", nil)
+
+	tests := []struct {
+		name  string
+		scope *ScopeDefinition
+		want  map[int64]bool
+	}{
+		{name: "tag with value", scope: &ScopeDefinition{Tags: []string{"env=prod"}}, want: map[int64]bool{web: true}},
+		{name: "tag key only", scope: &ScopeDefinition{Tags: []string{"env"}}, want: map[int64]bool{web: true, staging: true}},
+		{name: "all tags required", scope: &ScopeDefinition{Tags: []string{"env=prod", "team=ops"}}, want: map[int64]bool{}},
+		{name: "space", scope: &ScopeDefinition{Spaces: []string{"OPS", "dba"}}, want: map[int64]bool{web: true, db: true}},
+		{name: "name glob case-insensitive", scope: &ScopeDefinition{Names: []string{"db-*"}}, want: map[int64]bool{db: true}},
+		{name: "legacy value", scope: &ScopeDefinition{Value: "WEB"}, want: map[int64]bool{web: true, staging: true}},
+		{name: "resource type", scope: &ScopeDefinition{ResourceTypes: []string{"docker"}}, want: map[int64]bool{}},
+		{name: "selectors combine with and", scope: &ScopeDefinition{Names: []string{"web-*"}, Spaces: []string{"ops"}}, want: map[int64]bool{web: true}},
+		{name: "exclude", scope: &ScopeDefinition{Type: "exclude", Tags: []string{"env=prod"}}, want: map[int64]bool{staging: true, db: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, id := range []int64{web, staging, db} {
+				if got := tt.scope.matchResource(newResourceRef(id, "linux")); got != tt.want[id] {
+					t.Errorf("matchResource(%d) = %v, want %v", id, got, tt.want[id])
+				}
+			}
+		})
+	}
+}
+
+func TestScopeSubjectInScope(t *testing.T) {
+	setupDB(t, nil)
+	web := addLinux(t, "web-01", "", nil)
+	scoped := &ScopeDefinition{Names: []string{"web-*"}}
+	tests := []struct {
+		name    string
+		perm    *PermissionDefinition
+		subject scopeSubject
+		want    bool
+	}{
+		{name: "no scope", perm: &PermissionDefinition{}, subject: scopeSubject{}, want: true},
+		{name: "allow without resource", perm: &PermissionDefinition{Scope: scoped}, subject: scopeSubject{}, want: true},
+		{name: "allow by name", perm: &PermissionDefinition{Scope: scoped}, subject: scopeSubject{name: "db-01"}, want: false},
+		{name: "allow by resource", perm: &PermissionDefinition{Scope: scoped}, subject: scopeSubject{ref: newResourceRef(web, "linux")}, want: true},
+		{name: "deny without resource", perm: &PermissionDefinition{Effect: EffectDeny, Scope: scoped}, subject: scopeSubject{name: "web-01"}, want: false},
+		{name: "deny by resource", perm: &PermissionDefinition{Effect: EffectDeny, Scope: scoped}, subject: scopeSubject{ref: newResourceRef(web, "linux")}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.subject.inScope(tt.perm); got != tt.want {
+				t.Errorf("inScope() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopedResources(t *testing.T) {
+	setupDB(t, nil)
+	web1 := addLinux(t, "web-01", "", map[string]string{"env": "staging"})
+	web2 := addLinux(t, "web-02", "", map[string]string{"env": "staging"})
+	addLinux(t, "db-01", "", map[string]string{"env": "prod"})
+
+	staging := testRole(t, "staging", withScope(allow("resource", "use"), &configs.RolePermissionScope{Tags: []string{"env=staging"}}))
+	noProd := testRole(t, "no-prod", withScope(deny("resource", "use"), &configs.RolePermissionScope{Tags: []string{"env=prod"}}))
+	existing := []model.Resource{&model.LinuxConfig{ID: web1, Hostname: "web-01"}}
+
+	var got []int64
+	for _, res := range ScopedResources([]*model.Role{staging, noProd}, "linux", existing) {
+		got = append(got, res.GetID())
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if want := []int64{web2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ScopedResources() = %v, want %v", got, want)
+	}
+	if res := ScopedResources([]*model.Role{noProd}, "linux", nil); len(res) != 0 {
+		t.Errorf("deny scopes should not add resources, got %d", len(res))
+	}
+}
@@ -1,14 +1,25 @@
 package routers
 
 import (
+	"fmt"
+	"strings"
+
 	"binrc.com/roma/core/api"
 	"binrc.com/roma/core/api/middleware"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/mcpserver"
 	securityMiddleware "binrc.com/roma/core/middleware"
+	"binrc.com/roma/core/utils/logger"
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter() *gin.Engine {
 	r := gin.Default()
+	// 客户端 IP 用于黑名单、限流、审计和权限的 source_cidrs 条件，只信任配置的反向代理转发的地址
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Invalid api.trusted_proxies, forwarded client addresses are ignored: %v", err))
+		_ = r.SetTrustedProxies(nil)
+	}
 	// 使用中间件
 	r.Use(gin.Recovery())              // 恢复从任何恐慌中恢复，如果有的话
 	r.Use(middleware.CORSMiddleware()) // CORS 支持，前后端分离时需要
@@ -22,6 +33,11 @@ func SetupRouter() *gin.Engine {
 	systemController := api.NewSystemController()
 	r.GET("/health", systemController.GetHealth)
 
+	// MCP streamable HTTP 端点 - 只接受 MCP 令牌，工具内按资源权限检查
+	if mcpserver.Enabled() {
+		r.Any(mcpserver.Path(), middleware.MCPTokenAuth(), mcpserver.GinHandler())
+	}
+
 	// API v1 路由组
 	v1 := r.Group("/api/v1")
 	{
@@ -29,8 +45,12 @@ func SetupRouter() *gin.Engine {
 		authController := api.NewAuthController()
 		auth := v1.Group("/auth")
 		{
-			auth.POST("/login", authController.Login)   // 登录
-			auth.POST("/logout", authController.Logout) // 登出
+			auth.POST("/login", authController.Login)               // 登录
+			auth.POST("/login/mfa", authController.LoginMFA)        // 登录第二步：TOTP 验证码
+			auth.POST("/refresh", authController.Refresh)           // 刷新访问令牌
+			auth.GET("/oidc/login", authController.OIDCLogin)       // OIDC 单点登录
+			auth.GET("/oidc/callback", authController.OIDCCallback) // OIDC 回调
+			auth.POST("/logout", authController.Logout)             // 登出
 		}
 
 		// 其他路由需要 JWT 或 API Key 认证
@@ -48,6 +68,39 @@ func SetupRouter() *gin.Engine {
 			// 用户自己的资料管理 - 需要认证
 			users.GET("/me", middleware.RequirePermission("user", "get"), userController.GetCurrentUser)
 			users.PUT("/me", middleware.RequirePermission("user", "update"), userController.UpdateProfile)
+
+			// TOTP 二次验证（SSH 登录时通过 keyboard-interactive 输入验证码）
+			mfaController := api.NewMFAController()
+			users.GET("/me/mfa", middleware.RequirePermission("user", "get"), mfaController.GetMyMFA)                                     // 二次验证状态
+			users.POST("/me/mfa/totp", middleware.RequirePermission("user", "update"), mfaController.EnrollMyTOTP)                        // 开始绑定 TOTP
+			users.POST("/me/mfa/totp/confirm", middleware.RequirePermission("user", "update"), mfaController.ConfirmMyTOTP)               // 确认绑定
+			users.POST("/me/mfa/totp/reset", middleware.RequirePermission("user", "update"), mfaController.ResetMyTOTP)                   // 解除绑定
+			users.POST("/me/mfa/recovery-codes", middleware.RequirePermission("user", "update"), mfaController.RegenerateMyRecoveryCodes) // 重新生成恢复码
+			users.DELETE("/:id/mfa", middleware.RequirePermission("user", "reset_mfa"), mfaController.ResetUserMFA)                       // 管理员重置用户 TOTP（不能重置自己的）
+
+			// 我的 API Key：属于当前用户，权限范围不能超出自己的权限
+			apiKeyController := api.NewApikeyController()
+			users.GET("/me/apikeys", middleware.RequirePermission("user", "get"), apiKeyController.GetMyApikeys)
+			users.POST("/me/apikeys", middleware.RequirePermission("user", "update"), apiKeyController.CreateMyApikey)
+			users.DELETE("/me/apikeys/:id", middleware.RequirePermission("user", "update"), apiKeyController.DeleteMyApikey)
+
+			// 我的 MCP 令牌：AI 工具以当前用户身份调用 MCP 工具
+			mcpTokenController := api.NewMCPTokenController()
+			users.GET("/me/mcp-tokens", middleware.RequirePermission("user", "get"), mcpTokenController.GetMyMCPTokens)
+			users.POST("/me/mcp-tokens", middleware.RequirePermission("user", "update"), mcpTokenController.CreateMyMCPToken)
+			users.DELETE("/me/mcp-tokens/:id", middleware.RequirePermission("user", "update"), mcpTokenController.DeleteMyMCPToken)
+
+			// 我的临时访问申请：审批通过后在有效期内获得资源或空间的访问权限
+			accessRequestController := api.NewAccessRequestController()
+			users.GET("/me/access-requests", middleware.RequirePermission("user", "get"), accessRequestController.GetMyAccessRequests)
+			users.POST("/me/access-requests", middleware.RequirePermission("user", "update"), accessRequestController.CreateMyAccessRequest)
+			users.DELETE("/me/access-requests/:id", middleware.RequirePermission("user", "update"), accessRequestController.CancelMyAccessRequest)
+
+			// 登录会话管理（管理员）：吊销后该会话的令牌立即失效
+			loginSessionController := api.NewLoginSessionController()
+			users.GET("/:id/sessions", middleware.RequirePermission("user", "list"), loginSessionController.ListUserSessions)
+			users.DELETE("/:id/sessions", middleware.RequirePermission("user", "delete"), loginSessionController.RevokeUserSessions)
+			users.DELETE("/:id/sessions/:session_id", middleware.RequirePermission("user", "delete"), loginSessionController.RevokeUserSession)
 		}
 
 		// 角色相关路由 - 需要 user 管理权限（super 角色）
@@ -55,6 +108,7 @@ func SetupRouter() *gin.Engine {
 		roles := v1.Group("/roles")
 		{
 			roles.GET("", middleware.RequirePermission("user", "list"), roleController.GetAllRoles)
+			roles.GET("/explain", middleware.RequirePermission("user", "list"), roleController.ExplainAccess) // 解释一次权限判定的过程
 			roles.POST("", middleware.RequirePermission("user", "add"), roleController.CreateRole)
 			roles.GET("/:id", middleware.RequirePermission("user", "get"), roleController.GetRoleByID)
 			roles.PUT("/:id", middleware.RequirePermission("user", "update"), roleController.UpdateRoleByID)
@@ -118,6 +172,7 @@ func SetupRouter() *gin.Engine {
 		{
 			system.GET("/info", systemController.GetSystemInfo)
 			system.GET("/health", systemController.GetHealth)
+			system.GET("/ssh-ca", systemController.GetSSHCAPublicKey)
 		}
 
 		// API Key 相关路由 - 需要 user 管理权限（super 角色，仅管理员）
@@ -134,9 +189,12 @@ func SetupRouter() *gin.Engine {
 		sshKeyController := api.NewSSHKeyController()
 		sshKeys := v1.Group("/ssh-keys")
 		{
-			sshKeys.GET("/me", middleware.RequirePermission("user", "get"), sshKeyController.GetMySSHKey)                 // 获取当前用户的 SSH 公钥
-			sshKeys.POST("/me/upload", middleware.RequirePermission("user", "update"), sshKeyController.UploadSSHKey)     // 上传 SSH 密钥
-			sshKeys.POST("/me/generate", middleware.RequirePermission("user", "update"), sshKeyController.GenerateSSHKey) // 重新生成 SSH 密钥
+			sshKeys.GET("/me", middleware.RequirePermission("user", "get"), sshKeyController.GetMySSHKey)                   // 获取当前用户的 SSH 公钥
+			sshKeys.POST("/me/upload", middleware.RequirePermission("user", "update"), sshKeyController.UploadSSHKey)       // 上传 SSH 密钥
+			sshKeys.POST("/me/generate", middleware.RequirePermission("user", "update"), sshKeyController.GenerateSSHKey)   // 重新生成 SSH 密钥
+			sshKeys.GET("/me/keys", middleware.RequirePermission("user", "get"), sshKeyController.ListMySSHKeys)            // 我的 SSH 公钥列表
+			sshKeys.POST("/me/keys", middleware.RequirePermission("user", "update"), sshKeyController.AddMySSHKey)          // 添加 SSH 公钥
+			sshKeys.DELETE("/me/keys/:id", middleware.RequirePermission("user", "update"), sshKeyController.RevokeMySSHKey) // 吊销 SSH 公钥
 		}
 
 		// 空间管理路由 - 需要 admin 权限
@@ -160,7 +218,53 @@ func SetupRouter() *gin.Engine {
 			blacklist.DELETE("/:ip", middleware.RequirePermission("user", "delete"), blacklistController.RemoveFromBlacklist) // 解禁IP
 			blacklist.GET("/ip-info/:ip", middleware.RequirePermission("user", "get"), blacklistController.GetIPInfo)         // 获取IP信息
 		}
+
+		// 活动会话 - 需要 session.list/get/delete 权限
+		sessionController := api.NewSessionController()
+		sessions := v1.Group("/sessions")
+		{
+			sessions.GET("/active", middleware.RequirePermission("session", "list"), sessionController.GetActiveSessions)                // 活动会话列表
+			sessions.GET("/active/:id", middleware.RequirePermission("session", "get"), sessionController.GetActiveSession)              // 活动会话详情
+			sessions.GET("/active/:id/shadow", middleware.RequirePermission("session", "get"), sessionController.ShadowSession)          // 旁观会话（WebSocket）
+			sessions.DELETE("/active/:id", middleware.RequirePermission("session", "delete"), sessionController.KillSession)             // 强制结束会话
+			sessions.GET("/commands/pending", middleware.RequirePermission("session", "approve"), sessionController.GetPendingCommands)  // 待审批命令
+			sessions.POST("/commands/:id/approve", middleware.RequirePermission("session", "approve"), sessionController.ApproveCommand) // 批准命令
+			sessions.POST("/commands/:id/reject", middleware.RequirePermission("session", "approve"), sessionController.RejectCommand)   // 拒绝命令
+		}
+
+		// 临时访问申请审批 - 需要 access_request.list/approve 权限
+		accessRequestController := api.NewAccessRequestController()
+		accessRequests := v1.Group("/access-requests")
+		{
+			accessRequests.GET("", middleware.RequirePermission("access_request", "list"), accessRequestController.GetAccessRequests)                    // 申请列表
+			accessRequests.POST("/:id/approve", middleware.RequirePermission("access_request", "approve"), accessRequestController.ApproveAccessRequest) // 批准
+			accessRequests.POST("/:id/deny", middleware.RequirePermission("access_request", "approve"), accessRequestController.DenyAccessRequest)       // 拒绝
+			accessRequests.POST("/:id/revoke", middleware.RequirePermission("access_request", "approve"), accessRequestController.RevokeAccessRequest)   // 提前收回
+		}
+
+		// 上游主机密钥 - 需要 known_host.list/update/delete 权限
+		knownHostController := api.NewKnownHostController()
+		knownHosts := v1.Group("/known-hosts")
+		{
+			knownHosts.GET("", middleware.RequirePermission("known_host", "list"), knownHostController.GetKnownHosts)                 // 主机密钥列表
+			knownHosts.POST("/:id/accept", middleware.RequirePermission("known_host", "update"), knownHostController.AcceptKnownHost) // 确认新密钥
+			knownHosts.DELETE("/:id", middleware.RequirePermission("known_host", "delete"), knownHostController.DeleteKnownHost)      // 删除固定密钥
+		}
 	}
 
 	return r
 }
+
+// trustedProxies 配置中的可信反向代理列表，未配置时返回 nil（不信任任何代理）
+func trustedProxies() []string {
+	if global.CONFIG == nil || global.CONFIG.Api == nil {
+		return nil
+	}
+	var proxies []string
+	for _, p := range strings.Split(global.CONFIG.Api.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
@@ -1,6 +1,10 @@
 package services
 
 import (
+	"fmt"
+	"strings"
+
+	"binrc.com/roma/core/connect"
 	"binrc.com/roma/core/jump"
 	"binrc.com/roma/core/sshd"
 	"github.com/loganchef/ssh"
@@ -21,6 +25,11 @@ func SessionHandler(sess *ssh.Session) {
 	case "scp":
 		scpHandler(args, sess) //检测SCP命令执行逻辑
 	default:
+		// ssh user+web-01@roma：跳过菜单，直接连接登录名中指定的资源
+		if target := sshd.LoginTarget(*sess); target != "" {
+			targetHandler(target, strings.TrimSpace(rawCmd), sess)
+			return
+		}
 		remainingCmd, remainingArgs, err := sshd.ParseRemainingCommand(rawCmd)
 		if err != nil {
 			sshd.ErrorInfo(err, sess)
@@ -43,3 +52,34 @@ func scpHandler(args []string, sess *ssh.Session) {
 	}
 	(*sess).Close()
 }
+
+// targetHandler 直接连接登录名中指定的资源；带命令时非交互式执行并返回退出状态
+func targetHandler(target string, command string, sess *ssh.Session) {
+	resource, resourceType, err := sshd.FindLoginResource((*sess).User(), sshd.GetClientIP(*sess), target)
+	if err != nil {
+		sshd.ErrorInfo(fmt.Errorf("%s: %v", target, err), sess)
+		(*sess).Exit(1)
+		return
+	}
+
+	if command != "" {
+		output, err := connect.NewConnectionWithCommand(sess, resource, resourceType, command)
+		if err != nil {
+			sshd.ErrorInfo(err, sess)
+			(*sess).Exit(1)
+			return
+		}
+		if output != nil {
+			fmt.Fprint(*sess, output)
+		}
+		(*sess).Exit(0)
+		return
+	}
+
+	if err := connect.NewConnectionLoop(sess, resource, resourceType); err != nil {
+		sshd.ErrorInfo(err, sess)
+		(*sess).Exit(1)
+		return
+	}
+	(*sess).Exit(0)
+}
@@ -4,7 +4,9 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
+	"binrc.com/roma/core/apikeyauth"
 	"binrc.com/roma/core/global"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
@@ -101,16 +103,51 @@ func initSuperUser() {
 	}
 }
 
+// initApiKey 旧的明文凭证改为哈希保存，没有凭证时按配置创建默认凭证
+// 默认凭证和旧凭证都归属初始管理员，请求以该用户身份执行和审计
 func initApiKey() {
+	owner := apiKeyOwner()
+	if err := apikeyauth.MigrateLegacyKeys(owner); err != nil {
+		log.Printf("migrate api keys failed: %v", err)
+		return
+	}
 	op := operation.NewApikeyOperation()
 	keys, _ := op.GetAllApiKeys()
-	if len(keys) == 0 {
-		key := &model.Apikey{
-			Apikey:      global.CONFIG.ApiKey.Prefix + global.CONFIG.ApiKey.Key,
-			Description: "default apikey",
+	if len(keys) == 0 && global.CONFIG.ApiKey != nil && global.CONFIG.ApiKey.Key != "" {
+		if owner == nil {
+			log.Printf("skip default apikey: no owner user")
+			return
+		}
+		if _, err := apikeyauth.CreateWithKey(owner, global.CONFIG.ApiKey.Prefix+global.CONFIG.ApiKey.Key, "default apikey", time.Time{}, nil); err != nil {
+			log.Printf("create default apikey failed: %v", err)
+		}
+	}
+}
+
+// apiKeyOwner 默认凭证的所属用户：初始管理员，不存在时取第一个 super 用户
+func apiKeyOwner() *model.User {
+	opUser := operation.NewUserOperation()
+	if global.CONFIG.User1st != nil && global.CONFIG.User1st.Username != "" {
+		if user, err := opUser.GetUserByUsername(global.CONFIG.User1st.Username); err == nil {
+			return user
+		}
+	}
+	users, err := opUser.GetAllUsers()
+	if err != nil {
+		return nil
+	}
+	for _, u := range users {
+		roles, err := opUser.GetUserRoles(u.ID)
+		if err != nil {
+			continue
+		}
+		for _, role := range roles {
+			if permissions.IsSuperRole(role) {
+				return u
+			}
 		}
-		op.Create(key)
 	}
+	return nil
 }
 
 // initDefaultSpace 初始化默认空间
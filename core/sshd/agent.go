@@ -0,0 +1,128 @@
+package sshd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils/logger"
+	"github.com/loganchef/ssh"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentChannelType OpenSSH 的 agent 转发通道类型
+const agentChannelType = "auth-agent@openssh.com"
+
+// ErrAgentForwardingNotAllowed 用户的角色没有开启 allow_agent_forwarding
+var ErrAgentForwardingNotAllowed = errors.New("agent forwarding is not allowed for this user")
+
+// setupAgentForwarding 客户端请求了 agent 转发（ssh -A）且角色允许时，为上游会话开启 agent 转发
+// 输入: sess - 客户端会话；upstreamClient - 上游连接；upstreamSess - 上游会话（需在 Shell 之前调用）
+// 必要性: 上游主机上 git pull、继续跳转等需要用户自己的密钥；堡垒机只原样转发 agent 通道的字节流，
+// 不解析 agent 协议，也不持有任何私钥
+func setupAgentForwarding(sess ssh.Session, upstreamClient *gossh.Client, upstreamSess *gossh.Session) {
+	if !ssh.AgentRequested(sess) {
+		return
+	}
+	if !agentForwardingAllowed(sess.User()) {
+		recordAgentAudit(sess, "拒绝 ssh-agent 转发请求", ErrAgentForwardingNotAllowed)
+		return
+	}
+
+	channels := upstreamClient.HandleChannelOpen(agentChannelType)
+	if channels == nil {
+		return
+	}
+	if err := agent.RequestAgentForwarding(upstreamSess); err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Failed to request agent forwarding for %s: %v", sess.User(), err))
+		return
+	}
+	go func() {
+		// 上游连接关闭时 channels 随之关闭
+		for newChan := range channels {
+			go relayAgentChannel(sess, newChan)
+		}
+	}()
+}
+
+// agentForwardingAllowed 检查用户是否有允许 agent 转发的角色
+func agentForwardingAllowed(username string) bool {
+	opUser := operation.NewUserOperation()
+	user, err := opUser.GetUserByUsername(username)
+	if err != nil {
+		return false
+	}
+	roles, err := opUser.GetUserRoles(user.ID)
+	if err != nil {
+		return false
+	}
+	return permissions.IsAgentForwardingAllowed(roles)
+}
+
+// relayAgentChannel 将上游打开的 agent 通道连接到客户端的 agent
+func relayAgentChannel(sess ssh.Session, newChan gossh.NewChannel) {
+	sshConn, ok := sess.Context().Value(ssh.ContextKeyConn).(gossh.Conn)
+	if !ok {
+		newChan.Reject(gossh.ConnectionFailed, "client connection not available")
+		return
+	}
+	clientCh, clientReqs, err := sshConn.OpenChannel(agentChannelType, nil)
+	if err != nil {
+		newChan.Reject(gossh.ConnectionFailed, err.Error())
+		recordAgentAudit(sess, "上游使用转发的 ssh-agent 失败", err)
+		return
+	}
+	go gossh.DiscardRequests(clientReqs)
+
+	upstreamCh, upstreamReqs, err := newChan.Accept()
+	if err != nil {
+		clientCh.Close()
+		return
+	}
+	go gossh.DiscardRequests(upstreamReqs)
+	recordAgentAudit(sess, "上游使用转发的 ssh-agent", nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(clientCh, upstreamCh)
+		clientCh.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(upstreamCh, clientCh)
+		upstreamCh.CloseWrite()
+	}()
+	wg.Wait()
+	clientCh.Close()
+	upstreamCh.Close()
+}
+
+// recordAgentAudit 记录 agent 转发审计日志，关联会话的目标资源
+func recordAgentAudit(sess ssh.Session, description string, agentErr error) {
+	auditLog := &model.AuditLog{
+		Username:    sess.User(),
+		Action:      "agent_forward",
+		ActionType:  "high_risk",
+		Description: description,
+		IPAddress:   GetClientIP(sess),
+		Status:      "success",
+	}
+	if res := GetSessionResource(sess); res != nil {
+		auditLog.ResourceType = res.Type
+		auditLog.ResourceID = res.ID
+		auditLog.ResourceName = res.Name
+		auditLog.Description = fmt.Sprintf("%s: %s", description, res.Name)
+	}
+	if agentErr != nil {
+		auditLog.Status = "failed"
+		auditLog.ErrorMessage = agentErr.Error()
+	}
+	saveAuditLogAsync(auditLog)
+}
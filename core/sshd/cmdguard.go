@@ -0,0 +1,611 @@
+package sshd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"binrc.com/roma/core/cmdpolicy"
+	"github.com/loganchef/ssh"
+)
+
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyBackspace = 0x08
+	keyTab       = 0x09
+	keyCtrlK     = 0x0b
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlR     = 0x12
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+// echoWait 从回显还原命令行时等待上游回显的最长时间
+const echoWait = 500 * time.Millisecond
+
+// commandGuard 拦截客户端在终端中提交的命令行，按命令策略放行、拦截、确认或等待审批
+// 命令行优先由按键还原；使用了历史、补全等无法从按键还原的编辑时，改由上游回显的当前行还原（尽力而为）
+// 按键还原的命令行无论上游是否回显都会检查，粘贴的整行与回车在同一块输入中到达时同样检查
+type commandGuard struct {
+	sess  ssh.Session
+	set   *cmdpolicy.Set
+	input chan []byte
+	err   error
+	done  chan struct{}
+	once  sync.Once
+
+	pending []byte
+	held    []byte // 等待上游回显时暂缓处理的输入，从回车开始
+	line    lineEditor
+
+	mu        sync.Mutex
+	screen    screenLine
+	prompt    string // 本行第一次按键时屏幕上已有的内容（提示符）
+	echoed    int    // 本行第一次按键后上游输出的字节数
+	altScreen bool   // 全屏程序（vim、less 等）中回车不是命令
+}
+
+// newCommandGuard 为会话创建命令拦截器，没有适用的策略时返回 nil
+func newCommandGuard(sess ssh.Session, r io.Reader, resType string) *commandGuard {
+	target := cmdpolicy.Target{Username: sess.User(), ClientIP: GetClientIP(sess), ResourceType: resType}
+	if res := GetSessionResource(sess); res != nil {
+		target.ResourceType = res.Type
+		target.ResourceID = res.ID
+		target.ResourceName = res.Name
+	}
+	set := cmdpolicy.ForTarget(target)
+	if set.Empty() {
+		return nil
+	}
+	g := &commandGuard{sess: sess, set: set, input: make(chan []byte), done: make(chan struct{})}
+	go g.pump(r)
+	return g
+}
+
+// pump 持续读取客户端输入；确认和等待审批时也需要读取输入，因此统一由这里读取
+func (g *commandGuard) pump(r io.Reader) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case g.input <- append([]byte(nil), buf[:n]...):
+			case <-g.done:
+				return
+			}
+		}
+		if err != nil {
+			g.err = err
+			close(g.input)
+			return
+		}
+	}
+}
+
+// Close 终端结束时停止转发客户端输入，避免之后的按键被吞掉
+func (g *commandGuard) Close() {
+	g.once.Do(func() { close(g.done) })
+}
+
+// next 读取下一块客户端输入，客户端断开或终端结束时返回 false
+func (g *commandGuard) next() ([]byte, bool) {
+	select {
+	case chunk, ok := <-g.input:
+		return chunk, ok
+	case <-g.done:
+		return nil, false
+	}
+}
+
+// Read 返回交给上游的输入，实现 io.Reader
+func (g *commandGuard) Read(p []byte) (int, error) {
+	for len(g.pending) == 0 {
+		if g.held != nil {
+			// 回车之前的输入已交给上游，等回显到达后再还原命令行
+			chunk := g.held
+			g.held = nil
+			g.waitEcho()
+			g.line.waited = true
+			g.pending = g.process(chunk)
+			continue
+		}
+		chunk, ok := g.next()
+		if !ok {
+			if g.err != nil {
+				return 0, g.err
+			}
+			return 0, io.EOF
+		}
+		g.pending = g.process(chunk)
+	}
+	n := copy(p, g.pending)
+	g.pending = g.pending[n:]
+	return n, nil
+}
+
+// Write 观察上游输出，用于还原当前行和识别全屏程序，实现 io.Writer
+func (g *commandGuard) Write(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if bytes.Contains(p, []byte("\x1b[?1049h")) || bytes.Contains(p, []byte("\x1b[?47h")) {
+		g.altScreen = true
+	}
+	if bytes.Contains(p, []byte("\x1b[?1049l")) || bytes.Contains(p, []byte("\x1b[?47l")) {
+		g.altScreen = false
+	}
+	g.echoed += len(p)
+	g.screen.Feed(p)
+	return len(p), nil
+}
+
+// process 处理一块客户端输入，返回应交给上游的字节
+func (g *commandGuard) process(chunk []byte) []byte {
+	out := make([]byte, 0, len(chunk))
+	for i := 0; i < len(chunk); {
+		if !g.line.started {
+			g.startLine()
+		}
+		b := chunk[i]
+		switch {
+		case b == '\r' || b == '\n':
+			if g.needEcho() {
+				g.held = append([]byte(nil), chunk[i:]...)
+				return out
+			}
+			out = append(out, g.submit()...)
+			if g.line.discardRest {
+				// 确认或等待审批期间已交互，丢弃同一块中剩余的预输入
+				g.line.discardRest = false
+				return out
+			}
+			i++
+			continue
+		case b == keyEscape:
+			n := g.line.escape(chunk[i:])
+			out = append(out, chunk[i:i+n]...)
+			i += n
+			continue
+		case b < 0x20 || b == keyDelete:
+			g.line.control(b)
+		default:
+			r, size := utf8.DecodeRune(chunk[i:])
+			g.line.insert(r)
+			out = append(out, chunk[i:i+size]...)
+			i += size
+			continue
+		}
+		out = append(out, b)
+		i++
+	}
+	return out
+}
+
+// needEcho 本行需要从回显还原但还没有收到回显，回车需等待回显
+func (g *commandGuard) needEcho() bool {
+	if !g.line.uncertain || g.line.waited {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !g.altScreen && g.echoed == 0
+}
+
+// waitEcho 等待上游回显：收到回显且输出停止一小段时间、超过 echoWait 或终端结束时返回
+func (g *commandGuard) waitEcho() {
+	const interval = 20 * time.Millisecond
+	deadline := time.Now().Add(echoWait)
+	last := 0
+	for time.Now().Before(deadline) {
+		select {
+		case <-g.done:
+			return
+		case <-time.After(interval):
+		}
+		g.mu.Lock()
+		echoed := g.echoed
+		g.mu.Unlock()
+		if echoed > 0 && echoed == last {
+			return
+		}
+		last = echoed
+	}
+}
+
+// startLine 记录新一行开始时屏幕上的提示符
+func (g *commandGuard) startLine() {
+	g.mu.Lock()
+	g.prompt = g.screen.String()
+	g.echoed = 0
+	g.mu.Unlock()
+	g.line.started = true
+}
+
+// submit 用户按下回车：检查命令行，返回交给上游的字节（回车，或取消本行的 Ctrl-C）
+func (g *commandGuard) submit() []byte {
+	g.mu.Lock()
+	altScreen, echoed, screenText, prompt := g.altScreen, g.echoed, g.screen.String(), g.prompt
+	g.mu.Unlock()
+	typed, uncertain := g.line.String(), g.line.uncertain
+	g.line.reset()
+
+	enter := []byte{'\r'}
+	if altScreen {
+		return enter
+	}
+	command := typed
+	if uncertain {
+		if echoed == 0 {
+			// 等待后仍没有回显，无法得知历史、补全得到的命令行，不放行
+			fmt.Fprint(g.sess, "\r\n[!] Command not checked: the command line could not be read, please type it again\r\n")
+			return []byte{keyCtrlC}
+		}
+		command = strings.TrimPrefix(screenText, prompt)
+	}
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return enter
+	}
+
+	target := g.set.Target()
+	d := g.set.Evaluate(command)
+	switch d.Action {
+	case cmdpolicy.ActionDeny:
+		cmdpolicy.RecordBlocked(target, command, d)
+		fmt.Fprintf(g.sess, "\r\n[!] Command blocked: %s\r\n", d.Reason())
+		return []byte{keyCtrlC}
+	case cmdpolicy.ActionConfirm:
+		g.line.discardRest = true
+		if g.confirm(d) {
+			cmdpolicy.RecordConfirmed(target, command, d)
+			return enter
+		}
+		cmdpolicy.RecordBlocked(target, command, d)
+		fmt.Fprint(g.sess, "[!] Command cancelled\r\n")
+		return []byte{keyCtrlC}
+	case cmdpolicy.ActionApprove:
+		g.line.discardRest = true
+		if g.awaitApproval(command, d) {
+			return enter
+		}
+		return []byte{keyCtrlC}
+	}
+	return enter
+}
+
+// confirm 提示用户输入 yes 确认执行，输入在本地回显，不会发给上游
+func (g *commandGuard) confirm(d *cmdpolicy.Decision) bool {
+	fmt.Fprintf(g.sess, "\r\n[?] %s\r\n[?] Type yes to run this command: ", d.Reason())
+	var answer []rune
+	for {
+		chunk, ok := g.next()
+		if !ok {
+			return false
+		}
+		for _, r := range string(chunk) {
+			switch r {
+			case '\r', '\n':
+				fmt.Fprint(g.sess, "\r\n")
+				return strings.EqualFold(strings.TrimSpace(string(answer)), "yes")
+			case keyCtrlC:
+				fmt.Fprint(g.sess, "^C\r\n")
+				return false
+			case keyDelete, keyBackspace:
+				if len(answer) > 0 {
+					answer = answer[:len(answer)-1]
+					fmt.Fprint(g.sess, "\b \b")
+				}
+			default:
+				if r >= 0x20 {
+					answer = append(answer, r)
+					fmt.Fprint(g.sess, string(r))
+				}
+			}
+		}
+	}
+}
+
+// awaitApproval 等待第二审批人，期间用户按 Ctrl-C 放弃，其他输入丢弃
+func (g *commandGuard) awaitApproval(command string, d *cmdpolicy.Decision) bool {
+	p := cmdpolicy.RequestApproval(g.set.Target(), command, d)
+	fmt.Fprintf(g.sess, "\r\n[?] %s\r\n[?] Waiting for a second user to approve request %s (sessions --approve %s), press Ctrl-C to give up ...\r\n",
+		d.Reason(), p.ID(), p.ID())
+
+	ctx, cancel := context.WithCancel(g.sess.Context())
+	defer cancel()
+	type result struct {
+		approver string
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		approver, err := p.Wait(ctx)
+		done <- result{approver, err}
+	}()
+
+	for {
+		select {
+		case r := <-done:
+			if r.err != nil {
+				fmt.Fprintf(g.sess, "[!] %v\r\n", r.err)
+				return false
+			}
+			fmt.Fprintf(g.sess, "[+] Approved by %s\r\n", r.approver)
+			return true
+		default:
+		}
+		withdraw := false
+		select {
+		case r := <-done:
+			done <- r
+		case chunk, ok := <-g.input:
+			withdraw = !ok || bytes.IndexByte(chunk, keyCtrlC) >= 0
+		case <-g.done:
+			withdraw = true
+		}
+		if withdraw {
+			cancel()
+			<-done
+			fmt.Fprint(g.sess, "[!] Approval request withdrawn\r\n")
+			return false
+		}
+	}
+}
+
+// lineEditor 根据按键还原当前输入的命令行
+type lineEditor struct {
+	buf         []rune
+	cursor      int
+	started     bool
+	uncertain   bool // 使用了历史、补全等无法从按键还原的编辑
+	waited      bool // 已为本行的回车等待过回显
+	discardRest bool
+}
+
+func (l *lineEditor) reset() {
+	*l = lineEditor{discardRest: l.discardRest}
+}
+
+func (l *lineEditor) String() string {
+	return string(l.buf)
+}
+
+func (l *lineEditor) insert(r rune) {
+	l.buf = append(l.buf, 0)
+	copy(l.buf[l.cursor+1:], l.buf[l.cursor:])
+	l.buf[l.cursor] = r
+	l.cursor++
+}
+
+// control 处理常见的 readline/tty 行编辑控制键
+func (l *lineEditor) control(b byte) {
+	switch b {
+	case keyDelete, keyBackspace:
+		if l.cursor > 0 {
+			l.buf = append(l.buf[:l.cursor-1], l.buf[l.cursor:]...)
+			l.cursor--
+		}
+	case keyCtrlD:
+		if l.cursor < len(l.buf) {
+			l.buf = append(l.buf[:l.cursor], l.buf[l.cursor+1:]...)
+		}
+	case keyCtrlU:
+		l.buf = append([]rune(nil), l.buf[l.cursor:]...)
+		l.cursor = 0
+	case keyCtrlK:
+		l.buf = l.buf[:l.cursor]
+	case keyCtrlW:
+		start := l.cursor
+		for start > 0 && l.buf[start-1] == ' ' {
+			start--
+		}
+		for start > 0 && l.buf[start-1] != ' ' {
+			start--
+		}
+		l.buf = append(l.buf[:start], l.buf[l.cursor:]...)
+		l.cursor = start
+	case keyCtrlA:
+		l.cursor = 0
+	case keyCtrlE:
+		l.cursor = len(l.buf)
+	case keyCtrlB:
+		if l.cursor > 0 {
+			l.cursor--
+		}
+	case keyCtrlF:
+		if l.cursor < len(l.buf) {
+			l.cursor++
+		}
+	case keyCtrlC:
+		// 本行作废，下一次按键重新记录提示符
+		l.reset()
+	case keyTab, keyCtrlR, keyCtrlP, keyCtrlN:
+		l.uncertain = true
+	}
+}
+
+// escape 处理以 ESC 开头的按键序列，返回序列长度
+func (l *lineEditor) escape(seq []byte) int {
+	if len(seq) < 2 {
+		l.uncertain = true
+		return len(seq)
+	}
+	if seq[1] != '[' && seq[1] != 'O' {
+		// Alt 组合键等
+		l.uncertain = true
+		return 2
+	}
+	n := 2
+	for n < len(seq) && (seq[n] < 0x40 || seq[n] > 0x7e) {
+		n++
+	}
+	if n >= len(seq) {
+		l.uncertain = true
+		return len(seq)
+	}
+	n++
+	switch string(seq[2:n]) {
+	case "C":
+		if l.cursor < len(l.buf) {
+			l.cursor++
+		}
+	case "D":
+		if l.cursor > 0 {
+			l.cursor--
+		}
+	case "H", "1~":
+		l.cursor = 0
+	case "F", "4~":
+		l.cursor = len(l.buf)
+	case "3~":
+		if l.cursor < len(l.buf) {
+			l.buf = append(l.buf[:l.cursor], l.buf[l.cursor+1:]...)
+		}
+	case "200~", "201~":
+		// 括号粘贴的起止标记
+	default:
+		l.uncertain = true
+	}
+	return n
+}
+
+// screenLine 按上游输出模拟终端当前行的内容
+type screenLine struct {
+	buf    []rune
+	cursor int
+	esc    []byte
+	rest   []byte
+}
+
+func (s *screenLine) String() string {
+	return string(s.buf)
+}
+
+// Feed 处理上游输出，只跟踪当前行：换行清空，支持回车、退格、光标左右移动和行内擦除
+func (s *screenLine) Feed(p []byte) {
+	data := append(s.rest, p...)
+	s.rest = nil
+	for i := 0; i < len(data); {
+		if s.esc != nil {
+			s.esc = append(s.esc, data[i])
+			i++
+			if done := s.applyEscape(); done {
+				s.esc = nil
+			}
+			continue
+		}
+		b := data[i]
+		switch {
+		case b == keyEscape:
+			s.esc = []byte{b}
+			i++
+		case b == '\n':
+			s.buf, s.cursor = nil, 0
+			i++
+		case b == '\r':
+			s.cursor = 0
+			i++
+		case b == keyBackspace:
+			if s.cursor > 0 {
+				s.cursor--
+			}
+			i++
+		case b < 0x20 || b == keyDelete:
+			i++
+		default:
+			if !utf8.FullRune(data[i:]) {
+				s.rest = append([]byte(nil), data[i:]...)
+				return
+			}
+			r, size := utf8.DecodeRune(data[i:])
+			s.put(r)
+			i += size
+		}
+	}
+}
+
+func (s *screenLine) put(r rune) {
+	if s.cursor < len(s.buf) {
+		s.buf[s.cursor] = r
+	} else {
+		for len(s.buf) < s.cursor {
+			s.buf = append(s.buf, ' ')
+		}
+		s.buf = append(s.buf, r)
+	}
+	s.cursor++
+}
+
+// applyEscape 处理已缓存的转义序列，返回序列是否结束
+func (s *screenLine) applyEscape() bool {
+	seq := s.esc
+	if len(seq) < 2 {
+		return false
+	}
+	if seq[1] == ']' {
+		// OSC（如设置窗口标题），以 BEL 或 ST 结束
+		last := seq[len(seq)-1]
+		return last == 0x07 || (last == '\\' && len(seq) > 2 && seq[len(seq)-2] == keyEscape)
+	}
+	if seq[1] != '[' {
+		return true
+	}
+	last := seq[len(seq)-1]
+	if len(seq) == 2 || last < 0x40 || last > 0x7e {
+		return false
+	}
+	n := 1
+	if params := string(seq[2 : len(seq)-1]); params != "" && !strings.ContainsAny(params, "?;") {
+		fmt.Sscanf(params, "%d", &n)
+		if n < 1 {
+			n = 1
+		}
+	}
+	switch last {
+	case 'C':
+		s.cursor += n
+	case 'D':
+		s.cursor -= n
+		if s.cursor < 0 {
+			s.cursor = 0
+		}
+	case 'G':
+		s.cursor = n - 1
+	case 'K':
+		if string(seq[2:len(seq)-1]) == "" || string(seq[2:len(seq)-1]) == "0" {
+			if s.cursor < len(s.buf) {
+				s.buf = s.buf[:s.cursor]
+			}
+		} else {
+			s.buf, s.cursor = nil, 0
+		}
+	case 'P':
+		if s.cursor < len(s.buf) {
+			end := s.cursor + n
+			if end > len(s.buf) {
+				end = len(s.buf)
+			}
+			s.buf = append(s.buf[:s.cursor], s.buf[end:]...)
+		}
+	case '@':
+		if s.cursor < len(s.buf) {
+			blanks := []rune(strings.Repeat(" ", n))
+			s.buf = append(s.buf[:s.cursor], append(blanks, s.buf[s.cursor:]...)...)
+		}
+	case 'J':
+		s.buf, s.cursor = nil, 0
+	}
+	return true
+}
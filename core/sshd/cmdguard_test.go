@@ -0,0 +1,185 @@
+package sshd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"binrc.com/roma/core/cmdpolicy"
+	"github.com/loganchef/ssh"
+)
+
+// fakeSession 只记录写给客户端的内容
+type fakeSession struct {
+	ssh.Session
+	mu  sync.Mutex
+	out bytes.Buffer
+}
+
+func (s *fakeSession) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out.Write(p)
+}
+
+func (s *fakeSession) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out.String()
+}
+
+func newTestGuard(t *testing.T) (*commandGuard, *io.PipeWriter, *fakeSession) {
+	t.Helper()
+	set := cmdpolicy.ForTarget(cmdpolicy.Target{Username: "alice", ResourceType: "linux"})
+	if set.Empty() {
+		t.Fatal("test command policies are not loaded")
+	}
+	sess := &fakeSession{}
+	r, w := io.Pipe()
+	g := &commandGuard{sess: sess, set: set, input: make(chan []byte), done: make(chan struct{})}
+	go g.pump(r)
+	t.Cleanup(func() {
+		g.Close()
+		w.Close()
+	})
+	return g, w, sess
+}
+
+// readUpstream 读取交给上游的字节，直到读到 want 结尾或超时
+func readUpstream(t *testing.T, g *commandGuard, want string) string {
+	t.Helper()
+	var got []byte
+	buf := make([]byte, 256)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.HasSuffix(string(got), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("upstream got %q, want suffix %q", got, want)
+		}
+		n, err := g.Read(buf)
+		if err != nil {
+			t.Fatalf("read: %v (got %q)", err, got)
+		}
+		got = append(got, buf[:n]...)
+	}
+	return string(got)
+}
+
+func TestCommandGuard(t *testing.T) {
+	tests := []struct {
+		name      string
+		screen    string // 上游已输出的内容（提示符等）
+		input     string // 客户端一次发送的输入
+		echo      string // 收到回车前的输入后上游回显的内容
+		want      string // 交给上游的字节
+		wantNotes string // 写给客户端的提示
+	}{
+		{name: "allowed line", screen: "$ ", input: "ls -l\r", want: "ls -l\r"},
+		{name: "pasted line without echo", screen: "$ ", input: "rm -rf /\r", want: "rm -rf /\x03", wantNotes: "Command blocked"},
+		{name: "piped lines", screen: "$ ", input: "ls\nrm -rf /var\n", want: "ls\rrm -rf /var\x03", wantNotes: "Command blocked"},
+		{name: "line editing", screen: "$ ", input: "rm -rf /tmp\x7f\x7f\x7f\r", want: "rm -rf /tmp\x7f\x7f\x7f\x03", wantNotes: "Command blocked"},
+		{name: "history line from echo", screen: "$ ", input: "\x1b[A\r", echo: "rm -rf /srv", want: "\x1b[A\x03", wantNotes: "Command blocked"},
+		{name: "completion line from echo", screen: "$ ", input: "ls /e\t\r", echo: "tc/", want: "ls /e\t\r"},
+		{name: "history line without echo", screen: "$ ", input: "\x1b[A\r", want: "\x1b[A\x03", wantNotes: "could not be read"},
+		{name: "alt screen", screen: "\x1b[?1049h", input: "rm -rf /\r", want: "rm -rf /\r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, w, sess := newTestGuard(t)
+			g.Write([]byte(tt.screen))
+			go w.Write([]byte(tt.input))
+			if tt.echo != "" {
+				go func() {
+					time.Sleep(50 * time.Millisecond)
+					g.Write([]byte(tt.echo))
+				}()
+			}
+			if got := readUpstream(t, g, tt.want[len(tt.want)-1:]); got != tt.want {
+				t.Errorf("upstream got %q, want %q", got, tt.want)
+			}
+			notes := sess.String()
+			if tt.wantNotes == "" && notes != "" {
+				t.Errorf("unexpected notice %q", notes)
+			}
+			if tt.wantNotes != "" && !strings.Contains(notes, tt.wantNotes) {
+				t.Errorf("notice %q does not contain %q", notes, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	tests := []struct {
+		name          string
+		keys          string
+		want          string
+		wantUncertain bool
+	}{
+		{name: "plain", keys: "ls -l", want: "ls -l"},
+		{name: "backspace", keys: "lss\x7f -l", want: "ls -l"},
+		{name: "ctrl-h", keys: "lss\x08", want: "ls"},
+		{name: "ctrl-u kills to start", keys: "echo hi\x15ls", want: "ls"},
+		{name: "ctrl-w kills word", keys: "ls -l /tmp\x17/var", want: "ls -l /var"},
+		{name: "ctrl-a inserts at start", keys: "-rf /\x01rm ", want: "rm -rf /"},
+		{name: "ctrl-k kills to end", keys: "ls -l\x01\x06\x06\x0b", want: "ls"},
+		{name: "arrow keys", keys: "rf /\x1b[D\x1b[D\x1b[D\x1b[Drm -\x1b[F", want: "rm -rf /"},
+		{name: "delete key", keys: "lxs\x1b[D\x1b[D\x1b[3~", want: "ls"},
+		{name: "bracketed paste", keys: "\x1b[200~rm -rf /\x1b[201~", want: "rm -rf /"},
+		{name: "ctrl-c resets", keys: "rm\x03ls", want: "ls"},
+		{name: "history", keys: "\x1b[A", wantUncertain: true},
+		{name: "tab completion", keys: "ls /e\t", want: "ls /e", wantUncertain: true},
+		{name: "reverse search", keys: "\x12rm", want: "rm", wantUncertain: true},
+		{name: "alt key", keys: "ls\x1bb", want: "ls", wantUncertain: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var l lineEditor
+			keys := []byte(tt.keys)
+			for i := 0; i < len(keys); {
+				switch b := keys[i]; {
+				case b == keyEscape:
+					i += l.escape(keys[i:])
+				case b < 0x20 || b == keyDelete:
+					l.control(b)
+					i++
+				default:
+					l.insert(rune(b))
+					i++
+				}
+			}
+			if got := l.String(); got != tt.want {
+				t.Errorf("line = %q, want %q", got, tt.want)
+			}
+			if l.uncertain != tt.wantUncertain {
+				t.Errorf("uncertain = %v, want %v", l.uncertain, tt.wantUncertain)
+			}
+		})
+	}
+}
+
+func TestScreenLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{name: "prompt", output: "last login\r\n$ ", want: "$ "},
+		{name: "history redraw", output: "$ ls\r\x1b[K$ rm -rf /srv", want: "$ rm -rf /srv"},
+		{name: "backspace erase", output: "$ lss\b\x1b[K", want: "$ ls"},
+		{name: "cursor left and insert", output: "$ ls\x1b[2D\x1b[1@x", want: "$ xls"},
+		{name: "delete chars", output: "$ lxs\x1b[2D\x1b[P", want: "$ ls"},
+		{name: "title osc", output: "\x1b]0;user@host\x07$ ", want: "$ "},
+		{name: "split utf-8", output: "$ echo \xe4\xbd", want: "$ echo "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s screenLine
+			s.Feed([]byte(tt.output))
+			if got := s.String(); got != tt.want {
+				t.Errorf("screen = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package sshd
+
+import (
+	"errors"
+	"fmt"
+
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/knownhosts"
+	"binrc.com/roma/core/types"
+	"binrc.com/roma/core/utils"
+	"binrc.com/roma/core/utils/logger"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ErrNoSSHConnection 资源没有可用的 SSH 连接配置
+var ErrNoSSHConnection = errors.New("没有可用的 SSH 连接配置")
+
+// SSHConnections 筛选出地址和端口完整的 SSH 连接配置
+func SSHConnections(connections []*types.Connection) []*types.Connection {
+	sshConnections := []*types.Connection{}
+	for _, connection := range connections {
+		if connection != nil && connection.Type == constants.ConnectSSH && connection.Host != "" && connection.Port != 0 {
+			sshConnections = append(sshConnections, connection)
+		}
+	}
+	return sshConnections
+}
+
+// DecryptConnectionPassword 解密连接配置中的密码，解密失败时使用原始值（可能是未加密的）
+func DecryptConnectionPassword(c *types.Connection) string {
+	if c.Password == "" {
+		return ""
+	}
+	password, err := utils.DecryptPassword(c.Password)
+	if err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Failed to decrypt password for %s:%d: %v", c.Host, c.Port, err))
+		return c.Password
+	}
+	return password
+}
+
+// DialSSHConnections 并发连接资源的所有 SSH 地址，返回第一个成功的连接
+// 输入: target - 上游主机密钥校验目标；connections - 资源的连接配置（非 SSH 的会被忽略）；resType - 资源类型（资源无密钥时按此类型查找 passport）
+// 输出: *gossh.Client - 第一个成功的 SSH 客户端；*types.Connection - 对应的连接配置；error - 全部失败时返回最后一个错误
+// 认证优先级与交互式连接一致：资源自身的 PrivateKey > 该类型的 passport > 资源密码
+func DialSSHConnections(target knownhosts.Target, connections []*types.Connection, resType string) (*gossh.Client, *types.Connection, error) {
+	sshConnections := SSHConnections(connections)
+	if len(sshConnections) == 0 {
+		return nil, nil, ErrNoSSHConnection
+	}
+
+	type result struct {
+		client *gossh.Client
+		conn   *types.Connection
+		err    error
+	}
+	resultCh := make(chan result, len(sshConnections))
+	for _, conn := range sshConnections {
+		go func(c *types.Connection) {
+			client, err := NewSSHClientWithTarget(target, c.Host, c.Port, c.Username, c.PrivateKey, resType, DecryptConnectionPassword(c))
+			resultCh <- result{client: client, conn: c, err: err}
+		}(conn)
+	}
+
+	var lastErr error
+	for i := 0; i < len(sshConnections); i++ {
+		res := <-resultCh
+		if res.err == nil {
+			// 其余仍在进行的连接成功后直接关闭
+			remaining := len(sshConnections) - i - 1
+			go func() {
+				for j := 0; j < remaining; j++ {
+					if late := <-resultCh; late.client != nil {
+						late.client.Close()
+					}
+				}
+			}()
+			return res.client, res.conn, nil
+		}
+		lastErr = res.err
+	}
+	return nil, nil, lastErr
+}
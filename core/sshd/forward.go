@@ -0,0 +1,251 @@
+package sshd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils"
+	"binrc.com/roma/core/utils/logger"
+	"github.com/loganchef/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ErrPortForwardingNotAllowed 用户的角色没有开启 allow_port_forwarding
+var ErrPortForwardingNotAllowed = errors.New("port forwarding is not allowed for this user")
+
+// directTCPIPData direct-tcpip 通道的附加数据（RFC 4254 7.2）
+type directTCPIPData struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// forwardTarget 端口转发的目标资源及实际连接的地址
+type forwardTarget struct {
+	Resource model.Resource
+	Type     string
+	Host     string
+	Port     int
+}
+
+// maxForwardsPerConnection 每个 SSH 连接同时打开的端口转发通道上限
+const maxForwardsPerConnection = 10
+
+// forwardSlotsContextKey 连接上下文中保存端口转发通道计数的键
+type forwardSlotsContextKey struct{}
+
+// forwardSlots 连接上正在使用的端口转发通道数
+type forwardSlots struct {
+	open int
+}
+
+// acquireForward 为新的端口转发通道占用名额，返回释放函数；不允许时返回拒绝原因
+// 连接第一次转发时按 SecureConnectionHandler 的规则占用一个该 IP 的连接名额（并发数和速率限制），连接关闭时释放，
+// 只做端口转发、不打开会话的连接也受限制
+func acquireForward(ctx ssh.Context, ip string) (func(), string) {
+	if !sshAuthAllowed(ip) {
+		return nil, "address is blocked"
+	}
+	ctx.Lock()
+	defer ctx.Unlock()
+	slots, _ := ctx.Value(forwardSlotsContextKey{}).(*forwardSlots)
+	if slots == nil {
+		if allowed, reason := globalSSHSecurityManager.AllowConnection(ip); !allowed {
+			return nil, reason
+		}
+		slots = &forwardSlots{}
+		ctx.SetValue(forwardSlotsContextKey{}, slots)
+		go func() {
+			<-ctx.Done()
+			globalSSHSecurityManager.ReleaseConnection(ip)
+		}()
+	}
+	if slots.open >= maxForwardsPerConnection {
+		return nil, fmt.Sprintf("too many forwarded channels on this connection (max: %d)", maxForwardsPerConnection)
+	}
+	slots.open++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ctx.Lock()
+			slots.open--
+			ctx.Unlock()
+		})
+	}, ""
+}
+
+// DirectTCPIPHandler 处理本地端口转发（ssh -L）和 ProxyJump（ssh -J）
+// 输入: srv - SSH 服务器；conn - 客户端连接；newChan - direct-tcpip 通道请求；ctx - 连接上下文
+// 必要性: 只有开启 allow_port_forwarding 的角色可以转发，且只允许转发到用户有 use 权限的资源地址，并记录每条隧道的字节数和时长
+func DirectTCPIPHandler(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+	d := directTCPIPData{}
+	if err := gossh.Unmarshal(newChan.ExtraData(), &d); err != nil {
+		newChan.Reject(gossh.ConnectionFailed, "error parsing forward data: "+err.Error())
+		return
+	}
+	dest := net.JoinHostPort(d.DestAddr, strconv.FormatUint(uint64(d.DestPort), 10))
+
+	if !portForwardingAllowed(ctx.User()) {
+		logger.Logger.Warning(fmt.Sprintf("Port forwarding denied for %s to %s: %v", ctx.User(), dest, ErrPortForwardingNotAllowed))
+		recordTransferAudit(ctx, nil, "", "port_forward", fmt.Sprintf("转发到 %s 被拒绝", dest), ErrPortForwardingNotAllowed)
+		newChan.Reject(gossh.Prohibited, "port forwarding is not allowed")
+		return
+	}
+
+	release, reason := acquireForward(ctx, GetClientIP(ctx))
+	if release == nil {
+		logger.Logger.Warning(fmt.Sprintf("Port forwarding rejected for %s to %s: %s", ctx.User(), dest, reason))
+		newChan.Reject(gossh.ResourceShortage, reason)
+		return
+	}
+	started := false
+	defer func() {
+		// 隧道建立后由转发协程在结束时释放
+		if !started {
+			release()
+		}
+	}()
+
+	target, err := findForwardTarget(ctx.User(), GetClientIP(ctx), d.DestAddr, d.DestPort)
+	if err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Port forwarding denied for %s to %s: %v", ctx.User(), dest, err))
+		recordTransferAudit(ctx, nil, "", "port_forward", fmt.Sprintf("转发到 %s 被拒绝", dest), err)
+		newChan.Reject(gossh.Prohibited, "port forwarding to "+dest+" is not allowed")
+		return
+	}
+
+	dialHost := target.Host
+	if resolved, err := utils.ResolveHostName(dialHost); err == nil && resolved != "" {
+		dialHost = resolved
+	}
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	upstream, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(dialHost, strconv.Itoa(target.Port)))
+	if err != nil {
+		recordTransferAudit(ctx, target.Resource, target.Type, "port_forward", fmt.Sprintf("转发到 %s 连接失败", dest), err)
+		newChan.Reject(gossh.ConnectionFailed, err.Error())
+		return
+	}
+
+	ch, reqs, err := newChan.Accept()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	go gossh.DiscardRequests(reqs)
+	started = true
+
+	var once sync.Once
+	closeBoth := func() {
+		once.Do(func() {
+			ch.Close()
+			upstream.Close()
+		})
+	}
+	// 登记为活动会话，可以被列出、强制结束，并随临时授权收回
+	upstreamAddr := net.JoinHostPort(target.Host, strconv.Itoa(target.Port))
+	live := RegisterSession(NewSessionInfo(ctx, SessionTypeTunnel, target.Resource, target.Type, upstreamAddr), func(string) { closeBoth() })
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer closeBoth()
+		io.Copy(&countingWriter{w: upstream, n: &live.bytesIn}, ch)
+	}()
+	go func() {
+		defer wg.Done()
+		defer closeBoth()
+		io.Copy(&countingWriter{w: ch, n: &live.bytesOut}, upstream)
+	}()
+
+	go func() {
+		// 客户端断开时同时关闭隧道
+		select {
+		case <-ctx.Done():
+			closeBoth()
+		case <-waitGroupDone(&wg):
+		}
+		wg.Wait()
+		live.Unregister()
+		release()
+		info := live.Info()
+		recordTransferAudit(ctx, target.Resource, target.Type, "port_forward",
+			fmt.Sprintf("端口转发 %s -> %s，会话 %s，发送 %d 字节，接收 %d 字节，时长 %s",
+				dest, upstreamAddr, info.ID, info.BytesIn, info.BytesOut, time.Since(info.StartedAt).Round(time.Second)),
+			nil)
+	}()
+}
+
+// findForwardTarget 在用户可以 use 的资源中查找与转发目标匹配的连接地址
+// 目标主机可以是资源连接配置中的地址，也可以是资源名称；端口必须是资源连接配置中的端口
+func findForwardTarget(username, clientIP, destHost string, destPort uint32) (*forwardTarget, error) {
+	var target *forwardTarget
+	err := eachUsableResource(username, clientIP, constants.GetResourceType(), func(res model.Resource, resourceType string) bool {
+		nameMatched := strings.EqualFold(res.GetName(), destHost)
+		for _, c := range res.GetConnect() {
+			if c == nil || c.Host == "" || c.Port <= 0 || uint32(c.Port) != destPort {
+				continue
+			}
+			if nameMatched || strings.EqualFold(c.Host, destHost) {
+				target = &forwardTarget{Resource: res, Type: resourceType, Host: c.Host, Port: c.Port}
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: no usable resource at %s", ErrTransferPermissionDenied, net.JoinHostPort(destHost, strconv.FormatUint(uint64(destPort), 10)))
+	}
+	return target, nil
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// waitGroupDone 将 WaitGroup 转为可 select 的 channel
+func waitGroupDone(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// portForwardingAllowed 检查用户是否有允许端口转发的角色
+func portForwardingAllowed(username string) bool {
+	opUser := operation.NewUserOperation()
+	user, err := opUser.GetUserByUsername(username)
+	if err != nil {
+		return false
+	}
+	roles, err := opUser.GetUserRoles(user.ID)
+	if err != nil {
+		return false
+	}
+	return permissions.IsPortForwardingAllowed(roles)
+}
@@ -0,0 +1,163 @@
+package sshd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// withSecurityManager 测试期间使用独立的 SSH 安全管理器
+func withSecurityManager(t *testing.T, maxConnectionsPerIP int) {
+	t.Helper()
+	prev := globalSSHSecurityManager
+	globalSSHSecurityManager = &SSHSecurityManager{
+		ipConnections:           make(map[string]int),
+		ipLastConnection:        make(map[string][]time.Time),
+		ipAuthFailures:          make(map[string]int),
+		ipLastFailure:           make(map[string]time.Time),
+		ipBanUntil:              make(map[string]time.Time),
+		maxConnectionsPerIP:     maxConnectionsPerIP,
+		maxConnectionsPerSecond: 100,
+		maxAuthFailures:         3,
+		banDuration:             time.Minute,
+		failureWindow:           time.Minute,
+	}
+	t.Cleanup(func() { globalSSHSecurityManager = prev })
+}
+
+// connContext 模拟一个 SSH 连接的上下文，返回关闭连接的函数
+func connContext(t *testing.T, ip string) (*fakeContext, context.CancelFunc) {
+	t.Helper()
+	ctx := newFakeContext("forward-user", ip+":50000")
+	inner, cancel := context.WithCancel(context.Background())
+	ctx.Context = inner
+	t.Cleanup(cancel)
+	return ctx, cancel
+}
+
+func TestAcquireForwardPerConnection(t *testing.T) {
+	withSecurityManager(t, 5)
+	ctx, _ := connContext(t, "198.51.100.1")
+
+	var releases []func()
+	for i := 0; i < maxForwardsPerConnection; i++ {
+		release, reason := acquireForward(ctx, "198.51.100.1")
+		if release == nil {
+			t.Fatalf("forward %d rejected: %s", i+1, reason)
+		}
+		releases = append(releases, release)
+	}
+	if release, _ := acquireForward(ctx, "198.51.100.1"); release != nil {
+		t.Fatal("forward above the per-connection limit was allowed")
+	}
+	// 重复释放只计一次
+	releases[0]()
+	releases[0]()
+	if release, reason := acquireForward(ctx, "198.51.100.1"); release == nil {
+		t.Fatalf("forward after release rejected: %s", reason)
+	}
+	if release, _ := acquireForward(ctx, "198.51.100.1"); release != nil {
+		t.Fatal("double release freed two slots")
+	}
+	// 同一连接的所有转发只占用一个 IP 连接名额
+	if n := globalSSHSecurityManager.ipConnections["198.51.100.1"]; n != 1 {
+		t.Errorf("ipConnections = %d, want 1", n)
+	}
+}
+
+func TestAcquireForwardPerIP(t *testing.T) {
+	withSecurityManager(t, 1)
+	first, closeFirst := connContext(t, "198.51.100.2")
+	second, _ := connContext(t, "198.51.100.2")
+	other, _ := connContext(t, "198.51.100.3")
+	blocked, _ := connContext(t, "198.51.100.4")
+	addToSSHBlacklist("198.51.100.4", time.Minute)
+
+	steps := []struct {
+		name  string
+		ctx   *fakeContext
+		ip    string
+		allow bool
+	}{
+		{name: "first connection", ctx: first, ip: "198.51.100.2", allow: true},
+		{name: "second connection from the same address", ctx: second, ip: "198.51.100.2", allow: false},
+		{name: "other address", ctx: other, ip: "198.51.100.3", allow: true},
+		{name: "blacklisted address", ctx: blocked, ip: "198.51.100.4", allow: false},
+	}
+	for _, step := range steps {
+		release, reason := acquireForward(step.ctx, step.ip)
+		if (release != nil) != step.allow {
+			t.Errorf("%s: allowed = %v (%s), want %v", step.name, release != nil, reason, step.allow)
+		}
+	}
+
+	// 第一个连接关闭后释放 IP 名额
+	closeFirst()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if release, _ := acquireForward(second, "198.51.100.2"); release != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("address slot not released after the connection closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// rejectedChannel 记录拒绝原因的 direct-tcpip 通道请求，测试中不会被接受
+type rejectedChannel struct {
+	extra  []byte
+	reason string
+}
+
+func (c *rejectedChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	return nil, nil, errors.New("channel accepted unexpectedly")
+}
+
+func (c *rejectedChannel) Reject(_ gossh.RejectionReason, message string) error {
+	c.reason = message
+	return nil
+}
+
+func (c *rejectedChannel) ChannelType() string { return "direct-tcpip" }
+func (c *rejectedChannel) ExtraData() []byte   { return c.extra }
+
+func TestDirectTCPIPRequiresRoleFlag(t *testing.T) {
+	withSecurityManager(t, 5)
+	user := &model.User{Username: "forward-user", Name: "forward-user", Nickname: "forward-user", Email: "forward-user@example.com"}
+	if err := global.CDB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { global.CDB.Unscoped().Select("Roles").Delete(user) })
+	extra := gossh.Marshal(directTCPIPData{DestAddr: "10.0.0.1", DestPort: 22, OriginAddr: "127.0.0.1", OriginPort: 50000})
+
+	forward := func() string {
+		ctx, _ := connContext(t, "198.51.100.3")
+		req := &rejectedChannel{extra: extra}
+		DirectTCPIPHandler(nil, nil, req, ctx)
+		return req.reason
+	}
+
+	if got := forward(); got != "port forwarding is not allowed" {
+		t.Fatalf("without allow_port_forwarding: rejected with %q", got)
+	}
+
+	role := &model.Role{Name: "forwarder", Desc: `{"version":"1.0","allow_port_forwarding":true}`}
+	if err := global.CDB.Create(role).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { global.CDB.Delete(role) })
+	if err := global.CDB.Model(user).Association("Roles").Append(role); err != nil {
+		t.Fatal(err)
+	}
+	// 角色允许转发后仍需对目标资源有 use 权限
+	if got := forward(); got != "port forwarding to 10.0.0.1:22 is not allowed" {
+		t.Fatalf("with allow_port_forwarding but no resource: rejected with %q", got)
+	}
+}
@@ -0,0 +1,93 @@
+package sshd
+
+import (
+	"errors"
+	"strings"
+
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/model"
+	"github.com/loganchef/ssh"
+)
+
+// ErrLoginTargetNotFound 登录名中指定的资源不存在或没有 use 权限
+var ErrLoginTargetNotFound = errors.New("resource not found or permission denied")
+
+// loginContextKey 会话上下文中保存客户端原始登录名的键
+type loginContextKey struct{}
+
+// ParseLoginName 解析登录名 user+target，返回 ROMA 用户名和目标资源（未指定时为空）
+func ParseLoginName(login string) (string, string) {
+	username, target, _ := strings.Cut(login, "+")
+	return username, target
+}
+
+// loginUser 返回认证使用的 ROMA 用户名，并将上下文中的用户名替换为它
+// 必要性: ssh user+web-01@roma 登录时，权限、审计等逻辑只应看到 user
+func loginUser(ctx ssh.Context) string {
+	raw, ok := ctx.Value(loginContextKey{}).(string)
+	if !ok {
+		raw = ctx.User()
+		ctx.SetValue(loginContextKey{}, raw)
+	}
+	username, _ := ParseLoginName(raw)
+	ctx.SetValue(ssh.ContextKeyUser, username)
+	return username
+}
+
+// LoginTarget 返回登录名中指定的目标资源（ssh user+target@roma），未指定时为空
+func LoginTarget(sess ssh.Session) string {
+	raw, _ := sess.Context().Value(loginContextKey{}).(string)
+	_, target := ParseLoginName(raw)
+	return target
+}
+
+// loginSession 让 User() 返回去掉目标资源后的 ROMA 用户名
+type loginSession struct {
+	ssh.Session
+	user string
+}
+
+func (s *loginSession) User() string {
+	return s.user
+}
+
+// withLoginUser 登录名带有目标资源时包装会话
+func withLoginUser(sess ssh.Session) ssh.Session {
+	if user := sess.Context().User(); user != sess.User() {
+		return &loginSession{Session: sess, user: user}
+	}
+	return sess
+}
+
+// FindLoginResource 在用户可以 use 的资源中查找登录目标
+// 输入: username - ROMA 用户名；clientIP - 来源地址（用于权限条件）；target - 资源名称或资源的连接地址
+// 输出: model.Resource - 资源；string - 资源类型；error - 未找到时返回 ErrLoginTargetNotFound
+// 资源名称优先于连接地址匹配，同名时按资源类型顺序取第一个
+func FindLoginResource(username, clientIP, target string) (model.Resource, string, error) {
+	var byName, byHost *transferResource
+	err := eachUsableResource(username, clientIP, constants.GetResourceType(), func(res model.Resource, resourceType string) bool {
+		if res.GetName() == target {
+			byName = &transferResource{Resource: res, Type: resourceType}
+			return false
+		}
+		if byHost == nil {
+			for _, c := range res.GetConnect() {
+				if c != nil && c.Host == target {
+					byHost = &transferResource{Resource: res, Type: resourceType}
+					break
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if byName == nil {
+		byName = byHost
+	}
+	if byName == nil {
+		return nil, "", ErrLoginTargetNotFound
+	}
+	return byName.Resource, byName.Type, nil
+}
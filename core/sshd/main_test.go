@@ -0,0 +1,31 @@
+package sshd
+
+import (
+	"os"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testPolicies 测试中生效的命令策略，命令策略在第一次使用时编译，因此在 TestMain 中配置
+var testPolicies = []*configs.CommandPolicyConfig{
+	{Name: "no-rm-root", Patterns: []string{`^rm\s+-rf\s+/`}, Action: "deny", Message: "deleting from / is not allowed"},
+}
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.AutoMigrate(&model.User{}, &model.Role{}, &model.AuditLog{}, &model.KnownHost{}, &model.UserSSHKey{}, &model.SessionRecording{}); err != nil {
+		panic(err)
+	}
+	global.CDB = db
+	global.CONFIG = &configs.Config{CommandPolicies: testPolicies}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,138 @@
+package sshd
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+
+	"binrc.com/roma/core/ldapauth"
+	"binrc.com/roma/core/mfa"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"github.com/loganchef/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// errSSHPermissionDenied 认证失败时返回给 ssh 库的错误
+var errSSHPermissionDenied = errors.New("permission denied")
+
+// totpPrompt keyboard-interactive 中的验证码提示
+const totpPrompt = "Verification code (or recovery code): "
+
+// totpEnrollmentInstruction 角色要求 TOTP 但用户尚未绑定时显示的说明
+const totpEnrollmentInstruction = "Two-factor authentication is required for your account.\n" +
+	"Enroll TOTP via POST /api/v1/users/me/mfa/totp before logging in over SSH."
+
+// SecureServerConfig SSH 服务端认证配置（用作 ssh.Server 的 ServerConfigCallback）
+// 公钥认证通过后，已绑定 TOTP 或角色要求 TOTP 的用户还需通过 keyboard-interactive 输入验证码
+// 必要性: ssh.PublicKeyAuth 只能返回成功或失败，无法要求下一步认证（PartialSuccessError），
+// 因此直接设置 PublicKeyCallback，不再设置 PublicKeyHandler
+func SecureServerConfig(ctx ssh.Context) *gossh.ServerConfig {
+	return &gossh.ServerConfig{
+		// 没有 PublicKeyHandler 时 ssh 库会开启 NoClientAuth，这里拒绝 none 认证
+		NoClientAuthCallback: func(gossh.ConnMetadata) (*gossh.Permissions, error) {
+			return nil, errSSHPermissionDenied
+		},
+		PublicKeyCallback: func(conn gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			applySSHConnMetadata(ctx, conn)
+			ip := sshAuthIP(ctx)
+			if !sshAuthAllowed(ip) {
+				return nil, errSSHPermissionDenied
+			}
+			perms := &gossh.Permissions{}
+			if !publicKeyAuth(ctx, key, perms) {
+				recordSSHAuthResult(ip, false)
+				return nil, errSSHPermissionDenied
+			}
+			ctx.SetValue(ssh.ContextKeyPublicKey, key)
+
+			next, err := totpChallenge(ctx, ip, perms)
+			if err != nil {
+				log.Printf("PublicKeyAuth: 用户 %s 的二次验证状态查询失败: %v", ctx.User(), err)
+				return nil, errSSHPermissionDenied
+			}
+			if next != nil {
+				// 公钥通过后不清除失败计数，避免持有私钥的人无限次猜测验证码
+				return nil, &gossh.PartialSuccessError{Next: gossh.ServerAuthCallbacks{KeyboardInteractiveCallback: next}}
+			}
+			recordSSHAuthResult(ip, true)
+			return perms, nil
+		},
+	}
+}
+
+// totpChallenge 返回用户需要通过的 TOTP 校验，不需要二次验证时返回 nil
+// perms 为公钥认证的结果，二次验证通过后返回给 ssh 库
+func totpChallenge(ctx ssh.Context, ip string, perms *gossh.Permissions) (func(gossh.ConnMetadata, gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error), error) {
+	username := ctx.User()
+	user, err := operation.NewUserOperation().GetUserByUsername(username)
+	if err != nil {
+		// 尚未同步的目录用户还没有绑定 TOTP，按组映射的角色判断是否要求 TOTP
+		entry := pendingLDAPEntry(ctx)
+		if entry == nil {
+			return nil, err
+		}
+		if !permissions.IsTOTPRequired(ldapauth.MappedRoles(entry)) {
+			return nil, nil
+		}
+		return totpEnrollmentRequired(username), nil
+	}
+	enabled, err := mfa.IsEnabled(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		if !mfa.IsRequiredByRole(user.ID) {
+			return nil, nil
+		}
+		return totpEnrollmentRequired(username), nil
+	}
+
+	return func(conn gossh.ConnMetadata, challenge gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
+		if !sshAuthAllowed(ip) {
+			return nil, errSSHPermissionDenied
+		}
+		answers, err := challenge("", "", []string{totpPrompt}, []bool{false})
+		if err != nil {
+			return nil, err
+		}
+		if len(answers) != 1 {
+			recordSSHAuthResult(ip, false)
+			return nil, errSSHPermissionDenied
+		}
+		usedRecovery, err := mfa.Verify(user.ID, answers[0])
+		if err != nil {
+			log.Printf("PublicKeyAuth: 用户 %s 的 TOTP 验证失败: %v", username, err)
+			recordSSHAuthResult(ip, false)
+			return nil, errSSHPermissionDenied
+		}
+		if usedRecovery {
+			log.Printf("PublicKeyAuth: 用户 %s 使用恢复码通过二次验证", username)
+		}
+		recordSSHAuthResult(ip, true)
+		return perms, nil
+	}, nil
+}
+
+// totpEnrollmentRequired 角色要求 TOTP 但尚未绑定：提示绑定方式后拒绝登录
+func totpEnrollmentRequired(username string) func(gossh.ConnMetadata, gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
+	return func(conn gossh.ConnMetadata, challenge gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
+		challenge("", totpEnrollmentInstruction, nil, nil)
+		log.Printf("PublicKeyAuth: 用户 %s 的角色要求 TOTP，但尚未绑定", username)
+		return nil, errSSHPermissionDenied
+	}
+}
+
+// applySSHConnMetadata 将连接信息写入上下文（与 ssh 库在认证回调中的处理一致）
+func applySSHConnMetadata(ctx ssh.Context, conn gossh.ConnMetadata) {
+	if ctx.Value(ssh.ContextKeySessionID) != nil {
+		return
+	}
+	ctx.SetValue(ssh.ContextKeySessionID, hex.EncodeToString(conn.SessionID()))
+	ctx.SetValue(ssh.ContextKeyClientVersion, string(conn.ClientVersion()))
+	ctx.SetValue(ssh.ContextKeyServerVersion, string(conn.ServerVersion()))
+	ctx.SetValue(ssh.ContextKeyUser, conn.User())
+	ctx.SetValue(ssh.ContextKeyLocalAddr, conn.LocalAddr())
+	ctx.SetValue(ssh.ContextKeyRemoteAddr, conn.RemoteAddr())
+}
@@ -0,0 +1,329 @@
+package sshd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils/logger"
+	"github.com/loganchef/ssh"
+)
+
+// SessionResource 当前 SSH 会话正在访问的资源，用于录像和审计关联
+type SessionResource struct {
+	Type string
+	ID   uint
+	Name string
+}
+
+type sessionContextKey struct {
+	name string
+}
+
+var contextKeySessionResource = &sessionContextKey{"roma-session-resource"}
+
+// SetSessionResource 在会话上下文中记录目标资源
+// 输入: sess - SSH 会话；res - 目标资源信息
+// 必要性: NewTerminal 只拿到连接地址，需要通过上下文获取资源信息写入录像和审计
+func SetSessionResource(sess ssh.Session, res SessionResource) {
+	sess.Context().SetValue(contextKeySessionResource, &res)
+}
+
+// GetSessionResource 读取会话上下文中的目标资源，未设置时返回 nil
+func GetSessionResource(sess ssh.Session) *SessionResource {
+	if res, ok := sess.Context().Value(contextKeySessionResource).(*SessionResource); ok {
+		return res
+	}
+	return nil
+}
+
+// asciicastHeader asciicast v2 文件头
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder 以 asciicast v2 格式记录终端输出（"o"）、键盘输入（"i"）和窗口变化（"r"）
+// 输入只在配置 recording_input 或 recording_required 时记录：键入内容包含在 sudo、passwd 等无回显提示下输入的密码
+type Recorder struct {
+	mu        sync.Mutex
+	file      *os.File
+	w         *bufio.Writer
+	start     time.Time
+	pending   []byte // 输出中未完整的 UTF-8 字符
+	pendingIn []byte // 输入中未完整的 UTF-8 字符
+	err       error
+	closed    bool
+}
+
+// NewRecorder 创建录像文件并写入文件头
+// 输入: path - 录像文件路径；width/height - 初始窗口大小；term - 终端类型；title - 录像标题
+// 输出: *Recorder - 录像器；error - 错误信息
+func NewRecorder(path string, width, height int, term, title string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		file:  file,
+		w:     bufio.NewWriter(file),
+		start: time.Now(),
+	}
+	header, err := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": term, "SHELL": "/bin/sh"},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := r.w.Write(append(header, '\n')); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write 记录一段终端输出，实现 io.Writer
+// 录像写入失败不会影响终端本身，因此总是返回 len(p), nil
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeData("o", &r.pending, p)
+	return len(p), nil
+}
+
+// Input 记录一段键盘输入
+func (r *Recorder) Input(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeData("i", &r.pendingIn, p)
+}
+
+// InputWriter 返回把写入内容记录为输入事件的 io.Writer，用于 io.TeeReader 包装客户端输入
+func (r *Recorder) InputWriter() io.Writer {
+	return recorderInput{r}
+}
+
+type recorderInput struct {
+	r *Recorder
+}
+
+func (w recorderInput) Write(p []byte) (int, error) {
+	w.r.Input(p)
+	return len(p), nil
+}
+
+// writeData 写入一段数据事件，调用方需持有锁
+// 末尾不完整的 UTF-8 字符留在 pending 中等下一次写入，避免被替换成乱码
+func (r *Recorder) writeData(code string, pending *[]byte, p []byte) {
+	data := append(*pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	*pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.writeEvent(code, string(data[:cut]))
+	}
+}
+
+// Resize 记录窗口大小变化
+func (r *Recorder) Resize(width, height int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent("r", fmt.Sprintf("%dx%d", width, height))
+}
+
+// Close 刷新缓冲并关闭录像文件
+// 输出: int64 - 录像文件大小；error - 错误信息
+func (r *Recorder) Close() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, r.err
+	}
+	if len(r.pendingIn) > 0 {
+		r.writeEvent("i", string(r.pendingIn))
+		r.pendingIn = nil
+	}
+	if len(r.pending) > 0 {
+		r.writeEvent("o", string(r.pending))
+		r.pending = nil
+	}
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	var size int64
+	if info, err := r.file.Stat(); err == nil {
+		size = info.Size()
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	r.closed = true
+	return size, r.err
+}
+
+// writeEvent 写入一条事件，调用方需持有锁
+func (r *Recorder) writeEvent(code, data string) {
+	if r.err != nil || r.closed {
+		return
+	}
+	elapsed := time.Since(r.start).Seconds()
+	line, err := json.Marshal([]interface{}{elapsed, code, data})
+	if err != nil {
+		r.err = err
+		return
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		r.err = err
+		logger.Logger.Warning(fmt.Sprintf("Failed to write session recording %s: %v", r.file.Name(), err))
+	}
+}
+
+// sessionRecording 一次正在进行的终端录像
+type sessionRecording struct {
+	*Recorder
+	id uint
+}
+
+// startSessionRecording 按配置和角色决定是否录像，并创建审计日志与录像记录
+// 输入: sess - SSH 会话；host/port - 上游地址；width/height - 初始窗口；term - 终端类型
+// 输出: *sessionRecording - 录像（未开启时为 nil）；error - 需要录像但无法开始录像
+// 必要性: 所有经过堡垒机的交互式终端都需要可回放的录像
+func startSessionRecording(sess ssh.Session, host string, port int, width, height int, term string) (*sessionRecording, error) {
+	common := global.CONFIG.Common
+	if common != nil && common.RecordingDisabled {
+		return nil, nil
+	}
+
+	username := sess.User()
+	var userID uint
+	opUser := operation.NewUserOperation()
+	if user, err := opUser.GetUserByUsername(username); err == nil {
+		userID = user.ID
+		if roles, err := opUser.GetUserRoles(user.ID); err == nil && permissions.IsRecordingDisabled(roles) {
+			return nil, nil
+		}
+	}
+
+	res := GetSessionResource(sess)
+	if res == nil {
+		res = &SessionResource{Type: "linux", Name: host}
+	}
+
+	recordingDir := ""
+	if common != nil {
+		recordingDir = common.RecordingDir
+	}
+	if recordingDir == "" {
+		recordingDir = filepath.Join(constants.BASE_DIR, "recordings")
+	}
+	now := time.Now()
+	sessionID := sess.Context().SessionID()
+	if len(sessionID) > 12 {
+		sessionID = sessionID[:12]
+	}
+	path := filepath.Join(recordingDir, username, now.Format("20060102"),
+		fmt.Sprintf("%s-%s-%s.cast", now.Format("150405"), sessionID, filepath.Base(res.Name)))
+
+	hostAddr := fmt.Sprintf("%s:%d", host, port)
+	recorder, err := NewRecorder(path, width, height, term, fmt.Sprintf("%s@%s", username, res.Name))
+	if err != nil {
+		return nil, fmt.Errorf("create session recording %s: %w", path, err)
+	}
+
+	ipAddress := GetClientIP(sess)
+	auditLog := &model.AuditLog{
+		UserID:       userID,
+		Username:     username,
+		Action:       "ssh_session",
+		ActionType:   "normal",
+		ResourceType: res.Type,
+		ResourceID:   res.ID,
+		ResourceName: res.Name,
+		Description:  fmt.Sprintf("终端会话: %s，录像: %s", hostAddr, path),
+		IPAddress:    ipAddress,
+		Status:       "success",
+	}
+	if err := operation.NewAuditOperation().CreateAuditLog(auditLog); err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Failed to record session audit log: %v", err))
+	}
+
+	recording := &model.SessionRecording{
+		AuditLogID:   auditLog.ID,
+		SessionID:    sess.Context().SessionID(),
+		UserID:       userID,
+		Username:     username,
+		ResourceType: res.Type,
+		ResourceID:   res.ID,
+		ResourceName: res.Name,
+		Host:         hostAddr,
+		IPAddress:    ipAddress,
+		FilePath:     path,
+		StartedAt:    now,
+	}
+	if err := operation.NewSessionRecordingOperation().CreateRecording(recording); err != nil {
+		// 没有录像记录的文件无法在录像列表中回放，视为录像未开始
+		recorder.Close()
+		return nil, fmt.Errorf("save session recording record: %w", err)
+	}
+
+	return &sessionRecording{Recorder: recorder, id: recording.ID}, nil
+}
+
+// recordingRequired 是否配置了无法录像时拒绝会话
+func recordingRequired() bool {
+	common := global.CONFIG.Common
+	return common != nil && common.RecordingRequired
+}
+
+// recordingInput 录像是否记录键盘输入，配置 recording_required 时总是记录
+func recordingInput() bool {
+	common := global.CONFIG.Common
+	return common != nil && (common.RecordingInput || common.RecordingRequired)
+}
+
+// finish 关闭录像文件并更新录像记录
+func (s *sessionRecording) finish() {
+	size, err := s.Close()
+	if err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Session recording closed with error: %v", err))
+	}
+	if s.id == 0 {
+		return
+	}
+	if err := operation.NewSessionRecordingOperation().FinishRecording(s.id, size); err != nil {
+		logger.Logger.Warning(fmt.Sprintf("Failed to update session recording %d: %v", s.id, err))
+	}
+}
@@ -0,0 +1,232 @@
+package sshd
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"github.com/loganchef/ssh"
+)
+
+// recordingSession startSessionRecording 使用的会话
+type recordingSession struct {
+	ssh.Session
+	ctx *fakeContext
+}
+
+func (s *recordingSession) User() string         { return s.ctx.User() }
+func (s *recordingSession) Context() ssh.Context { return s.ctx }
+func (s *recordingSession) RemoteAddr() net.Addr { return s.ctx.RemoteAddr() }
+
+// readEvents 读取录像文件，返回文件头和事件
+func readEvents(t *testing.T, path string) (asciicastHeader, [][]interface{}) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	var header asciicastHeader
+	if !scanner.Scan() {
+		t.Fatal("empty recording")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	var events [][]interface{}
+	for scanner.Scan() {
+		var ev []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	return header, events
+}
+
+func TestRecorderEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(r *Recorder)
+		want   [][2]string // 事件类型与内容
+	}{
+		{
+			name:   "output",
+			record: func(r *Recorder) { r.Write([]byte("$ ls\r\n")) },
+			want:   [][2]string{{"o", "$ ls\r\n"}},
+		},
+		{
+			name:   "input",
+			record: func(r *Recorder) { r.Input([]byte("ls\r")) },
+			want:   [][2]string{{"i", "ls\r"}},
+		},
+		{
+			name: "input through tee reader",
+			record: func(r *Recorder) {
+				io.ReadAll(io.TeeReader(strings.NewReader("secret\r"), r.InputWriter()))
+				r.Write([]byte("\r\n"))
+			},
+			want: [][2]string{{"i", "secret\r"}, {"o", "\r\n"}},
+		},
+		{
+			name: "split input rune does not mix with output",
+			record: func(r *Recorder) {
+				r.Input([]byte("中")[:1])
+				r.Write([]byte("é"))
+				r.Input([]byte("中")[1:])
+			},
+			want: [][2]string{{"o", "é"}, {"i", "中"}},
+		},
+		{
+			name:   "resize",
+			record: func(r *Recorder) { r.Resize(120, 40) },
+			want:   [][2]string{{"r", "120x40"}},
+		},
+		{
+			name: "split utf-8 rune is kept together",
+			record: func(r *Recorder) {
+				r.Write([]byte("中")[:2])
+				r.Write([]byte("中")[2:])
+			},
+			want: [][2]string{{"o", "中"}},
+		},
+		{
+			name:   "pending bytes flushed on close",
+			record: func(r *Recorder) { r.Write([]byte("ok " + string([]byte("中")[:1]))) },
+			want:   [][2]string{{"o", "ok "}, {"o", "�"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sub", "test.cast")
+			r, err := NewRecorder(path, 80, 24, "xterm", "alice@web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.record(r)
+			if _, err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			header, events := readEvents(t, path)
+			if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Title != "alice@web" {
+				t.Errorf("header = %+v", header)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("events = %v, want %v", events, tt.want)
+			}
+			for i, ev := range events {
+				if ev[1] != tt.want[i][0] || ev[2] != tt.want[i][1] {
+					t.Errorf("event %d = %v, want %v", i, ev, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStartSessionRecording(t *testing.T) {
+	saved := global.CONFIG.Common
+	t.Cleanup(func() { global.CONFIG.Common = saved })
+
+	// 以普通文件作为父目录，录像目录无法创建
+	blocked := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocked, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		common    *configs.CommonConfig
+		wantNil   bool
+		wantErr   bool
+		wantCheck bool // 是否需要检查录像记录
+	}{
+		{name: "disabled", common: &configs.CommonConfig{RecordingDisabled: true}, wantNil: true},
+		{name: "directory not writable", common: &configs.CommonConfig{RecordingDir: filepath.Join(blocked, "recordings")}, wantNil: true, wantErr: true},
+		{name: "recording", common: &configs.CommonConfig{RecordingDir: t.TempDir()}, wantCheck: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global.CONFIG.Common = tt.common
+			sess := &recordingSession{ctx: newFakeContext("rec-"+strings.ReplaceAll(tt.name, " ", "-"), "10.0.0.1:5000")}
+			rec, err := startSessionRecording(sess, "10.0.0.2", 22, 80, 24, "xterm")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (rec == nil) != tt.wantNil {
+				t.Fatalf("recording = %v, wantNil %v", rec, tt.wantNil)
+			}
+			if !tt.wantCheck {
+				return
+			}
+			rec.Write([]byte("hello"))
+			rec.finish()
+
+			var record model.SessionRecording
+			if err := global.CDB.First(&record, rec.id).Error; err != nil {
+				t.Fatal(err)
+			}
+			if record.EndedAt == nil || record.Size == 0 || record.Host != "10.0.0.2:22" || record.IPAddress != "10.0.0.1" {
+				t.Errorf("record = %+v", record)
+			}
+			if _, events := readEvents(t, record.FilePath); len(events) != 1 || events[0][2] != "hello" {
+				t.Errorf("events = %v", events)
+			}
+		})
+	}
+}
+
+func TestRecordingInput(t *testing.T) {
+	saved := global.CONFIG.Common
+	t.Cleanup(func() { global.CONFIG.Common = saved })
+
+	tests := []struct {
+		name   string
+		common *configs.CommonConfig
+		want   bool
+	}{
+		{name: "no common config", common: nil, want: false},
+		{name: "default", common: &configs.CommonConfig{}, want: false},
+		{name: "recording_input", common: &configs.CommonConfig{RecordingInput: true}, want: true},
+		{name: "recording_required", common: &configs.CommonConfig{RecordingRequired: true}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global.CONFIG.Common = tt.common
+			if got := recordingInput(); got != tt.want {
+				t.Errorf("recordingInput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordingRequired(t *testing.T) {
+	saved := global.CONFIG.Common
+	t.Cleanup(func() { global.CONFIG.Common = saved })
+
+	tests := []struct {
+		name   string
+		common *configs.CommonConfig
+		want   bool
+	}{
+		{name: "no common config", common: nil, want: false},
+		{name: "default", common: &configs.CommonConfig{}, want: false},
+		{name: "required", common: &configs.CommonConfig{RecordingRequired: true}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			global.CONFIG.Common = tt.common
+			if got := recordingRequired(); got != tt.want {
+				t.Errorf("recordingRequired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
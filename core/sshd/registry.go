@@ -0,0 +1,280 @@
+package sshd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"binrc.com/roma/core/model"
+	"github.com/loganchef/ssh"
+)
+
+// ErrSessionNotFound 活动会话不存在
+var ErrSessionNotFound = errors.New("session not found")
+
+// shadowBufferSize 每个旁观者的缓冲块数，旁观者读取过慢时丢弃输出而不是阻塞原会话
+const shadowBufferSize = 256
+
+// 活动会话类型：所有绑定到资源的通道都登记到活动会话表，可以被列出、强制结束，并随临时授权收回
+const (
+	SessionTypeTerminal = "terminal" // 交互式终端
+	SessionTypeTunnel   = "tunnel"   // 端口转发（ssh -L / -J）
+	SessionTypeSFTP     = "sftp"     // SFTP 中到某台主机的连接
+	SessionTypeSCP      = "scp"      // SCP 传输
+	SessionTypeDatabase = "database" // 数据库 CLI
+	SessionTypeCommand  = "command"  // 非交互式命令（ssh 命令执行、MCP run_command）
+)
+
+// ActiveSessionInfo 活动会话快照，用于接口和 TUI 展示
+type ActiveSessionInfo struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	Username     string    `json:"username"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   uint      `json:"resource_id"`
+	ResourceName string    `json:"resource_name"`
+	Host         string    `json:"host"`
+	ClientIP     string    `json:"client_ip"`
+	StartedAt    time.Time `json:"started_at"`
+	BytesIn      int64     `json:"bytes_in"`
+	BytesOut     int64     `json:"bytes_out"`
+	Shadows      int       `json:"shadows"`
+}
+
+// LiveSession 一个正在代理中的会话
+type LiveSession struct {
+	info     ActiveSessionInfo
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	kill func(msg string) // 通知客户端（可选）并断开会话
+
+	mu      sync.Mutex
+	shadows map[chan []byte]struct{}
+	closed  bool
+}
+
+var activeSessions = struct {
+	sync.RWMutex
+	m map[string]*LiveSession
+}{m: make(map[string]*LiveSession)}
+
+// registerLiveSession 将终端会话登记到活动会话表
+// 输入: sess - 客户端会话；host/port - 上游地址；upstream - 关闭后即可断开上游的连接
+// 输出: *LiveSession - 登记后的会话，结束时需调用 unregister
+func registerLiveSession(sess ssh.Session, host string, port int, upstream io.Closer) *LiveSession {
+	info := ActiveSessionInfo{
+		Type:     SessionTypeTerminal,
+		Username: sess.User(),
+		Host:     fmt.Sprintf("%s:%d", host, port),
+		ClientIP: GetClientIP(sess),
+	}
+	if res := GetSessionResource(sess); res != nil {
+		info.ResourceType = res.Type
+		info.ResourceID = res.ID
+		info.ResourceName = res.Name
+	}
+	return RegisterSession(info, func(msg string) {
+		fmt.Fprintf(sess, "\r\n%s\r\n", msg)
+		if upstream != nil {
+			upstream.Close()
+		}
+		sess.Close()
+	})
+}
+
+// RegisterSession 将会话登记到活动会话表，ID 和开始时间自动生成
+// 输入: info - 会话信息，需填写类型、用户、来源和目标资源；kill - 强制结束会话，msg 为给客户端的提示
+// 输出: *LiveSession - 登记后的会话，结束时需调用 Unregister
+// 必要性: 端口转发、文件传输和非交互式命令与终端一样需要能被管理员结束、随临时授权收回
+func RegisterSession(info ActiveSessionInfo, kill func(msg string)) *LiveSession {
+	info.ID = newLiveSessionID()
+	info.StartedAt = time.Now()
+	ls := &LiveSession{
+		info:    info,
+		kill:    kill,
+		shadows: make(map[chan []byte]struct{}),
+	}
+
+	activeSessions.Lock()
+	activeSessions.m[ls.info.ID] = ls
+	activeSessions.Unlock()
+	return ls
+}
+
+// NewSessionInfo 根据 SSH 会话或连接上下文构造会话信息
+// 输入: subject - ssh.Session 或 ssh.Context；sessionType - 会话类型；resource/resourceType - 目标资源；host - 上游地址
+func NewSessionInfo(subject auditSubject, sessionType string, resource model.Resource, resourceType, host string) ActiveSessionInfo {
+	info := ActiveSessionInfo{
+		Type:         sessionType,
+		Username:     subject.User(),
+		ClientIP:     GetClientIP(subject),
+		ResourceType: resourceType,
+		Host:         host,
+	}
+	if resource != nil {
+		if id := resource.GetID(); id > 0 {
+			info.ResourceID = uint(id)
+		}
+		info.ResourceName = resource.GetName()
+	}
+	return info
+}
+
+func newLiveSessionID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Unregister 会话结束时从活动会话表移除，并断开所有旁观者
+func (ls *LiveSession) Unregister() {
+	activeSessions.Lock()
+	delete(activeSessions.m, ls.info.ID)
+	activeSessions.Unlock()
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.closed = true
+	for ch := range ls.shadows {
+		close(ch)
+		delete(ls.shadows, ch)
+	}
+}
+
+// Info 返回会话当前快照
+func (ls *LiveSession) Info() ActiveSessionInfo {
+	info := ls.info
+	info.BytesIn = ls.bytesIn.Load()
+	info.BytesOut = ls.bytesOut.Load()
+	ls.mu.Lock()
+	info.Shadows = len(ls.shadows)
+	ls.mu.Unlock()
+	return info
+}
+
+// Watchable 会话是否有可以旁观的终端输出
+func (ls *LiveSession) Watchable() bool {
+	return ls.info.Type == SessionTypeTerminal
+}
+
+// Shadow 以只读方式订阅会话输出
+// 输出: <-chan []byte - 输出流，会话结束时关闭；func() - 取消订阅
+func (ls *LiveSession) Shadow() (<-chan []byte, func()) {
+	ch := make(chan []byte, shadowBufferSize)
+	ls.mu.Lock()
+	if ls.closed {
+		close(ch)
+		ls.mu.Unlock()
+		return ch, func() {}
+	}
+	ls.shadows[ch] = struct{}{}
+	ls.mu.Unlock()
+
+	return ch, func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		if _, ok := ls.shadows[ch]; ok {
+			delete(ls.shadows, ch)
+			close(ch)
+		}
+	}
+}
+
+// Kill 强制结束会话：通知客户端后同时关闭上游和客户端通道
+func (ls *LiveSession) Kill(reason string) {
+	msg := "[!] Session terminated by administrator"
+	if reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, reason)
+	}
+	if ls.kill != nil {
+		ls.kill(msg)
+	}
+}
+
+// Write 记录上游输出并分发给旁观者，实现 io.Writer
+func (ls *LiveSession) Write(p []byte) (int, error) {
+	ls.bytesOut.Add(int64(len(p)))
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if len(ls.shadows) == 0 {
+		return len(p), nil
+	}
+	chunk := append([]byte(nil), p...)
+	for ch := range ls.shadows {
+		select {
+		case ch <- chunk:
+		default:
+			// 旁观者消费过慢，丢弃本块，避免拖慢原会话
+		}
+	}
+	return len(p), nil
+}
+
+// countingReader 统计客户端输入字节数
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// inputReader 包装客户端输入以统计流量
+func (ls *LiveSession) inputReader(r io.Reader) io.Reader {
+	return countingReader{r: r, n: &ls.bytesIn}
+}
+
+// ListActiveSessions 列出所有活动会话，按开始时间排序
+func ListActiveSessions() []ActiveSessionInfo {
+	activeSessions.RLock()
+	list := make([]*LiveSession, 0, len(activeSessions.m))
+	for _, ls := range activeSessions.m {
+		list = append(list, ls)
+	}
+	activeSessions.RUnlock()
+
+	result := make([]ActiveSessionInfo, 0, len(list))
+	for _, ls := range list {
+		result = append(result, ls.Info())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+// GetActiveSession 根据ID获取活动会话
+func GetActiveSession(id string) (*LiveSession, error) {
+	activeSessions.RLock()
+	defer activeSessions.RUnlock()
+	ls, ok := activeSessions.m[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return ls, nil
+}
+
+// KillActiveSession 根据ID强制结束活动会话
+// 输出: ActiveSessionInfo - 被结束会话的快照（用于审计）；error - 会话不存在
+func KillActiveSession(id string, reason string) (ActiveSessionInfo, error) {
+	ls, err := GetActiveSession(id)
+	if err != nil {
+		return ActiveSessionInfo{}, err
+	}
+	info := ls.Info()
+	ls.Kill(reason)
+	return info, nil
+}
@@ -0,0 +1,55 @@
+package sshd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegisterSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       string
+		reason    string
+		wantMsg   string
+		watchable bool
+	}{
+		{name: "terminal", typ: SessionTypeTerminal, reason: "maintenance", wantMsg: "[!] Session terminated by administrator: maintenance", watchable: true},
+		{name: "tunnel", typ: SessionTypeTunnel, wantMsg: "[!] Session terminated by administrator"},
+		{name: "sftp", typ: SessionTypeSFTP, reason: "grant ended", wantMsg: "[!] Session terminated by administrator: grant ended"},
+		{name: "command", typ: SessionTypeCommand, wantMsg: "[!] Session terminated by administrator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			live := RegisterSession(ActiveSessionInfo{Type: tt.typ, Username: "alice", ResourceType: "linux", ResourceID: 1}, func(msg string) {
+				got = append(got, msg)
+			})
+			info := live.Info()
+			if info.ID == "" || info.StartedAt.IsZero() || info.Type != tt.typ {
+				t.Fatalf("info = %+v", info)
+			}
+			if live.Watchable() != tt.watchable {
+				t.Errorf("Watchable() = %v, want %v", live.Watchable(), tt.watchable)
+			}
+			listed := false
+			for _, s := range ListActiveSessions() {
+				listed = listed || s.ID == info.ID
+			}
+			if !listed {
+				t.Error("session not listed")
+			}
+
+			if _, err := KillActiveSession(info.ID, tt.reason); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != tt.wantMsg {
+				t.Errorf("kill messages = %q, want %q", got, tt.wantMsg)
+			}
+
+			live.Unregister()
+			if _, err := GetActiveSession(info.ID); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("GetActiveSession after Unregister err = %v", err)
+			}
+		})
+	}
+}
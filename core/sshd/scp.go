@@ -5,15 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"path"
 	"strconv"
 	"strings"
-	"time"
 
-	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/global"
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
-	"binrc.com/roma/core/utils"
 	"github.com/loganchef/ssh"
 	gossh "golang.org/x/crypto/ssh"
 )
@@ -80,268 +78,485 @@ func (r *response) GetMessage() string {
 	return r.Message
 }
 
-// ExecuteSCP ExecuteSCP
-func ExecuteSCP(args []string, clientSess *ssh.Session) error {
-	flag := args[0]
-	switch flag {
-	case "-t":
-		err := copyToServer(args, clientSess)
-		if err != nil {
-			replyErr(*clientSess, err)
-			return err
+// scpOptions 客户端 scp 发送到服务端的参数（scp -t/-f [-r] [-p] [-d] path）
+type scpOptions struct {
+	sink      bool   // -t：客户端上传，本端作为接收方；否则为 -f 下载
+	recursive bool   // -r：递归传输目录
+	preserve  bool   // -p：保留修改/访问时间
+	targetDir bool   // -d：目标必须是目录
+	path      string // user@hostname:/remote/path
+}
+
+// parseSCPArgs 解析 scp 服务端参数，支持合并写法（如 -rt）和 -- 结束符
+func parseSCPArgs(args []string) (*scpOptions, error) {
+	opts := &scpOptions{}
+	modeSet := false
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" {
+			continue
+		}
+		if arg == "--" {
+			i++
+			break
 		}
-	case "-f":
-		err := copyFromServer(args, clientSess)
-		if err != nil {
-			replyErr(*clientSess, err)
-			return err
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 't':
+				opts.sink, modeSet = true, true
+			case 'f':
+				opts.sink, modeSet = false, true
+			case 'r':
+				opts.recursive = true
+			case 'p':
+				opts.preserve = true
+			case 'd':
+				opts.targetDir = true
+			case 'v', 'q':
+				// 客户端的调试/静默参数，与代理无关
+			default:
+				return nil, fmt.Errorf("unsupported scp option: -%c", c)
+			}
 		}
-		(*clientSess).Close()
-	default:
-		return errors.New("This feature is not currently supported")
 	}
+	if !modeSet {
+		return nil, errors.New("This feature is not currently supported")
+	}
+	// ParseRawCommand 按空格拆分，路径中的空格需要拼回去
+	opts.path = strings.Join(args[i:], " ")
+	if opts.path == "" {
+		return nil, errors.New("missing scp target path")
+	}
+	return opts, nil
+}
 
-	return nil
+// upstreamCommand 构造在上游执行的 scp 命令，透传 -r/-p/-d
+// 路径来自客户端，按单引号转义后交给上游 shell，不做通配符展开；含控制字符的路径直接拒绝
+func (o *scpOptions) upstreamCommand(remotePath string) (string, error) {
+	for _, r := range remotePath {
+		if r < 0x20 || r == 0x7f {
+			return "", fmt.Errorf("invalid scp path: %q", remotePath)
+		}
+	}
+	if remotePath == "" {
+		remotePath = "."
+	}
+	quoted := shellQuote(remotePath)
+	if strings.HasPrefix(remotePath, "-") {
+		quoted = "-- " + quoted
+	}
+
+	cmd := "scp"
+	if o.recursive {
+		cmd += " -r"
+	}
+	if o.preserve {
+		cmd += " -p"
+	}
+	if o.targetDir {
+		cmd += " -d"
+	}
+	if o.sink {
+		return fmt.Sprintf("%s -t %s", cmd, quoted), nil
+	}
+	return fmt.Sprintf("%s -f %s", cmd, quoted), nil
 }
 
-func copyToServer(args []string, clientSess *ssh.Session) error {
-	err := replyOk(*clientSess)
+// shellQuote 用单引号包裹参数，参数中的单引号先结束引号、转义后再重新开始引号
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ExecuteSCP ExecuteSCP
+func ExecuteSCP(args []string, clientSess *ssh.Session) error {
+	opts, err := parseSCPArgs(args)
 	if err != nil {
 		return err
 	}
+	// scp file user+web-01@roma:/tmp/ 时路径中没有目标资源，补全为 user@web-01:/tmp/
+	if target := LoginTarget(*clientSess); target != "" {
+		opts.path = (*clientSess).User() + "@" + target + ":" + opts.path
+	}
 
-	bufferedReader := bufio.NewReader(*clientSess)
-	b, err := bufferedReader.ReadByte()
+	if opts.sink {
+		err = copyToServer(opts, clientSess)
+	} else {
+		err = copyFromServer(opts, clientSess)
+	}
 	if err != nil {
+		replyErr(*clientSess, err)
 		return err
 	}
-
-	flag := string(b)
-	switch flag {
-	case flagCopyFile:
-		var perm string
-		var size int64
-		var filename string
-		n, err := fmt.Fscanf(bufferedReader, "%s %d %s\n", &perm, &size, &filename)
-
-		if err != nil {
-			return err
-		}
-		if n != 3 {
-			return fmt.Errorf("unexpected count in reading start directory message header: n=%d", 3)
-		}
-
-		err = copyFileToServer(bufferedReader, size, filename, args[1], perm, clientSess)
-		if err != nil {
-			return err
-		}
-		return nil
-	case flagEndDirectory:
-	case flagStartDirectory:
-		return errors.New("Folder transfer is not yet supported. You can try to compress the folder and upload it. ")
-	default:
-		return fmt.Errorf("expected control record")
+	if !opts.sink {
+		(*clientSess).Close()
 	}
-
 	return nil
 }
 
-func copyFromServer(args []string, clientSess *ssh.Session) error {
-	resource, resourceType, filePath, err := parseResourcePath(args[1], (*clientSess).User())
+// scpRelay 一次 SCP 传输的上下文：客户端会话、上游 scp 进程以及当前目录层级
+type scpRelay struct {
+	clientSess   ssh.Session
+	clientIn     *bufio.Reader
+	clientOut    io.Writer
+	upstreamIn   io.WriteCloser
+	upstreamOut  *bufio.Reader
+	upstreamSess *gossh.Session
+	upstream     *gossh.Client
+	live         *LiveSession
+
+	resource     model.Resource
+	resourceType string
+	remotePath   string
+	dirs         []string // 递归传输时当前所在的目录层级
+	transferred  int64    // 已转发的文件字节数（用于 scp_max_size 限制）
+}
+
+// newSCPRelay 解析目标资源、检查权限并在上游启动 scp
+func newSCPRelay(opts *scpOptions, clientSess *ssh.Session) (*scpRelay, error) {
+	resource, resourceType, remotePath, err := parseResourcePath(opts.path, (*clientSess).User(), GetClientIP(*clientSess))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	relay := &scpRelay{
+		clientSess:   *clientSess,
+		clientIn:     bufio.NewReader(*clientSess),
+		clientOut:    *clientSess,
+		resource:     resource,
+		resourceType: resourceType,
+		remotePath:   remotePath,
 	}
 
-	// 获取凭证
-	passportOp := operation.NewPassportOperation()
-	passports, err := passportOp.GetPassportByType(resourceType)
-	if err != nil || len(passports) == 0 {
-		return fmt.Errorf("no passport found for resource type: %s", resourceType)
+	command, err := opts.upstreamCommand(remotePath)
+	if err != nil {
+		relay.audit(opts, "", 0, err)
+		return nil, err
 	}
 
-	// 获取资源连接信息
-	var ip string
-	var port int
+	// 使用资源自身的凭证，并发尝试资源的所有 SSH 地址
+	upstream, err := dialTransferResource(*clientSess, resource, resourceType)
+	if err != nil {
+		relay.audit(opts, "", 0, err)
+		return nil, err
+	}
+	upstreamSess, err := upstream.NewSession()
+	if err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	stdin, err := upstreamSess.StdinPipe()
+	if err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	stdout, err := upstreamSess.StdoutPipe()
+	if err != nil {
+		upstream.Close()
+		return nil, err
+	}
+	if err := upstreamSess.Start(command); err != nil {
+		upstream.Close()
+		relay.audit(opts, "", 0, err)
+		return nil, err
+	}
 
-	switch r := resource.(type) {
-	case *model.LinuxConfig:
-		ip = r.IPv4Priv
-		if ip == "" {
-			ip = r.IPv4Pub
-		}
-		port = r.Port
-		if port == 0 {
-			port = 22
-		}
-	case *model.WindowsConfig:
-		ip = r.IPv4Priv
-		if ip == "" {
-			ip = r.IPv4Pub
-		}
-		port = r.Port
-		if port == 0 {
-			port = 22
-		}
+	// 客户端断开（取消传输）时立即断开上游，避免阻塞在读写上
+	go func() {
+		<-(*clientSess).Context().Done()
+		upstream.Close()
+	}()
+
+	relay.upstream = upstream
+	relay.upstreamSess = upstreamSess
+	relay.upstreamIn = stdin
+	relay.upstreamOut = bufio.NewReader(stdout)
+	relay.live = RegisterSession(NewSessionInfo(*clientSess, SessionTypeSCP, resource, resourceType, upstream.RemoteAddr().String()), func(string) {
+		// SCP 协议中不能插入提示文字，直接断开
+		upstream.Close()
+		(*clientSess).Close()
+	})
+	return relay, nil
+}
+
+// close 结束上游 scp 并断开连接
+func (r *scpRelay) close() {
+	r.live.Unregister()
+	r.upstreamIn.Close()
+	r.upstreamSess.Wait()
+	r.upstream.Close()
+}
+
+// relPath 当前目录层级下的相对路径（用于审计）
+func (r *scpRelay) relPath(name string) string {
+	return path.Join(append(append([]string{}, r.dirs...), name)...)
+}
+
+// audit 记录单个文件的传输审计（name 为空时表示整个传输失败）
+func (r *scpRelay) audit(opts *scpOptions, name string, size int64, err error) {
+	action, verb := "scp_download", "下载"
+	if opts.sink {
+		action, verb = "scp_upload", "上传"
+	}
+	var description string
+	switch {
+	case name == "":
+		description = fmt.Sprintf("SCP %s: %s %s", r.resource.GetName(), verb, r.remotePath)
+	case opts.sink:
+		description = fmt.Sprintf("SCP %s: 上传 %s 到 %s (%d bytes)", r.resource.GetName(), r.relPath(name), r.remotePath, size)
 	default:
-		return fmt.Errorf("unsupported resource type: %T", resource)
+		description = fmt.Sprintf("SCP %s: 下载 %s (%d bytes)", r.resource.GetName(), path.Join(path.Dir(path.Clean(r.remotePath)), r.relPath(name)), size)
 	}
+	recordTransferAudit(r.clientSess, r.resource, r.resourceType, action, description, err)
+}
 
-	upstream, err := NewSSHClient(ip, port, passports[0].ServiceUser, passports[0].Passport, resourceType)
+// scpRecord 控制记录：C（文件）、D（进入目录）、E（退出目录）、T（时间戳）
+type scpRecord struct {
+	kind byte
+	line string // 完整的记录行（含类型字符和换行）
+	perm string
+	size int64
+	name string
+}
+
+// readSCPRecord 读取一条控制记录；遇到 0x01/0x02 时返回对端发送的错误信息
+func readSCPRecord(r *bufio.Reader) (*scpRecord, error) {
+	kind, err := r.ReadByte()
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	upstreamSess, err := upstream.NewSession()
+	line, err := r.ReadString('\n')
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	errCh := make(chan error, 2)
-	defer func() {
-		select {
-		case <-errCh:
-			return
-		default:
+	switch kind {
+	case responseError, responseFailError:
+		return &scpRecord{kind: kind, line: string(kind) + line}, nil
+	case flagCopyFile[0], flagStartDirectory[0]:
+		// 格式: C0644 1234 filename / D0755 0 dirname
+		fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid scp record: %q", string(kind)+line)
 		}
-		close(errCh)
-	}()
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid scp record size: %q", fields[1])
+		}
+		name := fields[2]
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid scp file name: %q", name)
+		}
+		return &scpRecord{kind: kind, line: string(kind) + line, perm: fields[0], size: size, name: name}, nil
+	case flagEndDirectory[0], flagTime[0]:
+		return &scpRecord{kind: kind, line: string(kind) + line}, nil
+	default:
+		return nil, fmt.Errorf("expected control record")
+	}
+}
 
-	stdout, err := upstreamSess.StdoutPipe()
+// copyToServer 上传：客户端为发送方，按记录转发给上游 scp -t
+func copyToServer(opts *scpOptions, clientSess *ssh.Session) error {
+	relay, err := newSCPRelay(opts, clientSess)
 	if err != nil {
 		return err
 	}
+	defer relay.close()
+	return relay.upload(opts)
+}
 
-	stdin, err := upstreamSess.StdinPipe()
-	if err != nil {
+// upload 上传方向的记录转发
+func (r *scpRelay) upload(opts *scpOptions) error {
+	// 上游接收方就绪后再通知客户端开始发送
+	if err := checkResponse(r.upstreamOut); err != nil {
+		r.audit(opts, "", 0, err)
 		return err
 	}
-
-	err = upstreamSess.Start(fmt.Sprintf("scp -f %s", filePath))
-	if err != nil {
+	if err := replyOk(r.clientOut); err != nil {
 		return err
 	}
-	go func() {
-		defer stdin.Close()
 
-		err := replyOk(stdin)
-		if err != nil {
-			errCh <- err
-			return
+	for {
+		record, err := readSCPRecord(r.clientIn)
+		if errors.Is(err, io.EOF) {
+			return nil
 		}
-
-		stdOutReader := bufio.NewReader(stdout)
-		b, err := stdOutReader.ReadByte()
 		if err != nil {
-			errCh <- err
-			return
+			return err
 		}
 
-		if b == responseError {
-			message, err := stdOutReader.ReadString('\n')
-			if err != nil {
-				errCh <- err
-				return
+		// 发送方的警告/错误原样转给上游
+		if record.kind == responseError || record.kind == responseFailError {
+			if _, err := io.WriteString(r.upstreamIn, record.line); err != nil {
+				return err
 			}
-			errCh <- errors.New(message)
-			return
+			if record.kind == responseFailError {
+				return errors.New(strings.TrimSpace(record.line[1:]))
+			}
+			continue
 		}
 
-		flag := string(b)
-		switch flag {
-		case flagCopyFile:
-			var perm string
-			var size int64
-			var filename string
-			n, err := fmt.Fscanf(stdOutReader, "%s %d %s\n", &perm, &size, &filename)
-			if err != nil {
-				errCh <- err
-				return
+		if record.kind == flagCopyFile[0] {
+			if err := r.reserve(record.size); err != nil {
+				r.audit(opts, record.name, record.size, err)
+				return err
 			}
-			if n != 3 {
-				errCh <- fmt.Errorf("unexpected count in reading start directory message header: n=%d", 3)
+		}
+
+		if _, err := io.WriteString(r.upstreamIn, record.line); err != nil {
+			return err
+		}
+		if err := checkResponse(r.upstreamOut); err != nil {
+			if record.kind == flagCopyFile[0] {
+				r.audit(opts, record.name, record.size, err)
 			}
-			err = replyOk(stdin)
-			if err != nil {
-				errCh <- err
-				return
+			return err
+		}
+		if err := replyOk(r.clientOut); err != nil {
+			return err
+		}
+
+		switch record.kind {
+		case flagStartDirectory[0]:
+			r.dirs = append(r.dirs, record.name)
+		case flagEndDirectory[0]:
+			if len(r.dirs) > 0 {
+				r.dirs = r.dirs[:len(r.dirs)-1]
 			}
-			err = copyFileFromServer(stdOutReader, size, filename, perm, clientSess)
+		case flagCopyFile[0]:
+			err := r.forwardFile(record, r.clientIn, r.upstreamIn, r.upstreamOut, r.clientOut)
+			r.audit(opts, record.name, record.size, err)
 			if err != nil {
-				errCh <- err
-				return
+				return err
 			}
-			return
-		case flagEndDirectory:
-		case flagStartDirectory:
-			errCh <- errors.New("Folder transfer is not yet supported. You can try to compress the folder and upload it. ")
-			return
-		default:
-			errCh <- fmt.Errorf("expected control record")
-			return
 		}
+	}
+}
 
-	}()
+// copyFromServer 下载：上游 scp -f 为发送方，按记录转发给客户端
+func copyFromServer(opts *scpOptions, clientSess *ssh.Session) error {
+	relay, err := newSCPRelay(opts, clientSess)
+	if err != nil {
+		return err
+	}
+	defer relay.close()
+	return relay.download(opts)
+}
 
-	upstreamSess.Wait()
+// download 下载方向的记录转发
+func (r *scpRelay) download(opts *scpOptions) error {
+	// 客户端接收方就绪后再通知上游开始发送
+	if err := checkResponse(r.clientIn); err != nil {
+		return err
+	}
+	if err := replyOk(r.upstreamIn); err != nil {
+		return err
+	}
 
-	close(errCh)
-	for err := range errCh {
+	for {
+		record, err := readSCPRecord(r.upstreamOut)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
 		if err != nil {
+			r.audit(opts, "", 0, err)
 			return err
 		}
-	}
 
-	return nil
-}
+		// 上游的警告/错误（如文件不存在）原样转给客户端，由上游决定是否继续
+		if record.kind == responseError || record.kind == responseFailError {
+			if _, err := io.WriteString(r.clientOut, record.line); err != nil {
+				return err
+			}
+			r.audit(opts, "", 0, errors.New(strings.TrimSpace(record.line[1:])))
+			continue
+		}
 
-func copyFileFromServer(bfReader *bufio.Reader, size int64, filename string, perm string, clientSess *ssh.Session) error {
-	tmpFilePath, tmp, err := createTmpFile(bfReader, perm, size)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		tmp.Close()
-		if utils.FileExited(tmpFilePath) {
-			os.Remove(tmpFilePath)
+		if record.kind == flagCopyFile[0] {
+			if err := r.reserve(record.size); err != nil {
+				replyErr(r.upstreamIn, err)
+				r.audit(opts, record.name, record.size, err)
+				return err
+			}
 		}
-	}()
 
-	tmpReader := bufio.NewReader(tmp)
-	err = copyToClientSession(tmpReader, clientSess, perm, filename, size)
-	if err != nil {
-		return err
-	}
+		if _, err := io.WriteString(r.clientOut, record.line); err != nil {
+			return err
+		}
+		if err := checkResponse(r.clientIn); err != nil {
+			replyErr(r.upstreamIn, err)
+			if record.kind == flagCopyFile[0] {
+				r.audit(opts, record.name, record.size, err)
+			}
+			return err
+		}
+		if err := replyOk(r.upstreamIn); err != nil {
+			return err
+		}
 
-	return nil
+		switch record.kind {
+		case flagStartDirectory[0]:
+			r.dirs = append(r.dirs, record.name)
+		case flagEndDirectory[0]:
+			if len(r.dirs) > 0 {
+				r.dirs = r.dirs[:len(r.dirs)-1]
+			}
+		case flagCopyFile[0]:
+			err := r.forwardFile(record, r.upstreamOut, r.clientOut, r.clientIn, r.upstreamIn)
+			r.audit(opts, record.name, record.size, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
 }
 
-func copyToClientSession(tmpReader *bufio.Reader, clientSess *ssh.Session, perm, filename string, size int64) error {
-	if err := checkResponse(*clientSess); err != nil {
+// forwardFile 流式转发 C 记录之后的文件内容，不在本机落盘
+// 输入: src - 发送方数据流；dst - 接收方；dstAck - 接收方的确认流；srcAck - 回复发送方
+// 两端都是 SSH 通道，接收方读取变慢时写入会阻塞，从而对发送方形成背压
+func (r *scpRelay) forwardFile(record *scpRecord, src *bufio.Reader, dst io.Writer, dstAck *bufio.Reader, srcAck io.Writer) error {
+	if _, err := io.CopyN(dst, src, record.size); err != nil {
 		return err
 	}
 
-	_, err := fmt.Fprintln(*clientSess, flagCopyFile+perm, size, filename)
-	if err != nil {
+	// 文件内容之后是发送方的状态字节：0 表示成功，否则后跟错误信息
+	if err := checkResponse(src); err != nil {
+		replyErr(dst, err)
 		return err
 	}
-
-	if err := checkResponse(*clientSess); err != nil {
+	if err := replyOk(dst); err != nil {
 		return err
 	}
-
-	io.Copy(*clientSess, tmpReader)
-
-	_, err = fmt.Fprint(*clientSess, "\x00")
-	if err != nil {
+	if err := checkResponse(dstAck); err != nil {
+		replyErr(srcAck, err)
 		return err
 	}
+	return replyOk(srcAck)
+}
 
+// reserve 检查本次传输累计大小是否超过 scp_max_size
+func (r *scpRelay) reserve(size int64) error {
+	maxSize := scpMaxSize()
+	if maxSize > 0 && r.transferred+size > maxSize {
+		return fmt.Errorf("transfer size limit exceeded: %d bytes allowed", maxSize)
+	}
+	r.transferred += size
 	return nil
 }
 
+// scpMaxSize 单次 SCP 传输允许的最大字节数，0 表示不限制
+func scpMaxSize() int64 {
+	if global.CONFIG == nil || global.CONFIG.Common == nil {
+		return 0
+	}
+	return global.CONFIG.Common.ScpMaxSize
+}
+
 // parseResourcePath 解析 SCP 路径格式: user@hostname:/remote/path
 // 返回资源配置、远程路径和错误
-func parseResourcePath(fullPath, currentUsername string) (model.Resource, string, string, error) {
+func parseResourcePath(fullPath, currentUsername, clientIP string) (model.Resource, string, string, error) {
 	// 解析格式: user@hostname:/remote/path
 	args := strings.SplitN(fullPath, ":", 2)
 	invalidPathErr := errors.New(
@@ -360,37 +575,24 @@ func parseResourcePath(fullPath, currentUsername string) (model.Resource, string
 
 	_, hostname := serverArgs[0], serverArgs[1] // serviceUser 暂时未使用，未来可用于权限检查
 
-	// 从数据库查找资源（先尝试 Linux）
+	// 从数据库查找资源，同名时按 transferResourceTypes 顺序优先（与 SFTP 一致）
 	resourceOp := operation.NewResourceOperation()
-
-	// 尝试 Linux 资源
 	var resource model.Resource
 	var resourceType string
-
-	linuxResource := &model.LinuxConfig{}
-	err := resourceOp.DB.Where("hostname = ?", hostname).First(linuxResource).Error
-	if err == nil {
-		resource = linuxResource
-		resourceType = constants.ResourceTypeLinux
-	} else {
-		// 尝试 Windows 资源
-		windowsResource := &model.WindowsConfig{}
-		err = resourceOp.DB.Where("hostname = ?", hostname).First(windowsResource).Error
-		if err == nil {
-			resource = windowsResource
-			resourceType = constants.ResourceTypeWindows
-		} else {
-			return nil, "", "", fmt.Errorf("resource not found: hostname '%s'", hostname)
+	for _, t := range transferResourceTypes {
+		if res, err := resourceOp.GetResourceByName(hostname, t); err == nil {
+			resource, resourceType = res, t
+			break
 		}
 	}
+	if resource == nil {
+		return nil, "", "", fmt.Errorf("resource not found: hostname '%s'", hostname)
+	}
 
-	// TODO: 检查用户权限
-	// userOp := operation.NewUserOperation()
-	// user, err := userOp.GetUserByUsername(currentUsername)
-	// if err != nil {
-	// 	return nil, "", "", fmt.Errorf("user not found: %s", currentUsername)
-	// }
-	// 检查用户是否有权限访问此资源...
+	// 检查用户是否有权限 use 此资源（与 SFTP 一致）
+	if err := checkTransferPermission(currentUsername, clientIP, resource, resourceType); err != nil {
+		return nil, "", "", err
+	}
 
 	return resource, resourceType, remotePath, nil
 }
@@ -409,216 +611,6 @@ func checkResponse(r io.Reader) error {
 
 }
 
-func copyFileToServer(bfReader *bufio.Reader, size int64, filename, filePath string, perm string, clientSess *ssh.Session) error {
-	resource, resourceType, remotePath, err := parseResourcePath(filePath, (*clientSess).User())
-	if err != nil {
-		return err
-	}
-	err = replyOk(*clientSess)
-	if err != nil {
-		return err
-	}
-
-	// 获取凭证
-	passportOp := operation.NewPassportOperation()
-	passports, err := passportOp.GetPassportByType(resourceType)
-	if err != nil || len(passports) == 0 {
-		return fmt.Errorf("no passport found for resource type: %s", resourceType)
-	}
-
-	// 获取资源连接信息
-	var ip string
-	var port int
-
-	switch r := resource.(type) {
-	case *model.LinuxConfig:
-		ip = r.IPv4Priv
-		if ip == "" {
-			ip = r.IPv4Pub
-		}
-		port = r.Port
-		if port == 0 {
-			port = 22
-		}
-		filePath = remotePath
-	case *model.WindowsConfig:
-		ip = r.IPv4Priv
-		if ip == "" {
-			ip = r.IPv4Pub
-		}
-		port = r.Port
-		if port == 0 {
-			port = 22
-		}
-		filePath = remotePath
-	default:
-		return fmt.Errorf("unsupported resource type: %T", resource)
-	}
-
-	upstream, err := NewSSHClient(ip, port, passports[0].ServiceUser, passports[0].Passport, resourceType)
-	if err != nil {
-		return err
-	}
-
-	upstreamSess, err := upstream.NewSession()
-	if err != nil {
-		return err
-	}
-
-	err = copyToUpstreamSession(bfReader, upstreamSess, perm, filePath, filename, size)
-	if err != nil {
-		return err
-	}
-
-	err = replyOk(*clientSess)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func copyToUpstreamSession(r *bufio.Reader, upstreamSess *gossh.Session, perm, filePath, filename string, size int64) error {
-	errCh := make(chan error, 2)
-	defer func() {
-		select {
-		case <-errCh:
-			return
-		default:
-		}
-		close(errCh)
-	}()
-	stdout, err := upstreamSess.StdoutPipe()
-	if err != nil {
-		return err
-	}
-
-	stdin, err := upstreamSess.StdinPipe()
-	if err != nil {
-		return err
-	}
-
-	err = upstreamSess.Start(fmt.Sprintf("scp -t %s", filePath))
-	if err != nil {
-		return err
-	}
-
-	go func() {
-		defer stdin.Close()
-
-		if err = checkResponse(stdout); err != nil {
-			errCh <- err
-			return
-		}
-
-		_, err = fmt.Fprintln(stdin, flagCopyFile+perm, size, filename)
-		if err != nil {
-			errCh <- err
-			return
-		}
-
-		if err = checkResponse(stdout); err != nil {
-			errCh <- err
-			return
-		}
-
-		// Create a temp file
-		tmpFilePath, tmp, err := createTmpFile(r, perm, size)
-		defer func() {
-			tmp.Close()
-			if utils.FileExited(tmpFilePath) {
-				os.Remove(tmpFilePath)
-			}
-		}()
-
-		if err != nil {
-			errCh <- err
-			return
-		}
-		defer func() {
-			tmp.Close()
-		}()
-
-		tmpReader := bufio.NewReader(tmp)
-		io.Copy(stdin, tmpReader)
-
-		_, err = fmt.Fprint(stdin, "\x00")
-		if err != nil {
-			errCh <- err
-			return
-		}
-
-		if err = checkResponse(stdout); err != nil {
-			errCh <- err
-			return
-		}
-	}()
-
-	upstreamSess.Wait()
-
-	close(errCh)
-	for err := range errCh {
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func createTmpFile(r *bufio.Reader, perm string, size int64) (string, *os.File, error) {
-	fileMode, err := strconv.ParseUint(perm, 8, 0)
-	if err != nil {
-		return "", nil, err
-	}
-
-	tmpFilePath := fmt.Sprintf("/tmp/roma-tmp-file-%d", time.Now().UnixNano())
-	f, err := os.OpenFile(tmpFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(fileMode))
-	if err != nil {
-		return "", nil, err
-	}
-
-	defer func() {
-		if err := f.Close(); err != nil {
-			panic(err)
-		}
-	}()
-
-	var off int64
-	buf := make([]byte, 2048)
-	for {
-		n, err := r.Read(buf)
-		buffSize := int64(n)
-
-		if err != nil && err != io.EOF {
-			return "", nil, err
-		}
-
-		if off+buffSize > size && buf[n-1] == '\x00' {
-			_, err := f.WriteAt(buf[:n-1], off)
-			if err != nil {
-				return "", nil, err
-			}
-			break
-		} else if off+buffSize > size && buf[n-1] != '\x00' {
-			return "", nil, errors.New("File size not match. ")
-		}
-
-		_, err = f.WriteAt(buf, off)
-		if err != nil {
-			return "", nil, err
-		}
-		off = off + buffSize
-	}
-
-	tmp, err := os.Open(tmpFilePath)
-	if err != nil {
-		return tmpFilePath, nil, err
-	}
-
-	return "", tmp, nil
-}
-
 func replyOk(w io.Writer) error {
 	bufferedWriter := bufio.NewWriter(w)
 	_, err := bufferedWriter.Write([]byte{responseOk})
@@ -0,0 +1,105 @@
+package sshd
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSCPArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    *scpOptions
+		wantErr bool
+	}{
+		{name: "upload", args: []string{"-t", "alice@web:/tmp/"}, want: &scpOptions{sink: true, path: "alice@web:/tmp/"}},
+		{name: "download", args: []string{"-f", "alice@web:/etc/hosts"}, want: &scpOptions{path: "alice@web:/etc/hosts"}},
+		{name: "combined flags", args: []string{"-rpt", "alice@web:/srv"}, want: &scpOptions{sink: true, recursive: true, preserve: true, path: "alice@web:/srv"}},
+		{name: "target dir", args: []string{"-v", "-d", "-t", "--", "alice@web:/srv"}, want: &scpOptions{sink: true, targetDir: true, path: "alice@web:/srv"}},
+		{name: "path with spaces", args: []string{"-f", "alice@web:/tmp/a", "b.txt"}, want: &scpOptions{path: "alice@web:/tmp/a b.txt"}},
+		{name: "empty args skipped", args: []string{"", "-t", "", "alice@web:/tmp"}, want: &scpOptions{sink: true, path: "alice@web:/tmp"}},
+		{name: "no mode", args: []string{"-r", "alice@web:/tmp"}, wantErr: true},
+		{name: "unknown option", args: []string{"-tx", "alice@web:/tmp"}, wantErr: true},
+		{name: "missing path", args: []string{"-t"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSCPArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSCPArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSCPArgs(%q) = %+v, want %+v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSCPUpstreamCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    scpOptions
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "upload", opts: scpOptions{sink: true}, path: "/tmp/", want: "scp -t '/tmp/'"},
+		{name: "download with flags", opts: scpOptions{recursive: true, preserve: true}, path: "/srv/app", want: "scp -r -p -f '/srv/app'"},
+		{name: "target dir", opts: scpOptions{sink: true, targetDir: true}, path: "/srv", want: "scp -d -t '/srv'"},
+		{name: "home dir", opts: scpOptions{sink: true}, path: "", want: "scp -t '.'"},
+		{name: "spaces", opts: scpOptions{}, path: "/tmp/a b.txt", want: "scp -f '/tmp/a b.txt'"},
+		{name: "command substitution", opts: scpOptions{sink: true}, path: "/tmp/$(id);touch /tmp/pwned", want: "scp -t '/tmp/$(id);touch /tmp/pwned'"},
+		{name: "single quote", opts: scpOptions{}, path: "/tmp/x';id;'", want: `scp -f '/tmp/x'\'';id;'\'''`},
+		{name: "leading dash", opts: scpOptions{}, path: "-oProxyCommand=id", want: "scp -f -- '-oProxyCommand=id'"},
+		{name: "newline", opts: scpOptions{}, path: "/tmp/x\nid", wantErr: true},
+		{name: "nul", opts: scpOptions{sink: true}, path: "/tmp/x\x00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.upstreamCommand(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("upstreamCommand(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("upstreamCommand(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSCPRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *scpRecord
+		wantErr bool
+	}{
+		{name: "file", input: "C0644 1234 report.txt\n", want: &scpRecord{kind: 'C', line: "C0644 1234 report.txt\n", perm: "0644", size: 1234, name: "report.txt"}},
+		{name: "file name with spaces", input: "C0600 0 my file\n", want: &scpRecord{kind: 'C', line: "C0600 0 my file\n", perm: "0600", size: 0, name: "my file"}},
+		{name: "directory", input: "D0755 0 logs\n", want: &scpRecord{kind: 'D', line: "D0755 0 logs\n", perm: "0755", name: "logs"}},
+		{name: "end directory", input: "E\n", want: &scpRecord{kind: 'E', line: "E\n"}},
+		{name: "time", input: "T1700000000 0 1700000000 0\n", want: &scpRecord{kind: 'T', line: "T1700000000 0 1700000000 0\n"}},
+		{name: "warning", input: "\x01scp: /x: No such file\n", want: &scpRecord{kind: 1, line: "\x01scp: /x: No such file\n"}},
+		{name: "fatal", input: "\x02scp: fatal\n", want: &scpRecord{kind: 2, line: "\x02scp: fatal\n"}},
+		{name: "path traversal", input: "C0644 10 ../../etc/passwd\n", wantErr: true},
+		{name: "dot dot", input: "D0755 0 ..\n", wantErr: true},
+		{name: "negative size", input: "C0644 -1 a\n", wantErr: true},
+		{name: "bad size", input: "C0644 ten a\n", wantErr: true},
+		{name: "missing name", input: "C0644 10\n", wantErr: true},
+		{name: "unknown record", input: "X whatever\n", wantErr: true},
+		{name: "truncated", input: "C0644 10 a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSCPRecord(bufio.NewReader(strings.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readSCPRecord(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readSCPRecord(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,14 +4,19 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"binrc.com/roma/core/ldapauth"
+	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/usercert"
 	"binrc.com/roma/core/utils"
 	"binrc.com/roma/core/utils/logger"
 	"github.com/loganchef/ssh"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 // sshBlacklist SSH专用的黑名单（与API黑名单独立，避免循环导入）
@@ -307,45 +312,204 @@ func GetClientIP(ctx interface{}) string {
 	return host
 }
 
+// 公钥认证通过时记录在 Permissions.Extensions 中、认证完成后才执行的操作
+// PublicKeyCallback 也会处理客户端不带签名的公钥查询，回调中只做检查，不修改数据
+const (
+	extPublicKey     = "roma-public-key"     // 通过认证的公钥（wire 格式）
+	extSSHKeyID      = "roma-ssh-key-id"     // 需要更新最后使用时间的 user_ssh_keys 记录
+	extLDAPProvision = "roma-ldap-provision" // 需要按目录同步的 LDAP 用户
+)
+
+// ldapEntryContextKey 连接上下文中保存公钥认证时查询到的目录条目的键
+type ldapEntryContextKey struct{}
+
+// authCompletedContextKey 连接上下文中保存推迟操作执行结果的键
+type authCompletedContextKey struct{}
+
 // publicKeyAuth 公钥认证函数（内部使用，避免循环导入）
-// 输入: ctx - SSH上下文；key - 客户端提供的公钥
+// 输入: ctx - SSH上下文；key - 客户端提供的公钥；perms - 认证通过时返回给 ssh 库的权限，推迟的操作记录在其 Extensions 中
 // 输出: bool - 是否认证成功
 // 必要性: 这是公钥认证的核心逻辑，由SecurePublicKeyAuth包装后使用
-func publicKeyAuth(ctx ssh.Context, key ssh.PublicKey) bool {
-	username := ctx.User()
+func publicKeyAuth(ctx ssh.Context, key ssh.PublicKey, perms *gossh.Permissions) bool {
+	if perms.Extensions == nil {
+		perms.Extensions = make(map[string]string)
+	}
+	perms.Extensions[extPublicKey] = string(key.Marshal())
+
+	username := loginUser(ctx)
 	op := operation.NewUserOperation()
 	user, err := op.GetUserByUsername(username)
 	if err != nil {
+		// 尚未登录过的目录用户：用目录中的 sshPublicKey 认证，认证完成后再创建用户
+		if ldapauth.Enabled() {
+			if _, ok := key.(*gossh.Certificate); !ok {
+				return ldapPublicKeyMatches(ctx, username, key, perms)
+			}
+		}
 		log.Printf("PublicKeyAuth: 用户 %s 不存在: %v", username, err)
 		return false
 	}
 
-	// 如果用户没有设置公钥，拒绝认证
-	if user.PublicKey == "" {
-		log.Printf("PublicKeyAuth: 用户 %s 没有设置公钥", username)
-		return false
+	// 证书登录只信任配置的 CA，不再与用户的公钥比较
+	if cert, ok := key.(*gossh.Certificate); ok {
+		return userCertMatches(ctx, user, cert)
 	}
 
+	// 先比较用户资料中的公钥，再查找 user_ssh_keys 中的多把公钥
+	if legacyPublicKeyMatches(user, key) {
+		return true
+	}
+	if userSSHKeyMatches(ctx, user, key, perms) {
+		return true
+	}
+	if user.IsLDAP() && ldapauth.Enabled() && ldapPublicKeyMatches(ctx, username, key, perms) {
+		return true
+	}
+	log.Printf("PublicKeyAuth: 用户 %s 的公钥不匹配", username)
+	return false
+}
+
+// legacyPublicKeyMatches 比较用户资料中的单个公钥（users.public_key）
+func legacyPublicKeyMatches(user *model.User, key ssh.PublicKey) bool {
 	// 清理公钥字符串（去除前后空白和换行符）
 	pub := strings.TrimSpace(user.PublicKey)
 	if pub == "" {
-		log.Printf("PublicKeyAuth: 用户 %s 的公钥为空", username)
 		return false
 	}
 
 	// 解析数据库中存储的公钥
 	allowed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pub))
 	if err != nil {
-		log.Printf("PublicKeyAuth: 用户 %s 的公钥解析失败: %v, 公钥内容: %s", username, err, pub[:min(len(pub), 50)])
+		log.Printf("PublicKeyAuth: 用户 %s 的公钥解析失败: %v, 公钥内容: %s", user.Username, err, pub[:min(len(pub), 50)])
 		return false
 	}
 
 	// 比较客户端提供的公钥和数据库中存储的公钥
-	isEqual := ssh.KeysEqual(key, allowed)
-	if !isEqual {
-		log.Printf("PublicKeyAuth: 用户 %s 的公钥不匹配", username)
+	return ssh.KeysEqual(key, allowed)
+}
+
+// userSSHKeyMatches 按指纹查找用户的公钥，并检查过期时间和来源 IP 限制
+// 最后使用时间在认证完成后由 completeAuth 更新
+func userSSHKeyMatches(ctx ssh.Context, user *model.User, key ssh.PublicKey, perms *gossh.Permissions) bool {
+	op := operation.NewUserSSHKeyOperation()
+	userKey, err := op.GetUserSSHKeyByFingerprint(user.ID, gossh.FingerprintSHA256(key))
+	if err != nil || userKey == nil {
+		return false
 	}
-	return isEqual
+	if userKey.IsExpired(time.Now()) {
+		log.Printf("PublicKeyAuth: 用户 %s 的公钥 %s 已过期", user.Username, userKey.Label)
+		return false
+	}
+	ip := GetClientIP(ctx)
+	if !userKey.AllowsIP(ip) {
+		log.Printf("PublicKeyAuth: 用户 %s 的公钥 %s 不允许从 %s 登录", user.Username, userKey.Label, ip)
+		return false
+	}
+	perms.Extensions[extSSHKeyID] = strconv.FormatUint(uint64(userKey.ID), 10)
+	return true
+}
+
+// ldapPublicKeyMatches 实时查询目录中的 sshPublicKey；匹配且组映射出角色时通过，用户和角色在认证完成后由 completeAuth 同步
+func ldapPublicKeyMatches(ctx ssh.Context, username string, key ssh.PublicKey, perms *gossh.Permissions) bool {
+	entry, err := ldapauth.Lookup(username)
+	if err != nil {
+		log.Printf("PublicKeyAuth: LDAP 查询用户 %s 失败: %v", username, err)
+		return false
+	}
+	if !entry.HasPublicKey(key) {
+		return false
+	}
+	if len(ldapauth.MappedRoles(entry)) == 0 {
+		log.Printf("PublicKeyAuth: LDAP 用户 %s 没有映射的角色", username)
+		return false
+	}
+	ctx.SetValue(ldapEntryContextKey{}, entry)
+	perms.Extensions[extLDAPProvision] = username
+	return true
+}
+
+// pendingLDAPEntry 公钥认证时查询到、尚未同步的目录条目
+func pendingLDAPEntry(ctx ssh.Context) *ldapauth.Entry {
+	entry, _ := ctx.Value(ldapEntryContextKey{}).(*ldapauth.Entry)
+	return entry
+}
+
+// completeAuth 执行公钥认证时推迟的操作：更新公钥的最后使用时间、同步 LDAP 用户
+// 只在握手完成（签名已校验、二次验证已通过）后执行，每个连接只执行一次，之后返回第一次的结果
+func completeAuth(ctx ssh.Context, conn *gossh.ServerConn) error {
+	ctx.Lock()
+	defer ctx.Unlock()
+	if done, ok := ctx.Value(authCompletedContextKey{}).(*authCompleted); ok {
+		return done.err
+	}
+	err := applyAuthExtensions(ctx, conn.Permissions)
+	ctx.SetValue(authCompletedContextKey{}, &authCompleted{err: err})
+	return err
+}
+
+type authCompleted struct {
+	err error
+}
+
+func applyAuthExtensions(ctx ssh.Context, perms *gossh.Permissions) error {
+	if perms == nil || perms.Extensions == nil {
+		return nil
+	}
+	// 客户端可以先查询多把公钥，以最终通过签名校验的公钥为准
+	if raw, ok := perms.Extensions[extPublicKey]; ok {
+		if key, err := gossh.ParsePublicKey([]byte(raw)); err == nil {
+			ctx.SetValue(ssh.ContextKeyPublicKey, key)
+		}
+	}
+	if raw, ok := perms.Extensions[extSSHKeyID]; ok {
+		if id, err := strconv.ParseUint(raw, 10, 64); err == nil {
+			if err := operation.NewUserSSHKeyOperation().TouchUserSSHKey(uint(id), GetClientIP(ctx)); err != nil {
+				logger.Logger.Warning(fmt.Sprintf("Failed to update last used time of ssh key %d: %v", id, err))
+			}
+		}
+	}
+	if username, ok := perms.Extensions[extLDAPProvision]; ok {
+		entry := pendingLDAPEntry(ctx)
+		if entry == nil || entry.Username != username {
+			return fmt.Errorf("ldap entry of user %s is missing", username)
+		}
+		if _, err := ldapauth.ProvisionUser(entry); err != nil {
+			log.Printf("PublicKeyAuth: 同步 LDAP 用户 %s 失败: %v", username, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// AuthenticatedChannel 通道处理器包装器，在连接的第一个通道打开前执行公钥认证时推迟的操作
+// 输入: handler - 原始通道处理器
+// 输出: ssh.ChannelHandler - 包装后的通道处理器；推迟的操作失败（如 LDAP 用户同步失败）时拒绝通道并断开连接
+// 必要性: 认证回调也处理不带签名的公钥查询，修改数据的操作只能在认证完成后执行
+func AuthenticatedChannel(handler ssh.ChannelHandler) ssh.ChannelHandler {
+	return func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+		if err := completeAuth(ctx, conn); err != nil {
+			newChan.Reject(gossh.Prohibited, "login failed")
+			conn.Close()
+			return
+		}
+		handler(srv, conn, newChan, ctx)
+	}
+}
+
+// userCertMatches 校验 OpenSSH 用户证书：受信任 CA 签发、principal 映射到该用户、
+// 在有效期内、满足 source-address 且未被 KRL 吊销
+func userCertMatches(ctx ssh.Context, user *model.User, cert *gossh.Certificate) bool {
+	if !usercert.Enabled() {
+		log.Printf("PublicKeyAuth: 用户 %s 使用证书登录，但未配置受信任的 CA", user.Username)
+		return false
+	}
+	principal, err := usercert.Authenticate(cert, user.Username, GetClientIP(ctx))
+	if err != nil {
+		log.Printf("PublicKeyAuth: 用户 %s 的证书 %q (serial %d) 校验失败: %v", user.Username, cert.KeyId, cert.Serial, err)
+		return false
+	}
+	log.Printf("PublicKeyAuth: 用户 %s 使用证书 %q (serial %d, principal %s) 登录", user.Username, cert.KeyId, cert.Serial, principal)
+	return true
 }
 
 // SecurePublicKeyAuth 安全的公钥认证包装器
@@ -353,11 +517,53 @@ func publicKeyAuth(ctx ssh.Context, key ssh.PublicKey) bool {
 // 输出: bool - 是否认证成功
 // 必要性: 在公钥认证中添加安全检查和失败记录
 func SecurePublicKeyAuth(ctx ssh.Context, key ssh.PublicKey) bool {
+	ip := sshAuthIP(ctx)
+	if !sshAuthAllowed(ip) {
+		return false
+	}
+
+	// 执行实际的公钥认证（避免循环导入，直接在这里实现）
+	// 每次尝试使用独立的 Permissions，ssh 库最终返回的是连接共享的 Permissions，
+	// 只把本次通过的结果写回，之前尝试（如被拒绝的公钥）留下的推迟操作不会带到之后的认证
+	perms := &gossh.Permissions{}
+	success := publicKeyAuth(ctx, key, perms)
+	resetAuthExtensions(ctx.Permissions().Permissions, perms, success)
+
+	// 记录认证结果
+	recordSSHAuthResult(ip, success)
+	return success
+}
+
+// resetAuthExtensions 清除共享 Permissions 中上一次尝试记录的推迟操作，认证通过时写入本次的结果
+func resetAuthExtensions(shared, attempt *gossh.Permissions, success bool) {
+	if shared == nil {
+		return
+	}
+	for _, ext := range []string{extPublicKey, extSSHKeyID, extLDAPProvision} {
+		delete(shared.Extensions, ext)
+	}
+	if !success || len(attempt.Extensions) == 0 {
+		return
+	}
+	if shared.Extensions == nil {
+		shared.Extensions = make(map[string]string, len(attempt.Extensions))
+	}
+	for k, v := range attempt.Extensions {
+		shared.Extensions[k] = v
+	}
+}
+
+// sshAuthIP 认证时使用的客户端 IP
+func sshAuthIP(ctx ssh.Context) string {
 	ip := GetClientIP(ctx)
 	if ip == "" {
 		ip = ctx.RemoteAddr().String()
 	}
+	return ip
+}
 
+// sshAuthAllowed 检查 IP 是否在 SSH 黑名单中或被封禁
+func sshAuthAllowed(ip string) bool {
 	// 检查是否在SSH黑名单中
 	if isSSHBlacklisted(ip) {
 		logger.Logger.Warning(fmt.Sprintf("SSH: Blocked connection attempt from blacklisted IP %s", ip))
@@ -375,23 +581,21 @@ func SecurePublicKeyAuth(ctx ssh.Context, key ssh.PublicKey) bool {
 		}
 		sm.mu.RUnlock()
 	}
+	return true
+}
 
-	// 执行实际的公钥认证（避免循环导入，直接在这里实现）
-	success := publicKeyAuth(ctx, key)
-
-	// 记录认证结果
-	if globalSSHSecurityManager != nil {
-		if success {
-			globalSSHSecurityManager.RecordAuthSuccess(ip)
-		} else {
-			shouldBan := globalSSHSecurityManager.RecordAuthFailure(ip)
-			if shouldBan {
-				logger.Logger.Warning(fmt.Sprintf("SSH: IP %s banned due to too many failed authentication attempts", ip))
-			}
-		}
+// recordSSHAuthResult 记录认证结果，失败次数过多时封禁 IP
+func recordSSHAuthResult(ip string, success bool) {
+	if globalSSHSecurityManager == nil {
+		return
+	}
+	if success {
+		globalSSHSecurityManager.RecordAuthSuccess(ip)
+		return
+	}
+	if globalSSHSecurityManager.RecordAuthFailure(ip) {
+		logger.Logger.Warning(fmt.Sprintf("SSH: IP %s banned due to too many failed authentication attempts", ip))
 	}
-
-	return success
 }
 
 // SecureConnectionHandler 安全的连接处理器包装器
@@ -418,7 +622,7 @@ func SecureConnectionHandler(handler func(ssh.Session)) func(ssh.Session) {
 			defer globalSSHSecurityManager.ReleaseConnection(ip)
 		}
 
-		// 执行原始处理器
-		handler(sess)
+		// 执行原始处理器（登录名为 user+target 时，会话用户名为 user）
+		handler(withLoginUser(sess))
 	}
 }
@@ -0,0 +1,209 @@
+package sshd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	"github.com/loganchef/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// fakeContext 认证回调使用的连接上下文
+type fakeContext struct {
+	context.Context
+	sync.Mutex
+	mu     sync.Mutex
+	values map[interface{}]interface{}
+	perms  *ssh.Permissions
+}
+
+func newFakeContext(user, remote string) *fakeContext {
+	ctx := &fakeContext{Context: context.Background(), values: map[interface{}]interface{}{}, perms: &ssh.Permissions{Permissions: &gossh.Permissions{}}}
+	addr, _ := net.ResolveTCPAddr("tcp", remote)
+	ctx.SetValue(ssh.ContextKeyUser, user)
+	ctx.SetValue(ssh.ContextKeyRemoteAddr, addr)
+	return ctx
+}
+
+func (c *fakeContext) Value(key interface{}) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.values[key]; ok {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+func (c *fakeContext) SetValue(key, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+func (c *fakeContext) User() string                  { return c.Value(ssh.ContextKeyUser).(string) }
+func (c *fakeContext) SessionID() string             { return "test" }
+func (c *fakeContext) ClientVersion() string         { return "SSH-2.0-test" }
+func (c *fakeContext) ServerVersion() string         { return "SSH-2.0-roma" }
+func (c *fakeContext) RemoteAddr() net.Addr          { return c.Value(ssh.ContextKeyRemoteAddr).(net.Addr) }
+func (c *fakeContext) LocalAddr() net.Addr           { return nil }
+func (c *fakeContext) Permissions() *ssh.Permissions { return c.perms }
+
+func newUserKey(t *testing.T) gossh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// addUserKey 为用户添加 user_ssh_keys 记录
+func addUserKey(t *testing.T, user *model.User, key gossh.PublicKey, sourceIPs string, expiresAt *time.Time) *model.UserSSHKey {
+	t.Helper()
+	userKey := &model.UserSSHKey{UserID: user.ID, Label: "test", PublicKey: string(gossh.MarshalAuthorizedKey(key)),
+		Fingerprint: gossh.FingerprintSHA256(key), SourceIPs: sourceIPs, ExpiresAt: expiresAt}
+	if err := global.CDB.Create(userKey).Error; err != nil {
+		t.Fatal(err)
+	}
+	return userKey
+}
+
+func lastUsed(t *testing.T, id uint) *model.UserSSHKey {
+	t.Helper()
+	var userKey model.UserSSHKey
+	if err := global.CDB.First(&userKey, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &userKey
+}
+
+func TestPublicKeyAuthDefersSideEffects(t *testing.T) {
+	user := &model.User{Username: "key-user", Name: "key-user", Nickname: "key-user", Email: "key-user@example.com"}
+	if err := global.CDB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	valid, expired, restricted, unknown := newUserKey(t), newUserKey(t), newUserKey(t), newUserKey(t)
+	validKey := addUserKey(t, user, valid, "", nil)
+	addUserKey(t, user, expired, "", &past)
+	addUserKey(t, user, restricted, "10.0.0.0/8", nil)
+
+	tests := []struct {
+		name    string
+		user    string
+		key     gossh.PublicKey
+		want    bool
+		wantKey uint
+	}{
+		{name: "registered key", user: "key-user", key: valid, want: true, wantKey: validKey.ID},
+		{name: "expired key", user: "key-user", key: expired},
+		{name: "source address not allowed", user: "key-user", key: restricted},
+		{name: "unknown key", user: "key-user", key: unknown},
+		{name: "unknown user", user: "nobody", key: valid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perms := &gossh.Permissions{}
+			got := publicKeyAuth(newFakeContext(tt.user, "192.0.2.10:50000"), tt.key, perms)
+			if got != tt.want {
+				t.Fatalf("publicKeyAuth() = %v, want %v", got, tt.want)
+			}
+			if id := perms.Extensions[extSSHKeyID]; tt.wantKey != 0 && id != strconv.FormatUint(uint64(tt.wantKey), 10) {
+				t.Errorf("extension %s = %q, want %d", extSSHKeyID, id, tt.wantKey)
+			}
+		})
+	}
+	// 公钥查询（未签名）阶段不更新最后使用时间
+	if k := lastUsed(t, validKey.ID); k.LastUsedAt != nil {
+		t.Fatalf("key touched during authentication: %v", k.LastUsedAt)
+	}
+
+	// 客户端先查询了另一把公钥，以最终通过认证的公钥为准
+	ctx := newFakeContext("key-user", "192.0.2.10:50000")
+	perms := &gossh.Permissions{}
+	if !publicKeyAuth(ctx, valid, perms) {
+		t.Fatal("publicKeyAuth() = false")
+	}
+	ctx.SetValue(ssh.ContextKeyPublicKey, unknown)
+	if err := completeAuth(ctx, &gossh.ServerConn{Permissions: perms}); err != nil {
+		t.Fatalf("completeAuth() error: %v", err)
+	}
+	k := lastUsed(t, validKey.ID)
+	if k.LastUsedAt == nil || k.LastUsedIP != "192.0.2.10" {
+		t.Errorf("key not touched after authentication: %v %q", k.LastUsedAt, k.LastUsedIP)
+	}
+	if key, _ := ctx.Value(ssh.ContextKeyPublicKey).(gossh.PublicKey); key == nil || !ssh.KeysEqual(key, valid) {
+		t.Error("context public key is not the authenticated key")
+	}
+}
+
+func TestSecurePublicKeyAuthFreshAttempts(t *testing.T) {
+	withSecurityManager(t, 5)
+	user := &model.User{Username: "retry-user", Name: "retry-user", Nickname: "retry-user", Email: "retry-user@example.com"}
+	if err := global.CDB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	valid, unknown := newUserKey(t), newUserKey(t)
+	validKey := addUserKey(t, user, valid, "", nil)
+	ctx := newFakeContext("retry-user", "192.0.2.13:50000")
+	// 模拟连接上已有之前尝试留下的推迟操作
+	ctx.Permissions().Extensions = map[string]string{extLDAPProvision: "retry-user", "other": "kept"}
+
+	attempts := []struct {
+		name    string
+		key     gossh.PublicKey
+		want    bool
+		wantExt map[string]string
+	}{
+		{name: "registered key", key: valid, want: true, wantExt: map[string]string{
+			extPublicKey: string(valid.Marshal()),
+			extSSHKeyID:  strconv.FormatUint(uint64(validKey.ID), 10),
+			"other":      "kept",
+		}},
+		{name: "rejected key clears the previous attempt", key: unknown, want: false, wantExt: map[string]string{"other": "kept"}},
+		{name: "registered key again", key: valid, want: true, wantExt: map[string]string{
+			extPublicKey: string(valid.Marshal()),
+			extSSHKeyID:  strconv.FormatUint(uint64(validKey.ID), 10),
+			"other":      "kept",
+		}},
+	}
+	for _, tt := range attempts {
+		if got := SecurePublicKeyAuth(ctx, tt.key); got != tt.want {
+			t.Fatalf("%s: SecurePublicKeyAuth() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := ctx.Permissions().Extensions; !reflect.DeepEqual(got, tt.wantExt) {
+			t.Fatalf("%s: extensions = %v, want %v", tt.name, got, tt.wantExt)
+		}
+	}
+}
+
+func TestCompleteAuthOnce(t *testing.T) {
+	ctx := newFakeContext("ldap-user", "192.0.2.11:50000")
+	// 目录条目缺失时同步失败，之后的通道得到同样的结果
+	conn := &gossh.ServerConn{Permissions: &gossh.Permissions{Extensions: map[string]string{extLDAPProvision: "ldap-user"}}}
+	first := completeAuth(ctx, conn)
+	if first == nil {
+		t.Fatal("completeAuth() succeeded without a directory entry")
+	}
+	conn.Permissions.Extensions = nil
+	if err := completeAuth(ctx, conn); err != first {
+		t.Errorf("second completeAuth() = %v, want %v", err, first)
+	}
+
+	if err := completeAuth(newFakeContext("plain", "192.0.2.12:50000"), &gossh.ServerConn{}); err != nil {
+		t.Errorf("completeAuth() without extensions = %v", err)
+	}
+}
@@ -0,0 +1,510 @@
+package sshd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"binrc.com/roma/core/utils/logger"
+	"github.com/loganchef/ssh"
+	"github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// SftpHandler SFTP 子系统处理器
+// 虚拟文件系统：根目录下每个子目录对应用户可以 use 的一台主机（以主机名命名），
+// /<hostname>/<path> 代理到该主机 SFTP 服务上的 /<path>
+func SftpHandler(sess ssh.Session) {
+	vfs := newSftpFS(sess)
+	defer vfs.close()
+
+	server := sftp.NewRequestServer(sess, sftp.Handlers{
+		FileGet:  vfs,
+		FilePut:  vfs,
+		FileCmd:  vfs,
+		FileList: vfs,
+	})
+	if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+		logger.Logger.Warning(fmt.Sprintf("SFTP: session for %s ended with error: %v", sess.User(), err))
+	}
+	server.Close()
+}
+
+// sftpUpstream 到某台主机的 SFTP 连接
+type sftpUpstream struct {
+	resource transferResource
+	conn     *gossh.Client
+	client   *sftp.Client
+	live     *LiveSession
+}
+
+// closeUpstream 断开到主机的 SFTP 连接并从活动会话表移除
+func (up *sftpUpstream) closeUpstream() {
+	up.live.Unregister()
+	up.client.Close()
+	up.conn.Close()
+}
+
+// sftpFS 按会话构建的虚拟文件系统，实现 sftp.Handlers 所需的接口
+type sftpFS struct {
+	sess      ssh.Session
+	root      string // 登录名中指定的主机（sftp user+web-01@roma），非空时客户端的 / 即该主机的 /
+	startedAt time.Time
+
+	mu        sync.Mutex
+	resources map[string]transferResource
+	upstreams map[string]*sftpUpstream
+}
+
+func newSftpFS(sess ssh.Session) *sftpFS {
+	return &sftpFS{
+		sess:      sess,
+		root:      LoginTarget(sess),
+		startedAt: time.Now(),
+		upstreams: make(map[string]*sftpUpstream),
+	}
+}
+
+// close 断开所有上游连接
+func (fs *sftpFS) close() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for name, up := range fs.upstreams {
+		up.closeUpstream()
+		delete(fs.upstreams, name)
+	}
+}
+
+// virtualPath 将客户端请求的路径转换为虚拟文件系统中的路径
+func (fs *sftpFS) virtualPath(p string) string {
+	if fs.root == "" {
+		return p
+	}
+	return path.Join("/", fs.root, path.Clean("/"+p))
+}
+
+// splitSftpPath 将虚拟路径拆分为主机名和主机上的路径
+// 例如 /web01/var/log -> web01, /var/log；/ -> "", /
+func splitSftpPath(p string) (string, string) {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "", "/"
+	}
+	host, rest, _ := strings.Cut(p, "/")
+	return host, "/" + rest
+}
+
+// listResources 获取（并缓存）当前用户可访问的主机
+func (fs *sftpFS) listResources(refresh bool) (map[string]transferResource, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.resources == nil || refresh {
+		resources, err := listTransferResources(fs.sess.User(), GetClientIP(fs.sess))
+		if err != nil {
+			return nil, err
+		}
+		fs.resources = resources
+	}
+	return fs.resources, nil
+}
+
+// lookupResource 根据主机名查找资源，无权限与不存在同样返回 os.ErrNotExist
+func (fs *sftpFS) lookupResource(host string) (transferResource, error) {
+	resources, err := fs.listResources(false)
+	if err != nil {
+		return transferResource{}, err
+	}
+	if res, ok := resources[host]; ok {
+		return res, nil
+	}
+	// 会话期间新授权的资源
+	if resources, err = fs.listResources(true); err != nil {
+		return transferResource{}, err
+	}
+	if res, ok := resources[host]; ok {
+		return res, nil
+	}
+	return transferResource{}, os.ErrNotExist
+}
+
+// upstream 获取到主机的 SFTP 连接，首次访问时建立
+func (fs *sftpFS) upstream(host string) (*sftpUpstream, error) {
+	res, err := fs.lookupResource(host)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if up, ok := fs.upstreams[host]; ok {
+		return up, nil
+	}
+
+	conn, err := dialTransferResource(fs.sess, res.Resource, res.Type)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start sftp on %s: %v", host, err)
+	}
+
+	up := &sftpUpstream{resource: res, conn: conn, client: client}
+	// 每台主机的连接单独登记：结束时只断开该主机，并清空资源缓存，再次访问时重新检查权限
+	up.live = RegisterSession(NewSessionInfo(fs.sess, SessionTypeSFTP, res.Resource, res.Type, conn.RemoteAddr().String()), func(string) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		if fs.upstreams[host] == up {
+			delete(fs.upstreams, host)
+			fs.resources = nil
+			up.closeUpstream()
+		}
+	})
+	fs.upstreams[host] = up
+	return up, nil
+}
+
+// resolve 将请求路径解析为上游连接和主机上的路径，根目录和主机目录本身不可写
+func (fs *sftpFS) resolve(p string) (*sftpUpstream, string, error) {
+	host, rest := splitSftpPath(fs.virtualPath(p))
+	if host == "" {
+		return nil, "", sftp.ErrSSHFxPermissionDenied
+	}
+	up, err := fs.upstream(host)
+	if err != nil {
+		return nil, "", err
+	}
+	return up, rest, nil
+}
+
+// audit 记录 SFTP 操作审计日志
+func (fs *sftpFS) audit(up *sftpUpstream, action, description string, err error) {
+	recordTransferAudit(fs.sess, up.resource.Resource, up.resource.Type, action,
+		fmt.Sprintf("SFTP %s: %s", up.resource.Resource.GetName(), description), err)
+}
+
+// Fileread 下载文件
+func (fs *sftpFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	up, remotePath, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, sftpError(err)
+	}
+	f, err := up.client.Open(remotePath)
+	if err != nil {
+		fs.audit(up, "sftp_download", fmt.Sprintf("下载 %s", remotePath), err)
+		return nil, sftpError(err)
+	}
+	return &sftpAuditedFile{File: f, fs: fs, up: up, action: "sftp_download", verb: "下载", path: remotePath}, nil
+}
+
+// Filewrite 上传文件
+func (fs *sftpFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return fs.openWrite(r, os.O_WRONLY)
+}
+
+// OpenFile 以读写方式打开文件
+func (fs *sftpFS) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	return fs.openWrite(r, os.O_RDWR)
+}
+
+func (fs *sftpFS) openWrite(r *sftp.Request, mode int) (*sftpAuditedFile, error) {
+	up, remotePath, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return nil, sftpError(err)
+	}
+
+	flags := mode
+	pflags := r.Pflags()
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	if pflags.Append {
+		flags |= os.O_APPEND
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+
+	f, err := up.client.OpenFile(remotePath, flags)
+	if err != nil {
+		fs.audit(up, "sftp_upload", fmt.Sprintf("上传 %s", remotePath), err)
+		return nil, sftpError(err)
+	}
+	return &sftpAuditedFile{File: f, fs: fs, up: up, action: "sftp_upload", verb: "上传", path: remotePath}, nil
+}
+
+// Filecmd 处理 Setstat/Rename/Rmdir/Mkdir/Remove 等命令
+func (fs *sftpFS) Filecmd(r *sftp.Request) error {
+	up, remotePath, err := fs.resolve(r.Filepath)
+	if err != nil {
+		return sftpError(err)
+	}
+
+	switch r.Method {
+	case "Setstat":
+		err = fs.setstat(up, remotePath, r)
+		fs.audit(up, "sftp_setstat", fmt.Sprintf("修改属性 %s", remotePath), err)
+	case "Rename", "PosixRename":
+		// 不支持跨主机重命名
+		targetHost, targetPath := splitSftpPath(fs.virtualPath(r.Target))
+		if targetHost != firstSftpSegment(fs.virtualPath(r.Filepath)) {
+			return sftp.ErrSSHFxOpUnsupported
+		}
+		if r.Method == "PosixRename" {
+			err = up.client.PosixRename(remotePath, targetPath)
+		} else {
+			err = up.client.Rename(remotePath, targetPath)
+		}
+		fs.audit(up, "sftp_rename", fmt.Sprintf("重命名 %s -> %s", remotePath, targetPath), err)
+	case "Rmdir":
+		err = up.client.RemoveDirectory(remotePath)
+		fs.audit(up, "sftp_rmdir", fmt.Sprintf("删除目录 %s", remotePath), err)
+	case "Remove":
+		err = up.client.Remove(remotePath)
+		fs.audit(up, "sftp_remove", fmt.Sprintf("删除文件 %s", remotePath), err)
+	case "Mkdir":
+		err = up.client.Mkdir(remotePath)
+		fs.audit(up, "sftp_mkdir", fmt.Sprintf("创建目录 %s", remotePath), err)
+	default:
+		// Link/Symlink 的目标路径可能跨主机或为相对路径，暂不支持
+		return sftp.ErrSSHFxOpUnsupported
+	}
+	return sftpError(err)
+}
+
+// PosixRename 实现 sftp.PosixRenameFileCmder
+func (fs *sftpFS) PosixRename(r *sftp.Request) error {
+	return fs.Filecmd(r)
+}
+
+func (fs *sftpFS) setstat(up *sftpUpstream, remotePath string, r *sftp.Request) error {
+	attrFlags := r.AttrFlags()
+	attrs := r.Attributes()
+	if attrFlags.Size {
+		if err := up.client.Truncate(remotePath, int64(attrs.Size)); err != nil {
+			return err
+		}
+	}
+	if attrFlags.Permissions {
+		if err := up.client.Chmod(remotePath, attrs.FileMode()); err != nil {
+			return err
+		}
+	}
+	if attrFlags.UidGid {
+		if err := up.client.Chown(remotePath, int(attrs.UID), int(attrs.GID)); err != nil {
+			return err
+		}
+	}
+	if attrFlags.Acmodtime {
+		if err := up.client.Chtimes(remotePath, attrs.AccessTime(), attrs.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Filelist 处理 List/Stat/Readlink
+func (fs *sftpFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	return fs.list(r, false)
+}
+
+// Lstat 实现 sftp.LstatFileLister
+func (fs *sftpFS) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	return fs.list(r, true)
+}
+
+func (fs *sftpFS) list(r *sftp.Request, lstat bool) (sftp.ListerAt, error) {
+	host, remotePath := splitSftpPath(fs.virtualPath(r.Filepath))
+
+	if host == "" {
+		if r.Method == "List" {
+			return fs.listRoot()
+		}
+		return sftpListerAt{virtualDirInfo{name: "/", modTime: fs.startedAt}}, nil
+	}
+
+	// 主机目录本身不连接上游，直接返回虚拟目录信息
+	if remotePath == "/" && r.Method != "List" {
+		if _, err := fs.lookupResource(host); err != nil {
+			return nil, sftpError(err)
+		}
+		return sftpListerAt{virtualDirInfo{name: host, modTime: fs.startedAt}}, nil
+	}
+
+	up, err := fs.upstream(host)
+	if err != nil {
+		return nil, sftpError(err)
+	}
+
+	switch r.Method {
+	case "List":
+		infos, err := up.client.ReadDir(remotePath)
+		if err != nil {
+			return nil, sftpError(err)
+		}
+		return sftpListerAt(infos), nil
+	case "Stat", "Lstat":
+		var info os.FileInfo
+		if lstat || r.Method == "Lstat" {
+			info, err = up.client.Lstat(remotePath)
+		} else {
+			info, err = up.client.Stat(remotePath)
+		}
+		if err != nil {
+			return nil, sftpError(err)
+		}
+		return sftpListerAt{info}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// Readlink 实现 sftp.ReadlinkFileLister，绝对路径的链接目标映射回虚拟路径
+func (fs *sftpFS) Readlink(p string) (string, error) {
+	up, remotePath, err := fs.resolve(p)
+	if err != nil {
+		return "", sftpError(err)
+	}
+	target, err := up.client.ReadLink(remotePath)
+	if err != nil {
+		return "", sftpError(err)
+	}
+	// 登录时指定了主机则客户端看到的就是主机上的路径，无需映射
+	if path.IsAbs(target) && fs.root == "" {
+		host, _ := splitSftpPath(p)
+		target = path.Join("/", host, target)
+	}
+	return target, nil
+}
+
+// listRoot 根目录：列出用户可访问的主机
+func (fs *sftpFS) listRoot() (sftp.ListerAt, error) {
+	resources, err := fs.listResources(true)
+	if err != nil {
+		return nil, sftpError(err)
+	}
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	infos := make(sftpListerAt, 0, len(names))
+	for _, name := range names {
+		infos = append(infos, virtualDirInfo{name: name, modTime: fs.startedAt})
+	}
+	return infos, nil
+}
+
+// firstSftpSegment 返回虚拟路径的主机名部分
+func firstSftpSegment(p string) string {
+	host, _ := splitSftpPath(p)
+	return host
+}
+
+// sftpError 将上游错误转换为客户端可识别的 SFTP 状态码
+func sftpError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, os.ErrPermission) || errors.Is(err, ErrTransferPermissionDenied) {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	return err
+}
+
+// sftpListerAt 实现 sftp.ListerAt
+type sftpListerAt []os.FileInfo
+
+func (l sftpListerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// virtualDirInfo 虚拟目录（根目录和主机目录）的文件信息
+type virtualDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (v virtualDirInfo) Name() string       { return v.name }
+func (v virtualDirInfo) Size() int64        { return 0 }
+func (v virtualDirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (v virtualDirInfo) ModTime() time.Time { return v.modTime }
+func (v virtualDirInfo) IsDir() bool        { return true }
+func (v virtualDirInfo) Sys() interface{}   { return nil }
+
+// sftpAuditedFile 包装上游文件，关闭时按实际传输字节数记录审计
+type sftpAuditedFile struct {
+	*sftp.File
+	fs     *sftpFS
+	up     *sftpUpstream
+	action string
+	verb   string
+	path   string
+
+	bytes     atomic.Int64
+	closeOnce sync.Once
+
+	errMu sync.Mutex
+	err   error
+}
+
+func (f *sftpAuditedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	f.bytes.Add(int64(n))
+	return n, err
+}
+
+func (f *sftpAuditedFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(p, off)
+	f.bytes.Add(int64(n))
+	if err != nil {
+		f.setErr(err)
+	}
+	return n, err
+}
+
+func (f *sftpAuditedFile) setErr(err error) {
+	f.errMu.Lock()
+	defer f.errMu.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// TransferError 实现 sftp.TransferError，记录导致传输中断的错误
+func (f *sftpAuditedFile) TransferError(err error) {
+	f.setErr(err)
+}
+
+func (f *sftpAuditedFile) Close() error {
+	err := f.File.Close()
+	f.closeOnce.Do(func() {
+		f.errMu.Lock()
+		auditErr := f.err
+		f.errMu.Unlock()
+		if auditErr == nil {
+			auditErr = err
+		}
+		f.fs.audit(f.up, f.action, fmt.Sprintf("%s %s (%d bytes)", f.verb, f.path, f.bytes.Load()), auditErr)
+	})
+	return err
+}
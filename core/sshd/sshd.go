@@ -3,11 +3,16 @@ package sshd
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
+	"binrc.com/roma/core/knownhosts"
+	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/usercert"
 	"binrc.com/roma/core/utils"
 	"binrc.com/roma/core/utils/logger"
 	"github.com/fatih/color"
@@ -32,20 +37,22 @@ func NewTerminal(sess *ssh.Session, ip string, port int, sshUser string, key str
 	if len(password) > 0 {
 		pwd = password[0]
 	}
-	upstreamClient, err := NewSSHClient(ip, port, sshUser, key, resType, pwd)
+	upstreamClient, err := NewSSHClientWithTarget(SessionHostKeyTarget(*sess, resType), ip, port, sshUser, key, resType, pwd)
 	if err != nil {
 		return err
 	}
 
+	defer upstreamClient.Close()
+
 	upstreamSess, err := upstreamClient.NewSession()
 	if err != nil {
 		return err
 	}
 	defer upstreamSess.Close()
 
-	upstreamSess.Stdout = *sess
-	upstreamSess.Stdin = *sess
-	upstreamSess.Stderr = *sess
+	// 登记到活动会话表，供管理员查看、旁观和强制结束
+	live := registerLiveSession(*sess, ip, port, upstreamClient)
+	defer live.Unregister()
 
 	pty, winCh, _ := (*sess).Pty()
 
@@ -88,6 +95,40 @@ func NewTerminal(sess *ssh.Session, ip string, port int, sshUser string, key str
 		logger.Logger.Warning(fmt.Sprintf("Failed to request PTY: %v, continuing without PTY", err))
 	}
 
+	// 录像：将上游输出（按配置还有键盘输入）同时写入 asciicast 文件；配置 recording_required 时无法录像则拒绝会话
+	recording, err := startSessionRecording(*sess, ip, port, width, height, term)
+	if err != nil {
+		if recordingRequired() {
+			logger.Logger.Warning(fmt.Sprintf("Refusing session of %s: %v", (*sess).User(), err))
+			return fmt.Errorf("[-] Session recording is required but could not be started")
+		}
+		logger.Logger.Warning(fmt.Sprintf("Failed to start session recording: %v", err))
+	}
+
+	outputs := []io.Writer{*sess, live}
+	stdin := live.inputReader(*sess)
+	if recording != nil {
+		defer recording.finish()
+		outputs = append(outputs, recording)
+		// 在命令策略之前记录输入，被拦截的命令也会出现在录像中
+		if recordingInput() {
+			stdin = io.TeeReader(stdin, recording.InputWriter())
+		}
+	}
+
+	// 命令策略：有适用策略时逐行检查用户提交的命令，guard 同时观察上游输出以还原命令行
+	upstreamSess.Stdin = stdin
+	if guard := newCommandGuard(*sess, upstreamSess.Stdin, resType); guard != nil {
+		defer guard.Close()
+		upstreamSess.Stdin = guard
+		outputs = append(outputs, guard)
+	}
+	upstreamSess.Stdout = io.MultiWriter(outputs...)
+	upstreamSess.Stderr = io.MultiWriter(outputs...)
+
+	// ssh -A：按角色允许时把客户端的 agent 转发到上游
+	setupAgentForwarding(*sess, upstreamClient, upstreamSess)
+
 	if err := upstreamSess.Shell(); err != nil {
 		return err
 	}
@@ -96,6 +137,9 @@ func NewTerminal(sess *ssh.Session, ip string, port int, sshUser string, key str
 	if winCh != nil {
 		go func() {
 			for win := range winCh {
+				if recording != nil {
+					recording.Resize(win.Width, win.Height)
+				}
 				if err := upstreamSess.WindowChange(win.Height, win.Width); err != nil {
 					logger.Logger.Warning(fmt.Sprintf("Failed to change window size: %v", err))
 					break
@@ -111,17 +155,50 @@ func NewTerminal(sess *ssh.Session, ip string, port int, sshUser string, key str
 	return nil
 }
 
+// SessionHostKeyTarget 根据会话上下文中的资源构造主机密钥校验对象
+func SessionHostKeyTarget(sess ssh.Session, resType string) knownhosts.Target {
+	target := knownhosts.Target{ResourceType: resType, Username: sess.User(), IPAddress: GetClientIP(sess), SessionID: sess.Context().SessionID()}
+	if res := GetSessionResource(sess); res != nil {
+		target.ResourceType = res.Type
+		target.ResourceID = res.ID
+		target.ResourceName = res.Name
+	}
+	return target
+}
+
+// ResourceHostKeyTarget 根据资源构造主机密钥校验对象
+func ResourceHostKeyTarget(sess ssh.Session, resource model.Resource, resType string) knownhosts.Target {
+	target := knownhosts.ForResource(resType, resource)
+	if sess != nil {
+		target.Username = sess.User()
+		target.IPAddress = GetClientIP(sess)
+		target.SessionID = sess.Context().SessionID()
+	}
+	return target
+}
+
 // NewSSHClient 创建 SSH 客户端连接
 // 输入: ip - 目标 IP 地址；port - 目标端口；sshUser - SSH 用户名；key - 私钥内容（可为空）；resType - 资源类型；password - 密码（可为空）
 // 输出: *gossh.Client - SSH 客户端；error - 错误信息
 // 必要性: 这是建立 SSH 连接的核心函数，支持公钥和密码两种认证方式
 func NewSSHClient(ip string, port int, sshUser string, key string, resType string, password ...string) (*gossh.Client, error) {
+	return NewSSHClientWithTarget(knownhosts.Target{ResourceType: resType}, ip, port, sshUser, key, resType, password...)
+}
+
+// NewSSHClientWithTarget 创建 SSH 客户端连接，并按 target 校验上游主机密钥
+// 输入: target - 资源标识（用于 known_hosts 固定和审计）；其余参数同 NewSSHClient
+// 输出: *gossh.Client - SSH 客户端；error - 错误信息
+func NewSSHClientWithTarget(target knownhosts.Target, ip string, port int, sshUser string, key string, resType string, password ...string) (*gossh.Client, error) {
+	if target.ResourceType == "" {
+		target.ResourceType = resType
+	}
 	var pwd string
 	if len(password) > 0 {
 		pwd = password[0]
 	}
 
 	// 认证优先级：
+	// 0. 开启内置 CA 时，先使用为本次连接签发的短期证书
 	// 1. 优先使用资源自身的密钥字段（通过 key 参数传入，来自资源的 PrivateKey 字段）
 	// 2. 如果资源没有配置密钥，则从 passports 表查找该资源类型的默认密钥
 	// 3. 如果都没有，且提供了密码，则使用密码认证
@@ -135,7 +212,7 @@ func NewSSHClient(ip string, port int, sshUser string, key string, resType strin
 		if err != nil {
 			logger.Logger.Error(fmt.Sprintf("Failed to get passport for resource type %s: %v", resType, err))
 			// 如果 passports 表中也没有密钥，且没有密码，则返回错误
-			if pwd == "" {
+			if pwd == "" && !usercert.CAEnabled() {
 				return nil, fmt.Errorf("no key found (resource PrivateKey is empty, and no passport found for type %s) and no password provided", resType)
 			}
 		} else if len(keys) > 0 {
@@ -152,8 +229,25 @@ func NewSSHClient(ip string, port int, sshUser string, key string, resType strin
 		logger.Logger.Debug(fmt.Sprintf("Using resource PrivateKey (length: %d)", len(key)))
 	}
 
+	// 设置用户名（如果未提供，使用默认值）
+	if sshUser == "" {
+		sshUser = "root"
+	}
+
 	// 构建认证方法列表
 	authMethods := []gossh.AuthMethod{}
+	// 证书和私钥放在同一个 publickey 认证方法中，否则失败一次后不会再尝试其余的 publickey 方法
+	signers := []gossh.Signer{}
+
+	// 内置 CA 证书（principal 为上游用户名）
+	if usercert.CAEnabled() {
+		certSigner, err := usercert.NewCertSigner(sshUser, certKeyID(target))
+		if err != nil {
+			logger.Logger.Error(fmt.Sprintf("Failed to issue ssh certificate for %s: %v", sshUser, err))
+		} else {
+			signers = append(signers, certSigner)
+		}
+	}
 
 	// 优先使用私钥认证
 	if key != "" {
@@ -172,11 +266,14 @@ func NewSSHClient(ip string, port int, sshUser string, key string, resType strin
 				logger.Logger.Error(fmt.Sprintf("Failed to parse private key from %s (key length: %d, first 50 chars: %s): %v", keySource, len(key), key[:min(len(key), 50)], err))
 				// 如果密钥解析失败，记录详细错误，但继续尝试密码认证
 			} else {
-				authMethods = append(authMethods, gossh.PublicKeys(signer))
+				signers = append(signers, signer)
 				logger.Logger.Debug(fmt.Sprintf("Successfully parsed private key from %s", keySource))
 			}
 		}
 	}
+	if len(signers) > 0 {
+		authMethods = append(authMethods, gossh.PublicKeys(signers...))
+	}
 
 	// 如果提供了密码，添加密码认证（作为备选）
 	if pwd != "" {
@@ -201,18 +298,15 @@ func NewSSHClient(ip string, port int, sshUser string, key string, resType strin
 		return nil, fmt.Errorf("no authentication method available (%s, %s)", keyInfo, pwdInfo)
 	}
 
-	// 设置用户名（如果未提供，使用默认值）
-	if sshUser == "" {
-		sshUser = "root"
-	}
-
+	dialHost := strings.TrimSpace(ip)
+	// 按配置中的地址固定主机密钥，而不是 DNS 解析后的 IP
+	target.Host = net.JoinHostPort(dialHost, strconv.Itoa(port))
 	configs := &gossh.ClientConfig{
 		User:            sshUser,
 		Auth:            authMethods,
-		HostKeyCallback: gossh.HostKeyCallback(func(hostname string, remote net.Addr, key gossh.PublicKey) error { return nil }),
+		HostKeyCallback: knownhosts.HostKeyCallback(target),
 	}
 
-	dialHost := strings.TrimSpace(ip)
 	if resolved, err := utils.ResolveHostName(dialHost); err != nil {
 		logger.Logger.Warning(fmt.Sprintf("Resolve host failed for %s: %v", dialHost, err))
 	} else if resolved != "" && resolved != dialHost {
@@ -220,7 +314,7 @@ func NewSSHClient(ip string, port int, sshUser string, key string, resType strin
 		dialHost = resolved
 	}
 
-	addr := fmt.Sprintf("%s:%d", dialHost, port)
+	addr := net.JoinHostPort(dialHost, strconv.Itoa(port))
 
 	// 使用带超时的 TCP 连接（10秒超时）
 	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
@@ -241,6 +335,18 @@ func NewSSHClient(ip string, port int, sshUser string, key string, resType strin
 	return client, nil
 }
 
+// certKeyID 证书 key id：ROMA 用户和会话 ID，便于在上游 sshd 日志中追溯
+func certKeyID(target knownhosts.Target) string {
+	username := target.Username
+	if username == "" {
+		username = "system"
+	}
+	if target.SessionID == "" {
+		return fmt.Sprintf("roma:%s", username)
+	}
+	return fmt.Sprintf("roma:%s:%s", username, target.SessionID)
+}
+
 // ParseRawCommand ParseRawCommand
 func ParseRawCommand(command string) (string, []string, error) {
 	parts := strings.Split(command, " ")
@@ -0,0 +1,169 @@
+package sshd
+
+import (
+	"errors"
+	"fmt"
+
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/utils/logger"
+	"github.com/loganchef/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ErrTransferPermissionDenied 用户没有资源的 use 权限
+var ErrTransferPermissionDenied = errors.New("permission denied")
+
+// transferResourceTypes 支持文件传输（SCP/SFTP）的资源类型（可通过 SSH 连接的资源）
+// 顺序即同名资源的查找优先级
+var transferResourceTypes = []string{
+	constants.ResourceTypeLinux,
+	constants.ResourceTypeWindows,
+	constants.ResourceTypeDocker,
+	constants.ResourceTypeRouter,
+	constants.ResourceTypeSwitch,
+}
+
+// checkTransferPermission 检查用户是否有资源的 use 权限（SCP/SFTP 共用）
+func checkTransferPermission(username, clientIP string, resource model.Resource, resourceType string) error {
+	opUser := operation.NewUserOperation()
+	user, err := opUser.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("%w: unable to get user %s", ErrTransferPermissionDenied, username)
+	}
+	roles, err := opUser.GetUserRolesByUsername(username)
+	if err != nil {
+		return fmt.Errorf("%w: unable to get user roles", ErrTransferPermissionDenied)
+	}
+	if allowed, reason := permissions.CheckResourceAccessFrom(user, roles, resource.GetID(), resourceType, "use", clientIP); !allowed {
+		return fmt.Errorf("%w: %s %s", ErrTransferPermissionDenied, resource.GetName(), reason)
+	}
+	return nil
+}
+
+// listTransferResources 列出用户可以 use 的、支持文件传输的资源
+// 输出: map[string]transferResource - 以资源名称为键（与 SCP 路径中的 hostname 一致）
+func listTransferResources(username, clientIP string) (map[string]transferResource, error) {
+	result := make(map[string]transferResource)
+	err := eachUsableResource(username, clientIP, transferResourceTypes, func(res model.Resource, resourceType string) bool {
+		name := res.GetName()
+		// 同名时按 transferResourceTypes 顺序优先，与 SCP 的 parseResourcePath 查找顺序一致
+		if _, ok := result[name]; name != "" && !ok {
+			result[name] = transferResource{Resource: res, Type: resourceType}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// eachUsableResource 按类型顺序遍历用户可以 use 的资源，fn 返回 false 时停止遍历
+func eachUsableResource(username, clientIP string, resourceTypes []string, fn func(res model.Resource, resourceType string) bool) error {
+	opUser := operation.NewUserOperation()
+	user, err := opUser.GetUserByUsername(username)
+	if err != nil {
+		return fmt.Errorf("%w: unable to get user %s", ErrTransferPermissionDenied, username)
+	}
+	roles, err := opUser.GetUserRolesByUsername(username)
+	if err != nil {
+		return fmt.Errorf("%w: unable to get user roles", ErrTransferPermissionDenied)
+	}
+
+	op := operation.NewResourceOperation()
+	for _, resourceType := range resourceTypes {
+		var candidates []model.Resource
+		for _, role := range roles {
+			resList, err := op.GetResourceListByRoleId(role.ID, resourceType)
+			if err != nil {
+				logger.Logger.Warning(fmt.Sprintf("failed to list %s resources for role %d: %v", resourceType, role.ID, err))
+				continue
+			}
+			candidates = append(candidates, resList...)
+		}
+		// 角色资源范围（标签、空间、名称、类型）选中的资源
+		candidates = append(candidates, permissions.ScopedResources(roles, resourceType, candidates)...)
+		// 临时访问授权覆盖的资源
+		granted, err := permissions.GrantedResources(user.ID, resourceType)
+		if err != nil {
+			logger.Logger.Warning(fmt.Sprintf("failed to list granted %s resources for user %s: %v", resourceType, username, err))
+		}
+		seen := make(map[int64]bool, len(candidates))
+		for _, res := range candidates {
+			seen[res.GetID()] = true
+		}
+		for _, res := range granted {
+			if !seen[res.GetID()] {
+				seen[res.GetID()] = true
+				candidates = append(candidates, res)
+			}
+		}
+		for _, res := range candidates {
+			if allowed, _ := permissions.CheckResourceAccessFrom(user, roles, res.GetID(), resourceType, "use", clientIP); !allowed {
+				continue
+			}
+			if !fn(res, resourceType) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// transferResource 文件传输目标资源
+type transferResource struct {
+	Resource model.Resource
+	Type     string
+}
+
+// dialTransferResource 使用资源自身的凭证连接上游，与交互式连接一样并发尝试资源的所有 SSH 地址
+func dialTransferResource(sess ssh.Session, resource model.Resource, resourceType string) (*gossh.Client, error) {
+	client, conn, err := DialSSHConnections(ResourceHostKeyTarget(sess, resource, resourceType), resource.GetConnect(), resourceType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", resource.GetName(), err)
+	}
+	logger.Logger.Debug(fmt.Sprintf("Transfer: connected to %s via %s:%d", resource.GetName(), conn.Host, conn.Port))
+	return client, nil
+}
+
+// auditSubject 审计日志中的操作者，ssh.Session 和 ssh.Context 都满足
+type auditSubject interface {
+	User() string
+}
+
+// recordTransferAudit 异步记录文件传输（以及端口转发）审计日志
+func recordTransferAudit(sess auditSubject, resource model.Resource, resourceType, action, description string, transferErr error) {
+	auditLog := &model.AuditLog{
+		Username:     sess.User(),
+		Action:       action,
+		ActionType:   "normal",
+		ResourceType: resourceType,
+		Description:  description,
+		IPAddress:    GetClientIP(sess),
+		Status:       "success",
+	}
+	if resource != nil {
+		auditLog.ResourceID = uint(resource.GetID())
+		auditLog.ResourceName = resource.GetName()
+	}
+	if transferErr != nil {
+		auditLog.Status = "failed"
+		auditLog.ErrorMessage = transferErr.Error()
+	}
+	saveAuditLogAsync(auditLog)
+}
+
+// saveAuditLogAsync 补全用户 ID 后异步写入审计日志
+func saveAuditLogAsync(auditLog *model.AuditLog) {
+	go func() {
+		if user, err := operation.NewUserOperation().GetUserByUsername(auditLog.Username); err == nil {
+			auditLog.UserID = user.ID
+		}
+		if err := operation.NewAuditOperation().CreateAuditLog(auditLog); err != nil {
+			logger.Logger.Warning(fmt.Sprintf("Failed to record audit log %s: %v", auditLog.Action, err))
+		}
+	}()
+}
@@ -0,0 +1,74 @@
+package cmds
+
+import (
+	"sync"
+
+	"github.com/loganchef/ssh"
+)
+
+// InputChunk 一次从客户端读到的输入；Err 不为空时会话输入已结束
+type InputChunk struct {
+	Data []byte
+	Err  error
+}
+
+// InputSession 统一读取客户端输入的会话：同一时间最多只有一个对会话的读取，
+// 读到的输入交给下一个调用 Read 或从 Input 取数据的使用者
+// 必要性: readline 和需要读取按键的命令（如 sessions -w）共用会话输入，命令返回时无法取消已开始的读取，
+// 由这里持有该读取，读到的按键留给 readline，不会被丢弃
+type InputSession struct {
+	ssh.Session
+
+	mu      sync.Mutex
+	reading bool
+	err     error
+	chunks  chan InputChunk
+	pending []byte
+}
+
+// NewInputSession 包装会话，客户端输入改由 InputSession 读取
+func NewInputSession(sess ssh.Session) *InputSession {
+	return &InputSession{Session: sess, chunks: make(chan InputChunk, 1)}
+}
+
+// Input 需要时开始一次读取，返回接收输入的通道；每从通道取走一次输入后需要再次调用
+// 取走的输入不会再交给 Read；不再需要输入时直接放弃通道即可，之后读到的输入留给下一个使用者
+func (s *InputSession) Input() <-chan InputChunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reading || len(s.chunks) > 0 {
+		return s.chunks
+	}
+	if s.err != nil {
+		s.chunks <- InputChunk{Err: s.err}
+		return s.chunks
+	}
+	s.reading = true
+	go func() {
+		buf := make([]byte, 4096)
+		n, err := s.Session.Read(buf)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.reading = false
+		if err != nil {
+			s.err = err
+		}
+		// 只有一个读取，且通道为空时才会开始读取，这里不会阻塞
+		s.chunks <- InputChunk{Data: buf[:n], Err: err}
+	}()
+	return s.chunks
+}
+
+// Read 实现 io.Reader（供 readline 和上游会话使用），先返回上次未读完的输入
+func (s *InputSession) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		chunk := <-s.Input()
+		if len(chunk.Data) == 0 && chunk.Err != nil {
+			return 0, chunk.Err
+		}
+		s.pending = chunk.Data
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
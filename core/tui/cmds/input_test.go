@@ -0,0 +1,99 @@
+package cmds
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/loganchef/ssh"
+)
+
+// pipeSession 从管道读取客户端输入的会话
+type pipeSession struct {
+	ssh.Session
+	r *io.PipeReader
+}
+
+func (s *pipeSession) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+func newPipeInput(t *testing.T) (*InputSession, *io.PipeWriter) {
+	t.Helper()
+	r, w := io.Pipe()
+	t.Cleanup(func() { w.Close() })
+	return NewInputSession(&pipeSession{r: r}), w
+}
+
+func receive(t *testing.T, ch <-chan InputChunk) InputChunk {
+	t.Helper()
+	select {
+	case chunk := <-ch:
+		return chunk
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for input")
+		return InputChunk{}
+	}
+}
+
+func TestInputSessionRead(t *testing.T) {
+	input, w := newPipeInput(t)
+	go w.Write([]byte("hello"))
+
+	buf := make([]byte, 3)
+	var got []byte
+	for len(got) < 5 {
+		n, err := input.Read(buf)
+		if err != nil {
+			t.Fatalf("Read() error: %v", err)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "hello" {
+		t.Errorf("Read() = %q, want %q", got, "hello")
+	}
+}
+
+func TestInputSessionAbandonedRead(t *testing.T) {
+	input, w := newPipeInput(t)
+
+	// 旁观时取走的按键不再交给 Read
+	keys := input.Input()
+	go w.Write([]byte("x"))
+	if chunk := receive(t, keys); string(chunk.Data) != "x" {
+		t.Fatalf("Input() = %q, want %q", chunk.Data, "x")
+	}
+
+	// 旁观结束时还有未完成的读取：之后的按键留给 readline
+	input.Input()
+	if again := input.Input(); len(again) != 0 {
+		t.Fatal("Input() started a second read")
+	}
+	go w.Write([]byte("ls\r"))
+	buf := make([]byte, 16)
+	n, err := input.Read(buf)
+	if err != nil || string(buf[:n]) != "ls\r" {
+		t.Errorf("Read() = %q, %v, want %q", buf[:n], err, "ls\r")
+	}
+}
+
+func TestInputSessionError(t *testing.T) {
+	input, w := newPipeInput(t)
+	closed := errors.New("session closed")
+	w.CloseWithError(closed)
+
+	tests := []struct {
+		name string
+		read func() error
+	}{
+		{name: "input", read: func() error { return receive(t, input.Input()).Err }},
+		{name: "read", read: func() error { _, err := input.Read(make([]byte, 1)); return err }},
+		{name: "error is sticky", read: func() error { return receive(t, input.Input()).Err }},
+	}
+	for _, tt := range tests {
+		if err := tt.read(); !errors.Is(err, closed) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, closed)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package cmds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"binrc.com/roma/core/api"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/sshd"
+	"binrc.com/roma/core/tui/cmds/itface"
+	"github.com/loganchef/ssh"
+)
+
+func init() {
+	itface.Helpers = append(itface.Helpers, itface.HelperWeight{Helper: NewKnownHosts(nil), Weight: 9})
+	itface.Commands = append(itface.Commands, itface.CommandWeight{Command: NewKnownHosts(nil), Weight: 9})
+}
+
+// KnownHosts 管理员查看和确认上游主机密钥
+type KnownHosts struct {
+	baseLen int
+	flags   *Flags
+	sess    ssh.Session
+}
+
+func NewKnownHosts(sess ssh.Session) *KnownHosts {
+	flags := &Flags{}
+	flags.AddOption("a", "accept", "Accept the pending (rotated) host key of a record", StringOption, "")
+	flags.AddOption("d", "delete", "Forget a pinned host key, it will be pinned again on next connect", StringOption, "")
+	flags.AddOption("h", "help", "Display this help message", BoolOption, false)
+	return &KnownHosts{baseLen: 10, flags: flags, sess: sess}
+}
+
+// Name 返回命令名称
+func (cmd *KnownHosts) Name() string {
+	return "knownhosts"
+}
+
+func (cmd *KnownHosts) Execute(commands string) (string, error) {
+	args := ""
+	if len(commands) > cmd.baseLen {
+		args = commands[cmd.baseLen:]
+	}
+	cmd.flags.Parse(strings.Fields(args))
+
+	if cmd.flags.GetOption("help").IsSet {
+		return cmd.Usage(), nil
+	}
+
+	if id := cmd.flags.GetOption("accept"); id.IsSet {
+		if err := cmd.requirePermission("update"); err != nil {
+			return "", err
+		}
+		return cmd.accept(id.Value.(string))
+	}
+
+	if id := cmd.flags.GetOption("delete"); id.IsSet {
+		if err := cmd.requirePermission("delete"); err != nil {
+			return "", err
+		}
+		return cmd.delete(id.Value.(string))
+	}
+
+	if err := cmd.requirePermission("list"); err != nil {
+		return "", err
+	}
+	return cmd.list()
+}
+
+func (cmd *KnownHosts) requirePermission(action string) error {
+	roles, err := operation.NewUserOperation().GetUserRolesByUsername(cmd.sess.User())
+	if err != nil {
+		return errors.New("permission denied: unable to get user roles")
+	}
+	if allowed, reason := permissions.CheckRolesPermission(roles, "known_host", action, sshd.GetClientIP(cmd.sess)); !allowed {
+		if reason != "" {
+			return fmt.Errorf("permission denied: known_host.%s (%s)", action, reason)
+		}
+		return fmt.Errorf("permission denied: known_host.%s", action)
+	}
+	return nil
+}
+
+func (cmd *KnownHosts) list() (string, error) {
+	knownHosts, err := operation.NewKnownHostOperation().ListKnownHosts("", 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to list known hosts: %v", err)
+	}
+	if len(knownHosts) == 0 {
+		return "No known hosts.", nil
+	}
+
+	var buffer bytes.Buffer
+	tw := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", green("ID"), green("RESOURCE"), green("HOST"), green("FINGERPRINT"), green("PENDING"))
+	for _, kh := range knownHosts {
+		fingerprint := kh.Fingerprint
+		if fingerprint == "" {
+			fingerprint = "-"
+		}
+		pending := "-"
+		if kh.HasPendingKey() {
+			pending = yellow(kh.PendingFingerprint)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", kh.ID, fmt.Sprintf("%s/%d", kh.ResourceType, kh.ResourceID), kh.Host, fingerprint, pending)
+	}
+	tw.Flush()
+	return strings.TrimRight(buffer.String(), "\n"), nil
+}
+
+func (cmd *KnownHosts) accept(idStr string) (string, error) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid known host id: %s", idStr)
+	}
+	op := operation.NewKnownHostOperation()
+	before, err := op.GetKnownHostByID(uint(id))
+	if err != nil {
+		return "", fmt.Errorf("known host %d not found", id)
+	}
+
+	ip := sshd.GetClientIP(cmd.sess)
+	knownHost, err := op.AcceptPendingKey(uint(id))
+	if err != nil {
+		api.RecordTUIActionAuditLog(cmd.sess.User(), "host_key_accept", "high_risk", before.ResourceType, before.ResourceID, before.Host,
+			fmt.Sprintf("确认上游主机 %s 的新密钥", before.Host), ip, "failed", err.Error())
+		return "", fmt.Errorf("known host %d has no pending key", id)
+	}
+	api.RecordTUIActionAuditLog(cmd.sess.User(), "host_key_accept", "high_risk", knownHost.ResourceType, knownHost.ResourceID, knownHost.Host,
+		fmt.Sprintf("确认上游主机 %s 的新密钥，原指纹: %s，新指纹: %s", knownHost.Host, before.Fingerprint, knownHost.Fingerprint),
+		ip, "success", "")
+	return fmt.Sprintf("Host key for %s accepted: %s", knownHost.Host, knownHost.Fingerprint), nil
+}
+
+func (cmd *KnownHosts) delete(idStr string) (string, error) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid known host id: %s", idStr)
+	}
+	op := operation.NewKnownHostOperation()
+	knownHost, err := op.GetKnownHostByID(uint(id))
+	if err != nil {
+		return "", fmt.Errorf("known host %d not found", id)
+	}
+
+	ip := sshd.GetClientIP(cmd.sess)
+	if err := op.DeleteKnownHost(knownHost.ID); err != nil {
+		api.RecordTUIActionAuditLog(cmd.sess.User(), "host_key_delete", "high_risk", knownHost.ResourceType, knownHost.ResourceID, knownHost.Host,
+			fmt.Sprintf("删除上游主机 %s 的固定密钥", knownHost.Host), ip, "failed", err.Error())
+		return "", fmt.Errorf("failed to delete known host %d: %v", id, err)
+	}
+	api.RecordTUIActionAuditLog(cmd.sess.User(), "host_key_delete", "high_risk", knownHost.ResourceType, knownHost.ResourceID, knownHost.Host,
+		fmt.Sprintf("删除上游主机 %s 的固定密钥，指纹: %s", knownHost.Host, knownHost.Fingerprint), ip, "success", "")
+	return fmt.Sprintf("Host key for %s forgotten.", knownHost.Host), nil
+}
+
+func (cmd *KnownHosts) Usage() string {
+	usageMsg := cmd.flags.FormatUsagef("🍂 %s", green(cmd.Name()+" [OPTIONS]"))
+	usageMsg += cmd.flags.FormatUsagef("List, accept or forget pinned upstream host keys (administrators only)")
+	usageMsg += cmd.flags.FormatUsagef("Usage:")
+
+	var buffer bytes.Buffer
+	tw := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	tw = cmd.flags.ColorUsage(tw)
+	tw.Flush()
+	return usageMsg + buffer.String()
+}
@@ -14,6 +14,7 @@ import (
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/sshd"
 	"binrc.com/roma/core/tui/cmds/itface"
 	"binrc.com/roma/core/utils"
 	"github.com/loganchef/ssh"
@@ -186,6 +187,7 @@ func (cmd *Ln) handleWithCommand(execCommand string) (interface{}, error) {
 	op := operation.NewResourceOperation()
 	resourceType := cmd.flags.GetOptionValue("type").(string)
 
+	denied := ""
 	log.Info().Msg("roles:")
 	for _, role := range roles {
 		resList, _ := op.GetResourceListByRoleId(role.ID, resourceType)
@@ -194,17 +196,45 @@ func (cmd *Ln) handleWithCommand(execCommand string) (interface{}, error) {
 			log.Info().Msgf("searchType: %v", searchType)
 			log.Info().Msgf("resA: %v", resA)
 			if matchResource(res, searchType, resA) {
-				// 使用 CheckResourceAccessWithRoles 检查权限（角色 + 空间），避免重复查询用户角色
-				allowed, reason := permissions.CheckResourceAccessWithRoles(user, roles, res.GetID(), resourceType, "use")
+				// 使用 CheckResourceAccessFrom 检查权限（角色 + 空间），避免重复查询用户角色
+				allowed, reason := permissions.CheckResourceAccessFrom(user, roles, res.GetID(), resourceType, "use", sshd.GetClientIP(cmd.sess))
 				if !allowed {
 					log.Debug().Msgf("Resource %s (ID: %d) access denied: %s", res.GetName(), res.GetID(), reason)
+					if denied == "" {
+						denied = fmt.Sprintf("%s: %s", res.GetName(), reason)
+					}
 					continue
 				}
 				resListA = append(resListA, res)
 			}
 		}
 	}
+	// 角色资源范围（标签、空间、名称、类型）选中的资源
+	for _, res := range permissions.ScopedResources(roles, resourceType, resListA) {
+		if !matchResource(res, searchType, resA) {
+			continue
+		}
+		allowed, reason := permissions.CheckResourceAccessFrom(user, roles, res.GetID(), resourceType, "use", sshd.GetClientIP(cmd.sess))
+		if !allowed {
+			log.Debug().Msgf("Resource %s (ID: %d) access denied: %s", res.GetName(), res.GetID(), reason)
+			if denied == "" {
+				denied = fmt.Sprintf("%s: %s", res.GetName(), reason)
+			}
+			continue
+		}
+		resListA = append(resListA, res)
+	}
+	// 临时访问授权覆盖的资源
+	for _, res := range grantedResources(user.ID, resourceType, resListA) {
+		if matchResource(res, searchType, resA) {
+			resListA = append(resListA, res)
+		}
+	}
 	if len(resListA) == 0 {
+		if denied != "" {
+			// 目标在用户角色的资源内但检查未通过（如不在权限生效时段），给出原因
+			return nil, fmt.Errorf("permission denied: %s", denied)
+		}
 		return nil, errors.New("resource not found or permission denied")
 	}
 	if len(resListA) > 1 {
@@ -11,6 +11,7 @@ import (
 	"binrc.com/roma/core/model"
 	"binrc.com/roma/core/operation"
 	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/sshd"
 	"binrc.com/roma/core/tui/cmds/itface"
 	"github.com/loganchef/ssh"
 	"github.com/rs/zerolog/log"
@@ -165,8 +166,8 @@ func (cmd *Ls) handleResources(resourceType string) ([]model.Resource, error) {
 	for _, role := range roles {
 		resList, _ := op.GetResourceListByRoleId(role.ID, resourceType)
 		for _, res := range resList {
-			// 使用 CheckResourceAccessWithRoles 检查权限（角色 + 空间），避免重复查询用户角色
-			allowed, reason := permissions.CheckResourceAccessWithRoles(user, roles, res.GetID(), resourceType, "list")
+			// 使用 CheckResourceAccessFrom 检查权限（角色 + 空间），避免重复查询用户角色
+			allowed, reason := permissions.CheckResourceAccessFrom(user, roles, res.GetID(), resourceType, "list", sshd.GetClientIP(cmd.sess))
 			if !allowed {
 				log.Debug().Msgf("Resource %s (ID: %d) access denied: %s", res.GetName(), res.GetID(), reason)
 				continue
@@ -201,6 +202,18 @@ func (cmd *Ls) handleResources(resourceType string) ([]model.Resource, error) {
 		}
 	}
 
+	// 角色资源范围（标签、空间、名称、类型）选中的资源
+	for _, res := range permissions.ScopedResources(roles, resourceType, resListA) {
+		if allowed, reason := permissions.CheckResourceAccessFrom(user, roles, res.GetID(), resourceType, "list", sshd.GetClientIP(cmd.sess)); !allowed {
+			log.Debug().Msgf("Resource %s (ID: %d) access denied: %s", res.GetName(), res.GetID(), reason)
+			continue
+		}
+		resListA = append(resListA, res)
+	}
+
+	// 临时访问授权覆盖的资源
+	resListA = append(resListA, grantedResources(user.ID, resourceType, resListA)...)
+
 	if len(resListA) == 0 {
 		return nil, errors.New("resource of " + resourceType + " is empty or permission denied")
 	}
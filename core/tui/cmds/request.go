@@ -0,0 +1,256 @@
+package cmds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"binrc.com/roma/core/constants"
+	"binrc.com/roma/core/jitaccess"
+	"binrc.com/roma/core/model"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/sshd"
+	"binrc.com/roma/core/tui/cmds/itface"
+	"github.com/loganchef/ssh"
+)
+
+func init() {
+	itface.Helpers = append(itface.Helpers, itface.HelperWeight{Helper: NewRequest(nil), Weight: 9})
+	itface.Commands = append(itface.Commands, itface.CommandWeight{Command: NewRequest(nil), Weight: 9})
+}
+
+// Request 申请临时访问资源或空间，审批人在此审批
+type Request struct {
+	baseLen int
+	flags   *Flags
+	sess    ssh.Session
+}
+
+func NewRequest(sess ssh.Session) *Request {
+	flags := &Flags{}
+	flags.AddOption("t", "type", "Resource type of the requested resource", StringOption, constants.ResourceTypeLinux)
+	flags.AddOption("s", "space", "Request a whole space instead of a single resource", StringOption, "")
+	flags.AddOption("l", "list", "List my access requests", BoolOption, false)
+	flags.AddOption("p", "pending", "List requests waiting for approval (approvers only)", BoolOption, false)
+	flags.AddOption("a", "approve", "Approve a request by ID (approvers only)", StringOption, "")
+	flags.AddOption("d", "deny", "Deny a request by ID (approvers only)", StringOption, "")
+	flags.AddOption("R", "revoke", "Revoke an active grant by ID (approvers only)", StringOption, "")
+	flags.AddOption("x", "cancel", "Withdraw my own request or end my grant early", StringOption, "")
+	flags.AddOption("c", "comment", "Comment recorded with approve/deny/revoke", StringOption, "")
+	flags.AddOption("h", "help", "Display this help message", BoolOption, false)
+	return &Request{baseLen: 7, flags: flags, sess: sess}
+}
+
+// Name 返回命令名称
+func (cmd *Request) Name() string {
+	return "request"
+}
+
+func (cmd *Request) Execute(commands string) (string, error) {
+	args := []string{}
+	if len(commands) > cmd.baseLen {
+		args = parseArgsWithQuotes(commands[cmd.baseLen:])
+	}
+	cmd.flags.Parse(args)
+	positional := cmd.positional(args)
+
+	if cmd.flags.GetOption("help").IsSet {
+		return cmd.Usage(), nil
+	}
+
+	user, err := operation.NewUserOperation().GetUserByUsername(cmd.sess.User())
+	if err != nil {
+		return "", errors.New("permission denied: unable to get user")
+	}
+	ip := sshd.GetClientIP(cmd.sess)
+	comment := cmd.flags.GetOptionValue("comment").(string)
+
+	decisions := []struct {
+		option string
+		verb   string
+		fn     func(*model.User, uint, string, string) (*model.AccessRequest, error)
+	}{
+		{"approve", "approved", jitaccess.Approve},
+		{"deny", "denied", jitaccess.Deny},
+		{"revoke", "revoked", jitaccess.Revoke},
+	}
+	for _, d := range decisions {
+		if opt := cmd.flags.GetOption(d.option); opt.IsSet {
+			id, err := parseRequestID(opt.Value.(string))
+			if err != nil {
+				return "", err
+			}
+			req, err := d.fn(user, id, comment, ip)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Request #%d (%s → %s) %s.", req.ID, req.Username, req.Target(), d.verb), nil
+		}
+	}
+
+	if opt := cmd.flags.GetOption("cancel"); opt.IsSet {
+		id, err := parseRequestID(opt.Value.(string))
+		if err != nil {
+			return "", err
+		}
+		req, err := jitaccess.Cancel(user, id, ip)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Request #%d (%s) is now %s.", req.ID, req.Target(), req.Status), nil
+	}
+
+	if cmd.flags.GetOption("pending").IsSet {
+		roles, err := operation.NewUserOperation().GetUserRoles(user.ID)
+		if err != nil {
+			return "", errors.New("permission denied: access_request.list")
+		}
+		if allowed, reason := permissions.CheckRolesPermission(roles, "access_request", "list", ip); !allowed {
+			if reason != "" {
+				return "", fmt.Errorf("permission denied: access_request.list (%s)", reason)
+			}
+			return "", errors.New("permission denied: access_request.list")
+		}
+		reqs, err := jitaccess.List(0, model.AccessRequestPending)
+		if err != nil {
+			return "", err
+		}
+		return cmd.list(reqs, "No pending access requests."), nil
+	}
+
+	if cmd.flags.GetOption("list").IsSet || (len(positional) == 0 && !cmd.flags.GetOption("space").IsSet) {
+		reqs, err := jitaccess.List(user.ID, "")
+		if err != nil {
+			return "", err
+		}
+		return cmd.list(reqs, "No access requests."), nil
+	}
+
+	return cmd.submit(user, positional, ip)
+}
+
+// submit 提交申请：request [-t TYPE] RESOURCE DURATION "REASON" 或 request -s SPACE DURATION "REASON"
+func (cmd *Request) submit(user *model.User, positional []string, ip string) (string, error) {
+	space := cmd.flags.GetOptionValue("space").(string)
+	if space == "" {
+		if len(positional) < 3 {
+			return "", errors.New("usage: request RESOURCE DURATION \"REASON\", please request -h to get help")
+		}
+	} else if len(positional) < 2 {
+		return "", errors.New("usage: request -s SPACE DURATION \"REASON\", please request -h to get help")
+	}
+	name := ""
+	if space == "" {
+		name, positional = positional[0], positional[1:]
+	}
+	duration, err := jitaccess.ParseDuration(positional[0])
+	if err != nil {
+		return "", err
+	}
+	reason := strings.Join(positional[1:], " ")
+
+	var req *model.AccessRequest
+	if space != "" {
+		req, err = jitaccess.RequestSpace(user, space, duration, reason, ip)
+	} else {
+		resourceType := cmd.flags.GetOptionValue("type").(string)
+		if !sliceContains(constants.GetResourceType(), resourceType) {
+			return "", errors.New("invalid resource type, please request -h to get help")
+		}
+		req, err = jitaccess.RequestResource(user, resourceType, name, duration, reason, ip)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Request #%d for %s (%s) submitted, waiting for approval.", req.ID, req.Target(), duration), nil
+}
+
+// positional 提取位置参数，跳过选项及其取值
+func (cmd *Request) positional(args []string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			result = append(result, arg)
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if !strings.HasPrefix(arg, "--") && len(name) > 0 {
+			name = name[len(name)-1:]
+		}
+		if opt := cmd.flags.GetOption(name); opt != nil && opt.Type == StringOption {
+			i++
+		}
+	}
+	return result
+}
+
+func (cmd *Request) list(reqs []*model.AccessRequest, empty string) string {
+	if len(reqs) == 0 {
+		return empty
+	}
+	var buffer bytes.Buffer
+	tw := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", green("ID"), green("USER"), green("TARGET"), green("DURATION"), green("STATUS"), green("EXPIRES"), green("REASON"))
+	now := time.Now()
+	for _, r := range reqs {
+		status := r.Status
+		if r.Status == model.AccessRequestApproved && r.IsActive(now) {
+			status = yellow("active")
+		}
+		expires := "-"
+		if r.ExpiresAt != nil {
+			expires = r.ExpiresAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.Username, r.Target(), time.Duration(r.DurationSeconds)*time.Second, status, expires, r.Reason)
+	}
+	tw.Flush()
+	return strings.TrimRight(buffer.String(), "\n")
+}
+
+func parseRequestID(s string) (uint, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid request id %q", s)
+	}
+	return uint(id), nil
+}
+
+// grantedResources 返回临时访问授权覆盖、且不在 existing 中的资源
+func grantedResources(userID uint, resourceType string, existing []model.Resource) []model.Resource {
+	granted, err := permissions.GrantedResources(userID, resourceType)
+	if err != nil || len(granted) == 0 {
+		return nil
+	}
+	seen := make(map[int64]bool, len(existing))
+	for _, res := range existing {
+		seen[res.GetID()] = true
+	}
+	var result []model.Resource
+	for _, res := range granted {
+		if !seen[res.GetID()] {
+			seen[res.GetID()] = true
+			result = append(result, res)
+		}
+	}
+	return result
+}
+
+func (cmd *Request) Usage() string {
+	usageMsg := cmd.flags.FormatUsagef("🍂 %s", green(cmd.Name()+" [OPTIONS] RESOURCE DURATION \"REASON\""))
+	usageMsg += cmd.flags.FormatUsagef("Request time-boxed access to a resource or a whole space, e.g. request web-01 2h \"investigate incident\"")
+	usageMsg += cmd.flags.FormatUsagef("DURATION accepts 30m, 2h or 1d (at most %s); access starts when approved", jitaccess.MaxDuration())
+	usageMsg += cmd.flags.FormatUsagef("Usage:")
+
+	var buffer bytes.Buffer
+	tw := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	tw = cmd.flags.ColorUsage(tw)
+	tw.Flush()
+	return usageMsg + buffer.String()
+}
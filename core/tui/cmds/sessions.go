@@ -0,0 +1,229 @@
+package cmds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"binrc.com/roma/core/api"
+	"binrc.com/roma/core/cmdpolicy"
+	"binrc.com/roma/core/operation"
+	"binrc.com/roma/core/permissions"
+	"binrc.com/roma/core/sshd"
+	"binrc.com/roma/core/tui/cmds/itface"
+	"github.com/loganchef/ssh"
+)
+
+func init() {
+	itface.Helpers = append(itface.Helpers, itface.HelperWeight{Helper: NewSessions(nil), Weight: 8})
+	itface.Commands = append(itface.Commands, itface.CommandWeight{Command: NewSessions(nil), Weight: 8})
+}
+
+// Sessions 管理员查看、旁观和结束活动会话
+type Sessions struct {
+	baseLen int
+	flags   *Flags
+	sess    ssh.Session
+}
+
+func NewSessions(sess ssh.Session) *Sessions {
+	flags := &Flags{}
+	flags.AddOption("w", "watch", "Watch (read-only) a live session, press q or Ctrl-C to stop", StringOption, "")
+	flags.AddOption("k", "kill", "Terminate a live session", StringOption, "")
+	flags.AddOption("r", "reason", "Reason shown to the user when killing", StringOption, "")
+	flags.AddOption("P", "pending", "List commands waiting for a second approver", BoolOption, false)
+	flags.AddOption("A", "approve", "Approve a pending command by ID", StringOption, "")
+	flags.AddOption("D", "reject", "Reject a pending command by ID", StringOption, "")
+	flags.AddOption("h", "help", "Display this help message", BoolOption, false)
+	return &Sessions{baseLen: 8, flags: flags, sess: sess}
+}
+
+// Name 返回命令名称
+func (cmd *Sessions) Name() string {
+	return "sessions"
+}
+
+func (cmd *Sessions) Execute(commands string) (string, error) {
+	args := ""
+	if len(commands) > cmd.baseLen {
+		args = commands[cmd.baseLen:]
+	}
+	cmd.flags.Parse(strings.Fields(args))
+
+	if cmd.flags.GetOption("help").IsSet {
+		return cmd.Usage(), nil
+	}
+
+	if id := cmd.flags.GetOption("kill"); id.IsSet {
+		if err := cmd.requirePermission("delete"); err != nil {
+			return "", err
+		}
+		return cmd.kill(id.Value.(string), cmd.flags.GetOptionValue("reason").(string))
+	}
+
+	if id := cmd.flags.GetOption("approve"); id.IsSet {
+		return cmd.decide(id.Value.(string), true)
+	}
+
+	if id := cmd.flags.GetOption("reject"); id.IsSet {
+		return cmd.decide(id.Value.(string), false)
+	}
+
+	if cmd.flags.GetOption("pending").IsSet {
+		if err := cmd.requirePermission("approve"); err != nil {
+			return "", err
+		}
+		return cmd.pending(), nil
+	}
+
+	if id := cmd.flags.GetOption("watch"); id.IsSet {
+		if err := cmd.requirePermission("get"); err != nil {
+			return "", err
+		}
+		return cmd.watch(id.Value.(string))
+	}
+
+	if err := cmd.requirePermission("list"); err != nil {
+		return "", err
+	}
+	return cmd.list(), nil
+}
+
+func (cmd *Sessions) requirePermission(action string) error {
+	roles, err := operation.NewUserOperation().GetUserRolesByUsername(cmd.sess.User())
+	if err != nil {
+		return errors.New("permission denied: unable to get user roles")
+	}
+	if allowed, reason := permissions.CheckRolesPermission(roles, "session", action, sshd.GetClientIP(cmd.sess)); !allowed {
+		if reason != "" {
+			return fmt.Errorf("permission denied: session.%s (%s)", action, reason)
+		}
+		return fmt.Errorf("permission denied: session.%s", action)
+	}
+	return nil
+}
+
+func (cmd *Sessions) list() string {
+	sessions := sshd.ListActiveSessions()
+	if len(sessions) == 0 {
+		return "No active sessions."
+	}
+
+	var buffer bytes.Buffer
+	tw := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", green("ID"), green("TYPE"), green("USER"), green("RESOURCE"), green("FROM"), green("STARTED"), green("IN"), green("OUT"))
+	for _, s := range sessions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+			s.ID, s.Type, s.Username, fmt.Sprintf("%s/%s", s.ResourceType, s.ResourceName), s.ClientIP,
+			s.StartedAt.Format("2006-01-02 15:04:05"), s.BytesIn, s.BytesOut)
+	}
+	tw.Flush()
+	return strings.TrimRight(buffer.String(), "\n")
+}
+
+func (cmd *Sessions) pending() string {
+	commands := cmdpolicy.ListPending()
+	if len(commands) == 0 {
+		return "No commands waiting for approval."
+	}
+
+	var buffer bytes.Buffer
+	tw := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", green("ID"), green("USER"), green("RESOURCE"), green("POLICY"), green("EXPIRES"), green("COMMAND"))
+	for _, p := range commands {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.ID, p.Username, fmt.Sprintf("%s/%s", p.ResourceType, p.ResourceName), p.Policy,
+			p.ExpiresAt.Format("2006-01-02 15:04:05"), p.Command)
+	}
+	tw.Flush()
+	return strings.TrimRight(buffer.String(), "\n")
+}
+
+// decide 批准或拒绝等待审批的命令，权限和自审批由 cmdpolicy.Decide 检查
+func (cmd *Sessions) decide(id string, approve bool) (string, error) {
+	info, err := cmdpolicy.Decide(cmd.sess.User(), id, approve, sshd.GetClientIP(cmd.sess))
+	if err != nil {
+		if errors.Is(err, cmdpolicy.ErrNotApprover) {
+			return "", errors.New("permission denied: session.approve")
+		}
+		return "", err
+	}
+	verb := "approved"
+	if !approve {
+		verb = "rejected"
+	}
+	return fmt.Sprintf("Command %s by %s on %s %s: %s", info.ID, info.Username, info.ResourceName, verb, info.Command), nil
+}
+
+func (cmd *Sessions) kill(id, reason string) (string, error) {
+	ip := sshd.GetClientIP(cmd.sess)
+	info, err := sshd.KillActiveSession(id, reason)
+	if err != nil {
+		api.RecordTUIActionAuditLog(cmd.sess.User(), "kill_session", "high_risk", "session", 0, id,
+			fmt.Sprintf("强制结束会话 %s", id), ip, "failed", err.Error())
+		return "", fmt.Errorf("session %s not found", id)
+	}
+	api.RecordTUIActionAuditLog(cmd.sess.User(), "kill_session", "high_risk", info.ResourceType, info.ResourceID, info.ResourceName,
+		fmt.Sprintf("强制结束会话 %s（用户: %s, 来源: %s, 上游: %s, 原因: %s）", info.ID, info.Username, info.ClientIP, info.Host, reason),
+		ip, "success", "")
+	return fmt.Sprintf("Session %s (%s@%s) terminated.", info.ID, info.Username, info.ResourceName), nil
+}
+
+func (cmd *Sessions) watch(id string) (string, error) {
+	live, err := sshd.GetActiveSession(id)
+	if err != nil {
+		return "", fmt.Errorf("session %s not found", id)
+	}
+	info := live.Info()
+	if !live.Watchable() {
+		return "", fmt.Errorf("session %s is a %s session without terminal output", id, info.Type)
+	}
+	api.RecordTUIActionAuditLog(cmd.sess.User(), "shadow_session", "high_risk", info.ResourceType, info.ResourceID, info.ResourceName,
+		fmt.Sprintf("旁观会话 %s（用户: %s, 上游: %s）", info.ID, info.Username, info.Host), sshd.GetClientIP(cmd.sess), "success", "")
+
+	fmt.Fprintf(cmd.sess, "[*] Watching %s@%s (read-only), press q or Ctrl-C to stop\r\n", info.Username, info.ResourceName)
+
+	output, cancel := live.Shadow()
+	defer cancel()
+
+	// 只读：键盘输入只用于退出旁观，不会转发给被旁观会话
+	// 通过 InputSession 读取，旁观结束时未完成的读取留给 readline，不会吞掉下一次按键
+	input, ok := cmd.sess.(*InputSession)
+	if !ok {
+		input = NewInputSession(cmd.sess)
+	}
+	keys := input.Input()
+
+	started := time.Now()
+	for {
+		select {
+		case data, ok := <-output:
+			if !ok {
+				return fmt.Sprintf("\r\n[*] Session %s ended (watched %s)", id, time.Since(started).Round(time.Second)), nil
+			}
+			cmd.sess.Write(data)
+		case chunk := <-keys:
+			if chunk.Err != nil || bytes.ContainsAny(chunk.Data, "q\x03") {
+				return fmt.Sprintf("\r\n[*] Stopped watching session %s", id), nil
+			}
+			keys = input.Input()
+		case <-cmd.sess.Context().Done():
+			return "", nil
+		}
+	}
+}
+
+func (cmd *Sessions) Usage() string {
+	usageMsg := cmd.flags.FormatUsagef("🍂 %s", green(cmd.Name()+" [OPTIONS]"))
+	usageMsg += cmd.flags.FormatUsagef("List, watch or terminate live sessions and approve held commands (administrators only)")
+	usageMsg += cmd.flags.FormatUsagef("Usage:")
+
+	var buffer bytes.Buffer
+	tw := tabwriter.NewWriter(&buffer, 0, 0, 2, ' ', 0)
+	tw = cmd.flags.ColorUsage(tw)
+	tw.Flush()
+	return usageMsg + buffer.String()
+}
@@ -86,14 +86,7 @@ func roleSummary(rawDesc string) string {
 		}
 		var segments []string
 		for _, perm := range desc.Permissions {
-			label := perm.Target
-			if len(perm.Actions) > 0 {
-				label = fmt.Sprintf("%s(%s)", perm.Target, strings.Join(perm.Actions, "|"))
-			}
-			if perm.Scope != nil && perm.Scope.Value != "" {
-				label = fmt.Sprintf("%s scope:%s:%s", label, perm.Scope.Type, perm.Scope.Value)
-			}
-			segments = append(segments, label)
+			segments = append(segments, perm.String())
 		}
 		if len(segments) > 0 {
 			return strings.Join(segments, "; ")
@@ -72,6 +72,20 @@ func handleWhoami(ui *TUI, args []string, input string) (string, error) {
 	return output, nil
 }
 
+// Function to handle the "sessions" command
+func handleSessions(ui *TUI, cmd string) (string, error) {
+	return cmds.NewSessions(*ui.sess).Execute(cmd)
+}
+
+// Function to handle the "knownhosts" command
+func handleKnownHosts(ui *TUI, cmd string) (string, error) {
+	return cmds.NewKnownHosts(*ui.sess).Execute(cmd)
+}
+
+func handleRequest(ui *TUI, cmd string) (string, error) {
+	return cmds.NewRequest(*ui.sess).Execute(cmd)
+}
+
 // getNonEmptyLines 返回非空行的切片
 func getNonEmptyLines(input string) []string {
 	var lines []string
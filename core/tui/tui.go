@@ -25,8 +25,10 @@ type TUI struct {
 }
 
 // SetSession SetSession
+// 客户端输入统一由 cmds.InputSession 读取，readline 与读取按键的命令（如 sessions -w）不会互相抢占输入
 func (ui *TUI) SetSession(s *ssh.Session) {
-	ui.sess = s
+	var sess ssh.Session = cmds.NewInputSession(*s)
+	ui.sess = &sess
 }
 
 // Function constructor - constructs new function for listing given directory
@@ -65,6 +67,28 @@ var completer = readline.NewPrefixCompleter(
 	),
 	readline.PcItem("help"),
 	readline.PcItem("whoami"),
+	readline.PcItem("sessions",
+		readline.PcItem("-h", readline.PcItem("--help")),
+		readline.PcItem("-w", readline.PcItem("--watch")),
+		readline.PcItem("-k", readline.PcItem("--kill")),
+		readline.PcItem("-P", readline.PcItem("--pending")),
+		readline.PcItem("-A", readline.PcItem("--approve")),
+		readline.PcItem("-D", readline.PcItem("--reject")),
+	),
+	readline.PcItem("knownhosts",
+		readline.PcItem("-h", readline.PcItem("--help")),
+		readline.PcItem("-a", readline.PcItem("--accept")),
+		readline.PcItem("-d", readline.PcItem("--delete")),
+	),
+	readline.PcItem("request",
+		readline.PcItem("-h", readline.PcItem("--help")),
+		readline.PcItem("-l", readline.PcItem("--list")),
+		readline.PcItem("-p", readline.PcItem("--pending")),
+		readline.PcItem("-s", readline.PcItem("--space")),
+		readline.PcItem("-a", readline.PcItem("--approve")),
+		readline.PcItem("-d", readline.PcItem("--deny")),
+		readline.PcItem("-x", readline.PcItem("--cancel")),
+	),
 	readline.PcItem("clear"),
 	readline.PcItem("history"),
 	readline.PcItem("grep"),
@@ -236,6 +260,12 @@ func (ui *TUI) executeCommand(l *readline.Instance, cmd string, page string, his
 			output, lastErr = handleHelp(ui, args, previousOutput)
 		case "whoami":
 			output, lastErr = handleWhoami(ui, args, previousOutput)
+		case "sessions":
+			output, lastErr = handleSessions(ui, cmd)
+		case "knownhosts":
+			output, lastErr = handleKnownHosts(ui, cmd)
+		case "request":
+			output, lastErr = handleRequest(ui, cmd)
 		case "clear":
 			handleClear(ui)
 		case "history":
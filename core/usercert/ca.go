@@ -0,0 +1,144 @@
+package usercert
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/operation"
+	gossh "golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+// defaultCertValidity 未配置 validity_minutes 时证书的有效期
+const defaultCertValidity = 5 * time.Minute
+
+// certClockSkew 证书生效时间提前量，容忍上游主机的时钟偏差
+const certClockSkew = time.Minute
+
+// caSigner 缓存内置 CA 的签名器
+var caSigner struct {
+	sync.Mutex
+	signer gossh.Signer
+}
+
+// CAEnabled 是否使用内置 CA 签发的证书登录上游主机
+func CAEnabled() bool {
+	return global.CONFIG != nil && global.CONFIG.Security != nil &&
+		global.CONFIG.Security.SSHCA != nil && global.CONFIG.Security.SSHCA.Enabled
+}
+
+// CertValidity 签发证书的有效期
+func CertValidity() time.Duration {
+	if CAEnabled() && global.CONFIG.Security.SSHCA.ValidityMinutes > 0 {
+		return time.Duration(global.CONFIG.Security.SSHCA.ValidityMinutes) * time.Minute
+	}
+	return defaultCertValidity
+}
+
+// CASigner 返回内置 CA 的签名器，数据库中没有 CA 密钥时生成一把 ed25519 密钥
+func CASigner() (gossh.Signer, error) {
+	caSigner.Lock()
+	defer caSigner.Unlock()
+	if caSigner.signer != nil {
+		return caSigner.signer, nil
+	}
+
+	op := operation.NewSSHCAKeyOperation()
+	caKey, err := op.GetLatestSSHCAKey()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		privateKey, publicKey, genErr := generateCAKey()
+		if genErr != nil {
+			return nil, genErr
+		}
+		caKey, err = op.SaveSSHCAKey(privateKey, publicKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ssh ca key: %v", err)
+	}
+
+	signer, err := gossh.ParsePrivateKey(caKey.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh ca key: %v", err)
+	}
+	caSigner.signer = signer
+	return signer, nil
+}
+
+// CAPublicKey 返回内置 CA 的公钥（authorized_keys 格式），用于配置上游的 TrustedUserCAKeys
+func CAPublicKey() (string, error) {
+	signer, err := CASigner()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
+
+// NewCertSigner 为一次上游连接签发短期证书
+// 输入: principal - 上游主机上的用户名；keyID - 证书 key id（ROMA 用户和会话 ID，会出现在上游 sshd 日志中）
+// 输出: gossh.Signer - 持有临时私钥和证书的签名器；error - 错误信息
+// 必要性: 临时私钥只存在于内存中，证书几分钟后过期，无需在数据库中保存长期私钥
+func NewCertSigner(principal, keyID string) (gossh.Signer, error) {
+	ca, err := CASigner()
+	if err != nil {
+		return nil, err
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := &gossh.Certificate{
+		Key:             signer.PublicKey(),
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        gossh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: []string{principal},
+		ValidAfter:      uint64(now.Add(-certClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(CertValidity()).Unix()),
+		Permissions: gossh.Permissions{
+			Extensions: map[string]string{
+				"permit-pty":              "",
+				"permit-agent-forwarding": "",
+			},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, err
+	}
+	return gossh.NewCertSigner(cert, signer)
+}
+
+// generateCAKey 生成 ed25519 CA 密钥，返回 PEM 私钥和 authorized_keys 格式公钥
+func generateCAKey() ([]byte, []byte, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := gossh.MarshalPrivateKey(priv, "roma-ssh-ca")
+	if err != nil {
+		return nil, nil, err
+	}
+	sshPub, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(sshPub))) + " roma-ssh-ca"
+	return pem.EncodeToMemory(block), []byte(publicKey), nil
+}
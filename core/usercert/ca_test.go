@@ -0,0 +1,149 @@
+package usercert
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	"binrc.com/roma/core/model"
+	gossh "golang.org/x/crypto/ssh"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file:usercert?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.AutoMigrate(&model.SSHCAKey{}); err != nil {
+		panic(err)
+	}
+	global.CDB = db
+	global.CONFIG = &configs.Config{}
+	os.Exit(m.Run())
+}
+
+// resetCASigner 清空内置 CA 签名器缓存，下次从数据库重新加载
+func resetCASigner() {
+	caSigner.Lock()
+	caSigner.signer = nil
+	caSigner.Unlock()
+}
+
+// withSSHCA 在测试期间使用指定的内置 CA 配置
+func withSSHCA(t *testing.T, cfg *configs.SSHCAConfig) {
+	t.Helper()
+	saved := global.CONFIG
+	t.Cleanup(func() { global.CONFIG = saved })
+	global.CONFIG = &configs.Config{Security: &configs.SecurityConfig{SSHCA: cfg}}
+}
+
+func TestCASignerPersisted(t *testing.T) {
+	resetCASigner()
+	first, err := CAPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 缓存清空后从数据库加载同一把密钥，不会重新生成
+	resetCASigner()
+	second, err := CAPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("CA public key changed after reload: %q != %q", first, second)
+	}
+	var count int64
+	global.CDB.Model(&model.SSHCAKey{}).Count(&count)
+	if count != 1 {
+		t.Errorf("stored %d CA keys, want 1", count)
+	}
+}
+
+func TestCertValidity(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *configs.SSHCAConfig
+		want time.Duration
+	}{
+		{name: "not configured", cfg: nil, want: defaultCertValidity},
+		{name: "disabled", cfg: &configs.SSHCAConfig{ValidityMinutes: 30}, want: defaultCertValidity},
+		{name: "default", cfg: &configs.SSHCAConfig{Enabled: true}, want: defaultCertValidity},
+		{name: "configured", cfg: &configs.SSHCAConfig{Enabled: true, ValidityMinutes: 30}, want: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSSHCA(t, tt.cfg)
+			if got := CertValidity(); got != tt.want {
+				t.Errorf("CertValidity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCertSigner(t *testing.T) {
+	withSSHCA(t, &configs.SSHCAConfig{Enabled: true, ValidityMinutes: 10})
+	ca, err := CASigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewCertSigner("deploy", "alice/session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, ok := signer.PublicKey().(*gossh.Certificate)
+	if !ok {
+		t.Fatalf("signer public key is %T, want certificate", signer.PublicKey())
+	}
+
+	// 上游以 TrustedUserCAKeys 配置内置 CA 时接受该证书
+	checker := &gossh.CertChecker{
+		IsUserAuthority: func(auth gossh.PublicKey) bool {
+			return string(auth.Marshal()) == string(ca.PublicKey().Marshal())
+		},
+	}
+	if _, err := checker.Authenticate(connMeta("deploy"), cert); err != nil {
+		t.Errorf("upstream rejects certificate: %v", err)
+	}
+	if _, err := checker.Authenticate(connMeta("root"), cert); err == nil {
+		t.Error("certificate accepted for another principal")
+	}
+
+	now := time.Now()
+	validBefore := time.Unix(int64(cert.ValidBefore), 0)
+	if validBefore.Before(now.Add(9*time.Minute)) || validBefore.After(now.Add(11*time.Minute)) {
+		t.Errorf("ValidBefore = %v, want about 10 minutes from now", validBefore)
+	}
+	if time.Unix(int64(cert.ValidAfter), 0).After(now.Add(-certClockSkew + time.Second)) {
+		t.Errorf("ValidAfter = %d does not allow clock skew", cert.ValidAfter)
+	}
+	if cert.KeyId != "alice/session-1" || cert.CertType != gossh.UserCert {
+		t.Errorf("cert = %+v", cert)
+	}
+
+	// 每次签发使用新的临时密钥和序列号
+	again, err := NewCertSigner("deploy", "alice/session-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := again.PublicKey().(*gossh.Certificate)
+	if string(next.Key.Marshal()) == string(cert.Key.Marshal()) || next.Serial == cert.Serial {
+		t.Error("certificates share key or serial")
+	}
+}
+
+// connMeta 上游 sshd 看到的连接信息
+type connMeta string
+
+func (c connMeta) User() string          { return string(c) }
+func (c connMeta) SessionID() []byte     { return nil }
+func (c connMeta) ClientVersion() []byte { return nil }
+func (c connMeta) ServerVersion() []byte { return nil }
+func (c connMeta) RemoteAddr() net.Addr  { return nil }
+func (c connMeta) LocalAddr() net.Addr   { return nil }
@@ -0,0 +1,266 @@
+package usercert
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// OpenSSH KRL 格式（PROTOCOL.krl）
+const (
+	krlMagic         = "SSHKRL\n\x00"
+	krlFormatVersion = 1
+
+	krlSectionCertificates      = 1
+	krlSectionExplicitKey       = 2
+	krlSectionFingerprintSHA1   = 3
+	krlSectionSignature         = 4
+	krlSectionFingerprintSHA256 = 5
+
+	krlCertSerialList   = 0x20
+	krlCertSerialRange  = 0x21
+	krlCertSerialBitmap = 0x22
+	krlCertKeyID        = 0x23
+)
+
+// ErrInvalidKRL KRL 文件格式错误
+var ErrInvalidKRL = errors.New("invalid KRL")
+
+// KRL OpenSSH 密钥吊销列表
+type KRL struct {
+	Version uint64
+	// 按签发 CA 组织的证书吊销；键为 CA 公钥的 wire 格式，空字符串表示适用于任意 CA
+	certs  map[string]*krlCertRevocation
+	keys   map[string]struct{} // 吊销的公钥（wire 格式）
+	sha1   map[string]struct{} // 吊销的公钥 SHA1 指纹
+	sha256 map[string]struct{} // 吊销的公钥 SHA256 指纹
+}
+
+// krlCertRevocation 某个 CA 下吊销的证书序列号和 key id
+type krlCertRevocation struct {
+	serials []krlSerialRange
+	bitmaps []krlSerialBitmap
+	keyIDs  map[string]struct{}
+}
+
+type krlSerialRange struct {
+	lo, hi uint64
+}
+
+type krlSerialBitmap struct {
+	offset uint64
+	bits   *big.Int
+}
+
+// ParseKRL 解析二进制 KRL（ssh-keygen -k 生成）
+// 签名段不校验：KRL 文件由管理员放在本机，可信度等同于配置文件
+func ParseKRL(data []byte) (*KRL, error) {
+	if !bytes.HasPrefix(data, []byte(krlMagic)) {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidKRL)
+	}
+	r := &krlReader{buf: data[len(krlMagic):]}
+	if v := r.uint32(); v != krlFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidKRL, v)
+	}
+	k := &KRL{
+		certs:  make(map[string]*krlCertRevocation),
+		keys:   make(map[string]struct{}),
+		sha1:   make(map[string]struct{}),
+		sha256: make(map[string]struct{}),
+	}
+	k.Version = r.uint64()
+	r.uint64() // generated_date
+	r.uint64() // flags
+	r.string() // reserved
+	r.string() // comment
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	for len(r.buf) > 0 && r.err == nil {
+		sectionType := r.byte()
+		section := r.string()
+		if r.err != nil {
+			break
+		}
+		switch sectionType {
+		case krlSectionCertificates:
+			if err := k.parseCertSection(section); err != nil {
+				return nil, err
+			}
+		case krlSectionExplicitKey:
+			if err := collectStrings(section, k.keys); err != nil {
+				return nil, err
+			}
+		case krlSectionFingerprintSHA1:
+			if err := collectStrings(section, k.sha1); err != nil {
+				return nil, err
+			}
+		case krlSectionFingerprintSHA256:
+			if err := collectStrings(section, k.sha256); err != nil {
+				return nil, err
+			}
+		case krlSectionSignature:
+			// 签名段在文件末尾，之后不再有吊销数据
+			return k, nil
+		default:
+			return nil, fmt.Errorf("%w: unknown section type %d", ErrInvalidKRL, sectionType)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return k, nil
+}
+
+func (k *KRL) parseCertSection(section []byte) error {
+	r := &krlReader{buf: section}
+	caKey := string(r.string())
+	r.string() // reserved
+	rev, ok := k.certs[caKey]
+	if !ok {
+		rev = &krlCertRevocation{keyIDs: make(map[string]struct{})}
+		k.certs[caKey] = rev
+	}
+	for len(r.buf) > 0 && r.err == nil {
+		subType := r.byte()
+		sub := &krlReader{buf: r.string()}
+		if r.err != nil {
+			break
+		}
+		switch subType {
+		case krlCertSerialList:
+			for len(sub.buf) > 0 && sub.err == nil {
+				serial := sub.uint64()
+				rev.serials = append(rev.serials, krlSerialRange{lo: serial, hi: serial})
+			}
+		case krlCertSerialRange:
+			lo, hi := sub.uint64(), sub.uint64()
+			rev.serials = append(rev.serials, krlSerialRange{lo: lo, hi: hi})
+		case krlCertSerialBitmap:
+			offset := sub.uint64()
+			rev.bitmaps = append(rev.bitmaps, krlSerialBitmap{offset: offset, bits: new(big.Int).SetBytes(sub.string())})
+		case krlCertKeyID:
+			for len(sub.buf) > 0 && sub.err == nil {
+				rev.keyIDs[string(sub.string())] = struct{}{}
+			}
+		default:
+			return fmt.Errorf("%w: unknown certificate subsection type %d", ErrInvalidKRL, subType)
+		}
+		if sub.err != nil {
+			return sub.err
+		}
+	}
+	return r.err
+}
+
+// IsKeyRevoked 公钥是否被显式吊销（公钥本身或其指纹）
+func (k *KRL) IsKeyRevoked(key gossh.PublicKey) bool {
+	blob := key.Marshal()
+	if _, ok := k.keys[string(blob)]; ok {
+		return true
+	}
+	s1 := sha1.Sum(blob)
+	if _, ok := k.sha1[string(s1[:])]; ok {
+		return true
+	}
+	s256 := sha256.Sum256(blob)
+	_, ok := k.sha256[string(s256[:])]
+	return ok
+}
+
+// IsCertRevoked 证书是否被吊销：签发 CA、证书对应的公钥、序列号或 key id 任一命中即为吊销
+func (k *KRL) IsCertRevoked(cert *gossh.Certificate) bool {
+	if k.IsKeyRevoked(cert.SignatureKey) || k.IsKeyRevoked(cert.Key) {
+		return true
+	}
+	for _, caKey := range []string{string(cert.SignatureKey.Marshal()), ""} {
+		rev, ok := k.certs[caKey]
+		if !ok {
+			continue
+		}
+		if _, ok := rev.keyIDs[cert.KeyId]; ok {
+			return true
+		}
+		for _, rng := range rev.serials {
+			if cert.Serial >= rng.lo && cert.Serial <= rng.hi {
+				return true
+			}
+		}
+		for _, bm := range rev.bitmaps {
+			if cert.Serial >= bm.offset && cert.Serial-bm.offset < uint64(bm.bits.BitLen()) && bm.bits.Bit(int(cert.Serial-bm.offset)) == 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// collectStrings 读取连续的 string 字段放入集合
+func collectStrings(section []byte, set map[string]struct{}) error {
+	r := &krlReader{buf: section}
+	for len(r.buf) > 0 && r.err == nil {
+		set[string(r.string())] = struct{}{}
+	}
+	return r.err
+}
+
+// krlReader 按 SSH wire 格式顺序读取字段，出错后后续读取均返回零值
+type krlReader struct {
+	buf []byte
+	err error
+}
+
+func (r *krlReader) need(n int) bool {
+	if r.err != nil {
+		return false
+	}
+	if len(r.buf) < n {
+		r.err = fmt.Errorf("%w: truncated data", ErrInvalidKRL)
+		return false
+	}
+	return true
+}
+
+func (r *krlReader) byte() byte {
+	if !r.need(1) {
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *krlReader) uint32() uint32 {
+	if !r.need(4) {
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *krlReader) uint64() uint64 {
+	if !r.need(8) {
+		return 0
+	}
+	v := binary.BigEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *krlReader) string() []byte {
+	n := r.uint32()
+	if !r.need(int(n)) {
+		return nil
+	}
+	s := r.buf[:n]
+	r.buf = r.buf[n:]
+	return s
+}
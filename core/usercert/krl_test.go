@@ -0,0 +1,222 @@
+package usercert
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// krlString 按 SSH wire 格式编码 string 字段
+func krlString(b []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(b)))
+	return append(out, b...)
+}
+
+// krlSection 编码一个带类型的段或子段
+func krlSection(sectionType byte, body ...[]byte) []byte {
+	var data []byte
+	for _, b := range body {
+		data = append(data, b...)
+	}
+	return append([]byte{sectionType}, krlString(data)...)
+}
+
+// buildKRL 生成 KRL 文件内容
+func buildKRL(sections ...[]byte) []byte {
+	data := []byte(krlMagic)
+	data = binary.BigEndian.AppendUint32(data, krlFormatVersion)
+	data = binary.BigEndian.AppendUint64(data, 7) // krl_version
+	data = binary.BigEndian.AppendUint64(data, 0) // generated_date
+	data = binary.BigEndian.AppendUint64(data, 0) // flags
+	data = append(data, krlString(nil)...)        // reserved
+	data = append(data, krlString([]byte("test"))...)
+	for _, s := range sections {
+		data = append(data, s...)
+	}
+	return data
+}
+
+// krlCerts 证书吊销段，caKey 为 nil 时适用于任意 CA
+func krlCerts(caKey gossh.PublicKey, subs ...[]byte) []byte {
+	var blob []byte
+	if caKey != nil {
+		blob = caKey.Marshal()
+	}
+	body := append(krlString(blob), krlString(nil)...)
+	for _, s := range subs {
+		body = append(body, s...)
+	}
+	return krlSection(krlSectionCertificates, body)
+}
+
+func u64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+func newSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// issueCert 用 ca 签发用户证书，mutate 可在签名前修改证书
+func issueCert(t *testing.T, ca gossh.Signer, mutate func(*gossh.Certificate)) *gossh.Certificate {
+	t.Helper()
+	cert := &gossh.Certificate{
+		Key:             newSigner(t).PublicKey(),
+		Serial:          42,
+		CertType:        gossh.UserCert,
+		KeyId:           "alice@laptop",
+		ValidPrincipals: []string{"alice"},
+		ValidBefore:     gossh.CertTimeInfinity,
+	}
+	if mutate != nil {
+		mutate(cert)
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestParseKRLErrors(t *testing.T) {
+	valid := buildKRL()
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "bad magic", data: []byte("NOTAKRL\x00\x00\x00\x00\x01")},
+		{name: "unsupported version", data: append([]byte(krlMagic), 0, 0, 0, 2)},
+		{name: "truncated header", data: valid[:len(krlMagic)+10]},
+		{name: "unknown section", data: buildKRL(krlSection(9, nil))},
+		{name: "truncated section", data: buildKRL(krlSection(krlSectionExplicitKey, nil))[:len(valid)+3]},
+		{name: "unknown certificate subsection", data: buildKRL(krlCerts(nil, krlSection(0x30, nil)))},
+		{name: "truncated serial range", data: buildKRL(krlCerts(nil, krlSection(krlCertSerialRange, u64(1))))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseKRL(tt.data); !errors.Is(err, ErrInvalidKRL) {
+				t.Errorf("ParseKRL() err = %v, want ErrInvalidKRL", err)
+			}
+		})
+	}
+
+	krl, err := ParseKRL(valid)
+	if err != nil {
+		t.Fatalf("ParseKRL(empty) err = %v", err)
+	}
+	if krl.Version != 7 {
+		t.Errorf("Version = %d, want 7", krl.Version)
+	}
+}
+
+func TestKRLIsCertRevoked(t *testing.T) {
+	ca := newSigner(t)
+	otherCA := newSigner(t)
+	cert := issueCert(t, ca, nil) // serial 42, key id alice@laptop
+	keyBlob := cert.Key.Marshal()
+	s1 := sha1.Sum(keyBlob)
+	s256 := sha256.Sum256(keyBlob)
+
+	tests := []struct {
+		name     string
+		sections [][]byte
+		want     bool
+	}{
+		{name: "empty", want: false},
+		{name: "serial list", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertSerialList, u64(1), u64(42)))}, want: true},
+		{name: "serial list miss", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertSerialList, u64(41), u64(43)))}, want: false},
+		{name: "serial range", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertSerialRange, u64(40), u64(50)))}, want: true},
+		{name: "serial range miss", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertSerialRange, u64(43), u64(50)))}, want: false},
+		// 位图从 offset 40 开始，第 2 位对应序列号 42
+		{name: "serial bitmap", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertSerialBitmap, u64(40), krlString([]byte{0x04})))}, want: true},
+		{name: "serial bitmap miss", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertSerialBitmap, u64(40), krlString([]byte{0x0b})))}, want: false},
+		{name: "key id", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertKeyID, krlString([]byte("alice@laptop"))))}, want: true},
+		{name: "key id miss", sections: [][]byte{krlCerts(ca.PublicKey(), krlSection(krlCertKeyID, krlString([]byte("bob@laptop"))))}, want: false},
+		{name: "serial under another CA", sections: [][]byte{krlCerts(otherCA.PublicKey(), krlSection(krlCertSerialList, u64(42)))}, want: false},
+		{name: "serial under any CA", sections: [][]byte{krlCerts(nil, krlSection(krlCertSerialList, u64(42)))}, want: true},
+		{name: "explicit key", sections: [][]byte{krlSection(krlSectionExplicitKey, krlString(keyBlob))}, want: true},
+		{name: "sha1 fingerprint", sections: [][]byte{krlSection(krlSectionFingerprintSHA1, krlString(s1[:]))}, want: true},
+		{name: "sha256 fingerprint", sections: [][]byte{krlSection(krlSectionFingerprintSHA256, krlString(s256[:]))}, want: true},
+		{name: "revoked CA key", sections: [][]byte{krlSection(krlSectionExplicitKey, krlString(ca.PublicKey().Marshal()))}, want: true},
+		// 签名段之后的数据不再解析
+		{name: "after signature", sections: [][]byte{krlSection(krlSectionSignature, nil), krlSection(krlSectionExplicitKey, krlString(keyBlob))}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			krl, err := ParseKRL(buildKRL(tt.sections...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := krl.IsCertRevoked(cert); got != tt.want {
+				t.Errorf("IsCertRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseKRLFromSSHKeygen 解析 ssh-keygen -k 生成的 KRL
+func TestParseKRLFromSSHKeygen(t *testing.T) {
+	keygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen not available")
+	}
+	ca := newSigner(t)
+	dir := t.TempDir()
+	caPub := filepath.Join(dir, "ca.pub")
+	spec := filepath.Join(dir, "spec")
+	krlPath := filepath.Join(dir, "krl")
+	if err := os.WriteFile(caPub, gossh.MarshalAuthorizedKey(ca.PublicKey()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(spec, []byte("serial: 42\nserial: 100-200\nid: lost@laptop\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(keygen, "-k", "-f", krlPath, "-s", caPub, spec).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	data, err := os.ReadFile(krlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	krl, err := ParseKRL(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		serial uint64
+		keyID  string
+		want   bool
+	}{
+		{name: "serial", serial: 42, keyID: "alice@laptop", want: true},
+		{name: "serial range", serial: 150, keyID: "alice@laptop", want: true},
+		{name: "key id", serial: 7, keyID: "lost@laptop", want: true},
+		{name: "not revoked", serial: 7, keyID: "alice@laptop", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := issueCert(t, ca, func(c *gossh.Certificate) { c.Serial, c.KeyId = tt.serial, tt.keyID })
+			if got := krl.IsCertRevoked(cert); got != tt.want {
+				t.Errorf("IsCertRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
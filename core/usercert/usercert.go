@@ -0,0 +1,198 @@
+package usercert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrNotUserCert 不是用户证书（例如主机证书）
+	ErrNotUserCert = errors.New("not a user certificate")
+	// ErrUntrustedCA 证书不是由受信任的 CA 签发
+	ErrUntrustedCA = errors.New("certificate is not signed by a trusted CA")
+	// ErrRevoked 证书被 KRL 吊销
+	ErrRevoked = errors.New("certificate has been revoked")
+	// ErrNoPrincipal 证书中没有映射到登录用户的 principal
+	ErrNoPrincipal = errors.New("no certificate principal maps to this user")
+	// ErrSourceAddress 来源地址不在证书 source-address 限制内
+	ErrSourceAddress = errors.New("source address not allowed by certificate")
+)
+
+const sourceAddressOption = "source-address"
+
+// krlCache 按文件修改时间缓存 KRL，文件变化后重新加载
+var krlCache struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	krl     *KRL
+}
+
+// Enabled 是否配置了受信任的用户证书 CA
+func Enabled() bool {
+	cfg := config()
+	return cfg != nil && (len(cfg.TrustedKeys) > 0 || cfg.TrustedKeysFile != "")
+}
+
+// Authenticate 校验 OpenSSH 用户证书
+// 输入: cert - 客户端提供的证书；username - 登录的 ROMA 用户名；clientIP - 客户端 IP
+// 输出: string - 匹配到的 principal；error - 校验失败原因
+// 必要性: 公司 CA 签发的短期证书可以直接登录，无需为每个用户上传公钥
+func Authenticate(cert *gossh.Certificate, username, clientIP string) (string, error) {
+	cfg := config()
+	if cfg == nil {
+		return "", ErrUntrustedCA
+	}
+	if cert.CertType != gossh.UserCert {
+		return "", ErrNotUserCert
+	}
+
+	authorities, err := trustedKeys(cfg)
+	if err != nil {
+		return "", err
+	}
+	if !containsKey(authorities, cert.SignatureKey) {
+		return "", ErrUntrustedCA
+	}
+
+	var krl *KRL
+	if cfg.KRLFile != "" {
+		// KRL 无法加载时拒绝所有证书，避免吊销失效
+		if krl, err = loadKRL(cfg.KRLFile); err != nil {
+			return "", err
+		}
+	}
+
+	principal, ok := matchPrincipal(cert, username, cfg.Principals)
+	if !ok {
+		return "", ErrNoPrincipal
+	}
+
+	checker := &gossh.CertChecker{
+		IsRevoked: func(c *gossh.Certificate) bool {
+			return krl != nil && krl.IsCertRevoked(c)
+		},
+	}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		if krl != nil && krl.IsCertRevoked(cert) {
+			return "", ErrRevoked
+		}
+		return "", err
+	}
+
+	if allowed, ok := cert.CriticalOptions[sourceAddressOption]; ok && !sourceAddressAllowed(allowed, clientIP) {
+		return "", fmt.Errorf("%w: %s", ErrSourceAddress, clientIP)
+	}
+	return principal, nil
+}
+
+func config() *configs.UserCAConfig {
+	if global.CONFIG == nil || global.CONFIG.Security == nil {
+		return nil
+	}
+	return global.CONFIG.Security.UserCA
+}
+
+// matchPrincipal 查找映射到 username 的 principal，没有 principal 的证书不接受
+func matchPrincipal(cert *gossh.Certificate, username string, mapping map[string]string) (string, bool) {
+	for _, p := range cert.ValidPrincipals {
+		mapped := p
+		if m, ok := mapping[strings.ToLower(p)]; ok && m != "" {
+			mapped = m
+		}
+		if mapped == username {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// trustedKeys 读取配置和文件中的 CA 公钥
+func trustedKeys(cfg *configs.UserCAConfig) ([]gossh.PublicKey, error) {
+	lines := append([]string{}, cfg.TrustedKeys...)
+	if cfg.TrustedKeysFile != "" {
+		data, err := os.ReadFile(cfg.TrustedKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted CA keys: %v", err)
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+
+	keys := make([]gossh.PublicKey, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted CA key %q: %v", line[:min(len(line), 40)], err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func containsKey(keys []gossh.PublicKey, key gossh.PublicKey) bool {
+	blob := key.Marshal()
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), blob) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadKRL 加载 KRL，文件未变化时使用缓存
+func loadKRL(path string) (*KRL, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KRL: %v", err)
+	}
+
+	krlCache.Lock()
+	defer krlCache.Unlock()
+	if krlCache.krl != nil && krlCache.path == path && krlCache.modTime.Equal(info.ModTime()) && krlCache.size == info.Size() {
+		return krlCache.krl, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KRL: %v", err)
+	}
+	krl, err := ParseKRL(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KRL: %v", err)
+	}
+	krlCache.path, krlCache.modTime, krlCache.size, krlCache.krl = path, info.ModTime(), info.Size(), krl
+	return krl, nil
+}
+
+// sourceAddressAllowed 检查 IP 是否在 source-address（逗号分隔的地址或 CIDR）内
+func sourceAddressAllowed(allowed, clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range strings.Split(allowed, ",") {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if addr := net.ParseIP(entry); addr != nil && addr.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package usercert
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"binrc.com/roma/configs"
+	"binrc.com/roma/core/global"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// withUserCA 在测试期间使用指定的用户证书 CA 配置
+func withUserCA(t *testing.T, cfg *configs.UserCAConfig) {
+	t.Helper()
+	saved := global.CONFIG
+	t.Cleanup(func() { global.CONFIG = saved })
+	global.CONFIG = &configs.Config{Security: &configs.SecurityConfig{UserCA: cfg}}
+}
+
+func authorizedKey(key gossh.PublicKey) string {
+	return strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key)))
+}
+
+func TestAuthenticate(t *testing.T) {
+	ca := newSigner(t)
+	otherCA := newSigner(t)
+	dir := t.TempDir()
+
+	caFile := filepath.Join(dir, "trusted_ca")
+	if err := os.WriteFile(caFile, []byte("# company CA\n"+authorizedKey(ca.PublicKey())+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	krlFile := filepath.Join(dir, "krl")
+	if err := os.WriteFile(krlFile, buildKRL(krlCerts(ca.PublicKey(), krlSection(krlCertSerialList, u64(13)))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		cfg      *configs.UserCAConfig
+		signer   gossh.Signer
+		mutate   func(*gossh.Certificate)
+		username string
+		clientIP string
+		want     string
+		wantErr  error // nil 且 wantFail 为 false 时期望成功
+		wantFail bool  // 期望失败但不检查具体错误
+	}{
+		{name: "trusted", cfg: &configs.UserCAConfig{TrustedKeys: []string{authorizedKey(ca.PublicKey())}}, username: "alice", want: "alice"},
+		{name: "trusted keys file", cfg: &configs.UserCAConfig{TrustedKeysFile: caFile}, username: "alice", want: "alice"},
+		{name: "not configured", cfg: nil, username: "alice", wantErr: ErrUntrustedCA},
+		{name: "untrusted CA", cfg: &configs.UserCAConfig{TrustedKeys: []string{authorizedKey(ca.PublicKey())}}, signer: otherCA, username: "alice", wantErr: ErrUntrustedCA},
+		{name: "host certificate", cfg: &configs.UserCAConfig{TrustedKeysFile: caFile}, mutate: func(c *gossh.Certificate) { c.CertType = gossh.HostCert }, username: "alice", wantErr: ErrNotUserCert},
+		{name: "principal does not match", cfg: &configs.UserCAConfig{TrustedKeysFile: caFile}, username: "bob", wantErr: ErrNoPrincipal},
+		{name: "no principals", cfg: &configs.UserCAConfig{TrustedKeysFile: caFile}, mutate: func(c *gossh.Certificate) { c.ValidPrincipals = nil }, username: "alice", wantErr: ErrNoPrincipal},
+		{
+			name:     "principal mapping",
+			cfg:      &configs.UserCAConfig{TrustedKeysFile: caFile, Principals: map[string]string{"a.smith": "alice"}},
+			mutate:   func(c *gossh.Certificate) { c.ValidPrincipals = []string{"A.Smith"} },
+			username: "alice",
+			want:     "A.Smith",
+		},
+		{
+			name:     "mapped principal does not log in as itself",
+			cfg:      &configs.UserCAConfig{TrustedKeysFile: caFile, Principals: map[string]string{"alice": "bob"}},
+			username: "alice",
+			wantErr:  ErrNoPrincipal,
+		},
+		{
+			name:     "expired",
+			cfg:      &configs.UserCAConfig{TrustedKeysFile: caFile},
+			mutate:   func(c *gossh.Certificate) { c.ValidBefore = uint64(now.Add(-time.Minute).Unix()) },
+			username: "alice",
+			wantFail: true,
+		},
+		{
+			name:     "not yet valid",
+			cfg:      &configs.UserCAConfig{TrustedKeysFile: caFile},
+			mutate:   func(c *gossh.Certificate) { c.ValidAfter = uint64(now.Add(time.Hour).Unix()) },
+			username: "alice",
+			wantFail: true,
+		},
+		{name: "not revoked", cfg: &configs.UserCAConfig{TrustedKeysFile: caFile, KRLFile: krlFile}, username: "alice", want: "alice"},
+		{
+			name:     "revoked",
+			cfg:      &configs.UserCAConfig{TrustedKeysFile: caFile, KRLFile: krlFile},
+			mutate:   func(c *gossh.Certificate) { c.Serial = 13 },
+			username: "alice",
+			wantErr:  ErrRevoked,
+		},
+		// KRL 无法加载时拒绝所有证书
+		{name: "missing KRL", cfg: &configs.UserCAConfig{TrustedKeysFile: caFile, KRLFile: filepath.Join(dir, "missing")}, username: "alice", wantFail: true},
+		{name: "invalid trusted key", cfg: &configs.UserCAConfig{TrustedKeys: []string{"ssh-ed25519 not-base64"}}, username: "alice", wantFail: true},
+		{
+			name:     "source address allowed",
+			cfg:      &configs.UserCAConfig{TrustedKeysFile: caFile},
+			mutate:   func(c *gossh.Certificate) { c.CriticalOptions = map[string]string{sourceAddressOption: "10.0.0.0/8"} },
+			username: "alice",
+			clientIP: "10.1.2.3",
+			want:     "alice",
+		},
+		{
+			name:     "source address denied",
+			cfg:      &configs.UserCAConfig{TrustedKeysFile: caFile},
+			mutate:   func(c *gossh.Certificate) { c.CriticalOptions = map[string]string{sourceAddressOption: "10.0.0.0/8"} },
+			username: "alice",
+			clientIP: "192.168.1.1",
+			wantErr:  ErrSourceAddress,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withUserCA(t, tt.cfg)
+			signer := tt.signer
+			if signer == nil {
+				signer = ca
+			}
+			cert := issueCert(t, signer, tt.mutate)
+			got, err := Authenticate(cert, tt.username, tt.clientIP)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Authenticate() err = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantFail:
+				if err == nil {
+					t.Errorf("Authenticate() = %q, want error", got)
+				}
+			default:
+				if err != nil || got != tt.want {
+					t.Errorf("Authenticate() = %q, %v, want %q", got, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadKRLReload KRL 文件变化后重新加载
+func TestLoadKRLReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "krl")
+	ca := newSigner(t)
+	cert := issueCert(t, ca, nil)
+
+	if err := os.WriteFile(path, buildKRL(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	krl, err := loadKRL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if krl.IsCertRevoked(cert) {
+		t.Fatal("certificate revoked by empty KRL")
+	}
+	if cached, _ := loadKRL(path); cached != krl {
+		t.Error("unchanged KRL was reloaded")
+	}
+
+	if err := os.WriteFile(path, buildKRL(krlCerts(nil, krlSection(krlCertSerialList, u64(cert.Serial)))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// 确保修改时间变化
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	krl, err = loadKRL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !krl.IsCertRevoked(cert) {
+		t.Error("updated KRL was not reloaded")
+	}
+}
+
+func TestSourceAddressAllowed(t *testing.T) {
+	tests := []struct {
+		allowed  string
+		clientIP string
+		want     bool
+	}{
+		{allowed: "10.0.0.0/8", clientIP: "10.1.2.3", want: true},
+		{allowed: "10.0.0.0/8", clientIP: "11.0.0.1", want: false},
+		{allowed: "192.168.1.5", clientIP: "192.168.1.5", want: true},
+		{allowed: "192.168.1.5, 10.0.0.0/8", clientIP: "10.9.9.9", want: true},
+		{allowed: "2001:db8::/32", clientIP: "2001:db8::1", want: true},
+		{allowed: "10.0.0.0/8", clientIP: "", want: false},
+		{allowed: "not-an-address", clientIP: "10.0.0.1", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.allowed+"/"+tt.clientIP, func(t *testing.T) {
+			if got := sourceAddressAllowed(tt.allowed, tt.clientIP); got != tt.want {
+				t.Errorf("sourceAddressAllowed(%q, %q) = %v, want %v", tt.allowed, tt.clientIP, got, tt.want)
+			}
+		})
+	}
+}
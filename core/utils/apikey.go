@@ -1,16 +1,21 @@
 package utils
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"math/big"
 )
 
+// GenerateKey 生成 57 位随机密钥，使用 crypto/rand，密钥不可预测
 func GenerateKey() string {
-	random := rand.New(rand.NewSource(time.Now().UnixNano()))
 	const charset = "abcdefhiklmnorstuvwxzABCDEFGHIJKLMNOPRSTUVWXYZ0123456789" //平滑字符
+	max := big.NewInt(int64(len(charset)))
 	key := make([]byte, 57)
 	for i := range key {
-		key[i] = charset[random.Intn(len(charset))]
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		key[i] = charset[n.Int64()]
 	}
 	return string(key)
 }
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"os"
 	"time"
@@ -30,7 +32,7 @@ func getJWTSecret() []byte {
 	return []byte(secret)
 }
 
-// getJWTExpireHours 获取 JWT 过期时间（小时）
+// getJWTExpireHours 获取登录会话（刷新令牌）过期时间（小时）
 func getJWTExpireHours() int {
 	if global.CONFIG != nil && global.CONFIG.Security != nil && global.CONFIG.Security.JWT != nil && global.CONFIG.Security.JWT.ExpireHours > 0 {
 		return global.CONFIG.Security.JWT.ExpireHours
@@ -39,20 +41,40 @@ func getJWTExpireHours() int {
 	return 24
 }
 
+// SessionTTL 登录会话（刷新令牌）的有效期
+func SessionTTL() time.Duration {
+	return time.Duration(getJWTExpireHours()) * time.Hour
+}
+
+// AccessTokenTTL 访问令牌的有效期，默认 15 分钟，过期后用刷新令牌换取新的访问令牌
+func AccessTokenTTL() time.Duration {
+	if global.CONFIG != nil && global.CONFIG.Security != nil && global.CONFIG.Security.JWT != nil && global.CONFIG.Security.JWT.AccessExpireMinutes > 0 {
+		return time.Duration(global.CONFIG.Security.JWT.AccessExpireMinutes) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// mfaPendingPurpose 密码已验证、等待 TOTP 验证码的临时令牌
+const mfaPendingPurpose = "mfa_pending"
+
+// mfaPendingTTL 临时令牌有效期
+const mfaPendingTTL = 5 * time.Minute
+
 type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
+	Purpose  string `json:"purpose,omitempty"` // 为空表示正常登录令牌
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT 生成 JWT token
-func GenerateJWT(userID uint, username string) (string, error) {
-	expireHours := getJWTExpireHours()
+// GenerateJWT 生成访问令牌，jti 为登录会话 ID，会话吊销后令牌立即失效
+func GenerateJWT(userID uint, username, sessionID string) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expireHours) * time.Hour)),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -62,8 +84,54 @@ func GenerateJWT(userID uint, username string) (string, error) {
 	return token.SignedString(getJWTSecret())
 }
 
-// ParseJWT 解析 JWT token
+// ParseJWT 解析 JWT token（只接受正常登录令牌）
 func ParseJWT(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// GenerateMFAPendingToken 密码验证通过后生成等待 TOTP 的临时令牌，不能用于访问接口
+// jti 为随机 ID，用于统计每个令牌的验证码错误次数，并在登录成功后作废令牌
+func GenerateMFAPendingToken(userID uint, username string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	claims := Claims{
+		UserID:   userID,
+		Username: username,
+		Purpose:  mfaPendingPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(buf),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(mfaPendingTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(getJWTSecret())
+}
+
+// ParseMFAPendingToken 解析等待 TOTP 的临时令牌
+func ParseMFAPendingToken(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != mfaPendingPurpose || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func parseClaims(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
@@ -16,3 +16,11 @@ func init() {
 	stdoutHandler := logging.NewBackendFormatter(logging.NewLogBackend(os.Stdout, "", 0), format)
 	logging.SetBackend(stdoutHandler)
 }
+
+// UseStderr 日志改为输出到标准错误（stdio 模式下标准输出只能用于协议数据）
+func UseStderr() {
+	format := logging.MustStringFormatter(
+		`%{time:15:04:05.000} %{shortfunc} ▶ %{level:.4s} %{id:03x} %{message}`,
+	)
+	logging.SetBackend(logging.NewBackendFormatter(logging.NewLogBackend(os.Stderr, "", 0), format))
+}